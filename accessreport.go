@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// granted cluster-wide, rather than in a single namespace
+const allNamespaces string = "*"
+
+const groupAccessReport string = "reports/group-access"
+
+func accessLevel(ref rbacv1.RoleRef) string {
+	// the default user-facing cluster roles are what access reviews are phrased in, anything else is custom
+	if ref.Kind == "ClusterRole" {
+		switch ref.Name {
+		case "view", "edit", "admin", "cluster-admin":
+			return ref.Name
+		}
+	}
+	return "custom"
+}
+
+// group -> namespace -> levels, with "*" as the namespace for cluster-wide grants
+type accessMatrix map[string]map[string]map[string]bool
+
+func (m accessMatrix) add(group, namespace, level string) {
+	if m[group] == nil {
+		m[group] = map[string]map[string]bool{}
+	}
+	if m[group][namespace] == nil {
+		m[group][namespace] = map[string]bool{}
+	}
+	m[group][namespace][level] = true
+}
+
+func groupAccess(bindings []rbacv1.RoleBinding, clusterBindings []rbacv1.ClusterRoleBinding, lookFor string) accessMatrix {
+	m := accessMatrix{}
+	for _, b := range bindings {
+		for _, s := range b.Subjects {
+			if s.Kind == rbacv1.GroupKind && isUserDefined(s.Name, lookFor) {
+				m.add(s.Name, b.ObjectMeta.Namespace, accessLevel(b.RoleRef))
+			}
+		}
+	}
+	for _, b := range clusterBindings {
+		for _, s := range b.Subjects {
+			if s.Kind == rbacv1.GroupKind && isUserDefined(s.Name, lookFor) {
+				m.add(s.Name, allNamespaces, accessLevel(b.RoleRef))
+			}
+		}
+	}
+	return m
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeGroupAccessReport(bindings []rbacv1.RoleBinding, clusterBindings []rbacv1.ClusterRoleBinding, lookFor string) error {
+	/*
+		one row per group, one column per namespace, each cell listing the access levels the group has there - the json
+		form carries the same data for anything that wants to process it rather than open it in a spreadsheet
+	*/
+	m := groupAccess(bindings, clusterBindings, lookFor)
+
+	groupSet := map[string]bool{}
+	namespaceSet := map[string]bool{}
+	asJSON := map[string]map[string][]string{}
+	for group, namespaces := range m {
+		groupSet[group] = true
+		asJSON[group] = map[string][]string{}
+		for ns, levels := range namespaces {
+			namespaceSet[ns] = true
+			asJSON[group][ns] = sortedKeys(levels)
+		}
+	}
+	groups := sortedKeys(groupSet)
+	namespaces := sortedKeys(namespaceSet)
+
+	buffer := bytes.Buffer{}
+	w := csv.NewWriter(&buffer)
+	w.Write(append([]string{"group"}, namespaces...))
+	for _, group := range groups {
+		row := []string{group}
+		for _, ns := range namespaces {
+			row = append(row, strings.Join(sortedKeys(m[group][ns]), " "))
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if err := writeRootFile(groupAccessReport+".csv", buffer.Bytes()); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(asJSON, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeRootFile(groupAccessReport+".json", b)
+}
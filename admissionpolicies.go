@@ -0,0 +1,31 @@
+package main
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+/*
+	cel admission policies and their bindings are cluster configuration written by people, like the rbac we export.
+	they are newer than the client we are built with, so they go through the dynamic client, in whichever version
+	the cluster prefers - v1alpha1, v1beta1 or v1 - and a cluster which doesn't serve them simply has none
+*/
+
+var admissionPolicyResources = map[string]bool{
+	"validatingadmissionpolicies":       true,
+	"validatingadmissionpolicybindings": true,
+	"mutatingadmissionpolicies":         true,
+	"mutatingadmissionpolicybindings":   true,
+}
+
+func exportAdmissionPolicies(disc discovery.DiscoveryInterface, dyn dynamic.Interface) error {
+	gvrs, err := servedResources(disc, func(gv schema.GroupVersion, r metav1.APIResource) bool {
+		return gv.Group == "admissionregistration.k8s.io" && admissionPolicyResources[r.Name]
+	})
+	if err != nil {
+		return err
+	}
+	return exportResources("admission policies", gvrs, dyn)
+}
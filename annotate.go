@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+/*
+	with -annotate-namespaces, every namespace the scan exported something from is annotated with when it was last
+	scanned and what was found in it, so that freshness can be seen with kubectl rather than from the output store.
+	this is the one place the scanner writes to the cluster, so it's opt-in and needs patch on namespaces - a
+	namespace that can't be annotated is logged and skipped, it doesn't fail the scan that already completed
+*/
+
+const (
+	lastScanAnnotation        string = "kube-scanner.io/last-scan"
+	lastScanSummaryAnnotation string = "kube-scanner.io/last-scan-summary"
+)
+
+type namespaceSummary struct {
+	Objects  int            `json:"objects"`
+	Findings map[string]int `json:"findings"`
+}
+
+func namespaceSummaries() map[string]*namespaceSummary {
+	summaries := map[string]*namespaceSummary{}
+	get := func(namespace string) *namespaceSummary {
+		s, ok := summaries[namespace]
+		if !ok {
+			s = &namespaceSummary{Findings: map[string]int{severityHigh: 0, severityMedium: 0, severityLow: 0}}
+			summaries[namespace] = s
+		}
+		return s
+	}
+	if scanNamespace != "" {
+		get(scanNamespace)
+	}
+	exportedMu.Lock()
+	for _, o := range exported {
+		if o.Namespace != "" {
+			get(o.Namespace).Objects++
+		}
+	}
+	exportedMu.Unlock()
+
+	findingsMu.Lock()
+	for _, f := range findings {
+		// findings are only counted for namespaces which were exported, a namespace named by a finding alone may be gone
+		if s, ok := summaries[f.Namespace]; ok {
+			s.Findings[f.Severity]++
+		}
+	}
+	findingsMu.Unlock()
+	return summaries
+}
+
+func annotateNamespaces(clientset *kubernetes.Clientset, startedAt time.Time) {
+	annotated := 0
+	summaries := namespaceSummaries()
+	for _, namespace := range sortedSummaryKeys(summaries) {
+		b, err := json.Marshal(summaries[namespace])
+		if err != nil {
+			log.Printf("annotate %s: %v", namespace, err)
+			continue
+		}
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]string{
+					lastScanAnnotation:        startedAt.UTC().Format(time.RFC3339),
+					lastScanSummaryAnnotation: string(b),
+				},
+			},
+		})
+		if err != nil {
+			log.Printf("annotate %s: %v", namespace, err)
+			continue
+		}
+		_, err = clientset.CoreV1().Namespaces().Patch(context.TODO(), namespace, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: siemProduct})
+		if err != nil {
+			log.Printf("annotate %s: %v", namespace, err)
+			continue
+		}
+		annotated++
+	}
+	log.Printf("annotated %d namespaces with %s", annotated, lastScanAnnotation)
+}
+
+func sortedSummaryKeys(summaries map[string]*namespaceSummary) []string {
+	keys := map[string]bool{}
+	for k := range summaries {
+		keys[k] = true
+	}
+	return sortedKeys(keys)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+	every request a scan makes to the api server is counted, by resource, and with -max-api-calls a scan that needs
+	more than that many stops rather than keep going - a misconfigured scan, say one role lookup per binding on a
+	cluster with a hundred thousand bindings, can't hammer a shared production api server. only calls made while
+	a scan runs count, and never the leases of leader election, a scan going over its budget must not cost the
+	replica its leadership
+*/
+
+var (
+	maxAPICalls  int
+	apiCalls     = map[string]int{}
+	apiCallTotal int
+	apiCallsOn   bool
+	apiCallsMu   sync.Mutex
+)
+
+type budgetTransport struct {
+	next http.RoundTripper
+}
+
+func wrapAPIBudget(rt http.RoundTripper) http.RoundTripper {
+	return &budgetTransport{next: rt}
+}
+
+func startAPICalls() {
+	apiCallsMu.Lock()
+	defer apiCallsMu.Unlock()
+	apiCalls, apiCallTotal, apiCallsOn = map[string]int{}, 0, true
+}
+
+func stopAPICalls() {
+	apiCallsMu.Lock()
+	defer apiCallsMu.Unlock()
+	apiCallsOn = false
+}
+
+func apiResource(urlPath string) string {
+	// /api/v1/namespaces/ns/pods/name or /apis/group/version/namespaces/ns/pods/name, anything shorter is discovery
+	parts := strings.Split(strings.Trim(urlPath, "/"), "/")
+	switch {
+	case len(parts) >= 3 && parts[0] == "api":
+		parts = parts[2:]
+	case len(parts) >= 4 && parts[0] == "apis":
+		parts = parts[3:]
+	default:
+		return "discovery"
+	}
+	if len(parts) >= 3 && parts[0] == "namespaces" {
+		parts = parts[2:]
+	}
+	return parts[0]
+}
+
+func (t *budgetTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if strings.HasPrefix(r.URL.Path, "/apis/coordination.k8s.io/") {
+		return t.next.RoundTrip(r)
+	}
+	apiCallsMu.Lock()
+	if apiCallsOn {
+		apiCallTotal++
+		apiCalls[apiResource(r.URL.Path)]++
+	}
+	over := apiCallsOn && maxAPICalls > 0 && apiCallTotal > maxAPICalls
+	apiCallsMu.Unlock()
+	if over {
+		return nil, apiBudgetExceeded()
+	}
+	return t.next.RoundTrip(r)
+}
+
+func apiBudgetExceeded() error {
+	apiCallsMu.Lock()
+	over := maxAPICalls > 0 && apiCallTotal > maxAPICalls
+	apiCallsMu.Unlock()
+	if !over {
+		return nil
+	}
+	return fmt.Errorf("stopped: the scan needs more than -max-api-calls %d, most went to %s", maxAPICalls, apiCallSummary(3))
+}
+
+// the resources most calls went to, busiest first
+func apiCallSummary(top int) string {
+	apiCallsMu.Lock()
+	defer apiCallsMu.Unlock()
+	resources := []string{}
+	for r := range apiCalls {
+		resources = append(resources, r)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		if apiCalls[resources[i]] != apiCalls[resources[j]] {
+			return apiCalls[resources[i]] > apiCalls[resources[j]]
+		}
+		return resources[i] < resources[j]
+	})
+	if top > 0 && len(resources) > top {
+		resources = resources[:top]
+	}
+	parts := []string{}
+	for _, r := range resources {
+		parts = append(parts, fmt.Sprintf("%s %d", r, apiCalls[r]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func apiCallsTo(resource string) int {
+	apiCallsMu.Lock()
+	defer apiCallsMu.Unlock()
+	return apiCalls[resource]
+}
+
+func logAPICalls() {
+	apiCallsMu.Lock()
+	total := apiCallTotal
+	apiCallsMu.Unlock()
+	if maxAPICalls > 0 {
+		log.Printf("%d of %d api calls used: %s", total, maxAPICalls, apiCallSummary(0))
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/nicgrobler/k8s/result"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*
+	managedFields are stripped from every export, but before they are, the newest entry says who last wrote the
+	object and when - a field manager such as kubectl-client-side-apply, helm or argocd-controller. that is kept
+	alongside the object in result.json, which is change attribution of a sort without needing the audit log
+*/
+
+var (
+	modifications   = map[string]*result.Modification{}
+	modificationsMu sync.Mutex
+)
+
+func resetModifications() {
+	modificationsMu.Lock()
+	defer modificationsMu.Unlock()
+	modifications = map[string]*result.Modification{}
+}
+
+func lastModification(entries []metav1.ManagedFieldsEntry) *result.Modification {
+	// entries without a time can't be ordered, and the api server always sets one
+	var last *metav1.ManagedFieldsEntry
+	for i := range entries {
+		e := &entries[i]
+		if e.Time != nil && (last == nil || e.Time.After(last.Time.Time)) {
+			last = e
+		}
+	}
+	if last == nil {
+		return nil
+	}
+	return &result.Modification{Manager: last.Manager, Operation: string(last.Operation), Time: last.Time.UTC()}
+}
+
+// called by extract, the last place the managedFields of an object are still there
+func rememberModification(kind string, meta metav1.Object) {
+	m := lastModification(meta.GetManagedFields())
+	if m == nil {
+		return
+	}
+	modificationsMu.Lock()
+	defer modificationsMu.Unlock()
+	modifications[kind+"/"+meta.GetNamespace()+"/"+meta.GetName()] = m
+}
+
+func modificationOf(kind, namespace, name string) *result.Modification {
+	modificationsMu.Lock()
+	defer modificationsMu.Unlock()
+	return modifications[kind+"/"+namespace+"/"+name]
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nicgrobler/k8s/result"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+/*
+	-audit-log reads kubernetes audit logs (json lines of audit.k8s.io events, as written by the log backend,
+	gzipped or not) and attaches the most recent writes to each exported object in result.json: who, when and with
+	which verb. only completed, successful create, update, patch and delete requests count, and writes to a
+	subresource such as status are left out - those are controllers, not people
+*/
+
+var auditVerbs = map[string]bool{"create": true, "update": true, "patch": true, "delete": true}
+
+// the fields of an audit.k8s.io/v1 Event we need, the rest of it is left unread
+type auditEvent struct {
+	Stage string `json:"stage"`
+	Verb  string `json:"verb"`
+	User  struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	ObjectRef *struct {
+		Resource    string `json:"resource"`
+		Namespace   string `json:"namespace"`
+		Name        string `json:"name"`
+		APIGroup    string `json:"apiGroup"`
+		Subresource string `json:"subresource"`
+	} `json:"objectRef"`
+	ResponseStatus *struct {
+		Code int `json:"code"`
+	} `json:"responseStatus"`
+	// with level Request and above the name of a created object is only here
+	RequestObject *struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+	} `json:"requestObject"`
+	StageTimestamp time.Time `json:"stageTimestamp"`
+}
+
+func auditKey(group, resource, namespace, name string) string {
+	return group + "/" + resource + "/" + namespace + "/" + name
+}
+
+func exportedAuditKey(o exportedObject) string {
+	gv, _ := schema.ParseGroupVersion(o.APIVersion)
+	// audit events name the resource, exports the kind - the guess is right for everything with a regular plural
+	plural, _ := meta.UnsafeGuessKindToResource(gv.WithKind(o.Kind))
+	return auditKey(gv.Group, plural.Resource, o.Namespace, o.Name)
+}
+
+func (e auditEvent) write() (string, bool) {
+	if e.Stage != "ResponseComplete" || !auditVerbs[e.Verb] || e.ObjectRef == nil || e.ObjectRef.Subresource != "" {
+		return "", false
+	}
+	if e.ResponseStatus != nil && e.ResponseStatus.Code >= 300 {
+		return "", false
+	}
+	name := e.ObjectRef.Name
+	if name == "" && e.RequestObject != nil {
+		name = e.RequestObject.Metadata.Name
+	}
+	if name == "" {
+		return "", false
+	}
+	return auditKey(e.ObjectRef.APIGroup, e.ObjectRef.Resource, e.ObjectRef.Namespace, name), true
+}
+
+func newestFirst(events []result.AuditEvent, keep int) []result.AuditEvent {
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.After(events[j].Time) })
+	if len(events) > keep {
+		events = events[:keep]
+	}
+	return events
+}
+
+func readAuditLog(file string, wanted map[string]bool, keep int, trail map[string][]result.AuditEvent) (int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(file, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decompress %s; %w", file, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	scanner := bufio.NewScanner(r)
+	// request and response bodies make for long lines
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	matched, line := 0, 0
+	for scanner.Scan() {
+		line++
+		e := auditEvent{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return matched, fmt.Errorf("%s line %d: %w", file, line, err)
+		}
+		key, ok := e.write()
+		if !ok || !wanted[key] {
+			continue
+		}
+		matched++
+		trail[key] = append(trail[key], result.AuditEvent{User: e.User.Username, Verb: e.Verb, Time: e.StageTimestamp.UTC()})
+		// keeps memory bounded on objects written all day long
+		if len(trail[key]) > 2*keep {
+			trail[key] = newestFirst(trail[key], keep)
+		}
+	}
+	return matched, scanner.Err()
+}
+
+func correlateAuditLog(files string, keep int) error {
+	exportedMu.Lock()
+	defer exportedMu.Unlock()
+
+	wanted := map[string]bool{}
+	for _, o := range exported {
+		wanted[exportedAuditKey(o)] = true
+	}
+	trail := map[string][]result.AuditEvent{}
+	matched := 0
+	for _, file := range strings.Split(files, ",") {
+		if file = strings.TrimSpace(file); file == "" {
+			continue
+		}
+		n, err := readAuditLog(file, wanted, keep, trail)
+		if err != nil {
+			return err
+		}
+		matched += n
+	}
+
+	for i := range exported {
+		if events := trail[exportedAuditKey(exported[i])]; len(events) > 0 {
+			exported[i].AuditEvents = newestFirst(events, keep)
+		}
+	}
+	log.Printf("audit log: %d writes to %d exported objects", matched, len(trail))
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	backstageAPIVersion    string = "backstage.io/v1alpha1"
+	backstageCatalogFile   string = "catalog-info.yaml"
+	backstageUnknownOwner  string = "unknown"
+	backstageMaxNameLength int    = 63
+)
+
+type backstageEntity struct {
+	APIVersion string                 `json:"apiVersion"`
+	Kind       string                 `json:"kind"`
+	Metadata   backstageMetadata      `json:"metadata"`
+	Spec       map[string]interface{} `json:"spec"`
+}
+
+type backstageMetadata struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+var backstageInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9\-_.]+`)
+
+func backstageName(s string) string {
+	// entity names are limited to [a-zA-Z0-9-_.] and 63 characters, and must start and end alphanumerically
+	name := backstageInvalidChars.ReplaceAllString(s, "-")
+	if len(name) > backstageMaxNameLength {
+		name = name[:backstageMaxNameLength]
+	}
+	return strings.Trim(name, "-_.")
+}
+
+func backstageEntities(deployments []appsv1.Deployment, ownerLabel string) []backstageEntity {
+	/*
+		every namespace becomes a Resource, and every deployment becomes a Component that depends on the namespace
+		it runs in - the owner is taken from the owner label of the deployment, falling back to that of the pod template
+	*/
+	namespaces := map[string]string{}
+	components := []backstageEntity{}
+
+	for _, d := range deployments {
+		owner := d.ObjectMeta.Labels[ownerLabel]
+		if owner == "" {
+			owner = d.Spec.Template.ObjectMeta.Labels[ownerLabel]
+		}
+		if owner == "" {
+			owner = backstageUnknownOwner
+		}
+		if _, ok := namespaces[d.ObjectMeta.Namespace]; !ok || namespaces[d.ObjectMeta.Namespace] == backstageUnknownOwner {
+			namespaces[d.ObjectMeta.Namespace] = owner
+		}
+
+		components = append(components, backstageEntity{
+			APIVersion: backstageAPIVersion,
+			Kind:       "Component",
+			Metadata: backstageMetadata{
+				Name: backstageName(d.ObjectMeta.Namespace + "-" + d.ObjectMeta.Name),
+				Annotations: map[string]string{
+					"backstage.io/kubernetes-id":        d.ObjectMeta.Name,
+					"backstage.io/kubernetes-namespace": d.ObjectMeta.Namespace,
+				},
+			},
+			Spec: map[string]interface{}{
+				"type":      "service",
+				"lifecycle": "production",
+				"owner":     owner,
+				"dependsOn": []string{"resource:" + backstageName(d.ObjectMeta.Namespace)},
+			},
+		})
+	}
+
+	names := []string{}
+	for ns := range namespaces {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+
+	entities := []backstageEntity{}
+	for _, ns := range names {
+		entities = append(entities, backstageEntity{
+			APIVersion: backstageAPIVersion,
+			Kind:       "Resource",
+			Metadata: backstageMetadata{
+				Name:        backstageName(ns),
+				Description: "kubernetes namespace " + ns,
+				Annotations: map[string]string{
+					"backstage.io/kubernetes-namespace": ns,
+				},
+			},
+			Spec: map[string]interface{}{
+				"type":  "kubernetes-namespace",
+				"owner": namespaces[ns],
+			},
+		})
+	}
+	return append(entities, components...)
+}
+
+func writeBackstageCatalog(deployments []appsv1.Deployment, ownerLabel string) error {
+	buffer := bytes.Buffer{}
+	for _, entity := range backstageEntities(deployments, ownerLabel) {
+		b, err := yaml.Marshal(entity)
+		if err != nil {
+			return err
+		}
+		buffer.WriteString("---\n")
+		buffer.Write(b)
+	}
+	return writeRootFile(backstageCatalogFile, buffer.Bytes())
+}
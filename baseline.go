@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+/*
+	a baseline lists findings which have been looked at and accepted, so that a cluster with a long history can start
+	failing on anything new without first fixing everything old - findings are matched by check, kind, namespace and
+	name, never by message, since messages carry counts which change from run to run
+*/
+
+type baselineEntry struct {
+	ID        string `json:"id"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// what the finding said when it was accepted, for whoever reviews the baseline - not used for matching
+	Message string `json:"message,omitempty"`
+	// free text, for recording why it was accepted
+	Reason string `json:"reason,omitempty"`
+}
+
+func (e baselineEntry) key() string {
+	return e.ID + "|" + e.Kind + "|" + e.Namespace + "|" + e.Name
+}
+
+func findingKey(f finding) string {
+	return baselineEntry{ID: f.ID, Kind: f.Kind, Namespace: f.Namespace, Name: f.Name}.key()
+}
+
+func loadBaseline(path string) (map[string]bool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entries := []baselineEntry{}
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("invalid baseline %s; %w", path, err)
+	}
+	accepted := map[string]bool{}
+	for _, e := range entries {
+		accepted[e.key()] = true
+	}
+	return accepted, nil
+}
+
+func writeBaseline(path string) error {
+	findingsMu.Lock()
+	entries := []baselineEntry{}
+	seen := map[string]bool{}
+	for _, f := range findings {
+		e := baselineEntry{ID: f.ID, Kind: f.Kind, Namespace: f.Namespace, Name: f.Name, Message: f.Message}
+		if !seen[e.key()] {
+			seen[e.key()] = true
+			entries = append(entries, e)
+		}
+	}
+	findingsMu.Unlock()
+
+	// sorted, so that a baseline kept in git only changes where the findings did
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key() < entries[j].key() })
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
+
+func applyBaseline(accepted map[string]bool) (suppressed int, remaining int) {
+	// accepted findings are dropped from everything the run writes or sends, and only counted
+	findingsMu.Lock()
+	defer findingsMu.Unlock()
+	kept := []finding{}
+	for _, f := range findings {
+		if !accepted[findingKey(f)] {
+			kept = append(kept, f)
+		}
+	}
+	suppressed = len(findings) - len(kept)
+	findings = kept
+	return suppressed, len(kept)
+}
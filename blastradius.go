@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const blastRadiusReport string = "reports/blast-radius"
+
+// weights of each kind of grant in the score, per binding granting it
+const (
+	wildcardWeight int = 10
+	secretsWeight  int = 5
+	execWeight     int = 5
+	writeWeight    int = 2
+	subjectWeight  int = 1
+)
+
+type namespaceRisk struct {
+	Namespace string `json:"namespace"`
+	Score     int    `json:"score"`
+	Bindings  int    `json:"bindings"`
+	Subjects  int    `json:"subjects"`
+	Wildcard  int    `json:"wildcardBindings"`
+	Secrets   int    `json:"secretsBindings"`
+	Exec      int    `json:"execBindings"`
+	Write     int    `json:"writeBindings"`
+
+	subjects map[string]bool
+}
+
+func hasString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func ruleTraits(rules []rbacv1.PolicyRule) (wildcard, secrets, exec, write bool) {
+	for _, rule := range rules {
+		if hasString(rule.Verbs, "*") || hasString(rule.Resources, "*") {
+			wildcard = true
+		}
+		if hasString(rule.Resources, "secrets") {
+			secrets = true
+		}
+		if (hasString(rule.Resources, "pods/exec") || hasString(rule.Resources, "pods/attach")) && (hasString(rule.Verbs, "create") || hasString(rule.Verbs, "get")) {
+			exec = true
+		}
+		for _, verb := range rule.Verbs {
+			if elevatedVerbs[verb] && verb != "*" {
+				write = true
+			}
+		}
+	}
+	return wildcard, secrets, exec, write
+}
+
+func (r *namespaceRisk) add(rules []rbacv1.PolicyRule, subjects []rbacv1.Subject) {
+	r.Bindings++
+	for _, s := range subjects {
+		r.subjects[subjectKey(s)] = true
+	}
+	wildcard, secrets, exec, write := ruleTraits(rules)
+	if wildcard {
+		r.Wildcard++
+	}
+	if secrets {
+		r.Secrets++
+	}
+	if exec {
+		r.Exec++
+	}
+	if write {
+		r.Write++
+	}
+}
+
+func (r *namespaceRisk) score() {
+	r.Subjects = len(r.subjects)
+	r.Score = r.Subjects*subjectWeight + r.Wildcard*wildcardWeight + r.Secrets*secretsWeight + r.Exec*execWeight + r.Write*writeWeight
+}
+
+func blastRadius(clientset kubernetes.Interface, bindings []rbacv1.RoleBinding, clusterBindings []rbacv1.ClusterRoleBinding) ([]namespaceRisk, error) {
+	/*
+		scored from the user-defined bindings only - cluster-wide grants reach every namespace, so they are scored once
+		as "*" rather than inflating every namespace equally. highest risk comes first.
+	*/
+	risks := map[string]*namespaceRisk{}
+	get := func(ns string) *namespaceRisk {
+		if risks[ns] == nil {
+			risks[ns] = &namespaceRisk{Namespace: ns, subjects: map[string]bool{}}
+		}
+		return risks[ns]
+	}
+
+	for _, b := range bindings {
+		rules, err := roleRules(clientset, b.ObjectMeta.Namespace, b.RoleRef)
+		if err != nil {
+			return nil, err
+		}
+		get(b.ObjectMeta.Namespace).add(rules, b.Subjects)
+	}
+	for _, b := range clusterBindings {
+		rules, err := roleRules(clientset, "", b.RoleRef)
+		if err != nil {
+			return nil, err
+		}
+		get(allNamespaces).add(rules, b.Subjects)
+	}
+
+	ranked := []namespaceRisk{}
+	for _, r := range risks {
+		r.score()
+		ranked = append(ranked, *r)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Namespace < ranked[j].Namespace
+	})
+	return ranked, nil
+}
+
+func writeBlastRadiusReport(clientset kubernetes.Interface, bindings []rbacv1.RoleBinding, clusterBindings []rbacv1.ClusterRoleBinding) error {
+	ranked, err := blastRadius(clientset, bindings, clusterBindings)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(ranked, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeRootFile(blastRadiusReport+".json", b); err != nil {
+		return err
+	}
+
+	buffer := bytes.Buffer{}
+	w := csv.NewWriter(&buffer)
+	w.Write([]string{"rank", "namespace", "score", "bindings", "subjects", "wildcard", "secrets", "exec", "write"})
+	for i, r := range ranked {
+		w.Write([]string{
+			strconv.Itoa(i + 1), r.Namespace, strconv.Itoa(r.Score), strconv.Itoa(r.Bindings), strconv.Itoa(r.Subjects),
+			strconv.Itoa(r.Wildcard), strconv.Itoa(r.Secrets), strconv.Itoa(r.Exec), strconv.Itoa(r.Write),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return writeRootFile(blastRadiusReport+".csv", buffer.Bytes())
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// set at build time, for example: go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse HEAD)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+const defaultReleaseURL string = "https://api.github.com/repos/nicgrobler/kube-scanner/releases/latest"
+
+type buildInfo struct {
+	Version       string `json:"version"`
+	Commit        string `json:"commit"`
+	BuildDate     string `json:"buildDate"`
+	GoVersion     string `json:"goVersion"`
+	ClientGo      string `json:"clientGo"`
+	KubernetesAPI string `json:"kubernetesAPI"`
+}
+
+func moduleVersion(path string) string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == path {
+			if dep.Replace != nil {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
+
+func currentBuildInfo() buildInfo {
+	clientGo := moduleVersion("k8s.io/client-go")
+
+	// client-go v0.x.y is cut from kubernetes 1.x.y
+	kubernetes := "unknown"
+	if strings.HasPrefix(clientGo, "v0.") {
+		kubernetes = "v1." + strings.TrimPrefix(clientGo, "v0.")
+	}
+
+	return buildInfo{
+		Version:       version,
+		Commit:        commit,
+		BuildDate:     buildDate,
+		GoVersion:     runtime.Version(),
+		ClientGo:      clientGo,
+		KubernetesAPI: kubernetes,
+	}
+}
+
+type release struct {
+	TagName string         `json:"tag_name"`
+	HTMLURL string         `json:"html_url"`
+	Assets  []releaseAsset `json:"assets"`
+}
+
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+func latestRelease(url string) (release, error) {
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return release{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return release{}, fmt.Errorf("release check against %s failed: %s", url, resp.Status)
+	}
+	r := release{}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return release{}, err
+	}
+	return r, nil
+}
+
+func runVersion(args []string) error {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	checkUpdate := fs.Bool("check-update", false, "also check whether a newer release is available")
+	releaseURL := fs.String("release-url", defaultReleaseURL, "endpoint describing the latest release")
+	asJSON := fs.Bool("json", false, "print the build information as json")
+	fs.Parse(args)
+
+	info := currentBuildInfo()
+	if *asJSON {
+		b, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	} else {
+		fmt.Printf("kube-scanner %s\n", info.Version)
+		fmt.Printf("  commit:         %s\n", info.Commit)
+		fmt.Printf("  build date:     %s\n", info.BuildDate)
+		fmt.Printf("  go:             %s\n", info.GoVersion)
+		fmt.Printf("  client-go:      %s\n", info.ClientGo)
+		fmt.Printf("  kubernetes api: %s\n", info.KubernetesAPI)
+	}
+
+	if *checkUpdate {
+		latest, err := latestRelease(*releaseURL)
+		if err != nil {
+			return err
+		}
+		if latest.TagName != "" && latest.TagName != version {
+			fmt.Printf("a different release is available: %s (running %s) %s\n", latest.TagName, version, latest.HTMLURL)
+		} else {
+			fmt.Println("kube-scanner is up to date")
+		}
+	}
+	return nil
+}
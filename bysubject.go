@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+const bySubjectDirectory string = "by-subject"
+
+// resource types as used in the namespaced layout, so that the subject view is laid out the same way underneath
+var rbacResourceTypes = map[string]string{
+	"RoleBinding":        "binding",
+	"Role":               "role",
+	"ClusterRoleBinding": "clusterbinding",
+	"ClusterRole":        "clusterrole",
+}
+
+type subjectView struct {
+	dir     string
+	objects map[string]bool
+}
+
+func writeSubjectFile(dir, key string, state map[string][]byte) error {
+	// the view repeats the exported objects, written again from what was recorded for the rbac tracking
+	encoded, ok := state[key]
+	if !ok {
+		return nil
+	}
+	parts := strings.SplitN(key, "/", 3)
+	formatted, err := formatYAML(encoded, parts[0], parts[1], parts[2])
+	if err != nil {
+		return err
+	}
+	w := newFileWriter()
+	w.rootDir = filepath.Join(outputDirectory, bySubjectDirectory, dir)
+	w.Write(formatted)
+	return w.flush(parts[1], parts[2], rbacResourceTypes[parts[0]])
+}
+
+func writeSubjectViews(bindings []rbacv1.RoleBinding, clusterBindings []rbacv1.ClusterRoleBinding, lookFor string) error {
+	/*
+		access reviews go subject by subject, so next to the namespaced layout every matched user and group gets a
+		directory holding all of its bindings and the roles they refer to, across namespaces. roles are only there when
+		they were exported, which leaves out the clusterroles only ever used by namespaced bindings.
+	*/
+	views := map[string]*subjectView{}
+	add := func(s rbacv1.Subject, keys ...string) {
+		if (s.Kind != rbacv1.UserKind && s.Kind != rbacv1.GroupKind) || !isUserDefined(s.Name, lookFor) {
+			return
+		}
+		id := subjectKey(s)
+		if views[id] == nil {
+			views[id] = &subjectView{dir: sanitizePathComponent(strings.ToLower(s.Kind) + "-" + s.Name), objects: map[string]bool{}}
+		}
+		for _, k := range keys {
+			views[id].objects[k] = true
+		}
+	}
+
+	for _, b := range bindings {
+		role := rbacKey(b.RoleRef.Kind, b.ObjectMeta.Namespace, b.RoleRef.Name)
+		if b.RoleRef.Kind == "ClusterRole" {
+			role = rbacKey(b.RoleRef.Kind, "", b.RoleRef.Name)
+		}
+		for _, s := range b.Subjects {
+			add(s, rbacKey("RoleBinding", b.ObjectMeta.Namespace, b.ObjectMeta.Name), role)
+		}
+	}
+	for _, b := range clusterBindings {
+		for _, s := range b.Subjects {
+			add(s, rbacKey("ClusterRoleBinding", "", b.ObjectMeta.Name), rbacKey(b.RoleRef.Kind, "", b.RoleRef.Name))
+		}
+	}
+
+	state := currentRBACState()
+	for _, view := range views {
+		for _, key := range sortedKeys(view.objects) {
+			if err := writeSubjectFile(view.dir, key, state); err != nil {
+				return fmt.Errorf("failed to write %s for %s; %w", key, view.dir, err)
+			}
+		}
+	}
+	return nil
+}
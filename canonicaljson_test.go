@@ -0,0 +1,83 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// the number examples of rfc 8785 appendix b, and a few of its edges
+func TestCanonicalNumber(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want string
+	}{
+		{in: 0, want: "0"},
+		{in: math.Copysign(0, -1), want: "0"},
+		{in: 5e-324, want: "5e-324"},
+		{in: -5e-324, want: "-5e-324"},
+		{in: 1.7976931348623157e308, want: "1.7976931348623157e+308"},
+		{in: -1.7976931348623157e308, want: "-1.7976931348623157e+308"},
+		{in: 9007199254740992, want: "9007199254740992"},
+		{in: -9007199254740992, want: "-9007199254740992"},
+		{in: 295147905179352830000, want: "295147905179352830000"},
+		{in: 9.999999999999997e22, want: "9.999999999999997e+22"},
+		{in: 1e23, want: "1e+23"},
+		{in: 1e21, want: "1e+21"},
+		{in: 999999999999999700000, want: "999999999999999700000"},
+		{in: 4.294967295e9, want: "4294967295"},
+		{in: 333333333.3333332, want: "333333333.3333332"},
+		{in: 0.000001, want: "0.000001"},
+		{in: 1e-7, want: "1e-7"},
+		{in: 1.5e-7, want: "1.5e-7"},
+		{in: 100, want: "100"},
+		{in: 0.1, want: "0.1"},
+	}
+	for _, tt := range tests {
+		got, err := canonicalNumber(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("canonicalNumber(%v) is %q, %v, expected %q", tt.in, got, err, tt.want)
+		}
+	}
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := canonicalNumber(f); err == nil {
+			t.Errorf("canonicalNumber(%v) didn't fail", f)
+		}
+	}
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "whitespace and order", in: "{ \"b\": [1, 2.50, true, null],\n  \"a\": {\"y\": 1, \"x\": \"z\"} }", want: `{"a":{"x":"z","y":1},"b":[1,2.5,true,null]}`},
+		{name: "yaml", in: "kind: ConfigMap\napiVersion: v1\ndata:\n  a: \"1\"\n", want: `{"apiVersion":"v1","data":{"a":"1"},"kind":"ConfigMap"}`},
+		// rfc 8785 3.2.2.2
+		{name: "string escapes", in: `{"s":"\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/"}`, want: `{"s":"€$\u000f\nA'B\"\\\\\"/"}`},
+		{name: "named control characters", in: `{"s":"\b\f\n\r\t\u0001\u001f "}`, want: `{"s":"\b\f\n\r\t\u0001\u001f "}`},
+		{name: "html characters left alone", in: `{"s":"<a&b>\u2028"}`, want: "{\"s\":\"<a&b>\u2028\"}"},
+		// rfc 8785 3.2.3: by utf-16 code units, which puts the emoji (a surrogate pair) before U+FB33
+		{name: "key order", in: `{"\u20ac":"Euro Sign","\r":"Carriage Return","\ufb33":"Hebrew Letter Dalet With Dagesh","1":"One","\ud83d\ude00":"Emoji: Grinning Face","\u0080":"Control","\u00f6":"Latin Small Letter O With Diaeresis"}`,
+			want: "{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"ö\":\"Latin Small Letter O With Diaeresis\",\"€\":\"Euro Sign\",\"😀\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}"},
+		{name: "numbers", in: `{"n":[1E3,-0,0.0000001,1e21,12345678901234567890]}`, want: `{"n":[1000,0,1e-7,1e+21,12345678901234567000]}`},
+		{name: "empty", in: `{"a":{},"b":[],"c":""}`, want: `{"a":{},"b":[],"c":""}`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := canonicalJSON([]byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got\n%s\nexpected\n%s", got, tt.want)
+			}
+			// canonical json is its own canonical form
+			again, err := canonicalJSON(got)
+			if err != nil || string(again) != string(got) {
+				t.Errorf("not stable: %s, %v", again, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+	experimental: turn a snapshot into a code skeleton for teams moving exported manifests into maintained IaC
+	every object is emitted as a generic, untyped construct holding the exported body verbatim - the intent is a
+	starting point which compiles, not idiomatic code, and the typed imports are left to the people maintaining it
+*/
+
+var codegenLanguages = map[string]func(objects []snapshotObject) ([]byte, error){
+	"cdk8s-ts":  cdk8sTypeScript,
+	"cdk8s-go":  cdk8sGo,
+	"pulumi-ts": pulumiTypeScript,
+}
+
+var codegenInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+func codegenID(o snapshotObject) string {
+	parts := []string{strings.ToLower(o.kind())}
+	if ns := o.metadata("namespace"); ns != "" {
+		parts = append(parts, ns)
+	}
+	parts = append(parts, o.metadata("name"))
+	return strings.Trim(codegenInvalidChars.ReplaceAllString(strings.Join(parts, "-"), "-"), "-")
+}
+
+func codegenIDs(objects []snapshotObject) []string {
+	// construct ids have to be unique, and names differing only in characters an id can't hold end up the same
+	used := map[string]bool{}
+	ids := make([]string, len(objects))
+	for i, o := range objects {
+		id := codegenID(o)
+		for n := 2; used[id]; n++ {
+			id = fmt.Sprintf("%s-%d", codegenID(o), n)
+		}
+		used[id] = true
+		ids[i] = id
+	}
+	return ids
+}
+
+func codegenBody(o snapshotObject) (string, error) {
+	// json is a valid typescript object literal
+	b, err := json.MarshalIndent(o.Object, "    ", "  ")
+	return string(b), err
+}
+
+func cdk8sTypeScript(objects []snapshotObject) ([]byte, error) {
+	out := bytes.Buffer{}
+	out.WriteString("// generated by kube-scanner codegen (experimental)\n")
+	out.WriteString("import { App, Chart, ApiObject } from 'cdk8s';\n")
+	out.WriteString("import { Construct } from 'constructs';\n\n")
+	out.WriteString("export class Snapshot extends Chart {\n")
+	out.WriteString("  constructor(scope: Construct, id: string) {\n")
+	out.WriteString("    super(scope, id);\n")
+	ids := codegenIDs(objects)
+	for i, o := range objects {
+		body, err := codegenBody(o)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&out, "\n    new ApiObject(this, %q, %s);\n", ids[i], body)
+	}
+	out.WriteString("  }\n}\n\n")
+	out.WriteString("const app = new App();\nnew Snapshot(app, 'snapshot');\napp.synth();\n")
+	return out.Bytes(), nil
+}
+
+func pulumiTypeScript(objects []snapshotObject) ([]byte, error) {
+	out := bytes.Buffer{}
+	out.WriteString("// generated by kube-scanner codegen (experimental)\n")
+	out.WriteString("import * as k8s from '@pulumi/kubernetes';\n")
+	ids := codegenIDs(objects)
+	for i, o := range objects {
+		body, err := codegenBody(o)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&out, "\nnew k8s.apiextensions.CustomResource(%q, %s);\n", ids[i], strings.Replace(body, "\n    ", "\n", -1))
+	}
+	return out.Bytes(), nil
+}
+
+func cdk8sGo(objects []snapshotObject) ([]byte, error) {
+	/*
+		go has no literal to hold the body as it is, so each object is its exported json in a string: the ApiObject
+		is made from its apiVersion and kind, and every other field patched in as it was read
+	*/
+	out := bytes.Buffer{}
+	out.WriteString("// generated by kube-scanner codegen (experimental)\n")
+	out.WriteString("package main\n\n")
+	out.WriteString("import (\n\t\"encoding/json\"\n\n")
+	out.WriteString("\t\"github.com/aws/constructs-go/constructs/v10\"\n")
+	out.WriteString("\t\"github.com/aws/jsii-runtime-go\"\n")
+	out.WriteString("\t\"github.com/cdk8s-team/cdk8s-core-go/cdk8s/v2\"\n)\n\n")
+	out.WriteString("func apiObject(chart cdk8s.Chart, id string, manifest string) {\n")
+	out.WriteString("\tvar body map[string]interface{}\n")
+	out.WriteString("\tif err := json.Unmarshal([]byte(manifest), &body); err != nil {\n\t\tpanic(err)\n\t}\n")
+	out.WriteString("\to := cdk8s.NewApiObject(chart, jsii.String(id), &cdk8s.ApiObjectProps{\n")
+	out.WriteString("\t\tApiVersion: jsii.String(body[\"apiVersion\"].(string)),\n")
+	out.WriteString("\t\tKind:       jsii.String(body[\"kind\"].(string)),\n\t})\n")
+	out.WriteString("\tfor field, value := range body {\n")
+	out.WriteString("\t\tif field != \"apiVersion\" && field != \"kind\" {\n")
+	out.WriteString("\t\t\to.AddJsonPatch(cdk8s.JsonPatch_Add(jsii.String(\"/\"+field), value))\n\t\t}\n\t}\n}\n\n")
+	out.WriteString("func NewSnapshot(scope constructs.Construct, id string) cdk8s.Chart {\n")
+	out.WriteString("\tchart := cdk8s.NewChart(scope, jsii.String(id), nil)\n")
+	ids := codegenIDs(objects)
+	for i, o := range objects {
+		body, err := json.Marshal(o.Object)
+		if err != nil {
+			return nil, err
+		}
+		manifest := strconv.Quote(string(body))
+		if strconv.CanBackquote(string(body)) {
+			manifest = "`" + string(body) + "`"
+		}
+		fmt.Fprintf(&out, "\tapiObject(chart, %q, %s)\n", ids[i], manifest)
+	}
+	out.WriteString("\treturn chart\n}\n\n")
+	out.WriteString("func main() {\n\tapp := cdk8s.NewApp(nil)\n\tNewSnapshot(app, \"snapshot\")\n\tapp.Synth()\n}\n")
+	return out.Bytes(), nil
+}
+
+func runCodegen(args []string) error {
+	fs := flag.NewFlagSet("codegen", flag.ExitOnError)
+	fromDir := fs.String("from-dir", defaultOutputDir, "directory holding a previous export")
+	lang := fs.String("lang", "cdk8s-ts", "language to generate: cdk8s-ts, cdk8s-go or pulumi-ts")
+	out := fs.String("out", "", "file to write the generated code to, defaults to stdout")
+	fs.Parse(args)
+
+	generate, ok := codegenLanguages[*lang]
+	if !ok {
+		return fmt.Errorf("unsupported codegen language %q: expected cdk8s-ts, cdk8s-go or pulumi-ts", *lang)
+	}
+
+	objects, err := readSnapshot(*fromDir)
+	if err != nil {
+		return err
+	}
+	code, err := generate(objects)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		fmt.Print(string(code))
+		return nil
+	}
+	return os.WriteFile(*out, code, 0644)
+}
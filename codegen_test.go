@@ -0,0 +1,93 @@
+package main
+
+import (
+	"go/format"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func codegenObject(kind, namespace, name string) snapshotObject {
+	metadata := map[string]interface{}{"name": name}
+	if namespace != "" {
+		metadata["namespace"] = namespace
+	}
+	return snapshotObject{Object: map[string]interface{}{"apiVersion": "v1", "kind": kind, "metadata": metadata}}
+}
+
+func TestCodegenIDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects []snapshotObject
+		want    []string
+	}{
+		{
+			name:    "namespaced and cluster-wide",
+			objects: []snapshotObject{codegenObject("ConfigMap", "shop", "settings"), codegenObject("Namespace", "", "shop")},
+			want:    []string{"configmap-shop-settings", "namespace-shop"},
+		},
+		{
+			name:    "invalid characters",
+			objects: []snapshotObject{codegenObject("ClusterRole", "", "system:aggregate-to-edit")},
+			want:    []string{"clusterrole-system-aggregate-to-edit"},
+		},
+		{
+			name:    "names only differing in invalid characters",
+			objects: []snapshotObject{codegenObject("ConfigMap", "shop", "a-b"), codegenObject("ConfigMap", "shop", "a_b"), codegenObject("ConfigMap", "shop", "a.b")},
+			want:    []string{"configmap-shop-a-b", "configmap-shop-a-b-2", "configmap-shop-a-b-3"},
+		},
+		{
+			name:    "suffixed id taken by a later object",
+			objects: []snapshotObject{codegenObject("ConfigMap", "shop", "a-b"), codegenObject("ConfigMap", "shop", "a_b"), codegenObject("ConfigMap", "shop", "a-b-2")},
+			want:    []string{"configmap-shop-a-b", "configmap-shop-a-b-2", "configmap-shop-a-b-2-2"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := codegenIDs(tt.objects); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("codegenIDs gave %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCdk8sGo(t *testing.T) {
+	quoted := codegenObject("ConfigMap", "shop", "scripts")
+	quoted.Object["data"] = map[string]interface{}{"run.sh": "echo `date`"}
+	tests := []struct {
+		name    string
+		objects []snapshotObject
+		want    string
+	}{
+		{
+			name:    "raw string",
+			objects: []snapshotObject{codegenObject("ConfigMap", "shop", "settings")},
+			want:    "apiObject(chart, \"configmap-shop-settings\", `{\"apiVersion\":\"v1\",\"kind\":\"ConfigMap\",\"metadata\":{\"name\":\"settings\",\"namespace\":\"shop\"}}`)",
+		},
+		{
+			name:    "body holding a backquote",
+			objects: []snapshotObject{quoted},
+			want:    `apiObject(chart, "configmap-shop-scripts", "{\"apiVersion\":\"v1\",\"data\":{\"run.sh\":\"echo ` + "`date`" + `\"},\"kind\":\"ConfigMap\",\"metadata\":{\"name\":\"scripts\",\"namespace\":\"shop\"}}")`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := cdk8sGo(tt.objects)
+			if err != nil {
+				t.Fatal(err)
+			}
+			formatted, err := format.Source(code)
+			if err != nil {
+				t.Fatalf("generated code doesn't parse: %v", err)
+			}
+			if string(formatted) != string(code) {
+				t.Error("generated code isn't gofmt'd")
+			}
+			if !strings.Contains(string(code), tt.want) {
+				t.Errorf("generated code doesn't hold %s:\n%s", tt.want, code)
+			}
+		})
+	}
+}
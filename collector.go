@@ -0,0 +1,668 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/subtle"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nicgrobler/k8s/result"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+/*
+	fleet mode: an agent is an ordinary scan run with -push-to, which sends its output directory as a tar.gz to the
+	collector once the scan succeeded. the collector keeps the last -keep snapshots of every cluster on disk, one
+	directory each, and answers fleet-wide questions from the latest - the api is plain json over http:
+
+		POST /api/v1/clusters/<cluster>/snapshots     an agent pushing a run
+		GET  /api/v1/clusters                         every cluster, with the summary of its latest run
+		GET  /api/v1/clusters/<cluster>/result        result.json of the latest run
+		GET  /api/v1/clusters/<cluster>/files/<path>  any file of the latest run
+		GET  /api/v1/findings                         findings of every cluster, ?cluster= ?severity= and ?format=csv
+
+	every call but /healthz needs the bearer token from -token-file, agents send theirs from -push-token-file, or
+	a tenant token from -tenants which only reads its own namespaces (see tenants.go)
+*/
+
+const collectorAPI string = "/api/v1/"
+
+// cluster names become directory names on the collector
+var clusterNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func validClusterName(name string) bool {
+	return clusterNamePattern.MatchString(name) && !strings.Contains(name, "..")
+}
+
+func readToken(file string) (string, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("%s holds no token", file)
+	}
+	return token, nil
+}
+
+func archiveDirectory(dir string) ([]byte, error) {
+	buf := bytes.Buffer{}
+	if err := writeArchive(&buf, dir); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeArchive(w io.Writer, dir string) error {
+	// streamed file by file, an archive of a whole cluster doesn't have to fit in memory
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := fs.WalkDir(os.DirFS(dir), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := os.Open(filepath.Join(dir, filepath.FromSlash(p)))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: p, Mode: 0644, Size: info.Size(), Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func pushResults(collectorURL, tokenFile, cluster, dir string) error {
+	token, err := readToken(tokenFile)
+	if err != nil {
+		return err
+	}
+	archive, err := archiveDirectory(dir)
+	if err != nil {
+		return err
+	}
+	target := strings.TrimSuffix(collectorURL, "/") + collectorAPI + "clusters/" + url.PathEscape(cluster) + "/snapshots"
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(archive))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	req.Header.Set("Authorization", "Bearer "+token)
+	client := http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("collector %s answered %s: %s", collectorURL, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	log.Printf("pushed %d bytes to %s", len(archive), collectorURL)
+	return nil
+}
+
+type collector struct {
+	store     string
+	token     string
+	tenants   []tenant
+	keep      int
+	maxUpload int64
+	// held while a received snapshot is given its name and moved into place
+	naming sync.Mutex
+}
+
+// what /api/v1/clusters says about one cluster
+type clusterSummary struct {
+	Cluster    string         `json:"cluster"`
+	Snapshot   string         `json:"snapshot"`
+	ReceivedAt time.Time      `json:"receivedAt"`
+	StartedAt  time.Time      `json:"startedAt"`
+	Objects    int            `json:"objects"`
+	Findings   map[string]int `json:"findings"`
+	Errors     int            `json:"errors"`
+	// from status.json, when the agent ran with -status - left out for tenants, it grades the whole cluster
+	Grade string `json:"grade,omitempty"`
+	// other cluster names whose latest snapshot has the same fingerprint, see fingerprint.go - left out for tenants
+	SameClusterAs []string `json:"sameClusterAs,omitempty"`
+}
+
+type fleetFinding struct {
+	Cluster string `json:"cluster"`
+	result.Finding
+}
+
+func (c *collector) snapshots(cluster string) ([]string, error) {
+	// oldest first - names are timestamps, anything starting with a dot is an upload in progress. names taken in
+	// another timezone, or either side of a daylight saving change, don't sort by name alone
+	entries, err := os.ReadDir(filepath.Join(c.store, cluster))
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	sort.SliceStable(names, func(i, j int) bool {
+		a, errA := time.Parse(snapshotTimeFormat, names[i])
+		b, errB := time.Parse(snapshotTimeFormat, names[j])
+		return errA == nil && errB == nil && a.Before(b)
+	})
+	return names, nil
+}
+
+func (c *collector) latest(cluster string) (string, error) {
+	names, err := c.snapshots(cluster)
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", os.ErrNotExist
+	}
+	return filepath.Join(c.store, cluster, names[len(names)-1]), nil
+}
+
+func (c *collector) clusters() ([]string, error) {
+	entries, err := os.ReadDir(c.store)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, e := range entries {
+		if e.IsDir() && validClusterName(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+func readResultFile(dir string) (*result.ScanResult, error) {
+	f, err := os.Open(filepath.Join(dir, result.FileName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return result.Decode(f)
+}
+
+func extractArchive(r io.Reader, dir string, limit int64) error {
+	// limit is on the unpacked size, so that a small archive can't fill the disk
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// only plain files, and only below dir
+		name := path.Clean(h.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("refusing %s, it is outside the snapshot", h.Name)
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			continue
+		case tar.TypeReg:
+		default:
+			return fmt.Errorf("refusing %s, only regular files are accepted", h.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(f, io.LimitReader(tr, limit+1))
+		limit -= n
+		if err == nil && limit < 0 {
+			err = errors.New("the snapshot is too large once unpacked")
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *collector) receive(w http.ResponseWriter, r *http.Request, cluster string) {
+	// unpacked next to the snapshots and renamed into place, so that readers never see half a snapshot
+	if err := os.MkdirAll(filepath.Join(c.store, cluster), 0755); err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	incoming, err := os.MkdirTemp(filepath.Join(c.store, cluster), ".incoming-")
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer os.RemoveAll(incoming)
+
+	if err := extractArchive(http.MaxBytesReader(w, r.Body, c.maxUpload), incoming, 10*c.maxUpload); err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	res, err := readResultFile(incoming)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, fmt.Errorf("the snapshot holds no readable %s; %w", result.FileName, err))
+		return
+	}
+	if res.Cluster != "" && res.Cluster != cluster {
+		httpError(w, http.StatusBadRequest, fmt.Errorf("the snapshot is of cluster %s, not %s", res.Cluster, cluster))
+		return
+	}
+
+	name, err := c.storeSnapshot(incoming, cluster, time.Now())
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	log.Printf("collector: snapshot %s of %s, %d objects and %d findings", name, cluster, len(res.Objects), len(res.Findings))
+	if others := c.sameCluster(cluster); len(others) > 0 {
+		log.Printf("collector: warning: %s has the same fingerprint as %s, they are one cluster pushed under different names", cluster, strings.Join(others, ", "))
+	}
+	if err := c.prune(cluster); err != nil {
+		log.Printf("collector: %v", err)
+	}
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, map[string]string{"cluster": cluster, "snapshot": name})
+}
+
+func (c *collector) storeSnapshot(incoming, cluster string, received time.Time) (string, error) {
+	// names are times, so two pushes in the same millisecond take the next free one rather than the same
+	c.naming.Lock()
+	defer c.naming.Unlock()
+	for {
+		name := snapshotName(received)
+		target := filepath.Join(c.store, cluster, name)
+		if _, err := os.Lstat(target); os.IsNotExist(err) {
+			return name, os.Rename(incoming, target)
+		} else if err != nil {
+			return "", err
+		}
+		received = received.Add(time.Millisecond)
+	}
+}
+
+func (c *collector) prune(cluster string) error {
+	names, err := c.snapshots(cluster)
+	if err != nil {
+		return err
+	}
+	// snapshots under legal hold are kept, and don't count against -keep
+	kept := 0
+	for i := len(names) - 1; i >= 0; i-- {
+		dir := filepath.Join(c.store, cluster, names[i])
+		if isLegalHold(dir) {
+			continue
+		}
+		kept++
+		if kept <= c.keep {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *collector) fingerprints() map[string]string {
+	ids := map[string]string{}
+	names, err := c.clusters()
+	if err != nil {
+		return ids
+	}
+	for _, name := range names {
+		dir, err := c.latest(name)
+		if err != nil {
+			continue
+		}
+		if m, err := readManifest(dir); err == nil && m.Fingerprint != nil {
+			ids[name] = m.Fingerprint.ID
+		}
+	}
+	return ids
+}
+
+func (c *collector) sameCluster(cluster string) []string {
+	ids := c.fingerprints()
+	others := []string{}
+	for _, name := range sharedFingerprints(ids)[ids[cluster]] {
+		if name != cluster {
+			others = append(others, name)
+		}
+	}
+	return others
+}
+
+func (c *collector) latestResult(cluster string, t *tenant) (string, *result.ScanResult, error) {
+	// t is nil for the collector's own token, which sees everything
+	if t != nil && !t.seesCluster(cluster) {
+		return "", nil, os.ErrNotExist
+	}
+	dir, err := c.latest(cluster)
+	if err != nil {
+		return "", nil, err
+	}
+	res, err := readResultFile(dir)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", cluster, err)
+	}
+	if t != nil {
+		res = scopeResult(res, t)
+	}
+	return dir, res, nil
+}
+
+func (c *collector) summary(cluster string, t *tenant) (clusterSummary, error) {
+	dir, res, err := c.latestResult(cluster, t)
+	if err != nil {
+		return clusterSummary{}, err
+	}
+	s := clusterSummary{
+		Cluster:   cluster,
+		Snapshot:  filepath.Base(dir),
+		StartedAt: res.StartedAt,
+		Objects:   len(res.Objects),
+		Findings:  map[string]int{severityHigh: 0, severityMedium: 0, severityLow: 0},
+		Errors:    len(res.Errors),
+	}
+	s.ReceivedAt, _ = time.Parse(snapshotTimeFormat, s.Snapshot)
+	for _, f := range res.Findings {
+		s.Findings[f.Severity]++
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, statusFile)); err == nil && t == nil {
+		status := scanStatus{}
+		if json.Unmarshal(b, &status) == nil {
+			s.Grade = status.Grade
+		}
+	}
+	if t == nil {
+		if others := c.sameCluster(cluster); len(others) > 0 {
+			s.SameClusterAs = others
+		}
+	}
+	return s, nil
+}
+
+func (c *collector) listClusters(w http.ResponseWriter, t *tenant) {
+	names, err := c.clusters()
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	summaries := []clusterSummary{}
+	for _, name := range names {
+		s, err := c.summary(name, t)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			httpError(w, http.StatusInternalServerError, err)
+			return
+		}
+		summaries = append(summaries, s)
+	}
+	writeJSON(w, summaries)
+}
+
+func (c *collector) fleetFindings(w http.ResponseWriter, r *http.Request, t *tenant) {
+	q := r.URL.Query()
+	minimum := q.Get("severity")
+	if minimum != "" {
+		if err := validateSeverity(minimum); err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	names, err := c.clusters()
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	found := []fleetFinding{}
+	for _, name := range names {
+		if q.Get("cluster") != "" && q.Get("cluster") != name {
+			continue
+		}
+		_, res, err := c.latestResult(name, t)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			httpError(w, http.StatusInternalServerError, err)
+			return
+		}
+		for _, f := range res.Findings {
+			if minimum == "" || severityRank[f.Severity] >= severityRank[minimum] {
+				found = append(found, fleetFinding{Cluster: name, Finding: f})
+			}
+		}
+	}
+
+	if q.Get("format") != "csv" {
+		writeJSON(w, found)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"cluster", "id", "severity", "kind", "namespace", "name", "message"})
+	for _, f := range found {
+		cw.Write([]string{f.Cluster, f.ID, f.Severity, f.Object.Kind, f.Object.Namespace, f.Object.Name, f.Message})
+	}
+	cw.Flush()
+}
+
+func (c *collector) serveResult(w http.ResponseWriter, r *http.Request, cluster string, t *tenant) {
+	if t == nil {
+		c.serveFile(w, r, cluster, result.FileName, nil)
+		return
+	}
+	_, res, err := c.latestResult(cluster, t)
+	if errors.Is(err, os.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, res)
+}
+
+func (c *collector) serveFile(w http.ResponseWriter, r *http.Request, cluster, name string, t *tenant) {
+	dir, res, err := c.latestResult(cluster, t)
+	if errors.Is(err, os.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// cleaned against the root, so that .. can't leave the snapshot
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if t != nil {
+		// tenants read exported objects of their namespaces, and nothing else
+		allowed := false
+		for _, o := range res.Objects {
+			if o.Path == name {
+				allowed = true
+			}
+		}
+		if !allowed {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+func (c *collector) authorize(r *http.Request) (*tenant, bool) {
+	// the collector's own token comes back as a nil tenant
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(c.token)) == 1 {
+		return nil, true
+	}
+	if t := tenantForToken(c.tenants, token); t != nil {
+		return t, true
+	}
+	return nil, false
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/healthz" {
+		w.Write([]byte("ok\n"))
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, collectorAPI) {
+		http.NotFound(w, r)
+		return
+	}
+	t, ok := c.authorize(r)
+	if !ok {
+		httpError(w, http.StatusUnauthorized, errors.New("missing or unknown token"))
+		return
+	}
+	if t != nil && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		httpError(w, http.StatusForbidden, fmt.Errorf("tenant %s can only read", t.Name))
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, collectorAPI), "/"), "/")
+	if len(parts) >= 2 && parts[0] == "clusters" && !validClusterName(parts[1]) {
+		httpError(w, http.StatusBadRequest, fmt.Errorf("invalid cluster name %q", parts[1]))
+		return
+	}
+	switch {
+	case len(parts) == 1 && parts[0] == "clusters" && r.Method == http.MethodGet:
+		c.listClusters(w, t)
+	case len(parts) == 1 && parts[0] == "findings" && r.Method == http.MethodGet:
+		c.fleetFindings(w, r, t)
+	case len(parts) == 3 && parts[0] == "clusters" && parts[2] == "snapshots" && r.Method == http.MethodPost:
+		c.receive(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "clusters" && parts[2] == "result" && r.Method == http.MethodGet:
+		c.serveResult(w, r, parts[1], t)
+	case len(parts) >= 4 && parts[0] == "clusters" && parts[2] == "files" && r.Method == http.MethodGet:
+		c.serveFile(w, r, parts[1], strings.Join(parts[3:], "/"), t)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func httpError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("collector: %v", err)
+	}
+}
+
+func runCollector(args []string) error {
+	fs := flag.NewFlagSet("collector", flag.ExitOnError)
+	listen := fs.String("listen", ":8080", "address to serve the collector api on")
+	store := fs.String("store", "collector-data", "directory holding the snapshots pushed by agents, one directory per cluster")
+	tokenFile := fs.String("token-file", "", "file holding the bearer token agents and readers authenticate with")
+	keep := fs.Int("keep", 10, "snapshots kept per cluster, older ones are removed as new ones arrive")
+	maxUpload := fs.String("max-upload", "1Gi", "largest snapshot accepted, compressed - unpacked it may be ten times that")
+	tenantsFile := fs.String("tenants", "", "(optional) yaml file of tenants, whose tokens only read the namespaces they are given")
+	tlsCert := fs.String("tls-cert", "", "(optional) certificate to serve https with, together with -tls-key")
+	tlsKey := fs.String("tls-key", "", "(optional) key of -tls-cert")
+	timezone, timeFormat := timeFlags(fs)
+	fs.Parse(args)
+
+	if err := setReportTime(*timezone, *timeFormat); err != nil {
+		return err
+	}
+	if *tokenFile == "" {
+		return errors.New("collector: -token-file is required, the api would be open to anyone otherwise")
+	}
+	token, err := readToken(*tokenFile)
+	if err != nil {
+		return err
+	}
+	tenants, err := loadTenants(*tenantsFile)
+	if err != nil {
+		return err
+	}
+	if *keep < 1 {
+		return errors.New("collector: -keep must be at least 1")
+	}
+	size, err := resource.ParseQuantity(*maxUpload)
+	if err != nil {
+		return fmt.Errorf("collector: invalid -max-upload %q; %w", *maxUpload, err)
+	}
+	if err := os.MkdirAll(*store, 0755); err != nil {
+		return err
+	}
+
+	c := &collector{store: *store, token: token, tenants: tenants, keep: *keep, maxUpload: size.Value()}
+	log.Printf("collector: serving %s on %s", *store, *listen)
+	if *tlsCert != "" {
+		return http.ListenAndServeTLS(*listen, *tlsCert, *tlsKey, c)
+	}
+	return http.ListenAndServe(*listen, c)
+}
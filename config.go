@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+/*
+settings which are too structured for flags live in a yaml config file, given with -config - unknown keys are an
+error, so that a typo doesn't silently disable something an organisation relies on
+*/
+type scanConfig struct {
+	Header      headerConfig      `json:"header,omitempty"`
+	Subjects    subjectConfig     `json:"subjects,omitempty"`
+	Drift       driftConfig       `json:"drift,omitempty"`
+	Checks      checksConfig      `json:"checks,omitempty"`
+	Remediation remediationConfig `json:"remediation,omitempty"`
+	Retention   retentionConfig   `json:"retention,omitempty"`
+	Schedule    scheduleConfig    `json:"schedule,omitempty"`
+	Pipeline    []pipelineStep    `json:"pipeline,omitempty"`
+	Teams       []teamOutput      `json:"teams,omitempty"`
+	Hooks       hooksConfig       `json:"hooks,omitempty"`
+	Golden      []goldenConfig    `json:"golden,omitempty"`
+	Plugins     []pluginSource    `json:"plugins,omitempty"`
+}
+
+type headerConfig struct {
+	// text/template rendered at the top of every exported file, each line becoming a comment
+	Template string `json:"template,omitempty"`
+	// free form values made available to the template as .Values, for example org or classification
+	Values map[string]string `json:"values,omitempty"`
+}
+
+var cfg scanConfig
+
+func loadConfig(path string) (scanConfig, error) {
+	c := scanConfig{}
+	if path == "" {
+		return c, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	return parseConfig(b)
+}
+
+func parseConfig(b []byte) (scanConfig, error) {
+	c := scanConfig{}
+	err := yaml.UnmarshalStrict(b, &c)
+	return c, err
+}
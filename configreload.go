@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+/*
+	a daemon reads its config again before every scan, and applies it when it changed - the header, subject
+	mapping, checks, retention and scan windows all take effect from the next scan on, flags still need a restart.
+	the config is a file, which is also how a mounted configmap is seen, or configmap:<namespace>/<name> to read a
+	configmap straight from the api. a config which doesn't parse, or doesn't apply, is logged and the one before
+	it stays active. the active config is served as json on /config of -metrics-addr
+*/
+
+const configMapPrefix string = "configmap:"
+
+// the key a config is read from when the configmap has more than one
+const configMapKey string = "config.yaml"
+
+type configWatcher struct {
+	source    string
+	clientset *kubernetes.Clientset
+	apply     func(scanConfig) error
+
+	mu       sync.Mutex
+	active   scanConfig
+	digest   string
+	loadedAt time.Time
+}
+
+func isConfigMapSource(source string) bool {
+	return strings.HasPrefix(source, configMapPrefix)
+}
+
+func readConfigMap(clientset *kubernetes.Clientset, source string) ([]byte, error) {
+	parts := strings.SplitN(strings.TrimPrefix(source, configMapPrefix), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid config source %q: expected %s<namespace>/<name>", source, configMapPrefix)
+	}
+	cm, err := clientset.CoreV1().ConfigMaps(parts[0]).Get(context.TODO(), parts[1], metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if data, ok := cm.Data[configMapKey]; ok {
+		return []byte(data), nil
+	}
+	if len(cm.Data) == 1 {
+		for _, data := range cm.Data {
+			return []byte(data), nil
+		}
+	}
+	keys := []string{}
+	for k := range cm.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return nil, fmt.Errorf("configmap %s/%s has no %s key, and keys %v to choose from", parts[0], parts[1], configMapKey, keys)
+}
+
+func (w *configWatcher) read() ([]byte, error) {
+	if isConfigMapSource(w.source) {
+		return readConfigMap(w.clientset, w.source)
+	}
+	return os.ReadFile(w.source)
+}
+
+// reload applies the config when it changed since it was last applied, and reports whether it did
+func (w *configWatcher) reload() (bool, error) {
+	b, err := w.read()
+	if err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256(b)
+	digest := hex.EncodeToString(sum[:])
+
+	w.mu.Lock()
+	unchanged, previous := digest == w.digest, w.active
+	w.mu.Unlock()
+	if unchanged {
+		return false, nil
+	}
+
+	c, err := parseConfig(b)
+	if err != nil {
+		return false, err
+	}
+	if err := w.apply(c); err != nil {
+		// what was applied before did apply, it's put back rather than running on half of each
+		if restoreErr := w.apply(previous); restoreErr != nil {
+			return false, fmt.Errorf("%v, and restoring the previous config failed; %w", err, restoreErr)
+		}
+		return false, err
+	}
+
+	w.mu.Lock()
+	w.active, w.digest, w.loadedAt = c, digest, time.Now().UTC()
+	w.mu.Unlock()
+	return true, nil
+}
+
+func (w *configWatcher) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	w.mu.Lock()
+	body := struct {
+		Source   string     `json:"source"`
+		SHA256   string     `json:"sha256"`
+		LoadedAt time.Time  `json:"loadedAt"`
+		Config   scanConfig `json:"config"`
+	}{w.source, w.digest, w.loadedAt, w.active}
+	w.mu.Unlock()
+	b, err := json.MarshalIndent(body, "", "  ")
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(b)
+}
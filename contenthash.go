@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+/*
+	every object's content hash is recorded in result.json - the sha256 of the object as serialised, before the
+	header and formatting are added, so that it only changes when the object does. with -skip-unchanged, an object
+	whose hash matches the one the previous run recorded for the same file, and whose file is still there, is not
+	written again: stable clusters snapshot in no time after the first run, and the header date of untouched files
+	doesn't make every file change in git. formatting changes (the header template, -yaml-indent) only reach those
+	files on a run without -skip-unchanged
+*/
+
+var (
+	skipUnchanged  bool
+	previousHashes map[string]string
+	unchanged      int
+	hashesMu       sync.Mutex
+)
+
+func loadPreviousHashes(dir string) {
+	hashesMu.Lock()
+	defer hashesMu.Unlock()
+	previousHashes, unchanged = map[string]string{}, 0
+	if !skipUnchanged {
+		return
+	}
+	previous, err := readResultFile(dir)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		// a result we can't read only means everything is written again
+		log.Printf("not skipping unchanged objects, the previous result is unreadable: %v", err)
+		return
+	}
+	for _, o := range previous.Objects {
+		if o.SHA256 != "" {
+			previousHashes[o.Path] = o.SHA256
+		}
+	}
+}
+
+// isUnchanged reports whether the file at p already holds an object of this hash, and counts it when it does
+func isUnchanged(p, sum string) bool {
+	hashesMu.Lock()
+	defer hashesMu.Unlock()
+	if previousHashes[p] == "" || previousHashes[p] != sum {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(outputDirectory, filepath.FromSlash(p))); err != nil {
+		return false
+	}
+	unchanged++
+	return true
+}
+
+func logUnchanged() {
+	hashesMu.Lock()
+	defer hashesMu.Unlock()
+	if skipUnchanged {
+		log.Printf("%d unchanged objects not written again", unchanged)
+	}
+}
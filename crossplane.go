@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+var crossplaneXRDs = schema.GroupVersionResource{Group: "apiextensions.crossplane.io", Version: "v1", Resource: "compositeresourcedefinitions"}
+
+func crossplanePreset(disc discovery.DiscoveryInterface, dyn dynamic.Interface) ([]schema.GroupVersionResource, error) {
+	/*
+		crossplane's own types are fixed, but composites and claims are defined at runtime by XRDs, and provider configs
+		live in whatever group each installed provider uses - so the latter two have to be resolved from the cluster
+	*/
+	gvrs, err := servedResources(disc, func(gv schema.GroupVersion, r metav1.APIResource) bool {
+		if gv.Group == "apiextensions.crossplane.io" || gv.Group == "pkg.crossplane.io" {
+			return r.Name != "compositionrevisions" && r.Name != "providerrevisions" && r.Name != "configurationrevisions"
+		}
+		return r.Name == "providerconfigs"
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	xrds, err := dyn.Resource(crossplaneXRDs).List(context.TODO(), listOptions())
+	if apierrors.IsNotFound(err) {
+		// crossplane isn't installed
+		return gvrs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, xrd := range xrds.Items {
+		group, _, _ := unstructured.NestedString(xrd.Object, "spec", "group")
+		plural, _, _ := unstructured.NestedString(xrd.Object, "spec", "names", "plural")
+		claimPlural, _, _ := unstructured.NestedString(xrd.Object, "spec", "claimNames", "plural")
+		version := crossplaneServedVersion(xrd)
+		if group == "" || version == "" {
+			continue
+		}
+		if plural != "" {
+			gvrs = append(gvrs, schema.GroupVersionResource{Group: group, Version: version, Resource: strings.ToLower(plural)})
+		}
+		if claimPlural != "" {
+			gvrs = append(gvrs, schema.GroupVersionResource{Group: group, Version: version, Resource: strings.ToLower(claimPlural)})
+		}
+	}
+	return gvrs, nil
+}
+
+func crossplaneServedVersion(xrd unstructured.Unstructured) string {
+	// prefer the referenceable version, as that is the one the composites are stored as
+	versions, _, _ := unstructured.NestedSlice(xrd.Object, "spec", "versions")
+	served := ""
+	for _, v := range versions {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(m, "name")
+		isServed, _, _ := unstructured.NestedBool(m, "served")
+		referenceable, _, _ := unstructured.NestedBool(m, "referenceable")
+		if referenceable {
+			return name
+		}
+		if isServed && served == "" {
+			served = name
+		}
+	}
+	return served
+}
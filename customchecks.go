@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+)
+
+/*
+	site specific checks declared in the config file, run against every exported object of their kind just like the
+	built in ones - a check selects fields with a kubectl style jsonpath, and fails when they are there (or match a
+	pattern), or when they are missing
+*/
+
+const (
+	failPresent string = "present"
+	failAbsent  string = "absent"
+)
+
+type customCheck struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	// kubectl jsonpath, such as {.metadata.labels.team} or {.spec.template.spec.containers[*].image}
+	Path string `json:"path"`
+	// present (the default) fails objects where the path selects something, absent fails those where it doesn't
+	Fail string `json:"fail,omitempty"`
+	// with fail: present, only selected values matching this regular expression count
+	Pattern  string `json:"pattern,omitempty"`
+	Severity string `json:"severity"`
+	// text/template, with .Kind .Namespace .Name and .Values - the values the path selected
+	Message string `json:"message"`
+}
+
+type compiledCheck struct {
+	customCheck
+	path    *jsonpath.JSONPath
+	pattern *regexp.Regexp
+	message *template.Template
+}
+
+var customChecks []compiledCheck
+
+func parseCustomChecks(checks []customCheck) error {
+	customChecks = nil
+	seen := map[string]bool{}
+	for _, c := range checks {
+		if c.ID == "" || c.Kind == "" || c.Path == "" {
+			return fmt.Errorf("custom check %q: id, kind and path are required", c.ID)
+		}
+		if seen[c.ID] {
+			return fmt.Errorf("custom check %q is defined twice", c.ID)
+		}
+		seen[c.ID] = true
+		if c.Fail == "" {
+			c.Fail = failPresent
+		}
+		if c.Fail != failPresent && c.Fail != failAbsent {
+			return fmt.Errorf("custom check %s: unsupported fail %q: expected present or absent", c.ID, c.Fail)
+		}
+		if c.Severity == "" {
+			c.Severity = severityLow
+		}
+		if err := validateSeverity(c.Severity); err != nil {
+			return fmt.Errorf("custom check %s: %w", c.ID, err)
+		}
+
+		compiled := compiledCheck{customCheck: c}
+		// a missing field is what absent checks look for, so it can't be an error
+		compiled.path = jsonpath.New(c.ID).AllowMissingKeys(true)
+		if err := compiled.path.Parse(c.Path); err != nil {
+			return fmt.Errorf("custom check %s: invalid path; %w", c.ID, err)
+		}
+		if c.Pattern != "" {
+			re, err := regexp.Compile(c.Pattern)
+			if err != nil {
+				return fmt.Errorf("custom check %s: invalid pattern; %w", c.ID, err)
+			}
+			compiled.pattern = re
+		}
+		message := c.Message
+		if message == "" {
+			message = "failed custom check " + c.ID
+		}
+		t, err := template.New(c.ID).Option("missingkey=zero").Parse(message)
+		if err != nil {
+			return fmt.Errorf("custom check %s: invalid message; %w", c.ID, err)
+		}
+		compiled.message = t
+		customChecks = append(customChecks, compiled)
+	}
+	return nil
+}
+
+func (c compiledCheck) selected(obj map[string]interface{}) ([]string, error) {
+	results, err := c.path.FindResults(obj)
+	if err != nil {
+		return nil, err
+	}
+	values := []string{}
+	for _, r := range results {
+		for _, v := range r {
+			if !v.IsValid() || v.Interface() == nil {
+				continue
+			}
+			s := fmt.Sprint(v.Interface())
+			if s == "" {
+				continue
+			}
+			if c.pattern != nil && !c.pattern.MatchString(s) {
+				continue
+			}
+			values = append(values, s)
+		}
+	}
+	return values, nil
+}
+
+func runCustomChecks(objects []exportedObject) error {
+	if len(customChecks) == 0 {
+		return nil
+	}
+	for _, o := range objects {
+		var obj map[string]interface{}
+		for _, c := range customChecks {
+			if !strings.EqualFold(c.Kind, o.Kind) {
+				continue
+			}
+			// only objects some check is interested in are read back
+			if obj == nil {
+				data, err := readExported(o)
+				if err != nil {
+					return err
+				}
+				obj = map[string]interface{}{}
+				if err := yaml.Unmarshal(data, &obj); err != nil {
+					return fmt.Errorf("failed to read back %s; %w", o.Path, err)
+				}
+			}
+
+			values, err := c.selected(obj)
+			if err != nil {
+				return fmt.Errorf("custom check %s on %s; %w", c.ID, o.Path, err)
+			}
+			if (c.Fail == failPresent) != (len(values) > 0) {
+				continue
+			}
+			message := bytes.Buffer{}
+			err = c.message.Execute(&message, map[string]interface{}{
+				"Kind": o.Kind, "Namespace": o.Namespace, "Name": o.Name, "Values": strings.Join(values, ", "),
+			})
+			if err != nil {
+				return fmt.Errorf("custom check %s: %w", c.ID, err)
+			}
+			addExportedFinding(finding{
+				ID:        c.ID,
+				Severity:  c.Severity,
+				Kind:      o.Kind,
+				Namespace: o.Namespace,
+				Name:      o.Name,
+				Message:   message.String(),
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	cycloneDXFormat      string = "CycloneDX"
+	cycloneDXSpecVersion string = "1.4"
+	cycloneDXFile        string = "sbom.cdx.json"
+)
+
+type cdxBOM struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies,omitempty"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     []cdxTool    `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTool struct {
+	Vendor  string `json:"vendor"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type cdxComponent struct {
+	BOMRef     string         `json:"bom-ref"`
+	Type       string         `json:"type"`
+	Name       string         `json:"name"`
+	Version    string         `json:"version,omitempty"`
+	Group      string         `json:"group,omitempty"`
+	PURL       string         `json:"purl,omitempty"`
+	Properties []cdxProperty  `json:"properties,omitempty"`
+	Components []cdxComponent `json:"components,omitempty"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+func newSerialNumber() (string, error) {
+	// random (version 4) uuid, as recommended by the spec
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func splitImage(image string) (name, tag, digest string) {
+	/*
+		registry.example.com:5000/team/app:1.2@sha256:abcd -> registry.example.com:5000/team/app, 1.2, sha256:abcd
+		the tag separator is the last ':' after the final '/', so that registry ports are left alone
+	*/
+	name = image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, digest = name[:i], name[i+1:]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, tag = name[:i], name[i+1:]
+	}
+	return name, tag, digest
+}
+
+func imagePURL(image string) string {
+	// the oci purl type identifies images by digest, so there is no purl for images only referenced by tag
+	name, tag, digest := splitImage(image)
+	if digest == "" {
+		return ""
+	}
+	repository := name
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	purl := fmt.Sprintf("pkg:oci/%s@%s?repository_url=%s", name, strings.ReplaceAll(digest, ":", "%3A"), repository)
+	if tag != "" {
+		purl += "&tag=" + tag
+	}
+	return purl
+}
+
+func cycloneDXDocument(cluster string, deployments []appsv1.Deployment) (cdxBOM, error) {
+	/*
+		the cluster is the subject of the bom, each deployment is an application component, and every unique image
+		is a container component - the dependency graph records which application runs which images
+	*/
+	serial, err := newSerialNumber()
+	if err != nil {
+		return cdxBOM{}, err
+	}
+
+	bom := cdxBOM{
+		BOMFormat:    cycloneDXFormat,
+		SpecVersion:  cycloneDXSpecVersion,
+		SerialNumber: serial,
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Tools:     []cdxTool{{Vendor: siemVendor, Name: siemProduct, Version: version}},
+			Component: cdxComponent{BOMRef: "cluster", Type: "application", Name: cluster},
+		},
+	}
+
+	images := map[string]cdxComponent{}
+	for _, d := range deployments {
+		ref := "deployment:" + d.ObjectMeta.Namespace + "/" + d.ObjectMeta.Name
+		bom.Components = append(bom.Components, cdxComponent{
+			BOMRef: ref,
+			Type:   "application",
+			Name:   d.ObjectMeta.Name,
+			Group:  d.ObjectMeta.Namespace,
+			Properties: []cdxProperty{
+				{Name: "kube-scanner:kind", Value: "Deployment"},
+				{Name: "kube-scanner:namespace", Value: d.ObjectMeta.Namespace},
+			},
+		})
+
+		dependency := cdxDependency{Ref: ref, DependsOn: []string{}}
+		containers := []corev1.Container{}
+		containers = append(containers, d.Spec.Template.Spec.InitContainers...)
+		containers = append(containers, d.Spec.Template.Spec.Containers...)
+		for _, c := range containers {
+			imageRef := "image:" + c.Image
+			if _, ok := images[c.Image]; !ok {
+				name, tag, digest := splitImage(c.Image)
+				v := tag
+				if digest != "" {
+					v = digest
+				}
+				images[c.Image] = cdxComponent{BOMRef: imageRef, Type: "container", Name: name, Version: v, PURL: imagePURL(c.Image)}
+			}
+			dependency.DependsOn = append(dependency.DependsOn, imageRef)
+		}
+		bom.Dependencies = append(bom.Dependencies, dependency)
+	}
+
+	keys := []string{}
+	for k := range images {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		bom.Components = append(bom.Components, images[k])
+	}
+
+	return bom, nil
+}
+
+func writeCycloneDX(cluster string, deployments []appsv1.Deployment) error {
+	bom, err := cycloneDXDocument(cluster, deployments)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(bom, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeRootFile(cycloneDXFile, b)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+/*
+	a reference grafana dashboard for the metrics served with -metrics-addr, built from the same metric names so the
+	two can't drift apart - cluster and namespace are dashboard variables, so one dashboard covers a whole fleet
+*/
+
+type dashboardPanel struct {
+	Title   string
+	Type    string
+	Queries []string
+	// legend for every query, a grafana template such as {{cluster}}
+	Legend string
+	Unit   string
+	Format string
+}
+
+var dashboardPanels = []dashboardPanel{
+	{Title: "Last scan", Type: "stat", Queries: []string{fmt.Sprintf(`time() - %s{cluster=~"$cluster"}`, metricLastScan)}, Legend: "{{cluster}}", Unit: "s"},
+	{Title: "Scan succeeded", Type: "stat", Queries: []string{fmt.Sprintf(`%s{cluster=~"$cluster"}`, metricSuccess)}, Legend: "{{cluster}}"},
+	{Title: "Grade", Type: "table", Queries: []string{fmt.Sprintf(`%s{cluster=~"$cluster"}`, metricGrade)}, Format: "table"},
+	{Title: "Scan errors", Type: "stat", Queries: []string{fmt.Sprintf(`%s{cluster=~"$cluster"}`, metricScanErrors)}, Legend: "{{cluster}}"},
+	{Title: "Findings by severity", Type: "timeseries", Queries: []string{fmt.Sprintf(`sum by (cluster, severity) (%s{cluster=~"$cluster", namespace=~"$namespace"})`, metricFindings)}, Legend: "{{cluster}} {{severity}}"},
+	{Title: "Findings by check", Type: "table", Queries: []string{fmt.Sprintf(`sum by (cluster, namespace, check, severity) (%s{cluster=~"$cluster", namespace=~"$namespace"})`, metricFindings)}, Format: "table"},
+	{Title: "Drifted objects", Type: "timeseries", Queries: []string{fmt.Sprintf(`%s{cluster=~"$cluster"}`, metricDriftedObject)}, Legend: "{{cluster}}"},
+	{Title: "Exported objects by kind", Type: "timeseries", Queries: []string{fmt.Sprintf(`sum by (cluster, kind) (%s{cluster=~"$cluster", namespace=~"$namespace"})`, metricObjects)}, Legend: "{{cluster}} {{kind}}"},
+	{Title: "Scan duration", Type: "timeseries", Queries: []string{fmt.Sprintf(`%s{cluster=~"$cluster"}`, metricDuration)}, Legend: "{{cluster}}", Unit: "s"},
+}
+
+func grafanaDashboard() map[string]interface{} {
+	datasource := map[string]string{"type": "prometheus", "uid": "${datasource}"}
+	panels := []map[string]interface{}{}
+	for i, p := range dashboardPanels {
+		targets := []map[string]interface{}{}
+		for j, q := range p.Queries {
+			t := map[string]interface{}{"refId": string(rune('A' + j)), "expr": q, "datasource": datasource}
+			if p.Legend != "" {
+				t["legendFormat"] = p.Legend
+			}
+			if p.Format != "" {
+				t["format"] = p.Format
+				t["instant"] = true
+			}
+			targets = append(targets, t)
+		}
+		// two panels of half the width per row, wide enough for the tables
+		panel := map[string]interface{}{
+			"id":         i + 1,
+			"title":      p.Title,
+			"type":       p.Type,
+			"datasource": datasource,
+			"targets":    targets,
+			"gridPos":    map[string]int{"h": 8, "w": 12, "x": (i % 2) * 12, "y": (i / 2) * 8},
+		}
+		if p.Unit != "" {
+			panel["fieldConfig"] = map[string]interface{}{"defaults": map[string]string{"unit": p.Unit}, "overrides": []interface{}{}}
+		}
+		panels = append(panels, panel)
+	}
+
+	variable := func(name, query string) map[string]interface{} {
+		return map[string]interface{}{
+			"name":       name,
+			"type":       "query",
+			"datasource": datasource,
+			"query":      query,
+			"definition": query,
+			"refresh":    2,
+			"multi":      true,
+			"includeAll": true,
+			"allValue":   ".*",
+			"current":    map[string]interface{}{"text": "All", "value": "$__all"},
+		}
+	}
+	return map[string]interface{}{
+		"title":         "kube-scanner",
+		"uid":           "kube-scanner",
+		"tags":          []string{"kube-scanner"},
+		"schemaVersion": 36,
+		"refresh":       "5m",
+		"time":          map[string]string{"from": "now-7d", "to": "now"},
+		"panels":        panels,
+		"templating": map[string]interface{}{
+			"list": []interface{}{
+				map[string]interface{}{"name": "datasource", "type": "datasource", "query": "prometheus"},
+				variable("cluster", fmt.Sprintf("label_values(%s, cluster)", metricLastScan)),
+				variable("namespace", fmt.Sprintf(`label_values(%s{cluster=~"$cluster"}, namespace)`, metricObjects)),
+			},
+		},
+	}
+}
+
+func runDashboard(args []string) error {
+	fs := flag.NewFlagSet("dashboard", flag.ExitOnError)
+	out := fs.String("out", "", "file to write the dashboard json to, defaults to stdout")
+	fs.Parse(args)
+
+	b, err := json.MarshalIndent(grafanaDashboard(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		fmt.Println(string(b))
+		return nil
+	}
+	return os.WriteFile(*out, append(b, '\n'), 0644)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/nicgrobler/k8s/result"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+/*
+	a scanner allowed to list in some namespaces but not cluster-wide doesn't fail the scan: when listing something
+	from the whole cluster is forbidden, it is listed from every namespace the scanner can see instead, one at a
+	time. namespaces it may not list in are left out, recorded as errors and in reports/inaccessible-namespaces.json,
+	so that the export says what it is missing. this needs list on namespaces, without it the forbidden list fails
+	the scan as before. cluster scoped types can't be listed by namespace, and still need cluster-wide access
+*/
+
+const inaccessibleNamespacesReport string = "reports/inaccessible-namespaces.json"
+
+var (
+	namespaceSource kubernetes.Interface
+	// listed once, by the first list which needed them
+	visibleNamespaces []corev1.Namespace
+	// resources which couldn't be listed, by namespace
+	inaccessible   map[string][]string
+	inaccessibleMu sync.Mutex
+)
+
+func startDegradedMode(clientset kubernetes.Interface) {
+	inaccessibleMu.Lock()
+	defer inaccessibleMu.Unlock()
+	namespaceSource, visibleNamespaces, inaccessible = clientset, nil, map[string][]string{}
+}
+
+func listNamespaceObjects() ([]corev1.Namespace, error) {
+	inaccessibleMu.Lock()
+	defer inaccessibleMu.Unlock()
+	if visibleNamespaces != nil {
+		return visibleNamespaces, nil
+	}
+	if namespaceSource == nil {
+		return nil, fmt.Errorf("no client to list namespaces with")
+	}
+	list, err := namespaceSource.CoreV1().Namespaces().List(context.TODO(), listOptions())
+	if err != nil {
+		return nil, err
+	}
+	recordListed("namespaces", len(list.Items))
+	visibleNamespaces = list.Items
+	return visibleNamespaces, nil
+}
+
+func listNamespaces() ([]string, error) {
+	list, err := listNamespaceObjects()
+	names := []string{}
+	for _, ns := range list {
+		names = append(names, ns.ObjectMeta.Name)
+	}
+	return names, err
+}
+
+func listPerNamespace(resource string, list func(namespace string) error) error {
+	// list appends what it found, it is called for the whole cluster first, and for each namespace when forbidden
+	err := list(scanNamespace)
+	if scanNamespace != "" || !apierrors.IsForbidden(err) {
+		return err
+	}
+	namespaces, nerr := listNamespaces()
+	if nerr != nil {
+		return fmt.Errorf("%w, and can't list namespaces to list it from one at a time: %v", err, nerr)
+	}
+	log.Printf("no permission to list %s cluster-wide, listing it from %d namespaces one at a time", resource, len(namespaces))
+	for _, namespace := range namespaces {
+		if isSkippedNamespace(namespace) {
+			continue
+		}
+		nsErr := list(namespace)
+		switch {
+		case apierrors.IsNotFound(nsErr):
+			// cluster scoped, which can only be listed cluster-wide
+			return err
+		case apierrors.IsForbidden(nsErr):
+			recordInaccessible(namespace, resource, nsErr)
+		case nsErr != nil:
+			return nsErr
+		}
+	}
+	return nil
+}
+
+func recordInaccessible(namespace, resource string, err error) {
+	inaccessibleMu.Lock()
+	inaccessible[namespace] = append(inaccessible[namespace], resource)
+	inaccessibleMu.Unlock()
+	recordError(&result.ObjectRef{APIVersion: "v1", Kind: "Namespace", Name: namespace}, fmt.Errorf("no permission to list %s; %w", resource, err))
+}
+
+type inaccessibleNamespace struct {
+	Namespace string   `json:"namespace"`
+	Resources []string `json:"resources"`
+}
+
+func writeInaccessibleNamespaces() error {
+	inaccessibleMu.Lock()
+	entries := []inaccessibleNamespace{}
+	for namespace, resources := range inaccessible {
+		entries = append(entries, inaccessibleNamespace{Namespace: namespace, Resources: resources})
+	}
+	inaccessibleMu.Unlock()
+	if len(entries) == 0 {
+		return nil
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Namespace < entries[j].Namespace })
+	log.Printf("warning: %d namespaces could not be read, see %s", len(entries), inaccessibleNamespacesReport)
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeRootFile(inaccessibleNamespacesReport, b)
+}
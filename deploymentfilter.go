@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+/*
+	the rbac export only keeps what was granted to the rolestring, the deployment export can be scoped the same
+	way: by the service account a deployment runs as, and to the namespaces holding a matched binding. every filter
+	a deployment has to pass is a deploymentFilter, new ones only need adding to deploymentFilters. cluster bindings
+	grant in every namespace, so they don't make a namespace bound
+
+	-bound-namespaces-only goes further, leaving every namespace without a matched binding out of the snapshot: the
+	deployments, and the namespaced objects of presets other than those of rbac. cluster scoped objects stay
+*/
+
+// the namespaces holding a matched binding, nil unless -bound-namespaces-only is set
+var boundScope map[string]bool
+
+func setBoundScope(enabled bool, matchedBindings []rbacv1.RoleBinding) {
+	boundScope = nil
+	if enabled {
+		boundScope = boundNamespaces(matchedBindings)
+		log.Printf("exporting from the %d namespaces holding a matched binding", len(boundScope))
+	}
+}
+
+func outOfBoundScope(namespace, group string) bool {
+	return boundScope != nil && namespace != "" && group != rbacv1.GroupName && !boundScope[namespace]
+}
+
+type deploymentFilter struct {
+	name string
+	keep func(d appsv1.Deployment) bool
+}
+
+func deploymentFilters(opts scanOptions, matchedBindings []rbacv1.RoleBinding) []deploymentFilter {
+	filters := []deploymentFilter{}
+	if patterns := splitPatterns(opts.deploymentSAs); len(patterns) > 0 {
+		filters = append(filters, deploymentFilter{name: "service account", keep: func(d appsv1.Deployment) bool {
+			return matchesAnyPattern(patterns, deploymentServiceAccount(d))
+		}})
+	}
+	if opts.boundOnly || boundScope != nil {
+		bound := boundNamespaces(matchedBindings)
+		filters = append(filters, deploymentFilter{name: "bound namespace", keep: func(d appsv1.Deployment) bool {
+			return bound[d.ObjectMeta.Namespace]
+		}})
+	}
+	return filters
+}
+
+func filterDeployments(deployments []appsv1.Deployment, filters []deploymentFilter) []appsv1.Deployment {
+	if len(filters) == 0 {
+		return deployments
+	}
+	kept := []appsv1.Deployment{}
+	dropped := map[string]int{}
+	for _, d := range deployments {
+		keep := true
+		for _, f := range filters {
+			if !f.keep(d) {
+				dropped[f.name]++
+				keep = false
+				break
+			}
+		}
+		if keep {
+			kept = append(kept, d)
+		}
+	}
+	for _, f := range filters {
+		if dropped[f.name] > 0 {
+			log.Printf("left out %d deployments by %s", dropped[f.name], f.name)
+		}
+	}
+	return kept
+}
+
+func deploymentServiceAccount(d appsv1.Deployment) string {
+	if sa := d.Spec.Template.Spec.ServiceAccountName; sa != "" {
+		return sa
+	}
+	return "default"
+}
+
+func boundNamespaces(bindings []rbacv1.RoleBinding) map[string]bool {
+	bound := map[string]bool{}
+	for _, b := range bindings {
+		bound[b.ObjectMeta.Namespace] = true
+	}
+	return bound
+}
+
+func splitPatterns(list string) []string {
+	patterns := []string{}
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+func validatePatterns(flagName, list string) error {
+	for _, p := range splitPatterns(list) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid %s pattern %q", flagName, p)
+		}
+	}
+	return nil
+}
+
+func matchesAnyPattern(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+/*
+	compare two exports of the same cluster and list what was added, removed or changed, field by field - fields
+	which change without anyone changing them (controller bookkeeping, replicas driven by an autoscaler) are ignored
+	so that what's left is worth looking at
+*/
+
+// fields written by the api server or controllers, which are never drift
+var defaultDriftIgnores = []driftIgnore{
+	{Path: "status"},
+	{Path: "metadata.resourceVersion"},
+	{Path: "metadata.generation"},
+	{Path: "metadata.uid"},
+	{Path: "metadata.creationTimestamp"},
+	{Path: "metadata.managedFields"},
+	{Path: "metadata.annotations.deployment.kubernetes.io/revision"},
+	{Path: "metadata.annotations.kubectl.kubernetes.io/last-applied-configuration"},
+	// written by -annotate-namespaces on every run
+	{Kind: "Namespace", Path: "metadata.annotations." + lastScanAnnotation},
+	{Kind: "Namespace", Path: "metadata.annotations." + lastScanSummaryAnnotation},
+}
+
+type driftConfig struct {
+	// fields left out of the comparison, on top of the defaults
+	Ignore []driftIgnore `json:"ignore,omitempty"`
+}
+
+type driftIgnore struct {
+	// kind the path applies to, every kind when empty
+	Kind string `json:"kind,omitempty"`
+	// dotted path to the field, such as spec.replicas - [*] matches any list index, and a path covers everything below it
+	Path string `json:"path"`
+}
+
+type fieldChange struct {
+	Path string `json:"path"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+type objectDrift struct {
+	Change string `json:"change"`
+	// see objectkeys.go, of the newer object when its api version changed
+	Key       string        `json:"key"`
+	Kind      string        `json:"kind"`
+	Namespace string        `json:"namespace,omitempty"`
+	Name      string        `json:"name"`
+	Fields    []fieldChange `json:"fields,omitempty"`
+	// driftKey of the object, to find it again in either snapshot
+	key string
+}
+
+var listIndex = regexp.MustCompile(`\[[0-9]+\]`)
+
+func (i driftIgnore) matches(kind, field string) bool {
+	if i.Kind != "" && !strings.EqualFold(i.Kind, kind) {
+		return false
+	}
+	for _, p := range []string{field, listIndex.ReplaceAllString(field, "[*]")} {
+		if p == i.Path || strings.HasPrefix(p, i.Path+".") || strings.HasPrefix(p, i.Path+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+func flattenFields(prefix string, v interface{}, out map[string]string) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, child := range value {
+			p := k
+			if prefix != "" {
+				p = prefix + "." + k
+			}
+			flattenFields(p, child, out)
+		}
+	case []interface{}:
+		for i, child := range value {
+			flattenFields(fmt.Sprintf("%s[%d]", prefix, i), child, out)
+		}
+	default:
+		b, _ := json.Marshal(value)
+		out[prefix] = string(b)
+	}
+}
+
+func (o snapshotObject) key() string {
+	return objectKey(o.apiVersion(), o.kind(), o.metadata("namespace"), o.metadata("name"))
+}
+
+func driftKey(o snapshotObject) string {
+	// the group is part of the key, kinds are only unique within one
+	group := ""
+	if parts := strings.SplitN(o.apiVersion(), "/", 2); len(parts) == 2 {
+		group = parts[0]
+	}
+	return strings.Join([]string{group, o.kind(), o.metadata("namespace"), o.metadata("name")}, "/")
+}
+
+func objectFields(o snapshotObject, ignores []driftIgnore) map[string]string {
+	all := map[string]string{}
+	flattenFields("", o.Object, all)
+	fields := map[string]string{}
+	for p, v := range all {
+		ignored := false
+		for _, i := range ignores {
+			if i.matches(o.kind(), p) {
+				ignored = true
+				break
+			}
+		}
+		if !ignored {
+			fields[p] = v
+		}
+	}
+	return fields
+}
+
+func driftBetween(before, after []snapshotObject, ignores []driftIgnore) []objectDrift {
+	old := map[string]snapshotObject{}
+	for _, o := range before {
+		old[driftKey(o)] = o
+	}
+	current := map[string]snapshotObject{}
+	for _, o := range after {
+		current[driftKey(o)] = o
+	}
+
+	keys := map[string]bool{}
+	for k := range old {
+		keys[k] = true
+	}
+	for k := range current {
+		keys[k] = true
+	}
+
+	drift := []objectDrift{}
+	for _, k := range sortedKeys(keys) {
+		o, wasThere := old[k]
+		n, isThere := current[k]
+		switch {
+		case !isThere:
+			drift = append(drift, objectDrift{key: k, Key: o.key(), Change: "removed", Kind: o.kind(), Namespace: o.metadata("namespace"), Name: o.metadata("name")})
+		case !wasThere:
+			drift = append(drift, objectDrift{key: k, Key: n.key(), Change: "added", Kind: n.kind(), Namespace: n.metadata("namespace"), Name: n.metadata("name")})
+		default:
+			oldFields, newFields := objectFields(o, ignores), objectFields(n, ignores)
+			paths := map[string]bool{}
+			for p := range oldFields {
+				paths[p] = true
+			}
+			for p := range newFields {
+				paths[p] = true
+			}
+			changes := []fieldChange{}
+			for _, p := range sortedKeys(paths) {
+				if oldFields[p] != newFields[p] {
+					changes = append(changes, fieldChange{Path: p, Old: oldFields[p], New: newFields[p]})
+				}
+			}
+			if len(changes) > 0 {
+				drift = append(drift, objectDrift{key: k, Key: n.key(), Change: "changed", Kind: n.kind(), Namespace: n.metadata("namespace"), Name: n.metadata("name"), Fields: changes})
+			}
+		}
+	}
+	return drift
+}
+
+func printDrift(drift []objectDrift) {
+	marks := map[string]string{"added": "+", "removed": "-", "changed": "~"}
+	for _, d := range drift {
+		fmt.Printf("%s %s\n", marks[d.Change], d.Key)
+		for _, f := range d.Fields {
+			from, to := f.Old, f.New
+			if from == "" {
+				from = "(unset)"
+			}
+			if to == "" {
+				to = "(unset)"
+			}
+			fmt.Printf("    %s: %s -> %s\n", f.Path, from, to)
+		}
+	}
+}
+
+func driftIgnores(configFile, list string) ([]driftIgnore, error) {
+	// the defaults, those in the config's drift.ignore and those of an -ignore flag
+	c, err := loadConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+	ignores := append([]driftIgnore{}, defaultDriftIgnores...)
+	ignores = append(ignores, c.Drift.Ignore...)
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		i := driftIgnore{Path: entry}
+		// paths start with a lowercase field, kinds with an uppercase letter
+		if parts := strings.SplitN(entry, ":", 2); len(parts) == 2 && parts[0] != "" && parts[0][:1] == strings.ToUpper(parts[0][:1]) {
+			i = driftIgnore{Kind: parts[0], Path: parts[1]}
+		}
+		ignores = append(ignores, i)
+	}
+	return ignores, nil
+}
+
+func runDrift(args []string) error {
+	fs := flag.NewFlagSet("drift", flag.ExitOnError)
+	configFile := fs.String("config", "", "(optional) config file whose drift.ignore lists further fields to leave out")
+	ignore := fs.String("ignore", "", "(optional) comma separated fields to leave out, each a path or kind:path, such as Deployment:spec.replicas")
+	asJSON := fs.Bool("json", false, "(optional) write the drift as json instead of text")
+	exitCode := fs.Bool("exit-code", false, "(optional) exit with status 1 when anything drifted")
+	htmlFile := fs.String("html", "", "(optional) also write an html report with side by side diffs of every drifted object to this file")
+	latest := fs.Bool("latest", false, "(optional) compare the two most recent snapshots under the one directory given, such as a collector store")
+	timezone, timeFormat := timeFlags(fs)
+	fs.Parse(args)
+
+	if err := setReportTime(*timezone, *timeFormat); err != nil {
+		return err
+	}
+	usage := errors.New("usage: drift [-config file] [-ignore paths] [-json] [-html file] <old-dir> <new-dir> | drift -latest [flags] <directory of snapshots>")
+	oldDir, newDir := fs.Arg(0), fs.Arg(1)
+	switch {
+	case *latest && fs.NArg() == 1:
+		var err error
+		if oldDir, newDir, err = latestSnapshots(fs.Arg(0)); err != nil {
+			return err
+		}
+	case *latest || fs.NArg() != 2:
+		return usage
+	}
+
+	ignores, err := driftIgnores(*configFile, *ignore)
+	if err != nil {
+		return err
+	}
+
+	before, err := readSnapshot(oldDir)
+	if err != nil {
+		return err
+	}
+	after, err := readSnapshot(newDir)
+	if err != nil {
+		return err
+	}
+	drift := driftBetween(before, after, ignores)
+	if *htmlFile != "" {
+		if err := writeDriftHTML(*htmlFile, oldDir, newDir, before, after, drift, ignores); err != nil {
+			return err
+		}
+	}
+
+	if *asJSON {
+		b, err := json.MarshalIndent(drift, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	} else {
+		printDrift(drift)
+	}
+	if *exitCode && len(drift) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
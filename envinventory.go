@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	envInventoryReport string = "reports/env-inventory"
+	maskedValue        string = "****"
+)
+
+type envEntry struct {
+	Namespace  string `json:"namespace"`
+	Deployment string `json:"deployment"`
+	Container  string `json:"container"`
+	Name       string `json:"name"`
+	Source     string `json:"source"`
+	Value      string `json:"value,omitempty"`
+}
+
+// how often a variable is set across workloads, and to how many different values - the values themselves stay out
+type envVariable struct {
+	Name           string `json:"name"`
+	Containers     int    `json:"containers"`
+	DistinctValues int    `json:"distinctValues"`
+}
+
+func isAllowedEnv(name string, allowed []string) bool {
+	for _, pattern := range allowed {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func envSource(e corev1.EnvVar) string {
+	// references only name where a value comes from, which is never secret in itself
+	switch {
+	case e.ValueFrom == nil:
+		return "value"
+	case e.ValueFrom.SecretKeyRef != nil:
+		return "secret " + e.ValueFrom.SecretKeyRef.Name + "/" + e.ValueFrom.SecretKeyRef.Key
+	case e.ValueFrom.ConfigMapKeyRef != nil:
+		return "configmap " + e.ValueFrom.ConfigMapKeyRef.Name + "/" + e.ValueFrom.ConfigMapKeyRef.Key
+	case e.ValueFrom.FieldRef != nil:
+		return "field " + e.ValueFrom.FieldRef.FieldPath
+	case e.ValueFrom.ResourceFieldRef != nil:
+		return "resource " + e.ValueFrom.ResourceFieldRef.Resource
+	}
+	return "unknown"
+}
+
+func envInventory(deployments []appsv1.Deployment, allowed []string) ([]envEntry, []envVariable) {
+	entries := []envEntry{}
+	containers := map[string]int{}
+	values := map[string]map[string]bool{}
+
+	for _, d := range deployments {
+		all := []corev1.Container{}
+		all = append(all, d.Spec.Template.Spec.InitContainers...)
+		all = append(all, d.Spec.Template.Spec.Containers...)
+		for _, c := range all {
+			entry := envEntry{Namespace: d.ObjectMeta.Namespace, Deployment: d.ObjectMeta.Name, Container: c.Name}
+			for _, from := range c.EnvFrom {
+				e := entry
+				e.Name = from.Prefix + "*"
+				switch {
+				case from.SecretRef != nil:
+					e.Source = "secret " + from.SecretRef.Name
+				case from.ConfigMapRef != nil:
+					e.Source = "configmap " + from.ConfigMapRef.Name
+				}
+				entries = append(entries, e)
+			}
+			for _, env := range c.Env {
+				e := entry
+				e.Name = env.Name
+				e.Source = envSource(env)
+				if env.ValueFrom == nil {
+					e.Value = maskedValue
+					if isAllowedEnv(env.Name, allowed) {
+						e.Value = env.Value
+					}
+				}
+				entries = append(entries, e)
+
+				containers[env.Name]++
+				if values[env.Name] == nil {
+					values[env.Name] = map[string]bool{}
+				}
+				values[env.Name][e.Source+"="+env.Value] = true
+			}
+		}
+	}
+
+	variables := []envVariable{}
+	for name, n := range containers {
+		variables = append(variables, envVariable{Name: name, Containers: n, DistinctValues: len(values[name])})
+	}
+	sort.Slice(variables, func(i, j int) bool {
+		if variables[i].Containers != variables[j].Containers {
+			return variables[i].Containers > variables[j].Containers
+		}
+		return variables[i].Name < variables[j].Name
+	})
+	return entries, variables
+}
+
+func writeEnvInventory(deployments []appsv1.Deployment, allowList string) error {
+	allowed := []string{}
+	for _, a := range strings.Split(allowList, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			allowed = append(allowed, a)
+		}
+	}
+	entries, variables := envInventory(deployments, allowed)
+
+	buffer := bytes.Buffer{}
+	w := csv.NewWriter(&buffer)
+	w.Write([]string{"namespace", "deployment", "container", "name", "source", "value"})
+	for _, e := range entries {
+		w.Write([]string{e.Namespace, e.Deployment, e.Container, e.Name, e.Source, e.Value})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if err := writeRootFile(envInventoryReport+".csv", buffer.Bytes()); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(map[string]interface{}{"variables": variables, "entries": entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeRootFile(envInventoryReport+".json", b)
+}
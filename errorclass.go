@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/nicgrobler/k8s/result"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+/*
+	every error that doesn't stop a run is put in a class - auth, not-found, throttled, serialization or io - so
+	what is built around the scanner can tell a missing permission from a busy api server from a full disk, without
+	grepping logs. the classes are counted, with the objects they affected, in the summary of result.json and in
+	status.json, and the error that stopped a run is classified the same way
+*/
+
+func classifyError(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case apierrors.IsUnauthorized(err), apierrors.IsForbidden(err):
+		return result.ErrorAuth
+	case apierrors.IsNotFound(err):
+		return result.ErrorNotFound
+	case apierrors.IsTooManyRequests(err), apierrors.IsServerTimeout(err):
+		return result.ErrorThrottled
+	case isSerializationError(err):
+		return result.ErrorSerialization
+	case isIOError(err):
+		return result.ErrorIO
+	}
+	return result.ErrorOther
+}
+
+func isSerializationError(err error) bool {
+	var syntax *json.SyntaxError
+	var unmarshalType *json.UnmarshalTypeError
+	var marshaler *json.MarshalerError
+	var unsupported *json.UnsupportedTypeError
+	if errors.As(err, &syntax) || errors.As(err, &unmarshalType) || errors.As(err, &marshaler) || errors.As(err, &unsupported) {
+		return true
+	}
+	if runtime.IsNotRegisteredError(err) || runtime.IsMissingKind(err) || runtime.IsMissingVersion(err) {
+		return true
+	}
+	// sigs.k8s.io/yaml doesn't wrap what it fails on
+	msg := err.Error()
+	return strings.Contains(msg, "error converting YAML to JSON") || strings.Contains(msg, "error unmarshaling JSON")
+}
+
+func isIOError(err error) bool {
+	var path *fs.PathError
+	var link *os.LinkError
+	var netErr net.Error
+	return errors.As(err, &path) || errors.As(err, &link) || errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func errorSummary(errs []result.Error) []result.ErrorClassSummary {
+	byClass := map[string]*result.ErrorClassSummary{}
+	for _, e := range errs {
+		s := byClass[e.Class]
+		if s == nil {
+			s = &result.ErrorClassSummary{Class: e.Class, Objects: []result.ObjectRef{}}
+			byClass[e.Class] = s
+		}
+		s.Count++
+		if e.Object != nil {
+			s.Objects = append(s.Objects, *e.Object)
+		}
+	}
+	summary := []result.ErrorClassSummary{}
+	for _, s := range byClass {
+		summary = append(summary, *s)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Count != summary[j].Count {
+			return summary[i].Count > summary[j].Count
+		}
+		return summary[i].Class < summary[j].Class
+	})
+	return summary
+}
+
+func errorClassCounts() map[string]int {
+	resultMu.Lock()
+	defer resultMu.Unlock()
+	counts := map[string]int{}
+	for _, e := range scanErrors {
+		counts[e.Class]++
+	}
+	return counts
+}
+
+func logErrorSummary() {
+	resultMu.Lock()
+	summary := errorSummary(scanErrors)
+	resultMu.Unlock()
+	if len(summary) == 0 {
+		return
+	}
+	parts := []string{}
+	for _, s := range summary {
+		parts = append(parts, fmt.Sprintf("%d %s", s.Count, s.Class))
+	}
+	log.Printf("export may be incomplete, errors: %s", strings.Join(parts, ", "))
+}
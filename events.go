@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nicgrobler/k8s/result"
+)
+
+const (
+	eventsFile string = "events.jsonl"
+
+	eventListed  string = "listed"
+	eventMatched string = "matched"
+	eventWrote   string = "wrote"
+	eventError   string = "error"
+	// left alone because of the .kubescannerignore
+	eventIgnored string = "ignored"
+	// not written again, see -skip-unchanged
+	eventUnchanged string = "unchanged"
+)
+
+// one line of events.jsonl - every action of a run, in the order they happened
+type scanEvent struct {
+	Time     time.Time         `json:"time"`
+	Action   string            `json:"action"`
+	Resource string            `json:"resource,omitempty"`
+	Object   *result.ObjectRef `json:"object,omitempty"`
+	Count    int               `json:"count,omitempty"`
+	Path     string            `json:"path,omitempty"`
+	Message  string            `json:"message,omitempty"`
+}
+
+var (
+	scanEvents   []scanEvent
+	scanEventsMu sync.Mutex
+)
+
+func recordEvent(e scanEvent) {
+	e.Time = time.Now().UTC()
+	e.Object = keyedRef(e.Object)
+	scanEventsMu.Lock()
+	defer scanEventsMu.Unlock()
+	scanEvents = append(scanEvents, e)
+}
+
+func recordListed(resource string, count int) {
+	recordEvent(scanEvent{Action: eventListed, Resource: resource, Count: count})
+}
+
+func recordMatched(obj result.ObjectRef) {
+	recordEvent(scanEvent{Action: eventMatched, Object: &obj})
+}
+
+func resetEvents() {
+	scanEventsMu.Lock()
+	defer scanEventsMu.Unlock()
+	scanEvents = nil
+}
+
+func writeEvents() error {
+	scanEventsMu.Lock()
+	buffer := bytes.Buffer{}
+	enc := json.NewEncoder(&buffer)
+	for _, e := range scanEvents {
+		if err := enc.Encode(e); err != nil {
+			scanEventsMu.Unlock()
+			return err
+		}
+	}
+	scanEventsMu.Unlock()
+
+	// not through writeRootFile, which would record writing the event log in the event log
+	if isIgnoredPath(eventsFile) {
+		return nil
+	}
+	file := filepath.Join(outputDirectory, eventsFile)
+	if err := output.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+	return output.WriteFile(file, buffer.Bytes(), os.ModePerm)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nicgrobler/k8s/result"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+)
+
+/*
+	explain prints what a check looks for and why, and how to fix what it found - the text lives in rules/, one file
+	per check, compiled into the binary. given an export, it also shows the fields of every object the check flagged
+*/
+
+//go:embed rules/*.yaml
+var ruleFiles embed.FS
+
+type ruleInfo struct {
+	ID       string   `json:"id"`
+	Title    string   `json:"title"`
+	Severity string   `json:"severity"`
+	Kinds    []string `json:"kinds"`
+	// why it matters
+	Rationale string `json:"rationale"`
+	// jsonpaths to the fields the check looks at
+	Fields      []string `json:"fields"`
+	Remediation string   `json:"remediation"`
+}
+
+func loadRules() (map[string]ruleInfo, error) {
+	rules := map[string]ruleInfo{}
+	entries, err := ruleFiles.ReadDir("rules")
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		b, err := ruleFiles.ReadFile(path.Join("rules", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		r := ruleInfo{}
+		if err := yaml.UnmarshalStrict(b, &r); err != nil {
+			return nil, fmt.Errorf("rules/%s: %w", e.Name(), err)
+		}
+		rules[r.ID] = r
+	}
+	return rules, nil
+}
+
+func customRuleInfo(c customCheck) ruleInfo {
+	fail := c.Fail
+	if fail == "" {
+		fail = failPresent
+	}
+	rationale := fmt.Sprintf("Fails %s objects where %s is %s", c.Kind, c.Path, fail)
+	if c.Pattern != "" && fail == failPresent {
+		rationale += fmt.Sprintf(" and matches %s", c.Pattern)
+	}
+	return ruleInfo{ID: c.ID, Title: "site specific check from the config file", Severity: c.Severity, Kinds: []string{c.Kind}, Rationale: rationale + ".\n", Fields: []string{c.Path}}
+}
+
+func printRule(r ruleInfo) {
+	fmt.Printf("%s: %s\n", r.ID, r.Title)
+	fmt.Printf("severity: %s\n", r.Severity)
+	if len(r.Kinds) > 0 {
+		fmt.Printf("kinds: %s\n", strings.Join(r.Kinds, ", "))
+	}
+	fmt.Printf("\n%s", r.Rationale)
+	if len(r.Fields) > 0 {
+		fmt.Printf("\nfields checked:\n")
+		for _, f := range r.Fields {
+			fmt.Printf("  %s\n", f)
+		}
+	}
+	if r.Remediation != "" {
+		fmt.Printf("\nremediation:\n")
+		for _, line := range strings.Split(strings.TrimRight(r.Remediation, "\n"), "\n") {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+}
+
+func fieldValues(obj map[string]interface{}, field string) (string, error) {
+	jp := jsonpath.New(field).AllowMissingKeys(true)
+	if err := jp.Parse(field); err != nil {
+		return "", err
+	}
+	results, err := jp.FindResults(obj)
+	if err != nil {
+		return "", err
+	}
+	values := []string{}
+	for _, r := range results {
+		for _, v := range r {
+			if !v.IsValid() {
+				continue
+			}
+			b, err := json.Marshal(v.Interface())
+			if err != nil {
+				return "", err
+			}
+			values = append(values, string(b))
+		}
+	}
+	if len(values) == 0 {
+		return "(not set)", nil
+	}
+	return strings.Join(values, " "), nil
+}
+
+func printInstances(r ruleInfo, dir string) error {
+	f, err := os.Open(filepath.Join(dir, result.FileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	res, err := result.Decode(f)
+	if err != nil {
+		return err
+	}
+
+	paths := map[string]string{}
+	for _, o := range res.Objects {
+		paths[o.Kind+"/"+o.Namespace+"/"+o.Name] = o.Path
+	}
+	instances := []result.Finding{}
+	for _, finding := range res.Findings {
+		if finding.ID == r.ID {
+			instances = append(instances, finding)
+		}
+	}
+	sort.SliceStable(instances, func(i, j int) bool {
+		return instances[i].Object.Namespace+"/"+instances[i].Object.Name < instances[j].Object.Namespace+"/"+instances[j].Object.Name
+	})
+	fmt.Printf("\nfound in %s: %d\n", dir, len(instances))
+
+	for _, finding := range instances {
+		name := finding.Object.Name
+		if finding.Object.Namespace != "" {
+			name = finding.Object.Namespace + "/" + name
+		}
+		fmt.Printf("\n  %s %s: %s\n", finding.Object.Kind, name, finding.Message)
+
+		// the fields come from the exported object, when the object itself was exported
+		p, ok := paths[finding.Object.Kind+"/"+finding.Object.Namespace+"/"+finding.Object.Name]
+		if !ok {
+			continue
+		}
+		data, err := readExported(exportedObject{Path: p})
+		if err != nil {
+			return err
+		}
+		obj := map[string]interface{}{}
+		if err := yaml.Unmarshal(data, &obj); err != nil {
+			return fmt.Errorf("failed to read %s; %w", p, err)
+		}
+		for _, field := range r.Fields {
+			value, err := fieldValues(obj, field)
+			if err != nil {
+				return fmt.Errorf("%s: %w", field, err)
+			}
+			fmt.Printf("    %s = %s\n", field, value)
+		}
+	}
+	return nil
+}
+
+func runExplain(args []string) error {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	fromDir := fs.String("from-dir", defaultOutputDir, "(optional) export whose findings of the check to show, skipped when it holds no result")
+	configFile := fs.String("config", "", "(optional) config file, so that its custom checks can be explained too")
+	dataDir := fs.String("data-dir", "", "(optional) vendored data directory, so that the custom checks of its policies can be explained too")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: explain [-from-dir dir] [-config file] [-data-dir dir] <finding-id>")
+	}
+	id := fs.Arg(0)
+
+	rules, err := loadRules()
+	if err != nil {
+		return err
+	}
+	c, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	policies, err := loadDataDir(*dataDir)
+	if err != nil {
+		return err
+	}
+	for _, custom := range append(c.Checks.Custom, policies...) {
+		if _, builtin := rules[custom.ID]; !builtin {
+			rules[custom.ID] = customRuleInfo(custom)
+		}
+	}
+
+	r, ok := rules[id]
+	if !ok {
+		ids := map[string]bool{}
+		for known := range rules {
+			ids[known] = true
+		}
+		return fmt.Errorf("unknown finding %q: expected one of %s", id, strings.Join(sortedKeys(ids), ", "))
+	}
+	printRule(r)
+
+	// readExported works relative to the output directory
+	outputDirectory = *fromDir
+	return printInstances(r, *fromDir)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const exposureReport string = "reports/exposure"
+
+var openshiftRoutes = schema.GroupVersionResource{Group: "route.openshift.io", Version: "v1", Resource: "routes"}
+
+// annotations asking the cloud provider for a load balancer only reachable from inside the network
+var internalLoadBalancerAnnotations = map[string]string{
+	"service.beta.kubernetes.io/aws-load-balancer-internal":          "",
+	"service.beta.kubernetes.io/aws-load-balancer-scheme":            "internal",
+	"service.beta.kubernetes.io/azure-load-balancer-internal":        "true",
+	"networking.gke.io/load-balancer-type":                           "Internal",
+	"cloud.google.com/load-balancer-type":                            "Internal",
+	"service.beta.kubernetes.io/openstack-internal-load-balancer":    "true",
+	"service.kubernetes.io/ibm-load-balancer-cloud-provider-ip-type": "private",
+}
+
+type exposureChain struct {
+	Namespace  string `json:"namespace"`
+	Deployment string `json:"deployment"`
+	Service    string `json:"service"`
+	Entrypoint string `json:"entrypoint"`
+	Name       string `json:"name,omitempty"`
+	Host       string `json:"host,omitempty"`
+	Exposed    bool   `json:"internetExposed"`
+}
+
+func isInternalLoadBalancer(svc corev1.Service) bool {
+	for k, v := range internalLoadBalancerAnnotations {
+		if value, ok := svc.ObjectMeta.Annotations[k]; ok && (v == "" || strings.EqualFold(value, v)) {
+			return true
+		}
+	}
+	return false
+}
+
+func serviceTargets(svc corev1.Service, d appsv1.Deployment) bool {
+	// services without a selector point at endpoints managed by hand, which can't be traced back to a workload
+	if svc.ObjectMeta.Namespace != d.ObjectMeta.Namespace || len(svc.Spec.Selector) == 0 {
+		return false
+	}
+	return labels.SelectorFromSet(svc.Spec.Selector).Matches(labels.Set(d.Spec.Template.ObjectMeta.Labels))
+}
+
+func ingressServices(ing networkingv1.Ingress) map[string][]string {
+	// service name -> hosts routed to it, an empty host meaning every host the ingress controller answers for
+	services := map[string][]string{}
+	if b := ing.Spec.DefaultBackend; b != nil && b.Service != nil {
+		services[b.Service.Name] = append(services[b.Service.Name], "*")
+	}
+	for _, rule := range ing.Spec.Rules {
+		host := rule.Host
+		if host == "" {
+			host = "*"
+		}
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, p := range rule.HTTP.Paths {
+			if p.Backend.Service != nil {
+				services[p.Backend.Service.Name] = append(services[p.Backend.Service.Name], host)
+			}
+		}
+	}
+	return services
+}
+
+func listRoutes(dyn dynamic.Interface) ([]unstructured.Unstructured, error) {
+	routes, err := dyn.Resource(openshiftRoutes).Namespace(scanNamespace).List(context.TODO(), listOptions())
+	if apierrors.IsNotFound(err) {
+		// not an openshift cluster
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return routes.Items, nil
+}
+
+func exposureChains(deployments []appsv1.Deployment, services []corev1.Service, ingresses []networkingv1.Ingress, routes []unstructured.Unstructured) []exposureChain {
+	/*
+		deployment -> service by selector, then service -> ingress or route by backend, or the service straight to the
+		outside as a load balancer or node port. ingresses and routes always count as exposed, since whether the
+		controller behind them faces the internet isn't something the cluster records
+	*/
+	chains := []exposureChain{}
+	for _, d := range deployments {
+		for _, svc := range services {
+			if !serviceTargets(svc, d) {
+				continue
+			}
+			chain := exposureChain{Namespace: d.ObjectMeta.Namespace, Deployment: d.ObjectMeta.Name, Service: svc.ObjectMeta.Name}
+
+			reached := false
+			switch svc.Spec.Type {
+			case corev1.ServiceTypeLoadBalancer:
+				c := chain
+				c.Entrypoint, c.Exposed = "loadbalancer", !isInternalLoadBalancer(svc)
+				for _, in := range svc.Status.LoadBalancer.Ingress {
+					c.Host = in.Hostname
+					if c.Host == "" {
+						c.Host = in.IP
+					}
+				}
+				chains = append(chains, c)
+				reached = true
+			case corev1.ServiceTypeNodePort:
+				c := chain
+				c.Entrypoint, c.Exposed = "nodeport", true
+				chains = append(chains, c)
+				reached = true
+			}
+
+			for _, ing := range ingresses {
+				if ing.ObjectMeta.Namespace != svc.ObjectMeta.Namespace {
+					continue
+				}
+				for _, host := range ingressServices(ing)[svc.ObjectMeta.Name] {
+					c := chain
+					c.Entrypoint, c.Name, c.Host, c.Exposed = "ingress", ing.ObjectMeta.Name, host, true
+					chains = append(chains, c)
+					reached = true
+				}
+			}
+			for _, r := range routes {
+				to, _, _ := unstructured.NestedString(r.Object, "spec", "to", "name")
+				if r.GetNamespace() != svc.ObjectMeta.Namespace || to != svc.ObjectMeta.Name {
+					continue
+				}
+				host, _, _ := unstructured.NestedString(r.Object, "spec", "host")
+				c := chain
+				c.Entrypoint, c.Name, c.Host, c.Exposed = "route", r.GetName(), host, true
+				chains = append(chains, c)
+				reached = true
+			}
+
+			if !reached {
+				c := chain
+				c.Entrypoint = "cluster"
+				chains = append(chains, c)
+			}
+		}
+	}
+	sort.SliceStable(chains, func(i, j int) bool {
+		return chains[i].Namespace+"/"+chains[i].Deployment < chains[j].Namespace+"/"+chains[j].Deployment
+	})
+	return chains
+}
+
+func writeExposureReport(clientset kubernetes.Interface, dyn dynamic.Interface, deployments []appsv1.Deployment) error {
+	listStarted := time.Now()
+	services, err := clientset.CoreV1().Services(scanNamespace).List(context.TODO(), listOptions())
+	if err != nil {
+		return err
+	}
+	recordListed("services", len(services.Items))
+	timeList("services", listStarted)
+	listStarted = time.Now()
+	ingresses, err := clientset.NetworkingV1().Ingresses(scanNamespace).List(context.TODO(), listOptions())
+	if err != nil {
+		return err
+	}
+	recordListed("ingresses", len(ingresses.Items))
+	timeList("ingresses", listStarted)
+	listStarted = time.Now()
+	routes, err := listRoutes(dyn)
+	if err != nil {
+		return err
+	}
+	recordListed(openshiftRoutes.String(), len(routes))
+	timeList(openshiftRoutes.Resource, listStarted)
+
+	chains := exposureChains(deployments, services.Items, ingresses.Items, routes)
+
+	exposed := map[string][]string{}
+	for _, c := range chains {
+		if c.Exposed {
+			key := c.Namespace + "/" + c.Deployment
+			exposed[key] = append(exposed[key], c.Entrypoint+" "+c.Host)
+		}
+	}
+	for _, key := range grantKeys(exposed) {
+		parts := strings.SplitN(key, "/", 2)
+		addFinding(finding{
+			ID:        "internet-exposed",
+			Severity:  severityLow,
+			Kind:      "Deployment",
+			Namespace: parts[0],
+			Name:      parts[1],
+			Message:   fmt.Sprintf("reachable from outside the cluster through %s", strings.Join(exposed[key], ", ")),
+		})
+	}
+
+	b, err := json.MarshalIndent(chains, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeRootFile(exposureReport+".json", b); err != nil {
+		return err
+	}
+
+	buffer := bytes.Buffer{}
+	w := csv.NewWriter(&buffer)
+	w.Write([]string{"namespace", "deployment", "service", "entrypoint", "name", "host", "internet exposed"})
+	for _, c := range chains {
+		exposed := "no"
+		if c.Exposed {
+			exposed = "yes"
+		}
+		w.Write([]string{c.Namespace, c.Deployment, c.Service, c.Entrypoint, c.Name, c.Host, exposed})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return writeRootFile(exposureReport+".csv", buffer.Bytes())
+}
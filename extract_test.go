@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// every manifest under testdata/golden has to extract to its .golden file - hack/golden.sh UPDATE=1 rewrites them
+func TestExtractGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "golden", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no manifests under testdata/golden")
+	}
+	for _, input := range inputs {
+		input := input
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			in, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(strings.TrimSuffix(input, ".yaml") + ".golden")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := bytes.Buffer{}
+			if err := extractAll(bytes.NewReader(in), &got); err != nil {
+				t.Fatalf("extract failed: %v", err)
+			}
+			if got.String() != string(want) {
+				t.Errorf("extract of %s doesn't match its golden file\n--- want\n%s\n--- got\n%s", input, want, got.String())
+			}
+		})
+	}
+}
+
+// whatever is fed to it, extract must not panic, and what it writes has to extract again
+func FuzzExtract(f *testing.F) {
+	inputs, _ := filepath.Glob(filepath.Join("testdata", "golden", "*.yaml"))
+	for _, input := range inputs {
+		if b, err := os.ReadFile(input); err == nil {
+			f.Add(b)
+		}
+	}
+	f.Fuzz(func(t *testing.T, in []byte) {
+		once := bytes.Buffer{}
+		if err := extractAll(bytes.NewReader(in), &once); err != nil {
+			return
+		}
+		twice := bytes.Buffer{}
+		if err := extractAll(bytes.NewReader(once.Bytes()), &twice); err != nil {
+			t.Fatalf("extract output doesn't extract again: %v\n%s", err, once.String())
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	appsv1 "k8s.io/api/apps/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/kubectl/pkg/scheme"
+)
+
+/*
+	run manifests through the same pruning and serialisation as a scan, without a cluster - this is what the golden
+	files under testdata/golden are checked with (extract_test.go, and hack/golden.sh to rewrite them), and is
+	handy for seeing what an export of an object would hold
+*/
+
+func extractManifest(doc []byte) (runtime.Object, error) {
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(doc, nil, nil)
+	if err != nil {
+		// not a type we have compiled in, so handle it the way presets do
+		u := &unstructured.Unstructured{}
+		if uerr := u.UnmarshalJSON(doc); uerr != nil {
+			return nil, err
+		}
+		return extract(u), nil
+	}
+
+	// extract() works on the values held in typed lists, and the decoder hands back pointers
+	var extracted runtime.Object
+	switch v := obj.(type) {
+	case *appsv1.Deployment:
+		extracted = extract(*v)
+	case *appsv1.ReplicaSet:
+		extracted = extract(*v)
+	case *rbacv1.RoleBinding:
+		extracted = extract(*v)
+	case *rbacv1.Role:
+		extracted = extract(*v)
+	case *rbacv1.ClusterRoleBinding:
+		extracted = extract(*v)
+	default:
+		extracted = extract(obj)
+	}
+	if extracted == nil {
+		return nil, fmt.Errorf("unsupported kind %s", obj.GetObjectKind().GroupVersionKind().Kind)
+	}
+	return extracted, nil
+}
+
+func runExtract(args []string) error {
+	fs := flag.NewFlagSet("extract", flag.ExitOnError)
+	file := fs.String("f", "-", "manifest file to read, may hold several yaml documents, - for stdin")
+	fs.Parse(args)
+
+	var in io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	return extractAll(in, os.Stdout)
+}
+
+func extractAll(in io.Reader, out io.Writer) error {
+	// every document of in, pruned and serialised the way a scan would write it
+	reader := yaml.NewYAMLReader(bufio.NewReader(in))
+	first := true
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		json, err := yaml.ToJSON(doc)
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(json)) == 0 || string(bytes.TrimSpace(json)) == "null" {
+			continue
+		}
+
+		obj, err := extractManifest(json)
+		if err != nil {
+			return err
+		}
+		if !first {
+			fmt.Fprintln(out, "---")
+		}
+		first = false
+		if err := encodeObject(obj, out); err != nil {
+			return err
+		}
+	}
+}
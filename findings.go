@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	severityLow    string = "low"
+	severityMedium string = "medium"
+	severityHigh   string = "high"
+)
+
+// a finding is anything the scan noticed that a human should probably look at
+type finding struct {
+	ID        string
+	Severity  string
+	Kind      string
+	Namespace string
+	Name      string
+	Message   string
+}
+
+var severityRank = map[string]int{severityLow: 1, severityMedium: 2, severityHigh: 3}
+
+// which checks report anything, set from the config file and -disable-checks
+type checksConfig struct {
+	// when set, only these checks report findings
+	Enable []string `json:"enable,omitempty"`
+	// checks whose findings are dropped
+	Disable []string `json:"disable,omitempty"`
+	// site specific checks, run alongside the built in ones
+	Custom []customCheck `json:"custom,omitempty"`
+}
+
+var (
+	findings   []finding
+	findingsMu sync.Mutex
+
+	enabledChecks  map[string]bool
+	disabledChecks map[string]bool
+)
+
+func setChecks(c checksConfig, disable string) {
+	enabledChecks, disabledChecks = nil, map[string]bool{}
+	if len(c.Enable) > 0 {
+		enabledChecks = map[string]bool{}
+		for _, id := range c.Enable {
+			enabledChecks[id] = true
+		}
+	}
+	for _, id := range c.Disable {
+		disabledChecks[id] = true
+	}
+	for _, id := range strings.Split(disable, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			disabledChecks[id] = true
+		}
+	}
+}
+
+func checkEnabled(id string) bool {
+	if enabledChecks != nil && !enabledChecks[id] {
+		return false
+	}
+	return !disabledChecks[id]
+}
+
+const withheldMessage string = "details withheld, the pipeline hides fields of the exported objects: see the object file"
+
+func addFinding(f finding) {
+	// checks looking at the listed objects could name what the pipeline took out of the files
+	if len(hidingSteps(transforms)) > 0 {
+		f.Message = withheldMessage
+	}
+	addExportedFinding(f)
+}
+
+// for checks reading the object files back, which only see what the pipeline left in them
+func addExportedFinding(f finding) {
+	if !checkEnabled(f.ID) {
+		return
+	}
+	findingsMu.Lock()
+	defer findingsMu.Unlock()
+	findings = append(findings, f)
+}
+
+func validateSeverity(s string) error {
+	if s != "" && severityRank[s] == 0 {
+		return fmt.Errorf("unsupported severity %q: expected low, medium or high", s)
+	}
+	return nil
+}
+
+func findingsAtOrAbove(severity string) int {
+	findingsMu.Lock()
+	defer findingsMu.Unlock()
+	count := 0
+	for _, f := range findings {
+		if severityRank[f.Severity] >= severityRank[severity] {
+			count++
+		}
+	}
+	return count
+}
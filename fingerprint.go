@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+/*
+	the cluster name of a snapshot is whatever the scan was told, or the endpoint it talked to, so one cluster
+	reached through a load balancer and directly shows up as two. the fingerprint recorded in the manifest is what
+	the cluster says about itself: the uid of kube-system, created once with the cluster and never again, and the
+	addresses of its api servers from the kubernetes service. the collector warns when a push shares its
+	fingerprint with another cluster name, and the fingerprints command does the same for a directory of snapshots
+*/
+
+type clusterFingerprint struct {
+	// uid of the kube-system namespace, what two snapshots are compared by
+	ID string `json:"id"`
+	// the endpoint the scan used
+	Server string `json:"server,omitempty"`
+	// the api servers behind the kubernetes service, as host:port
+	APIServers []string `json:"apiServers,omitempty"`
+}
+
+var (
+	apiServerHost      string
+	currentFingerprint *clusterFingerprint
+)
+
+func readClusterFingerprint(clientset kubernetes.Interface) *clusterFingerprint {
+	// scanners limited to a few namespaces can't read kube-system, their snapshots just go without
+	ns, err := clientset.CoreV1().Namespaces().Get(context.TODO(), "kube-system", metav1.GetOptions{})
+	if err != nil {
+		log.Printf("no cluster fingerprint: %v", err)
+		return nil
+	}
+	f := &clusterFingerprint{ID: string(ns.ObjectMeta.UID), Server: apiServerHost}
+	endpoints, err := clientset.CoreV1().Endpoints("default").Get(context.TODO(), "kubernetes", metav1.GetOptions{})
+	if err != nil {
+		return f
+	}
+	for _, subset := range endpoints.Subsets {
+		for _, a := range subset.Addresses {
+			for _, p := range subset.Ports {
+				f.APIServers = append(f.APIServers, net.JoinHostPort(a.IP, strconv.Itoa(int(p.Port))))
+			}
+		}
+	}
+	sort.Strings(f.APIServers)
+	return f
+}
+
+// for every fingerprint shared by more than one cluster name, the names
+func sharedFingerprints(clusters map[string]string) map[string][]string {
+	byID := map[string]map[string]bool{}
+	for cluster, id := range clusters {
+		if id == "" {
+			continue
+		}
+		if byID[id] == nil {
+			byID[id] = map[string]bool{}
+		}
+		byID[id][cluster] = true
+	}
+	shared := map[string][]string{}
+	for id, names := range byID {
+		if len(names) > 1 {
+			shared[id] = sortedKeys(names)
+		}
+	}
+	return shared
+}
+
+func runFingerprints(args []string) error {
+	fs := flag.NewFlagSet("fingerprints", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: fingerprints <directory of snapshots>")
+	}
+	dirs, err := snapshotDirectories(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	// by cluster name, the fingerprint of its most recent snapshot
+	latest := map[string]exportManifest{}
+	for _, dir := range dirs {
+		m, err := readManifest(dir)
+		if err != nil {
+			log.Printf("skipping %s: %v", dir, err)
+			continue
+		}
+		if previous, ok := latest[m.Cluster]; !ok || m.StartedAt.After(previous.StartedAt) {
+			latest[m.Cluster] = m
+		}
+	}
+	ids := map[string]string{}
+	for _, cluster := range sortedManifestClusters(latest) {
+		m := latest[cluster]
+		id := "-"
+		if m.Fingerprint != nil {
+			id = m.Fingerprint.ID
+			ids[cluster] = id
+		}
+		fmt.Printf("%s\t%s\n", cluster, id)
+	}
+
+	shared := sharedFingerprints(ids)
+	for id, names := range shared {
+		log.Printf("warning: %s are the same cluster, fingerprint %s", strings.Join(names, ", "), id)
+	}
+	if len(shared) > 0 {
+		return fmt.Errorf("fingerprints shared by more than one cluster name: %d", len(shared))
+	}
+	return nil
+}
+
+func sortedManifestClusters(m map[string]exportManifest) []string {
+	names := []string{}
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+)
+
+/*
+	fleet diff compares the configuration of many clusters at once: every cluster against every other one, a
+	matrix of how many objects differ between the two, or with -baseline every cluster against the one golden
+	cluster, listing what each one that deviates does differently. clusters are the most recent snapshot of each
+	one under a directory of snapshots (a collector store, say), and the live clusters of -contexts, which are read
+	concurrently. -kinds narrows the comparison to what should be the same everywhere, such as ClusterRole or
+	NetworkPolicy.networking.k8s.io - live clusters only list those, so it's required with -contexts. the drift
+	ignores apply, as do drift's -config and -ignore
+*/
+
+type fleetMember struct {
+	name    string
+	objects []snapshotObject
+}
+
+type fleetDiff struct {
+	Clusters []string `json:"clusters"`
+	Kinds    []string `json:"kinds,omitempty"`
+	Baseline string   `json:"baseline,omitempty"`
+	// objects differing between two clusters, rows and columns in the order of clusters - against the baseline
+	// there is the one row
+	Matrix     [][]int          `json:"matrix"`
+	Deviations []fleetDeviation `json:"deviations,omitempty"`
+}
+
+type fleetDeviation struct {
+	Cluster string `json:"cluster"`
+	// added objects are in the cluster but not the baseline, removed ones the other way around
+	Objects []objectDrift `json:"objects"`
+}
+
+func runFleet(args []string) error {
+	if len(args) == 0 || args[0] != "diff" {
+		return errors.New("usage: fleet diff [-kinds kinds] [-baseline cluster] [-contexts contexts] [<directory of snapshots>]")
+	}
+	return runFleetDiff(args[1:])
+}
+
+func runFleetDiff(args []string) error {
+	fs := flag.NewFlagSet("fleet diff", flag.ExitOnError)
+	kindList := fs.String("kinds", "", "(optional) comma separated kinds to compare, each a kind or kind.group such as NetworkPolicy.networking.k8s.io - every kind when not set, required with -contexts")
+	baseline := fs.String("baseline", "", "(optional) golden cluster every other one is compared against, instead of every cluster against every other")
+	contexts := fs.String("contexts", "", "(optional) comma separated kubeconfig contexts of live clusters to compare, as well as or instead of snapshots")
+	configFile := fs.String("config", "", "(optional) config file whose drift.ignore lists further fields to leave out")
+	ignore := fs.String("ignore", "", "(optional) comma separated fields to leave out, each a path or kind:path, such as Deployment:spec.replicas")
+	details := fs.Bool("details", false, "(optional) with -baseline, also list the objects of every deviating cluster and how they differ")
+	asJSON := fs.Bool("json", false, "(optional) write the comparison as json instead of a table")
+	exitCode := fs.Bool("exit-code", false, "(optional) exit with status 1 when any cluster differs")
+	kubeconfig := kubeconfigFlag(fs)
+	fs.Parse(args)
+
+	if fs.NArg() > 1 || (fs.NArg() == 0 && *contexts == "") {
+		return errors.New("usage: fleet diff [-kinds kinds] [-baseline cluster] [-contexts contexts] [<directory of snapshots>]")
+	}
+	kinds := parseGroupKinds(*kindList)
+	if *contexts != "" && len(kinds) == 0 {
+		return errors.New("fleet diff: -contexts needs -kinds, live clusters would be listed whole otherwise")
+	}
+	ignores, err := driftIgnores(*configFile, *ignore)
+	if err != nil {
+		return err
+	}
+
+	members := []fleetMember{}
+	if fs.NArg() == 1 {
+		if members, err = latestFleetSnapshots(fs.Arg(0)); err != nil {
+			return err
+		}
+	}
+	live, err := liveFleetMembers(*kubeconfig, splitPatterns(*contexts), kinds)
+	if err != nil {
+		return err
+	}
+	members = append(members, live...)
+
+	names := map[string]bool{}
+	for i, m := range members {
+		if names[m.name] {
+			return fmt.Errorf("fleet diff: cluster %s is given more than once", m.name)
+		}
+		names[m.name] = true
+		members[i].objects = selectGroupKinds(m.objects, kinds)
+	}
+	if len(members) < 2 {
+		return errors.New("fleet diff: fewer than two clusters to compare")
+	}
+	if *baseline != "" && !names[*baseline] {
+		return fmt.Errorf("fleet diff: baseline %s is not one of the clusters compared", *baseline)
+	}
+
+	diff := compareFleet(members, *baseline, ignores)
+	diff.Kinds = kindNames(kinds)
+	if *asJSON {
+		b, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	} else {
+		printFleetDiff(diff, *details)
+	}
+	if *exitCode && fleetDiffers(diff) {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func parseGroupKinds(list string) []schema.GroupKind {
+	kinds := []schema.GroupKind{}
+	for _, k := range splitPatterns(list) {
+		kinds = append(kinds, schema.ParseGroupKind(k))
+	}
+	return kinds
+}
+
+func kindNames(kinds []schema.GroupKind) []string {
+	names := []string{}
+	for _, k := range kinds {
+		names = append(names, k.String())
+	}
+	return names
+}
+
+func groupKindSelected(kinds []schema.GroupKind, group, kind string) bool {
+	// a kind given without a group matches that kind of any group
+	if len(kinds) == 0 {
+		return true
+	}
+	for _, k := range kinds {
+		if strings.EqualFold(k.Kind, kind) && (k.Group == "" || k.Group == group) {
+			return true
+		}
+	}
+	return false
+}
+
+func selectGroupKinds(objects []snapshotObject, kinds []schema.GroupKind) []snapshotObject {
+	selected := []snapshotObject{}
+	for _, o := range objects {
+		gv, _ := schema.ParseGroupVersion(o.apiVersion())
+		if groupKindSelected(kinds, gv.Group, o.kind()) {
+			selected = append(selected, o)
+		}
+	}
+	return selected
+}
+
+func latestFleetSnapshots(root string) ([]fleetMember, error) {
+	// like fingerprints, the most recent snapshot of every cluster name
+	dirs, err := snapshotDirectories(root)
+	if err != nil {
+		return nil, err
+	}
+	latest := map[string]exportManifest{}
+	latestDir := map[string]string{}
+	for _, dir := range dirs {
+		m, err := readManifest(dir)
+		if err != nil {
+			log.Printf("skipping %s: %v", dir, err)
+			continue
+		}
+		if m.Cluster == "" {
+			m.Cluster = filepath.Base(dir)
+		}
+		if previous, ok := latest[m.Cluster]; !ok || m.StartedAt.After(previous.StartedAt) {
+			latest[m.Cluster], latestDir[m.Cluster] = m, dir
+		}
+	}
+	members := []fleetMember{}
+	for _, cluster := range sortedManifestClusters(latest) {
+		objects, err := readSnapshot(latestDir[cluster])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", latestDir[cluster], err)
+		}
+		members = append(members, fleetMember{name: cluster, objects: objects})
+	}
+	return members, nil
+}
+
+func liveFleetMembers(kubeconfig string, contexts []string, kinds []schema.GroupKind) ([]fleetMember, error) {
+	// every cluster is read at the same time, a fleet read one after the other takes as long as all of them together
+	members := make([]fleetMember, len(contexts))
+	errs := make([]error, len(contexts))
+	var wg sync.WaitGroup
+	for i, contextName := range contexts {
+		wg.Add(1)
+		go func(i int, contextName string) {
+			defer wg.Done()
+			objects, err := liveFleetObjects(kubeconfig, contextName, kinds)
+			if err != nil {
+				errs[i] = fmt.Errorf("context %s: %w", contextName, err)
+				return
+			}
+			members[i] = fleetMember{name: contextName, objects: objects}
+		}(i, contextName)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return members, nil
+}
+
+func liveFleetObjects(kubeconfig, contextName string, kinds []schema.GroupKind) ([]snapshotObject, error) {
+	config, _, err := loadKubeconfigContext(kubeconfig, contextName)
+	if err != nil {
+		return nil, err
+	}
+	disc, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	dyn, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := restmapper.GetAPIGroupResources(disc)
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+
+	// the preferred version of every kind asked for, the first group serving it for a kind without one
+	found := map[schema.GroupKind]bool{}
+	listed := map[schema.GroupVersionResource]bool{}
+	objects := []snapshotObject{}
+	for _, g := range groups {
+		version := g.Group.PreferredVersion.Version
+		for _, r := range g.VersionedResources[version] {
+			if strings.Contains(r.Name, "/") {
+				continue
+			}
+			gvr := schema.GroupVersionResource{Group: g.Group.Name, Version: version, Resource: r.Name}
+			for _, k := range kinds {
+				if found[k] || listed[gvr] || !groupKindSelected([]schema.GroupKind{k}, g.Group.Name, r.Kind) {
+					continue
+				}
+				found[k], listed[gvr] = true, true
+				list, err := dyn.Resource(gvr).List(context.TODO(), listOptions())
+				if err != nil {
+					return nil, fmt.Errorf("failed to list %s; %w", gvr.String(), err)
+				}
+				for _, item := range list.Items {
+					objects = append(objects, snapshotObject{Object: item.Object})
+				}
+			}
+		}
+	}
+	for _, k := range kinds {
+		if !found[k] {
+			log.Printf("fleet diff: %s is not served by context %s", k.String(), contextName)
+		}
+	}
+	return objects, nil
+}
+
+func compareFleet(members []fleetMember, baseline string, ignores []driftIgnore) fleetDiff {
+	diff := fleetDiff{Clusters: []string{}, Baseline: baseline, Matrix: [][]int{}}
+	for _, m := range members {
+		diff.Clusters = append(diff.Clusters, m.name)
+	}
+
+	var wg sync.WaitGroup
+	if baseline != "" {
+		var golden fleetMember
+		for _, m := range members {
+			if m.name == baseline {
+				golden = m
+			}
+		}
+		row := make([]int, len(members))
+		drifts := make([][]objectDrift, len(members))
+		for i, m := range members {
+			wg.Add(1)
+			go func(i int, m fleetMember) {
+				defer wg.Done()
+				drifts[i] = driftBetween(golden.objects, m.objects, ignores)
+				row[i] = len(drifts[i])
+			}(i, m)
+		}
+		wg.Wait()
+		diff.Matrix = append(diff.Matrix, row)
+		for i, m := range members {
+			if len(drifts[i]) > 0 {
+				diff.Deviations = append(diff.Deviations, fleetDeviation{Cluster: m.name, Objects: drifts[i]})
+			}
+		}
+		return diff
+	}
+
+	for range members {
+		diff.Matrix = append(diff.Matrix, make([]int, len(members)))
+	}
+	for i := range members {
+		for j := i + 1; j < len(members); j++ {
+			wg.Add(1)
+			go func(i, j int) {
+				defer wg.Done()
+				n := len(driftBetween(members[i].objects, members[j].objects, ignores))
+				diff.Matrix[i][j], diff.Matrix[j][i] = n, n
+			}(i, j)
+		}
+	}
+	wg.Wait()
+	return diff
+}
+
+func fleetDiffers(diff fleetDiff) bool {
+	for _, row := range diff.Matrix {
+		for _, n := range row {
+			if n > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func printFleetDiff(diff fleetDiff, details bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if diff.Baseline != "" {
+		fmt.Fprintf(w, "CLUSTER\tDIFFERING FROM %s\t\n", diff.Baseline)
+		for i, cluster := range diff.Clusters {
+			if cluster == diff.Baseline {
+				continue
+			}
+			n := diff.Matrix[0][i]
+			mark := ""
+			if n > 0 {
+				mark = "deviates"
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\n", cluster, n, mark)
+		}
+		w.Flush()
+		if details {
+			for _, d := range diff.Deviations {
+				fmt.Printf("\n%s against %s:\n", d.Cluster, diff.Baseline)
+				printDrift(d.Objects)
+			}
+		}
+		return
+	}
+
+	fmt.Fprintf(w, "\t%s\t\n", strings.Join(diff.Clusters, "\t"))
+	for i, cluster := range diff.Clusters {
+		cells := []string{}
+		for j, n := range diff.Matrix[i] {
+			cell := fmt.Sprint(n)
+			if i == j {
+				cell = "-"
+			}
+			cells = append(cells, cell)
+		}
+		fmt.Fprintf(w, "%s\t%s\t\n", cluster, strings.Join(cells, "\t"))
+	}
+	w.Flush()
+	// the cluster differing from the most others is the first to look at
+	outliers := make([]int, len(diff.Clusters))
+	for i, row := range diff.Matrix {
+		for _, n := range row {
+			if n > 0 {
+				outliers[i]++
+			}
+		}
+	}
+	order := make([]int, len(diff.Clusters))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return outliers[order[a]] > outliers[order[b]] })
+	if top := order[0]; outliers[top] > 0 {
+		log.Printf("fleet diff: %s differs from %d of %d other clusters", diff.Clusters[top], outliers[top], len(diff.Clusters)-1)
+	}
+}
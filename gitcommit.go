@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+	-git-commit commits the output directory, which has to be inside a git work tree, after every successful scan.
+	one commit of a large cluster buries every change in one diff, so it can be split: one commit per namespace, or
+	per kind of object, with cluster-scoped objects and the reports and metadata in commits of their own. chunks
+	without changes get no commit. this uses the git binary, and expects nothing else to be staged
+*/
+
+const (
+	gitCommitSingle    string = "single"
+	gitCommitNamespace string = "namespace"
+	gitCommitKind      string = "kind"
+)
+
+// changed files listed in a commit message at most, the rest are counted
+const gitMessageFiles int = 50
+
+type gitChange struct {
+	status string
+	path   string
+}
+
+func validateGitCommit(mode string) error {
+	switch mode {
+	case "", gitCommitSingle, gitCommitNamespace, gitCommitKind:
+		return nil
+	}
+	return fmt.Errorf("unsupported -git-commit %q: expected single, namespace or kind", mode)
+}
+
+func git(dir string, stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func gitChanges(dir string) ([]gitChange, error) {
+	// porcelain paths are relative to the top of the work tree, the chunks to the output directory
+	prefix, err := git(dir, nil, "rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, err
+	}
+	out, err := git(dir, nil, "status", "--porcelain=v1", "-z", "--untracked-files=all", "--", ".")
+	if err != nil {
+		return nil, err
+	}
+	changes := []gitChange{}
+	for _, entry := range strings.Split(string(out), "\x00") {
+		if len(entry) < 4 {
+			continue
+		}
+		c := gitChange{status: strings.TrimSpace(entry[:2]), path: strings.TrimPrefix(entry[3:], strings.TrimSpace(string(prefix)))}
+		// hand-maintained files are committed by whoever maintains them
+		if !isIgnoredPath(c.path) {
+			changes = append(changes, c)
+		}
+	}
+	return changes, nil
+}
+
+func gitChunk(mode, p string) string {
+	parts := strings.Split(p, "/")
+	switch {
+	case mode == gitCommitSingle:
+		return "export"
+	case parts[0] == "namespaces" && len(parts) > 2 && mode == gitCommitNamespace:
+		return "namespace " + parts[1]
+	case parts[0] == "namespaces" && len(parts) > 3:
+		return "kind " + parts[2]
+	case parts[0] == "non_namespaced" && len(parts) > 2 && mode == gitCommitNamespace:
+		return "cluster-scoped objects"
+	case parts[0] == "non_namespaced" && len(parts) > 2:
+		return "kind " + parts[1]
+	}
+	return "reports and metadata"
+}
+
+func gitMessage(cluster, chunk string, startedAt time.Time, changes []gitChange) (string, string) {
+	counts := map[string]int{}
+	for _, c := range changes {
+		switch c.status {
+		case "??", "A":
+			counts["added"]++
+		case "D":
+			counts["deleted"]++
+		default:
+			counts["modified"]++
+		}
+	}
+	summary := []string{}
+	for _, what := range []string{"added", "modified", "deleted"} {
+		if counts[what] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[what], what))
+		}
+	}
+	subject := fmt.Sprintf("%s: %s, %s", cluster, chunk, strings.Join(summary, ", "))
+
+	body := strings.Builder{}
+	fmt.Fprintf(&body, "kube-scanner %s scan of %s started %s\n\n", version, cluster, reportTime(startedAt))
+	for i, c := range changes {
+		if i == gitMessageFiles {
+			fmt.Fprintf(&body, "... and %d more\n", len(changes)-i)
+			break
+		}
+		fmt.Fprintf(&body, "%-2s %s\n", c.status, c.path)
+	}
+	return subject, body.String()
+}
+
+func commitExport(dir, mode, cluster string, startedAt time.Time) error {
+	changes, err := gitChanges(dir)
+	if err != nil {
+		return err
+	}
+	chunks := map[string][]gitChange{}
+	for _, c := range changes {
+		chunk := gitChunk(mode, c.path)
+		chunks[chunk] = append(chunks[chunk], c)
+	}
+	names := []string{}
+	for name := range chunks {
+		names = append(names, name)
+	}
+	// objects first, in name order, what was generated from them last
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == "reports and metadata") != (names[j] == "reports and metadata") {
+			return names[j] == "reports and metadata"
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		paths := bytes.Buffer{}
+		for _, c := range chunks[name] {
+			paths.WriteString(c.path + "\x00")
+		}
+		if _, err := git(dir, paths.Bytes(), "add", "-A", "--pathspec-from-file=-", "--pathspec-file-nul"); err != nil {
+			return err
+		}
+		subject, body := gitMessage(cluster, name, startedAt, chunks[name])
+		if _, err := git(dir, nil, "commit", "-q", "-m", subject, "-m", body); err != nil {
+			return err
+		}
+	}
+	log.Printf("git: %d files changed, in %d commits", len(changes), len(names))
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+/*
+	a platform team can mark an export as the golden configuration of some kinds, such as ClusterRoles and
+	NetworkPolicies, and every cluster scanned with the config reports how it deviates: golden objects the
+	cluster doesn't have, and fields whose values differ - fields only the cluster has are fine, like
+	verify-restore. extra: true also reports objects of the kinds only the cluster has. the golden export is an
+	output directory, or a path in a git repository (a local one or a url, at a branch or tag) such as the work
+	tree -git-commit keeps. the drift ignores of the defaults and drift.ignore apply. every deviation is a
+	golden-deviation finding, and reports/golden-deviations.json lists them by golden configuration
+
+		golden:
+		  - name: platform-rbac
+		    kinds: [ClusterRole, NetworkPolicy.networking.k8s.io]
+		    git:
+		      repo: https://git.example.com/platform/standards.git
+		      ref: main
+		      path: clusters/reference
+*/
+
+const goldenDeviationsFile string = "reports/golden-deviations.json"
+
+type goldenConfig struct {
+	Name string `json:"name"`
+	// kind or kind.group
+	Kinds []string `json:"kinds"`
+	// an output directory, or git
+	Snapshot string     `json:"snapshot,omitempty"`
+	Git      *goldenGit `json:"git,omitempty"`
+	Extra    bool       `json:"extra,omitempty"`
+	Severity string     `json:"severity,omitempty"`
+}
+
+type goldenGit struct {
+	Repo string `json:"repo"`
+	// branch or tag, the default branch when empty
+	Ref string `json:"ref,omitempty"`
+	// directory of the export within the repository, the top when empty
+	Path string `json:"path,omitempty"`
+}
+
+type goldenReport struct {
+	Name       string        `json:"name"`
+	Source     string        `json:"source"`
+	Kinds      []string      `json:"kinds"`
+	Deviations []objectDrift `json:"deviations"`
+}
+
+func validateGolden(golden []goldenConfig) error {
+	names := map[string]bool{}
+	for _, g := range golden {
+		if g.Name == "" || names[g.Name] {
+			return fmt.Errorf("golden: every golden configuration needs a name of its own, %q", g.Name)
+		}
+		names[g.Name] = true
+		if len(g.Kinds) == 0 {
+			return fmt.Errorf("golden: %s needs at least one kind", g.Name)
+		}
+		if (g.Snapshot == "") == (g.Git == nil) {
+			return fmt.Errorf("golden: %s needs either a snapshot or git", g.Name)
+		}
+		if g.Git != nil && g.Git.Repo == "" {
+			return fmt.Errorf("golden: %s: git needs a repo", g.Name)
+		}
+		if g.Severity != "" {
+			if err := validateSeverity(g.Severity); err != nil {
+				return fmt.Errorf("golden: %s: %w", g.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (g goldenConfig) source() string {
+	if g.Git == nil {
+		return g.Snapshot
+	}
+	s := g.Git.Repo
+	if g.Git.Ref != "" {
+		s += "@" + g.Git.Ref
+	}
+	if g.Git.Path != "" {
+		s += ":" + g.Git.Path
+	}
+	return s
+}
+
+func readGolden(g goldenConfig) ([]snapshotObject, error) {
+	if g.Git == nil {
+		return readSnapshot(g.Snapshot)
+	}
+	// a shallow clone of just the one ref, gone again once it has been read
+	tmp, err := os.MkdirTemp("", "kube-scanner-golden-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if g.Git.Ref != "" {
+		args = append(args, "--branch", g.Git.Ref)
+	}
+	if _, err := git(tmp, nil, append(args, g.Git.Repo, "repo")...); err != nil {
+		return nil, err
+	}
+	return readSnapshot(filepath.Join(tmp, "repo", filepath.FromSlash(g.Git.Path)))
+}
+
+func checkGolden(golden []goldenConfig, objects []exportedObject) error {
+	if len(golden) == 0 {
+		return nil
+	}
+	ignores := append(append([]driftIgnore{}, defaultDriftIgnores...), cfg.Drift.Ignore...)
+	reports := []goldenReport{}
+	for _, g := range golden {
+		kinds := parseGroupKinds(strings.Join(g.Kinds, ","))
+		want, err := readGolden(g)
+		if err != nil {
+			return fmt.Errorf("golden %s: failed to read %s; %w", g.Name, g.source(), err)
+		}
+		// golden objects of namespaces this scan doesn't look at can't be missing from it
+		inScope := []snapshotObject{}
+		for _, o := range selectGroupKinds(want, kinds) {
+			ns := o.metadata("namespace")
+			if ns == "" || ((scanNamespace == "" || ns == scanNamespace) && !isSkippedNamespace(ns)) {
+				inScope = append(inScope, o)
+			}
+		}
+
+		have := []snapshotObject{}
+		for _, o := range objects {
+			gv := strings.SplitN(o.APIVersion, "/", 2)
+			group := ""
+			if len(gv) == 2 {
+				group = gv[0]
+			}
+			if !groupKindSelected(kinds, group, o.Kind) {
+				continue
+			}
+			data, err := readExported(o)
+			if err != nil {
+				return err
+			}
+			obj := map[string]interface{}{}
+			if err := yaml.Unmarshal(data, &obj); err != nil {
+				return fmt.Errorf("failed to read back %s; %w", o.Path, err)
+			}
+			have = append(have, snapshotObject{Path: o.Path, Object: obj})
+		}
+		if len(have) == 0 && len(inScope) > 0 {
+			// most likely the kinds weren't exported at all, everything would be missing
+			log.Printf("golden %s: no %s exported by this scan, not compared", g.Name, strings.Join(g.Kinds, ", "))
+			continue
+		}
+
+		deviations := restoreGaps(inScope, have, ignores)
+		if g.Extra {
+			goldenKeys := map[string]bool{}
+			for _, o := range inScope {
+				goldenKeys[driftKey(o)] = true
+			}
+			for _, o := range have {
+				if k := driftKey(o); !goldenKeys[k] {
+					deviations = append(deviations, objectDrift{key: k, Key: o.key(), Change: "extra", Kind: o.kind(), Namespace: o.metadata("namespace"), Name: o.metadata("name")})
+				}
+			}
+		}
+		severity := g.Severity
+		if severity == "" {
+			severity = severityMedium
+		}
+		for _, d := range deviations {
+			addExportedFinding(finding{ID: "golden-deviation", Severity: severity, Kind: d.Kind, Namespace: d.Namespace, Name: d.Name, Message: goldenMessage(g, d)})
+		}
+		if len(deviations) > 0 {
+			log.Printf("golden %s: %d objects deviate from %s", g.Name, len(deviations), g.source())
+		}
+		reports = append(reports, goldenReport{Name: g.Name, Source: g.source(), Kinds: g.Kinds, Deviations: deviations})
+	}
+
+	b, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeRootFile(goldenDeviationsFile, b)
+}
+
+func goldenMessage(g goldenConfig, d objectDrift) string {
+	object := strings.ToLower(d.Kind) + " " + d.Name
+	switch d.Change {
+	case "missing":
+		return fmt.Sprintf("%s of the golden configuration %s is missing", object, g.Name)
+	case "extra":
+		return fmt.Sprintf("%s is not part of the golden configuration %s", object, g.Name)
+	}
+	paths := []string{}
+	for i, f := range d.Fields {
+		if i == 5 {
+			paths = append(paths, fmt.Sprintf("and %d more", len(d.Fields)-i))
+			break
+		}
+		paths = append(paths, f.Path)
+	}
+	return fmt.Sprintf("%s differs from the golden configuration %s: %s", object, g.Name, strings.Join(paths, ", "))
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+)
+
+/*
+	grep searches the objects of a snapshot without having to unpack or pipe 50k files through other tools. a plain
+	search matches the pattern against every line of an object as yaml - whatever format or compression it was
+	written with - so something like 'image: nginx' finds what it looks like it should. a -path search selects
+	fields with a kubectl style jsonpath instead, such as {.spec.template.spec.containers[*].image}, and matches the
+	pattern against their values - without a pattern every object holding the field matches. -kind and -namespace
+	narrow down the objects searched first. like grep, exits with status 1 when nothing matched
+*/
+
+type grepQuery struct {
+	kinds      []string
+	namespaces []string
+	pattern    *regexp.Regexp
+	path       *jsonpath.JSONPath
+}
+
+type grepMatch struct {
+	Key   string `json:"key"`
+	Path  string `json:"path"`
+	Line  int    `json:"line,omitempty"`
+	Value string `json:"value"`
+}
+
+func (q grepQuery) selects(o snapshotObject) bool {
+	if len(q.kinds) > 0 {
+		found := false
+		for _, k := range q.kinds {
+			if strings.EqualFold(k, o.kind()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	// cluster scoped objects have no namespace to match, so a namespace filter leaves them out
+	return len(q.namespaces) == 0 || matchesAnyPattern(q.namespaces, o.metadata("namespace"))
+}
+
+func (q grepQuery) matches(o snapshotObject) ([]grepMatch, error) {
+	matches := []grepMatch{}
+	if q.path == nil {
+		b, err := yaml.Marshal(o.Object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render %s; %w", o.Path, err)
+		}
+		for i, line := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+			if q.pattern.MatchString(line) {
+				matches = append(matches, grepMatch{Key: o.key(), Path: o.Path, Line: i + 1, Value: line})
+			}
+		}
+		return matches, nil
+	}
+
+	results, err := q.path.FindResults(o.Object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search %s; %w", o.Path, err)
+	}
+	for _, r := range results {
+		for _, v := range r {
+			if !v.IsValid() || v.Interface() == nil {
+				continue
+			}
+			value := fmt.Sprint(v.Interface())
+			// maps and lists are shown the way they would be written
+			switch v.Interface().(type) {
+			case map[string]interface{}, []interface{}:
+				b, err := json.Marshal(v.Interface())
+				if err != nil {
+					return nil, err
+				}
+				value = string(b)
+			}
+			if q.pattern != nil && !q.pattern.MatchString(value) {
+				continue
+			}
+			matches = append(matches, grepMatch{Key: o.key(), Path: o.Path, Value: value})
+		}
+	}
+	return matches, nil
+}
+
+func runGrep(args []string) error {
+	fs := flag.NewFlagSet("grep", flag.ExitOnError)
+	fromDir := fs.String("from-dir", "", "output directory of the snapshot to search")
+	kinds := fs.String("kind", "", "(optional) comma separated kinds to search, such as Deployment,ConfigMap")
+	namespaces := fs.String("namespace", "", "(optional) comma separated namespaces to search, each may be a glob such as team-*")
+	field := fs.String("path", "", "(optional) kubectl style jsonpath of the fields to match against, such as {.spec.template.spec.containers[*].image}")
+	isRegexp := fs.Bool("regexp", false, "(optional) the pattern is a regular expression rather than plain text")
+	ignoreCase := fs.Bool("i", false, "(optional) match regardless of case")
+	listOnly := fs.Bool("l", false, "(optional) only list the objects which matched")
+	asJSON := fs.Bool("json", false, "(optional) write the matches as json instead of text")
+	fs.Parse(args)
+
+	usage := errors.New("usage: grep -from-dir <snapshot> [-kind kinds] [-namespace namespaces] [-path jsonpath] [-regexp] [-i] [-l] [-json] <pattern>")
+	if *fromDir == "" || fs.NArg() > 1 || (fs.NArg() == 0 && *field == "") {
+		return usage
+	}
+	if err := validatePatterns("-namespace", *namespaces); err != nil {
+		return err
+	}
+
+	q := grepQuery{kinds: splitPatterns(*kinds), namespaces: splitPatterns(*namespaces)}
+	if fs.NArg() == 1 {
+		expr := fs.Arg(0)
+		if !*isRegexp {
+			expr = regexp.QuoteMeta(expr)
+		}
+		if *ignoreCase {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid pattern; %w", err)
+		}
+		q.pattern = re
+	}
+	if *field != "" {
+		q.path = jsonpath.New("grep").AllowMissingKeys(true)
+		if err := q.path.Parse(*field); err != nil {
+			return fmt.Errorf("invalid -path; %w", err)
+		}
+	}
+
+	snapshot, err := readSnapshot(*fromDir)
+	if err != nil {
+		return err
+	}
+	matches := []grepMatch{}
+	for _, o := range snapshot {
+		if !q.selects(o) {
+			continue
+		}
+		found, err := q.matches(o)
+		if err != nil {
+			return err
+		}
+		if *listOnly && len(found) > 0 {
+			found = found[:1]
+		}
+		matches = append(matches, found...)
+	}
+
+	switch {
+	case *asJSON:
+		b, err := json.MarshalIndent(matches, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	case *listOnly:
+		for _, m := range matches {
+			fmt.Println(m.Path)
+		}
+	default:
+		for _, m := range matches {
+			if m.Line > 0 {
+				fmt.Printf("%s:%d: %s\n", m.Path, m.Line, m.Value)
+			} else {
+				fmt.Printf("%s: %s\n", m.Path, m.Value)
+			}
+		}
+	}
+	if len(matches) == 0 {
+		os.Exit(1)
+	}
+	return nil
+}
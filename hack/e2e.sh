@@ -0,0 +1,59 @@
+#!/usr/bin/env bash
+#
+# end-to-end test: create a kind cluster, seed it with the fixtures, run the scanner against it and check the output
+# tree against testdata/e2e/expected.txt
+#
+# requires kind and kubectl on the PATH. set KEEP_CLUSTER=1 to leave the cluster running afterwards for debugging.
+
+set -euo pipefail
+
+ROOT="$(cd "$(dirname "$0")/.." && pwd)"
+CLUSTER="${CLUSTER:-kube-scanner-e2e}"
+WORKDIR="$(mktemp -d)"
+KUBECONFIG_FILE="${WORKDIR}/kubeconfig"
+OUTDIR="${WORKDIR}/out"
+
+cleanup() {
+	if [ "${KEEP_CLUSTER:-0}" != "1" ]; then
+		kind delete cluster --name "${CLUSTER}" >/dev/null 2>&1 || true
+	fi
+	rm -rf "${WORKDIR}"
+}
+trap cleanup EXIT
+
+for tool in kind kubectl go; do
+	command -v "${tool}" >/dev/null || { echo "e2e: ${tool} is required" >&2; exit 1; }
+done
+
+go build -o "${WORKDIR}/kube-scanner" "${ROOT}"
+
+kind create cluster --name "${CLUSTER}" --kubeconfig "${KUBECONFIG_FILE}" --wait 120s
+kubectl --kubeconfig "${KUBECONFIG_FILE}" apply -f "${ROOT}/testdata/e2e/fixtures.yaml"
+
+"${WORKDIR}/kube-scanner" -kubeconfig "${KUBECONFIG_FILE}" -outdir "${OUTDIR}" -rolestring OPSH
+
+failed=0
+while IFS= read -r line; do
+	case "${line}" in
+	"" | "#"*) continue ;;
+	"!"*)
+		if [ -e "${OUTDIR}/${line#!}" ]; then
+			echo "e2e: unexpected ${line#!}" >&2
+			failed=1
+		fi
+		;;
+	*)
+		if [ ! -s "${OUTDIR}/${line}" ]; then
+			echo "e2e: missing ${line}" >&2
+			failed=1
+		fi
+		;;
+	esac
+done <"${ROOT}/testdata/e2e/expected.txt"
+
+if [ "${failed}" != "0" ]; then
+	echo "e2e: output tree was:" >&2
+	(cd "${OUTDIR}" && find . -type f | sort) >&2
+	exit 1
+fi
+echo "e2e: ok"
@@ -0,0 +1,31 @@
+#!/usr/bin/env bash
+#
+# check that every manifest under testdata/golden still extracts to its .golden file
+# run with UPDATE=1 to rewrite the golden files after an intentional change to the pruning
+# go test runs the same check (extract_test.go), along with FuzzExtract's seed corpus
+
+set -euo pipefail
+
+ROOT="$(cd "$(dirname "$0")/.." && pwd)"
+BIN="$(mktemp)"
+trap 'rm -f "${BIN}"' EXIT
+
+go build -o "${BIN}" "${ROOT}"
+
+failed=0
+for input in "${ROOT}"/testdata/golden/*.yaml; do
+	golden="${input%.yaml}.golden"
+	if [ "${UPDATE:-0}" = "1" ]; then
+		"${BIN}" extract -f "${input}" >"${golden}"
+		continue
+	fi
+	if ! "${BIN}" extract -f "${input}" | diff -u "${golden}" -; then
+		echo "golden: ${input#${ROOT}/} does not match ${golden#${ROOT}/}" >&2
+		failed=1
+	fi
+done
+
+if [ "${failed}" != "0" ]; then
+	exit 1
+fi
+echo "golden: ok"
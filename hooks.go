@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nicgrobler/k8s/result"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*
+	hooks are commands run for every namespace scanned, before its objects are written and once they are - a quota
+	snapshot, a notification to the owning team. kinds are still listed cluster-wide, but the deployments, bindings
+	and roles are written one namespace at a time, and the hooks of a namespace run around its own writes. objects
+	of the optional exports which come later (revision history, presets, matching roles) are written after the
+	namespace's after hooks. a hook reads the namespace as json on stdin, and finds the basics in its environment:
+
+		KUBE_SCANNER_PHASE      before or after
+		KUBE_SCANNER_CLUSTER    the -cluster-name
+		KUBE_SCANNER_NAMESPACE  the namespace
+		KUBE_SCANNER_OUTPUT     the directory its objects are written to
+
+	a hook which fails, or runs past its timeout, is recorded as an error and the scan goes on
+
+		hooks:
+		  afterNamespace:
+		    - name: quota-snapshot
+		      command: [/usr/local/bin/snapshot-quota]
+		      namespaces: ["team-*"]
+		      timeout: 30s
+*/
+
+const (
+	hookBefore string = "before"
+	hookAfter  string = "after"
+)
+
+const defaultHookTimeout = time.Minute
+
+type hooksConfig struct {
+	BeforeNamespace []namespaceHook `json:"beforeNamespace,omitempty"`
+	AfterNamespace  []namespaceHook `json:"afterNamespace,omitempty"`
+}
+
+type namespaceHook struct {
+	Name    string   `json:"name,omitempty"`
+	Command []string `json:"command"`
+	// namespace names or globs, every namespace scanned when empty
+	Namespaces []string `json:"namespaces,omitempty"`
+	// such as 30s, a minute when not set
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// what a hook reads on stdin
+type namespaceHookInput struct {
+	Phase       string            `json:"phase"`
+	Cluster     string            `json:"cluster"`
+	Namespace   string            `json:"namespace"`
+	UID         string            `json:"uid,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Output      string            `json:"output"`
+	// objects exported from the namespace, after only
+	Objects int `json:"objects,omitempty"`
+}
+
+func validateHooks(c hooksConfig) error {
+	for _, h := range append(append([]namespaceHook{}, c.BeforeNamespace...), c.AfterNamespace...) {
+		if len(h.Command) == 0 {
+			return fmt.Errorf("hook %q: needs a command", h.Name)
+		}
+		if h.Timeout != "" {
+			if d, err := time.ParseDuration(h.Timeout); err != nil || d <= 0 {
+				return fmt.Errorf("hook %q: invalid timeout %q", h.Name, h.Timeout)
+			}
+		}
+		for _, pattern := range h.Namespaces {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("hook %q: invalid namespace pattern %q", h.Name, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+func (h namespaceHook) label() string {
+	if h.Name != "" {
+		return h.Name
+	}
+	return h.Command[0]
+}
+
+func (h namespaceHook) appliesTo(namespace string) bool {
+	return len(h.Namespaces) == 0 || matchesAnyPattern(h.Namespaces, namespace)
+}
+
+func hooksConfigured(c hooksConfig) bool {
+	return len(c.BeforeNamespace) > 0 || len(c.AfterNamespace) > 0
+}
+
+func scanNamespaceOrder(withObjects []string, all bool) []corev1.Namespace {
+	/*
+		the namespaces written one after the other, by name: those holding objects to write, and with all every
+		namespace the scan covers - hooks run for a namespace with nothing to export too. the metadata comes from
+		the namespace list, a namespace which can't be read still gets its name
+	*/
+	known := map[string]corev1.Namespace{}
+	if all {
+		if scanNamespace != "" {
+			ns, err := namespaceSource.CoreV1().Namespaces().Get(context.TODO(), scanNamespace, metav1.GetOptions{})
+			if err != nil {
+				ns = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: scanNamespace}}
+			}
+			known[scanNamespace] = *ns
+		} else if listed, err := listNamespaceObjects(); err != nil {
+			recordError(nil, fmt.Errorf("namespace hooks only run for namespaces with objects, failed to list namespaces; %w", err))
+		} else {
+			for _, ns := range listed {
+				if !isSkippedNamespace(ns.ObjectMeta.Name) {
+					known[ns.ObjectMeta.Name] = ns
+				}
+			}
+		}
+	}
+	for _, name := range withObjects {
+		if _, ok := known[name]; !ok {
+			known[name] = corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		}
+	}
+	names := []string{}
+	for name := range known {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	order := []corev1.Namespace{}
+	for _, name := range names {
+		order = append(order, known[name])
+	}
+	return order
+}
+
+func runNamespaceHooks(phase string, hooks []namespaceHook, cluster string, ns corev1.Namespace) {
+	if len(hooks) == 0 {
+		return
+	}
+	input := namespaceHookInput{
+		Phase:       phase,
+		Cluster:     cluster,
+		Namespace:   ns.ObjectMeta.Name,
+		UID:         string(ns.ObjectMeta.UID),
+		Labels:      ns.ObjectMeta.Labels,
+		Annotations: ns.ObjectMeta.Annotations,
+		Output:      filepath.Join(outputDirectory, "namespaces", sanitizePathComponent(ns.ObjectMeta.Name)),
+	}
+	if phase == hookAfter {
+		exportedMu.Lock()
+		for _, o := range exported {
+			if o.Namespace == input.Namespace {
+				input.Objects++
+			}
+		}
+		exportedMu.Unlock()
+	}
+	for _, h := range hooks {
+		if !h.appliesTo(input.Namespace) {
+			continue
+		}
+		// recorded against the namespace, the scan goes on with the next one
+		if err := runNamespaceHook(h, input); err != nil {
+			recordError(&result.ObjectRef{APIVersion: "v1", Kind: "Namespace", Name: input.Namespace}, fmt.Errorf("%s hook %s failed; %w", phase, h.label(), err))
+		}
+	}
+}
+
+func runNamespaceHook(h namespaceHook, input namespaceHookInput) error {
+	timeout := defaultHookTimeout
+	if h.Timeout != "" {
+		timeout, _ = time.ParseDuration(h.Timeout)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stdin, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Env = append(os.Environ(),
+		"KUBE_SCANNER_PHASE="+input.Phase,
+		"KUBE_SCANNER_CLUSTER="+input.Cluster,
+		"KUBE_SCANNER_NAMESPACE="+input.Namespace,
+		"KUBE_SCANNER_OUTPUT="+input.Output,
+	)
+	out, err := cmd.CombinedOutput()
+	if text := strings.TrimSpace(string(out)); text != "" {
+		log.Printf("hook %s, namespace %s: %s", h.label(), input.Namespace, text)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	return err
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"sigs.k8s.io/yaml"
+)
+
+/*
+	drift as a single html file, for reviewing changes without any tooling beyond a browser: a summary of what was
+	added, removed and changed, then every object side by side, old on the left and new on the right. the yaml
+	compared is that of the objects with the ignored fields taken out, so the diffs hold exactly what drift reports
+*/
+
+type diffCell struct {
+	Number int
+	Text   string
+	// equal, delete, insert or empty
+	Class string
+}
+
+type diffRow struct {
+	Old, New diffCell
+	// unchanged lines left out between two hunks
+	Skipped int
+}
+
+type objectDiff struct {
+	objectDrift
+	Rows []diffRow
+}
+
+type diffReport struct {
+	Old, New string
+	Created  string
+	Counts   map[string]int
+	Objects  []objectDiff
+}
+
+var diffTemplate = template.Must(template.New("diff").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>kube-scanner drift</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table.diff { border-collapse: collapse; width: 100%; table-layout: fixed; font-family: monospace; font-size: 12px; margin-bottom: 2em; }
+table.diff td { vertical-align: top; white-space: pre-wrap; word-break: break-all; padding: 0 4px; }
+table.diff td.n { width: 3em; text-align: right; color: #999; }
+td.delete { background: #ffebe9; }
+td.insert { background: #e6ffec; }
+td.empty { background: #f6f8fa; }
+tr.skip td { background: #ddf4ff; color: #57606a; text-align: center; }
+.added { color: #1a7f37; } .removed { color: #cf222e; } .changed { color: #9a6700; }
+</style>
+</head>
+<body>
+<h1>Drift</h1>
+<p>{{.Old}} &rarr; {{.New}}, generated {{.Created}}</p>
+<p><span class="added">{{index .Counts "added"}} added</span>, <span class="removed">{{index .Counts "removed"}} removed</span>, <span class="changed">{{index .Counts "changed"}} changed</span></p>
+<ul>
+{{range $i, $o := .Objects}}<li><a href="#o{{$i}}" class="{{$o.Change}}">{{$o.Change}}</a> {{$o.Key}}</li>
+{{end}}</ul>
+{{range $i, $o := .Objects}}<h3 id="o{{$i}}"><span class="{{$o.Change}}">{{$o.Change}}</span> {{$o.Key}}</h3>
+<table class="diff">
+{{range $o.Rows}}{{if .Skipped}}<tr class="skip"><td colspan="4">{{.Skipped}} unchanged lines</td></tr>
+{{else}}<tr><td class="n">{{if .Old.Number}}{{.Old.Number}}{{end}}</td><td class="{{.Old.Class}}">{{.Old.Text}}</td><td class="n">{{if .New.Number}}{{.New.Number}}{{end}}</td><td class="{{.New.Class}}">{{.New.Text}}</td></tr>
+{{end}}{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+func withoutIgnored(kind, prefix string, v interface{}, ignores []driftIgnore) interface{} {
+	// the same paths flattenFields builds, so an ignore leaves out here what it leaves out of the drift
+	for _, i := range ignores {
+		if prefix != "" && i.matches(kind, prefix) {
+			return nil
+		}
+	}
+	switch value := v.(type) {
+	case map[string]interface{}:
+		kept := map[string]interface{}{}
+		for k, child := range value {
+			p := k
+			if prefix != "" {
+				p = prefix + "." + k
+			}
+			if c := withoutIgnored(kind, p, child, ignores); c != nil {
+				kept[k] = c
+			}
+		}
+		if len(kept) == 0 && len(value) > 0 {
+			return nil
+		}
+		return kept
+	case []interface{}:
+		kept := []interface{}{}
+		for i, child := range value {
+			if c := withoutIgnored(kind, fmt.Sprintf("%s[%d]", prefix, i), child, ignores); c != nil {
+				kept = append(kept, c)
+			}
+		}
+		return kept
+	}
+	return v
+}
+
+func comparedYAML(o *snapshotObject, ignores []driftIgnore) ([]string, error) {
+	if o == nil {
+		return []string{}, nil
+	}
+	b, err := yaml.Marshal(withoutIgnored(o.kind(), "", o.Object, ignores))
+	if err != nil {
+		return nil, err
+	}
+	return splitLines(b), nil
+}
+
+func sideBySide(a, b []string) []diffRow {
+	cell := func(lines []string, i int, class string) diffCell {
+		return diffCell{Number: i + 1, Text: lines[i], Class: class}
+	}
+	rows := []diffRow{}
+	last := 0
+	for _, group := range difflib.NewMatcher(a, b).GetGroupedOpCodes(3) {
+		if skipped := group[0].I1 - last; skipped > 0 {
+			rows = append(rows, diffRow{Skipped: skipped})
+		}
+		for _, op := range group {
+			switch op.Tag {
+			case 'e':
+				for i, j := op.I1, op.J1; i < op.I2; i, j = i+1, j+1 {
+					rows = append(rows, diffRow{Old: cell(a, i, "equal"), New: cell(b, j, "equal")})
+				}
+			default:
+				// replaced lines are paired up, whichever side runs longer is padded
+				for i, j := op.I1, op.J1; i < op.I2 || j < op.J2; i, j = i+1, j+1 {
+					row := diffRow{Old: diffCell{Class: "empty"}, New: diffCell{Class: "empty"}}
+					if i < op.I2 {
+						row.Old = cell(a, i, "delete")
+					}
+					if j < op.J2 {
+						row.New = cell(b, j, "insert")
+					}
+					rows = append(rows, row)
+				}
+			}
+			last = op.I2
+		}
+	}
+	if skipped := len(a) - last; skipped > 0 && len(rows) > 0 {
+		rows = append(rows, diffRow{Skipped: skipped})
+	}
+	return rows
+}
+
+func writeDriftHTML(file, oldDir, newDir string, before, after []snapshotObject, drift []objectDrift, ignores []driftIgnore) error {
+	byKey := func(objects []snapshotObject) map[string]*snapshotObject {
+		m := map[string]*snapshotObject{}
+		for i := range objects {
+			m[driftKey(objects[i])] = &objects[i]
+		}
+		return m
+	}
+	old, current := byKey(before), byKey(after)
+
+	report := diffReport{Old: oldDir, New: newDir, Created: reportTime(time.Now()), Counts: map[string]int{}}
+	for _, d := range drift {
+		report.Counts[d.Change]++
+		a, err := comparedYAML(old[d.key], ignores)
+		if err != nil {
+			return err
+		}
+		b, err := comparedYAML(current[d.key], ignores)
+		if err != nil {
+			return err
+		}
+		report.Objects = append(report.Objects, objectDiff{objectDrift: d, Rows: sideBySide(a, b)})
+	}
+
+	if isIgnoredPath(file) {
+		skipIgnored(file)
+		return nil
+	}
+	var b bytes.Buffer
+	if err := diffTemplate.Execute(&b, report); err != nil {
+		return err
+	}
+	if err := output.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+	if err := countOutput(0, b.Len()); err != nil {
+		return err
+	}
+	return output.WriteFile(file, b.Bytes(), os.ModePerm)
+}
+
+func latestSnapshots(root string) (string, string, error) {
+	// the two most recent by when they were taken, directory names don't always sort that way
+	dirs, err := snapshotDirectories(root)
+	if err != nil {
+		return "", "", err
+	}
+	taken := map[string]time.Time{}
+	for _, dir := range dirs {
+		m, err := readManifest(dir)
+		if err != nil {
+			return "", "", err
+		}
+		taken[dir] = m.StartedAt
+	}
+	if len(dirs) < 2 {
+		return "", "", errors.New("fewer than two snapshots under " + root)
+	}
+	sort.SliceStable(dirs, func(i, j int) bool { return taken[dirs[i]].Before(taken[dirs[j]]) })
+	return dirs[len(dirs)-2], dirs[len(dirs)-1], nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+/*
+	a .kubescannerignore at the top of the output directory lists what the scanner must never write, so that
+	hand-maintained files can live next to generated ones - a README, a kustomization, an object owned by another
+	process. lines are read like a .gitignore: a pattern holds a / to be matched from the top of the output
+	directory, and is matched against every file name otherwise, * stays within one directory while ** spans any
+	number of them, a pattern covers everything below a directory it matches, and a leading ! takes a path back
+	again. lines starting with object: match objects instead, as Kind/namespace/name or Kind/name for cluster
+	scoped ones, globs allowed. the file is read again at the start of every scan, and what it matches is left out
+	of -git-commit too
+*/
+
+const ignoreFile string = ".kubescannerignore"
+
+const objectIgnorePrefix string = "object:"
+
+type ignoreRule struct {
+	pattern *regexp.Regexp
+	negate  bool
+	object  bool
+}
+
+var outputIgnores []ignoreRule
+
+func globRegexp(glob string, anchored bool) (*regexp.Regexp, error) {
+	expr := strings.Builder{}
+	expr.WriteString("^")
+	if !anchored {
+		expr.WriteString("(.*/)?")
+	}
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			expr.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			expr.WriteString("[^/]*")
+		case glob[i] == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	// a directory covers everything below it
+	expr.WriteString("(/.*)?$")
+	return regexp.Compile(expr.String())
+}
+
+func parseIgnoreFile(b []byte) ([]ignoreRule, error) {
+	rules := []ignoreRule{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		rule := ignoreRule{}
+		if strings.HasPrefix(text, "!") {
+			rule.negate, text = true, text[1:]
+		}
+		anchored := true
+		if strings.HasPrefix(text, objectIgnorePrefix) {
+			rule.object, text = true, strings.TrimSpace(strings.TrimPrefix(text, objectIgnorePrefix))
+		} else {
+			text = strings.TrimSuffix(text, "/")
+			anchored = strings.Contains(text, "/")
+			text = strings.TrimPrefix(text, "/")
+		}
+		if text == "" {
+			return nil, fmt.Errorf("%s line %d: empty pattern", ignoreFile, line)
+		}
+		p, err := globRegexp(text, anchored)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", ignoreFile, line, err)
+		}
+		rule.pattern = p
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+func loadIgnoreFile(dir string) ([]ignoreRule, error) {
+	b, err := os.ReadFile(filepath.Join(dir, ignoreFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseIgnoreFile(b)
+}
+
+func ignoredBy(rules []ignoreRule, object bool, s string) bool {
+	// the last rule matching wins, as in a .gitignore
+	ignored := false
+	for _, r := range rules {
+		if r.object == object && r.pattern.MatchString(s) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// isIgnoredPath reports whether the file, relative to the output directory, must be left alone
+func isIgnoredPath(p string) bool {
+	// the ignore file itself is always hand-maintained
+	return p == ignoreFile || ignoredBy(outputIgnores, false, filepath.ToSlash(p))
+}
+
+func isIgnoredObject(kind, namespace, name string) bool {
+	key := kind + "/" + name
+	if namespace != "" {
+		key = kind + "/" + namespace + "/" + name
+	}
+	return ignoredBy(outputIgnores, true, key)
+}
+
+func skipIgnored(p string) {
+	log.Printf("not writing %s: matched by %s", p, ignoreFile)
+	recordEvent(scanEvent{Action: eventIgnored, Path: p})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+/*
+	where the time of a run goes, by resource: how long listing it took, extracting the fields we keep and encoding
+	and writing the files, and how many bytes that wrote. lists are timed from request to decoded response, so on a
+	large cluster they are mostly the api server, the rest is us and the disk. with -kind-stats the table is
+	logged at the end of every run and written to reports/kind-stats.json
+*/
+
+const kindStatsReport string = "reports/kind-stats.json"
+
+type kindStat struct {
+	Resource string `json:"resource"`
+	Lists    int    `json:"lists"`
+	Objects  int    `json:"objects"`
+	Bytes    int64  `json:"bytes"`
+	// requests to the api server for the resource, see apibudget.go
+	APICalls int `json:"apiCalls"`
+	// durations in milliseconds, summed over every list, object and file of the resource
+	ListMillis    int64 `json:"listMillis"`
+	ExtractMillis int64 `json:"extractMillis"`
+	WriteMillis   int64 `json:"writeMillis"`
+
+	list, extract, write time.Duration
+}
+
+var (
+	kindStats   = map[string]*kindStat{}
+	kindStatsMu sync.Mutex
+)
+
+func resetKindStats() {
+	kindStatsMu.Lock()
+	defer kindStatsMu.Unlock()
+	kindStats = map[string]*kindStat{}
+}
+
+func statFor(resource string) *kindStat {
+	// callers hold kindStatsMu
+	s := kindStats[resource]
+	if s == nil {
+		s = &kindStat{Resource: resource}
+		kindStats[resource] = s
+	}
+	return s
+}
+
+func resourceOf(gvk schema.GroupVersionKind) string {
+	// the same plural names the list timings are recorded under
+	plural, _ := meta.UnsafeGuessKindToResource(gvk)
+	return plural.Resource
+}
+
+func timeList(resource string, started time.Time) {
+	kindStatsMu.Lock()
+	defer kindStatsMu.Unlock()
+	s := statFor(resource)
+	s.Lists++
+	s.list += time.Since(started)
+}
+
+func timeExtract(obj runtime.Object, started time.Time) {
+	if obj == nil {
+		return
+	}
+	// listed typed objects come without their kind
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if gvk.Empty() {
+		if gvks, _, err := scheme.Scheme.ObjectKinds(obj); err == nil && len(gvks) > 0 {
+			gvk = gvks[0]
+		}
+	}
+	kindStatsMu.Lock()
+	defer kindStatsMu.Unlock()
+	statFor(resourceOf(gvk)).extract += time.Since(started)
+}
+
+func timeWrite(gvk schema.GroupVersionKind, started time.Time, written int) {
+	kindStatsMu.Lock()
+	defer kindStatsMu.Unlock()
+	s := statFor(resourceOf(gvk))
+	s.Objects++
+	s.Bytes += int64(written)
+	s.write += time.Since(started)
+}
+
+func kindStatsTable() []kindStat {
+	kindStatsMu.Lock()
+	defer kindStatsMu.Unlock()
+	apiCallsMu.Lock()
+	for resource := range apiCalls {
+		statFor(resource)
+	}
+	apiCallsMu.Unlock()
+	table := []kindStat{}
+	for _, s := range kindStats {
+		s.ListMillis, s.ExtractMillis, s.WriteMillis = s.list.Milliseconds(), s.extract.Milliseconds(), s.write.Milliseconds()
+		s.APICalls = apiCallsTo(s.Resource)
+		table = append(table, *s)
+	}
+	// slowest first, it is what anyone reading this is after
+	sort.Slice(table, func(i, j int) bool {
+		ti, tj := table[i].list+table[i].extract+table[i].write, table[j].list+table[j].extract+table[j].write
+		if ti != tj {
+			return ti > tj
+		}
+		return table[i].Resource < table[j].Resource
+	})
+	return table
+}
+
+func writeKindStats() error {
+	table := kindStatsTable()
+	for _, s := range table {
+		log.Printf("%s: %d api calls, %d lists in %s, %d objects extracted in %s and written in %s, %d bytes", s.Resource, s.APICalls, s.Lists, s.list.Round(time.Millisecond), s.Objects, s.extract.Round(time.Millisecond), s.write.Round(time.Millisecond), s.Bytes)
+	}
+	b, err := json.MarshalIndent(table, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeRootFile(kindStatsReport, b)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func kubeconfigFlag(fs *flag.FlagSet) *string {
+	return fs.String("kubeconfig", "", "(optional) path to the kubeconfig file, defaults to $KUBECONFIG or ~/.kube/config, and the in-cluster service account when neither exists")
+}
+
+func loadKubeconfig(path string) (*rest.Config, string, error) {
+	return loadKubeconfigContext(path, "")
+}
+
+func loadKubeconfigContext(path, contextName string) (*rest.Config, string, error) {
+	/*
+		the same rules as kubectl: an explicit file wins, otherwise every file listed in $KUBECONFIG is merged (the first
+		to set something wins), falling back to ~/.kube/config - the namespace returned is the one set on the context
+		used, the current one unless another is named, empty when it doesn't set one
+	*/
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = path
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: contextName})
+
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	raw, err := clientConfig.RawConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	namespace := ""
+	if contextName == "" {
+		contextName = raw.CurrentContext
+	}
+	if context, ok := raw.Contexts[contextName]; ok {
+		namespace = context.Namespace
+	}
+	return config, namespace, nil
+}
+
+func serverConfig(server, tokenFile, caFile string, insecure bool) (*rest.Config, error) {
+	/*
+		for automation which hands out short-lived tokens: no kubeconfig is read at all, the token file is read again
+		whenever it changes, so a token rotated underneath a daemon keeps working. without a ca file the system roots
+		verify the server
+	*/
+	if server == "" || tokenFile == "" {
+		return nil, errors.New("-server and -token-file are only used together")
+	}
+	if _, err := os.Stat(tokenFile); err != nil {
+		return nil, err
+	}
+	if caFile != "" && insecure {
+		return nil, errors.New("-certificate-authority and -insecure-skip-tls-verify can't be used together")
+	}
+	return &rest.Config{
+		Host:            server,
+		BearerTokenFile: tokenFile,
+		TLSClientConfig: rest.TLSClientConfig{CAFile: caFile, Insecure: insecure},
+	}, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+/*
+	with -leader-elect, replicas of a daemon share a lease and only its holder scans, so a highly available
+	deployment never writes two snapshots of one scan. the others wait to take over. a leader which loses the lease
+	exits, even in the middle of a scan - restarted, it waits its turn like the others, and the new leader starts
+	from a clean slate. needs get, create and update on leases in the namespace of the lease
+*/
+
+const serviceAccountNamespaceFile string = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+const (
+	leaseDuration = 30 * time.Second
+	renewDeadline = 20 * time.Second
+	retryPeriod   = 5 * time.Second
+)
+
+func leaseNamespace(namespace, contextNamespace string) string {
+	// in a pod, the lease goes next to the daemon
+	if namespace != "" {
+		return namespace
+	}
+	if b, err := os.ReadFile(serviceAccountNamespaceFile); err == nil && strings.TrimSpace(string(b)) != "" {
+		return strings.TrimSpace(string(b))
+	}
+	if contextNamespace != "" {
+		return contextNamespace
+	}
+	return metav1.NamespaceDefault
+}
+
+func leaderIdentity() (string, error) {
+	// the pod name, which is its hostname - the pid tells two daemons on one machine apart
+	host, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s_%d", host, os.Getpid()), nil
+}
+
+func runAsLeader(clientset *kubernetes.Clientset, namespace, name string, run func()) error {
+	id, err := leaderIdentity()
+	if err != nil {
+		return err
+	}
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Client:     clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: id},
+	}
+
+	log.Printf("waiting to lead as %s, on lease %s/%s", id, namespace, name)
+	leaderelection.RunOrDie(context.Background(), leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: leaseDuration,
+		RenewDeadline: renewDeadline,
+		RetryPeriod:   retryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				log.Printf("leading as %s, scanning", id)
+				run()
+			},
+			OnStoppedLeading: func() {
+				log.Fatalf("%s lost the lease %s/%s, exiting so that only the new leader scans", id, namespace, name)
+			},
+			OnNewLeader: func(identity string) {
+				if identity != id {
+					log.Printf("%s leads, standing by", identity)
+				}
+			},
+		},
+	})
+	// RunOrDie only returns once leading stopped, which exits above
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	limitStop string = "stop"
+	limitWarn string = "warn"
+)
+
+/*
+a safety valve for pointing the scanner at a much bigger cluster than intended - once a run goes over either
+bound it either stops, leaving what was written so far, or warns once and carries on
+*/
+type scanLimits struct {
+	maxObjects int
+	maxBytes   int64
+	action     string
+}
+
+var (
+	limits        scanLimits
+	limitObjects  int
+	limitBytes    int64
+	limitWarned   bool
+	limitCountsMu sync.Mutex
+)
+
+func parseLimits(maxObjects int, maxSize, action string) (scanLimits, error) {
+	l := scanLimits{maxObjects: maxObjects, action: action}
+	if action != limitStop && action != limitWarn {
+		return l, fmt.Errorf("unsupported limit action %q: expected stop or warn", action)
+	}
+	if maxSize != "" {
+		q, err := resource.ParseQuantity(maxSize)
+		if err != nil {
+			return l, fmt.Errorf("invalid max output size %q, expected for example 500Mi or 2G; %w", maxSize, err)
+		}
+		l.maxBytes = q.Value()
+	}
+	return l, nil
+}
+
+func resetLimitCounts() {
+	limitCountsMu.Lock()
+	defer limitCountsMu.Unlock()
+	limitObjects = 0
+	limitBytes = 0
+	limitWarned = false
+}
+
+func countOutput(objects, size int) error {
+	// called before anything is written, so that a stopped run never goes past its limits, or writes without its lock
+	if err := lostScanLock(); err != nil {
+		return err
+	}
+	limitCountsMu.Lock()
+	defer limitCountsMu.Unlock()
+	limitObjects += objects
+	limitBytes += int64(size)
+
+	problem := ""
+	switch {
+	case limits.maxObjects > 0 && limitObjects > limits.maxObjects:
+		problem = fmt.Sprintf("more than the maximum of %d objects", limits.maxObjects)
+	case limits.maxBytes > 0 && limitBytes > limits.maxBytes:
+		problem = fmt.Sprintf("more than the maximum of %d bytes of output", limits.maxBytes)
+	default:
+		return nil
+	}
+
+	if limits.action == limitWarn {
+		if !limitWarned {
+			log.Printf("warning: this scan writes %s, carrying on", problem)
+			limitWarned = true
+		}
+		return nil
+	}
+	return fmt.Errorf("stopped: this scan would write %s, the output directory only holds part of the scan", problem)
+}
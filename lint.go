@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/kubectl/pkg/scheme"
+	"sigs.k8s.io/yaml"
+)
+
+/*
+	post-export validation of what was actually written: every file is decoded strictly against the api types
+	compiled into the scanner (unknown or duplicate fields fail), then checked for the fields the api server would
+	insist on at restore time - types we don't have compiled in only get the generic checks, unless their crd was
+	vendored with -data-dir
+*/
+
+const (
+	lintWarn string = "warn"
+	lintFail string = "fail"
+)
+
+var strictDecoder = json.NewSerializerWithOptions(json.DefaultMetaFactory, scheme.Scheme, scheme.Scheme, json.SerializerOptions{Yaml: true, Strict: true})
+
+func lintObject(data []byte) []string {
+	obj, _, err := strictDecoder.Decode(data, nil, nil)
+	if runtime.IsNotRegisteredError(err) {
+		u := &unstructured.Unstructured{}
+		b, err := yaml.YAMLToJSON(data)
+		if err == nil {
+			err = u.UnmarshalJSON(b)
+		}
+		if err != nil {
+			return []string{err.Error()}
+		}
+		return append(lintMetadata(u.GetName(), u.GetNamespace(), u.GetLabels()), lintSchema(u.Object)...)
+	}
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	problems := []string{}
+	if accessor, ok := obj.(metav1.Object); ok {
+		problems = append(problems, lintMetadata(accessor.GetName(), accessor.GetNamespace(), accessor.GetLabels())...)
+	}
+
+	switch v := obj.(type) {
+	case *appsv1.Deployment:
+		problems = append(problems, lintDeployment(v)...)
+	case *rbacv1.RoleBinding:
+		problems = append(problems, lintRoleRef(v.RoleRef)...)
+	case *rbacv1.ClusterRoleBinding:
+		problems = append(problems, lintRoleRef(v.RoleRef)...)
+	}
+	return problems
+}
+
+func lintMetadata(name, namespace string, objectLabels map[string]string) []string {
+	problems := []string{}
+	if name == "" {
+		problems = append(problems, "metadata.name is required")
+	}
+	if namespace != "" {
+		for _, msg := range validation.IsDNS1123Label(namespace) {
+			problems = append(problems, "metadata.namespace: "+msg)
+		}
+	}
+	for k, v := range objectLabels {
+		for _, msg := range validation.IsQualifiedName(k) {
+			problems = append(problems, fmt.Sprintf("metadata.labels %s: %s", k, msg))
+		}
+		for _, msg := range validation.IsValidLabelValue(v) {
+			problems = append(problems, fmt.Sprintf("metadata.labels %s: %s", k, msg))
+		}
+	}
+	return problems
+}
+
+func lintDeployment(d *appsv1.Deployment) []string {
+	problems := []string{}
+	if d.Spec.Selector == nil {
+		return append(problems, "spec.selector is required")
+	}
+	selector, err := metav1.LabelSelectorAsSelector(d.Spec.Selector)
+	if err != nil {
+		problems = append(problems, "spec.selector: "+err.Error())
+	} else if selector.Empty() || !selector.Matches(labels.Set(d.Spec.Template.ObjectMeta.Labels)) {
+		problems = append(problems, "spec.selector does not match spec.template.metadata.labels")
+	}
+	if len(d.Spec.Template.Spec.Containers) == 0 {
+		problems = append(problems, "spec.template.spec.containers must not be empty")
+	}
+	for i, c := range d.Spec.Template.Spec.Containers {
+		if c.Name == "" {
+			problems = append(problems, fmt.Sprintf("spec.template.spec.containers[%d].name is required", i))
+		}
+		if c.Image == "" {
+			problems = append(problems, fmt.Sprintf("spec.template.spec.containers[%d].image is required", i))
+		}
+	}
+	return problems
+}
+
+func lintRoleRef(ref rbacv1.RoleRef) []string {
+	problems := []string{}
+	if ref.Name == "" {
+		problems = append(problems, "roleRef.name is required")
+	}
+	if ref.Kind != "Role" && ref.Kind != "ClusterRole" {
+		problems = append(problems, fmt.Sprintf("roleRef.kind must be Role or ClusterRole, not %q", ref.Kind))
+	}
+	return problems
+}
+
+func readExported(o exportedObject) ([]byte, error) {
+	// an exported file as it was written, decompressed if need be
+	data, err := os.ReadFile(filepath.Join(outputDirectory, filepath.FromSlash(o.Path)))
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(o.Path, compressedSuffix) {
+		return gunzipBytes(data)
+	}
+	return data, nil
+}
+
+func lintExport(objects []exportedObject, mode string) (int, error) {
+	// returns how many files had problems, so that the caller can decide whether that fails the run
+	failed := 0
+	for _, o := range objects {
+		data, err := readExported(o)
+		if err != nil {
+			return failed, err
+		}
+
+		problems := lintObject(data)
+		if len(problems) == 0 {
+			continue
+		}
+		failed++
+		for _, p := range problems {
+			log.Printf("lint %s: %s: %s", mode, o.Path, p)
+		}
+		addExportedFinding(finding{
+			ID:        "lint",
+			Severity:  severityMedium,
+			Kind:      o.Kind,
+			Namespace: o.Namespace,
+			Name:      o.Name,
+			Message:   strings.Join(problems, "; "),
+		})
+	}
+	return failed, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*
+	every list goes to etcd by default, a consistent read which on very large clusters is what a scan spends its
+	time on. with -list-consistency cache lists are served from the watch cache of the api server instead: far
+	cheaper, at most a few seconds stale, and possibly from different points in time for different resources
+*/
+
+const (
+	listConsistent string = "consistent"
+	listFromCache  string = "cache"
+)
+
+var listConsistency = listConsistent
+
+func setListConsistency(mode string) error {
+	if mode != listConsistent && mode != listFromCache {
+		return fmt.Errorf("unsupported -list-consistency %q: expected consistent or cache", mode)
+	}
+	listConsistency = mode
+	return nil
+}
+
+// listOptions is what every list call starts from
+func listOptions() metav1.ListOptions {
+	if listConsistency == listFromCache {
+		return metav1.ListOptions{ResourceVersion: "0", ResourceVersionMatch: metav1.ResourceVersionMatchNotOlderThan}
+	}
+	return metav1.ListOptions{}
+}
@@ -2,24 +2,24 @@ package main
 
 import (
 	"bytes"
-	"context"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
 	"os"
-	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/nicgrobler/k8s/result"
 	appsv1 "k8s.io/api/apps/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
+	"k8s.io/client-go/rest"
 	"k8s.io/kubectl/pkg/scheme"
 )
 
@@ -30,7 +30,48 @@ const (
 
 var outputDirectory string
 
+// record of every object written during the run, relative to the output directory
+type exportedObject struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	Path       string
+	Sanitized  bool
+	// newest managedFields entry, see attribution.go
+	LastModified *result.Modification
+	// newest writes first, see auditlog.go
+	AuditEvents []result.AuditEvent
+	// of the serialised object, see contenthash.go
+	SHA256 string
+}
+
+var (
+	exported   []exportedObject
+	exportedMu sync.Mutex
+)
+
+func recordExport(o exportedObject) {
+	exportedMu.Lock()
+	defer exportedMu.Unlock()
+	exported = append(exported, o)
+}
+
 func extract(unknown interface{}) runtime.Object {
+	started := time.Now()
+	obj := extractFields(unknown)
+	if obj == nil {
+		recordUnsupported(unknown)
+		return nil
+	}
+	timeExtract(obj, started)
+	if keepRaw {
+		rememberRaw(unknown)
+	}
+	return obj
+}
+
+func extractFields(unknown interface{}) runtime.Object {
 
 	/*
 		given that there are many fields which we will not want, it's easier to create an initial, empty, default
@@ -39,6 +80,7 @@ func extract(unknown interface{}) runtime.Object {
 
 	switch v := unknown.(type) {
 	case appsv1.Deployment:
+		rememberModification("Deployment", &v.ObjectMeta)
 		newP := appsv1.Deployment{}
 		newP.TypeMeta = v.TypeMeta
 		newP.ObjectMeta.Labels = v.ObjectMeta.Labels
@@ -47,7 +89,22 @@ func extract(unknown interface{}) runtime.Object {
 		newP.Spec = v.Spec
 		return newP.DeepCopyObject()
 
+	case appsv1.ReplicaSet:
+		rememberModification("ReplicaSet", &v.ObjectMeta)
+		// only kept as revision history of a deployment, so the revision number is the one annotation worth keeping
+		newP := appsv1.ReplicaSet{}
+		newP.TypeMeta = v.TypeMeta
+		newP.ObjectMeta.Labels = v.ObjectMeta.Labels
+		newP.ObjectMeta.Name = v.ObjectMeta.Name
+		newP.ObjectMeta.Namespace = v.ObjectMeta.Namespace
+		if revision, ok := v.ObjectMeta.Annotations[revisionAnnotation]; ok {
+			newP.ObjectMeta.Annotations = map[string]string{revisionAnnotation: revision}
+		}
+		newP.Spec = v.Spec
+		return newP.DeepCopyObject()
+
 	case rbacv1.RoleBinding:
+		rememberModification("RoleBinding", &v.ObjectMeta)
 		newP := rbacv1.RoleBinding{}
 		newP.TypeMeta = v.TypeMeta
 		newP.ObjectMeta.Labels = v.ObjectMeta.Labels
@@ -58,6 +115,7 @@ func extract(unknown interface{}) runtime.Object {
 		return newP.DeepCopyObject()
 
 	case rbacv1.Role:
+		rememberModification("Role", &v.ObjectMeta)
 		newP := rbacv1.Role{}
 		newP.TypeMeta = v.TypeMeta
 		newP.ObjectMeta.Labels = v.ObjectMeta.Labels
@@ -67,6 +125,7 @@ func extract(unknown interface{}) runtime.Object {
 		return newP.DeepCopyObject()
 
 	case rbacv1.ClusterRoleBinding:
+		rememberModification("ClusterRoleBinding", &v.ObjectMeta)
 		newP := rbacv1.ClusterRoleBinding{}
 		newP.TypeMeta = v.TypeMeta
 		newP.ObjectMeta.Labels = v.ObjectMeta.Labels
@@ -77,6 +136,7 @@ func extract(unknown interface{}) runtime.Object {
 		return newP.DeepCopyObject()
 
 	case *rbacv1.ClusterRole:
+		rememberModification("ClusterRole", &v.ObjectMeta)
 		newP := rbacv1.ClusterRole{}
 		newP.TypeMeta = v.TypeMeta
 		newP.ObjectMeta.Labels = v.ObjectMeta.Labels
@@ -84,46 +144,22 @@ func extract(unknown interface{}) runtime.Object {
 		newP.Rules = v.Rules
 		return newP.DeepCopyObject()
 
-	}
-	return nil
-}
-
-type fileWriter struct {
-	rootDir string
-	buffer  bytes.Buffer
-}
-
-// implement Writer interface
-func (f *fileWriter) Write(p []byte) (n int, err error) {
-	return f.buffer.Write(p)
-}
-
-func (f *fileWriter) flush(namespace, name, resourceType string) error {
-	/*
-		write the byte stream to a file, in the following format:
-		rootDir / namespaces / namespaceName / resourceType / filename
-		rootDir / non_namespaced / resourceType / filename
-	*/
-	path := f.rootDir
-
-	if namespace != "" {
-		path = f.rootDir + "/namespaces/" + namespace + "/" + resourceType
-	} else {
-		path = f.rootDir + "/non_namespaced/" + resourceType
-	}
-	err := os.MkdirAll(path, os.ModePerm)
-	if err != nil {
-		return err
-	}
-	return ioutil.WriteFile(path+"/"+name, f.buffer.Bytes(), os.ModePerm)
-
-}
+	case *unstructured.Unstructured:
+		// types only known at runtime: keep everything but status, and the same metadata as for the typed objects
+		rememberModification(v.GetKind(), v)
+		newP := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		for k, val := range v.Object {
+			if k != "metadata" && k != "status" {
+				newP.Object[k] = val
+			}
+		}
+		newP.SetLabels(v.GetLabels())
+		newP.SetName(v.GetName())
+		newP.SetNamespace(v.GetNamespace())
+		return newP.DeepCopyObject()
 
-func newFileWriter() *fileWriter {
-	return &fileWriter{
-		rootDir: outputDirectory,
-		buffer:  bytes.Buffer{},
 	}
+	return nil
 }
 
 func addTypeInformationToObject(obj runtime.Object) error {
@@ -148,20 +184,96 @@ func addTypeInformationToObject(obj runtime.Object) error {
 	return nil
 }
 
-func dumpToFile(c runtime.Object, namespace, name, resourceType string) {
-	w := newFileWriter()
-	addTypeInformationToObject(c)
+func encodeObject(c runtime.Object, w io.Writer) error {
+	if err := addTypeInformationToObject(c); err != nil && c.GetObjectKind().GroupVersionKind().Empty() {
+		return err
+	}
 	s := json.NewYAMLSerializer(json.DefaultMetaFactory, scheme.Scheme, scheme.Scheme)
-	err := s.Encode(c, w)
+	return s.Encode(c, w)
+}
+
+func dumpToFile(c runtime.Object, namespace, name, resourceType string) error {
+	// safe to call from concurrent workers: every call has its own buffer, and the shared records are locked
+	if c == nil {
+		// of a type extract doesn't support, already counted there
+		return nil
+	}
+	started := time.Now()
+	c, err := transformObject(c)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("failed to transform %s %s/%s; %w", resourceType, namespace, name, err)
+	}
+	encoded := bytes.Buffer{}
+	err = encodeObject(c, &encoded)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s %s/%s; %w", resourceType, namespace, name, err)
+	}
+	if serializer.Format == formatCanonicalJSON {
+		canonical, err := canonicalJSON(encoded.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to encode %s %s/%s; %w", resourceType, namespace, name, err)
+		}
+		encoded.Reset()
+		encoded.Write(canonical)
+	}
+	first, err := claimWrite(c.GetObjectKind().GroupVersionKind(), namespace, name, encoded.Bytes())
+	if err != nil || !first {
+		return err
+	}
+	p := objectPath(namespace, name, resourceType)
+	if isIgnoredPath(p) || isIgnoredObject(c.GetObjectKind().GroupVersionKind().Kind, namespace, name) {
+		skipIgnored(p)
+		return nil
+	}
+
+	if err := countOutput(1, 0); err != nil {
+		return err
+	}
+	sum := sha256Hex(encoded.Bytes())
+	action := eventUnchanged
+	written := 0
+	if !isUnchanged(p, sum) {
+		action = eventWrote
+		formatted, err := formatYAML(encoded.Bytes(), c.GetObjectKind().GroupVersionKind().Kind, namespace, name)
+		if err != nil {
+			return fmt.Errorf("failed to format %s %s/%s; %w", resourceType, namespace, name, err)
+		}
+		w := newFileWriter()
+		w.Write(formatted)
+		err = w.flush(namespace, name, resourceType)
+		if err != nil {
+			return fmt.Errorf("failed to write %s %s/%s; %w", resourceType, namespace, name, err)
+		}
+		written = len(formatted)
+	}
+	if keepRaw {
+		if err := writeRaw(c.GetObjectKind().GroupVersionKind().Kind, namespace, name, resourceType); err != nil {
+			return err
+		}
 	}
-	w.flush(namespace, name, resourceType)
 
+	// an unchanged object is as much part of the export as a written one
+	gvk := c.GetObjectKind().GroupVersionKind()
+	recordRBAC(gvk.Kind, namespace, name, encoded.Bytes())
+	recordDigest(gvk.Kind, namespace, name, encoded.Bytes())
+	o := exportedObject{
+		APIVersion:   gvk.GroupVersion().String(),
+		Kind:         gvk.Kind,
+		Namespace:    namespace,
+		Name:         name,
+		Path:         p,
+		Sanitized:    isSanitized(namespace, name, resourceType),
+		LastModified: modificationOf(gvk.Kind, namespace, name),
+		SHA256:       sum,
+	}
+	recordExport(o)
+	timeWrite(gvk, started, written)
+	recordEvent(scanEvent{Action: action, Object: &result.ObjectRef{APIVersion: o.APIVersion, Kind: o.Kind, Namespace: namespace, Name: name}, Path: o.Path})
+	return nil
 }
 
 func isUserDefined(s, lookFor string) bool {
-	return strings.Contains(s, lookFor)
+	return matchesRolestring(s, lookFor)
 }
 
 func containsUserDefined(subjects []rbacv1.Subject, lookFor string) bool {
@@ -173,110 +285,679 @@ func containsUserDefined(subjects []rbacv1.Subject, lookFor string) bool {
 	return false
 }
 
+func runCommand(args []string) bool {
+	// sub-commands mostly work on existing exports - the few which need a cluster take their own -kubeconfig
+	if len(args) == 0 {
+		return false
+	}
+
+	var err error
+	switch args[0] {
+	case "codegen":
+		err = runCodegen(args[1:])
+	case "collector":
+		err = runCollector(args[1:])
+	case "dashboard":
+		err = runDashboard(args[1:])
+	case "drift":
+		err = runDrift(args[1:])
+	case "explain":
+		err = runExplain(args[1:])
+	case "extract":
+		err = runExtract(args[1:])
+	case "fingerprints":
+		err = runFingerprints(args[1:])
+	case "fleet":
+		err = runFleet(args[1:])
+	case "grep":
+		err = runGrep(args[1:])
+	case "hold":
+		err = runHold(args[1:])
+	case "merge":
+		err = runMerge(args[1:])
+	case "prune":
+		err = runPrune(args[1:])
+	case "rbac":
+		err = runRBAC(args[1:])
+	case "verify-restore":
+		err = runVerifyRestore(args[1:])
+	case "version":
+		err = runVersion(args[1:])
+	case "view":
+		err = runView(args[1:])
+	case "self-update":
+		err = runSelfUpdate(args[1:])
+	default:
+		return false
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+	return true
+}
+
 func main() {
 
+	if runCommand(os.Args[1:]) {
+		return
+	}
+
 	var kubeconfig *string
+	var timezone, timeFormat *string
+	var server *string
+	var tokenFile *string
+	var caFile *string
+	var insecureTLS *bool
 	var outputDir *string
 	var roleRefString *string
+	var matchMode *string
+	var siemAddress *string
+	var siemFormat *string
+	var backstage *bool
+	var revisionHistory *int
+	var envInventory *bool
+	var envAllow *string
+	var sidecarReport *bool
+	var topologyReport *bool
+	var imagePlatforms *bool
+	var registryAuth *string
+	var pluginCache *string
+	var requireArch *string
+	var imagePinning *bool
+	var exposureReport *bool
+	var quotaCheck *bool
+	var namespace *string
+	var allNamespaces *bool
+	var baseline *string
+	var writeBaselineFile *string
+	var failOn *string
+	var disableChecks *string
+	var remediation *bool
+	var status *bool
+	var metricsAddr *string
+	var ownerLabel *string
+	var clusterName *string
+	var serviceNow *string
+	var sbom *bool
+	var kindStatistics *bool
+	var sample *string
+	var deploymentServiceAccounts *string
+	var boundNamespacesOnly *bool
+	var boundScopeOnly *bool
+	var samplePerNamespace *int
+	var terraform *bool
+	var terraformFlavor *string
+	var presetList *string
+	var fsync *bool
+	var compress *string
+	var profile *string
+	var resourceList *string
+	var includeSystem *bool
+	var systemNamespaces *string
+	var accessReport *bool
+	var unmatchedReport *bool
+	var namespaceGrantsView *bool
+	var matchingRoles *bool
+	var roleUsage *bool
+	var bySubject *bool
+	var conflicts *string
+	var subjectInventory *bool
+	var maxObjects *int
+	var maxCalls *int
+	var maxOutputSize *string
+	var limitAction *string
+	var yamlIndent *int
+	var yamlFlowLists *bool
+	var yamlNoWrap *bool
+	var outputFormat *string
+	var yamlMultiline *string
+	var header *bool
+	var configFile *string
+	var retentionClass *string
+	var legalHold *string
+	var annotateNS *bool
+	var auditLog *string
+	var auditEvents *int
+	var gitCommit *string
+	var skipUnchangedObjects *bool
+	var keepRawObjects *bool
+	var explainSteps *bool
+	var requestTimeout *time.Duration
+	var consistency *string
+	var pushTo *string
+	var uploadS3 *string
+	var s3Endpoint *string
+	var s3Region *string
+	var s3PartSize *string
+	var s3Bandwidth *string
+	var s3Staging *string
+	var pushTokenFile *string
+	var cpuProfile *string
+	var memProfile *string
+	var pprofAddr *string
+	var dataDir *string
+	var lint *string
+	var blastRadiusRanking *bool
+	var interval *time.Duration
+	var watchRBAC *bool
+	var leaderElect *bool
+	var leaseNS *string
+	var lockMode *string
+	var lockNamespace *string
+	var lockName *string
+	var lockTTL *time.Duration
+	var leaseName *string
+	var alertWebhook *string
+	var alertEvents *bool
 
 	outputDir = flag.String("outdir", defaultOutputDir, "absolute path to the directory to write the yaml files into")
 	roleRefString = flag.String("rolestring", userDefinedUserString, "common string used in user-defined role refs: for example, OPSH, or RES-DEV")
-
-	if home := homedir.HomeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	} else {
-		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
-	}
+	matchMode = flag.String("match-mode", matchContains, "how -rolestring matches subject names: contains, prefix, suffix, exact or regex")
+
+	configFile = flag.String("config", "", "(optional) yaml config file holding the structured settings, such as the file header template - or configmap:<namespace>/<name> to read it from a configmap. a daemon applies changes to it before every scan")
+	profile = flag.String("profile", "", "(optional) named bundle of settings for a common use case: "+profileNames())
+	namespace = flag.String("namespace", "", "(optional) only scan this namespace, listing from it directly so that namespace scoped read access is enough - cluster bindings are left out unless named in -resources")
+	allNamespaces = flag.Bool("all-namespaces", false, "(optional) scan every namespace, even when the kubeconfig context sets a default one")
+	resourceList = flag.String("resources", defaultResources, "comma separated list of resource sets to scan: deployments, rbac (namespaced bindings and roles), clusterrbac, admissionpolicies (cel admission policies and their bindings)")
+	includeSystem = flag.Bool("include-system", false, "(optional) also scan the system namespaces, which are skipped by default")
+	systemNamespaces = flag.String("system-namespaces", defaultSystemNamespaces, "comma separated list of namespace patterns treated as system namespaces")
+	yamlIndent = flag.Int("yaml-indent", 2, "spaces per indentation level in the exported yaml")
+	outputFormat = flag.String("output-format", formatYAMLOutput, "how exported objects are written: yaml, or canonical-json for rfc 8785 json which always serialises the same object to the same bytes")
+	yamlNoWrap = flag.Bool("yaml-no-wrap", false, "(optional) keep long strings on one line in the exported yaml, rather than folding them at 80 columns")
+	yamlMultiline = flag.String("yaml-multiline", "", "(optional) write strings holding line breaks as literal blocks (literal) or double quoted strings (quoted), rather than choosing for each")
+	yamlFlowLists = flag.Bool("yaml-flow-lists", false, "(optional) write lists of plain values inline, for example verbs: [get, list]")
+	header = flag.Bool("header", false, "(optional) start every exported file with a comment saying when and from which cluster it was exported - a header template in the config file replaces it, and is always applied")
+	fsync = flag.Bool("fsync", false, "(optional) sync every written file to disk before moving on, slower but safe against crashes")
+	compress = flag.String("compress", "", "(optional) comma separated list of resource types to write gzipped, for example deployment,role - or * for all")
+	maxCalls = flag.Int("max-api-calls", 0, "(optional) most requests a scan may make to the api server, it stops once it needs more - 0 for no limit")
+	maxObjects = flag.Int("max-objects", 0, "(optional) most objects a scan may export, 0 for no limit")
+	maxOutputSize = flag.String("max-output-size", "", "(optional) most a scan may write to the output directory, for example 500Mi or 2G")
+	limitAction = flag.String("limit-action", limitStop, "what to do when a scan goes over -max-objects or -max-output-size: stop, or warn and carry on")
+	presetList = flag.String("preset", "", "(optional) comma separated list of additional resource presets to export: "+presetNames())
+	siemAddress = flag.String("siem", "", "(optional) syslog endpoint to send findings to, for example udp://siem.example.com:514")
+	siemFormat = flag.String("siem-format", "cef", "message format used for findings sent to the siem endpoint: cef or leef")
+	revisionHistory = flag.Int("revision-history", 0, "(optional) also export the replicasets of the last n revisions of every deployment, so that rollbacks survive a restore")
+	envInventory = flag.Bool("env-inventory", false, "(optional) also write an inventory of the environment variables set in every container, with their values masked")
+	envAllow = flag.String("env-allow", "", "(optional) comma separated list of environment variable names, or patterns such as LOG_*, whose values are shown in the inventory")
+	sidecarReport = flag.Bool("sidecar-report", false, "(optional) also write a report of the init containers and well known sidecars in use, with their versions")
+	topologyReport = flag.Bool("topology-report", false, "(optional) also write a summary of the node selectors, tolerations, affinities and spread constraints of every deployment")
+	imagePlatforms = flag.Bool("image-platforms", false, "(optional) also look up the platforms every image is built for in its registry, and report those missing -require-arch")
+	imagePinning = flag.Bool("image-pinning", false, "(optional) also report which containers run images by tag, and write patches pinning every tag to its current digest")
+	pluginCache = flag.String("plugin-cache", defaultPluginCache(), "(optional) directory caching the plugin bundles of the config, pinned ones are not fetched again")
+	registryAuth = flag.String("registry-auth", defaultRegistryAuth(), "(optional) docker config.json holding registry credentials for -image-platforms and -image-pinning, public images need none")
+	requireArch = flag.String("require-arch", "arm64", "architecture, or os/architecture, every image is expected to support")
+	exposureReport = flag.Bool("exposure-report", false, "(optional) also trace every deployment through its services to ingresses, routes and load balancers, and report those reachable from outside")
+	quotaCheck = flag.Bool("quota-check", false, "(optional) also check the requests of every namespace's deployments against its resource quotas, and flag namespaces already over-committed")
+	baseline = flag.String("baseline", "", "(optional) file of accepted findings, as written by -write-baseline - these are left out of the result, and the run fails on anything else unless -fail-on sets a higher threshold")
+	writeBaselineFile = flag.String("write-baseline", "", "(optional) write every finding of this run to the given file, to be used as a -baseline later")
+	failOn = flag.String("fail-on", "", "(optional) fail the run when anything of this severity or above was found: low, medium or high")
+	disableChecks = flag.String("disable-checks", "", "(optional) comma separated ids of checks whose findings are dropped, on top of checks.disable in the config file")
+	remediation = flag.Bool("remediation", false, "(optional) also check deployments for missing labels, resource limits and latest tags, and write json patches fixing them under remediation/")
+	status = flag.Bool("status", false, "(optional) also write status.json: a grade, finding counts and the number of objects changed since the previous run, for dashboards - rewritten after every run in daemon mode")
+	metricsAddr = flag.String("metrics-addr", "", "(optional) in daemon mode, serve prometheus metrics of the latest run on this address, for example :9090 - see the dashboard command")
+	dataDir = flag.String("data-dir", "", "(optional) directory of vendored data for clusters without egress: deprecations.yaml, schemas/ holding crds, policies/ holding custom checks and images.yaml")
+	cpuProfile = flag.String("cpuprofile", "", "(optional) write a cpu profile of the scan to this file, for go tool pprof")
+	memProfile = flag.String("memprofile", "", "(optional) write a memory profile of the scan to this file once it is done, for go tool pprof")
+	pprofAddr = flag.String("pprof-addr", "", "(optional) serve the pprof endpoints under /debug/pprof/ on this address, for example localhost:6060")
+	pushTo = flag.String("push-to", "", "(optional) url of a kube-scanner collector to push the output directory to after every successful scan, see the collector command")
+	pushTokenFile = flag.String("push-token-file", "", "file holding the bearer token for -push-to")
+	uploadS3 = flag.String("upload-s3", "", "(optional) upload the output directory as a tar.gz to s3://bucket/prefix after every successful scan, as a resumable multipart upload")
+	s3Endpoint = flag.String("s3-endpoint", "", "(optional) url of the s3 api for -upload-s3, such as that of a minio - aws in -s3-region by default")
+	s3Region = flag.String("s3-region", "", "(optional) region of the -upload-s3 bucket, defaults to $AWS_REGION or us-east-1")
+	s3PartSize = flag.String("s3-part-size", "64Mi", "size of the parts -upload-s3 sends the archive in, at least 5Mi - a failed part is all that is sent again")
+	s3Bandwidth = flag.String("s3-bandwidth", "", "(optional) bytes per second -upload-s3 may use, such as 10Mi")
+	s3Staging = flag.String("s3-staging", "", "(optional) directory keeping archives until their upload completed, so that a later run can resume it - defaults to a directory under the system temp directory")
+	annotateNS = flag.Bool("annotate-namespaces", false, "(optional) annotate every scanned namespace with kube-scanner.io/last-scan and a summary of its findings, needs patch on namespaces")
+	auditLog = flag.String("audit-log", "", "(optional) comma separated kubernetes audit log files, gzipped or not, whose latest writes to each exported object are recorded in result.json")
+	auditEvents = flag.Int("audit-events", 5, "number of audit log writes kept per object with -audit-log")
+	requestTimeout = flag.Duration("request-timeout", 0, "(optional) give up on any single request to the api server after this long, for example 30s - no limit by default")
+	consistency = flag.String("list-consistency", listConsistent, "how lists are read: consistent, from etcd, or cache, from the api server's watch cache - much cheaper on large clusters, and at most a few seconds stale")
+	explainSteps = flag.Bool("explain-pipeline", false, "print the steps every exported object goes through, in order, from the pipeline of the config file, and exit")
+	keepRawObjects = flag.Bool("keep-raw", false, "(optional) also write every exported object as the api returned it, unpruned, under raw/")
+	skipUnchangedObjects = flag.Bool("skip-unchanged", false, "(optional) don't write objects again whose content hash matches that of the previous run into the same output directory")
+	gitCommit = flag.String("git-commit", "", "(optional) commit the output directory, inside a git work tree, after every scan: single for one commit, namespace or kind for one commit per namespace or kind of object")
+	retentionClass = flag.String("retention-class", "", "(optional) retention class recorded in the manifest, one of retention.classes in the config file - see the prune command")
+	legalHold = flag.String("legal-hold", "", "(optional) place the export under legal hold for this reason, so that prune never removes it")
+	backstage = flag.Bool("backstage", false, "(optional) also write a backstage catalog-info.yaml describing the exported deployments")
+	ownerLabel = flag.String("owner-label", "team", "label holding the owning team of a deployment, used in generated catalog and inventory files")
+	serviceNow = flag.String("servicenow", "", "(optional) also write a servicenow cmdb import set in the given format: json or csv")
+	deploymentServiceAccounts = flag.String("deployment-service-accounts", "", "(optional) comma separated service account names or globs, only deployments running as one of them are exported")
+	boundNamespacesOnly = flag.Bool("deployments-in-bound-namespaces", false, "(optional) only export deployments of namespaces holding a rolebinding matched by the rolestring")
+	boundScopeOnly = flag.Bool("bound-namespaces-only", false, "(optional) leave every namespace without a rolebinding matched by the rolestring out of the snapshot: deployments and namespaced preset objects, rbac is kept")
+	sample = flag.String("sample", "", "(optional) only export this share of the deployments of every namespace, such as 10%, rbac is always exported in full")
+	samplePerNamespace = flag.Int("sample-per-namespace", 0, "(optional) export at most this many deployments of every namespace, rbac is always exported in full")
+	kindStatistics = flag.Bool("kind-stats", false, "(optional) log how long every resource took to list, extract and write, and the bytes written, and write it to reports/kind-stats.json")
+	sbom = flag.Bool("sbom", false, "(optional) also write a cyclonedx sbom describing the deployed workloads and their images")
+	matchingRoles = flag.Bool("export-matching-roles", false, "(optional) also export roles and clusterroles whose name or labels hold the rolestring, even when no matched binding refers to them")
+	unmatchedReport = flag.Bool("unmatched-report", false, "(optional) also write the users and groups of bindings the rolestring didn't match, to check it isn't missing any")
+	namespaceGrantsView = flag.Bool("namespace-grants", false, "(optional) also write what the matched bindings grant per namespace, telling roles of the namespace apart from clusterroles bound in it")
+	accessReport = flag.Bool("access-report", false, "(optional) also write a report of namespace access per matched group")
+	roleUsage = flag.Bool("clusterrole-usage", false, "(optional) also write a report of every binding, matched or not, referring to each exported clusterrole")
+	subjectInventory = flag.Bool("subject-inventory", false, "(optional) also write an inventory of every matched user and group and its grants - on openshift, matched groups are exported and their users listed too")
+	conflicts = flag.String("write-conflicts", conflictWarn, "what to do when one object is read twice in a run with different content: warn, keeping the first, or fail")
+	bySubject = flag.Bool("by-subject", false, "(optional) also write every matched user and group's bindings and roles into a directory of its own, under by-subject")
+	lint = flag.String("lint", "", "(optional) validate every exported file against the api types once written: warn, or fail to exit non-zero on problems")
+	blastRadiusRanking = flag.Bool("blast-radius", false, "(optional) also write a ranking of namespaces by the risk of their user-defined rbac")
+	terraform = flag.Bool("terraform", false, "(optional) also write terraform kubernetes_manifest resources and import commands for everything exported")
+	terraformFlavor = flag.String("terraform-flavor", terraformManifest, "kind of terraform resources to write: manifest for kubernetes_manifest only, or rbac to write roles and bindings as kubernetes_role and kubernetes_role_binding resources")
+	interval = flag.Duration("interval", 0, "(optional) run as a daemon, scanning again every interval, for example 15m")
+	leaderElect = flag.Bool("leader-elect", false, "(optional) in daemon mode, only scan while holding a lease, so that one of several replicas scans at a time - needs get, create and update on leases")
+	lockMode = flag.String("scan-lock", "", "(optional) keep scans of the same output from overlapping: file for a lock file next to the output directory, lease for a lease in the cluster")
+	lockNamespace = flag.String("scan-lock-namespace", "", "namespace of the -scan-lock lease, defaults to that of the pod, or the kubeconfig context")
+	lockName = flag.String("scan-lock-lease", "kube-scanner-scan", "name of the -scan-lock lease, scans sharing it never overlap")
+	lockTTL = flag.Duration("scan-lock-ttl", 10*time.Minute, "a scan lock left unrenewed for this long is taken over, its holder presumed gone")
+	leaseNS = flag.String("leader-elect-namespace", "", "namespace of the -leader-elect lease, defaults to that of the pod, or the kubeconfig context")
+	leaseName = flag.String("leader-elect-lease", "kube-scanner", "name of the -leader-elect lease, replicas sharing it scan one at a time")
+	watchRBAC = flag.Bool("watch-rbac", false, "(optional) in daemon mode, alert whenever a matched binding or role changes between scans")
+	alertWebhook = flag.String("alert-webhook", "", "(optional) url to post rbac change alerts to as json, in addition to logging them")
+	alertEvents = flag.Bool("alert-events", false, "(optional) also record rbac change alerts as kubernetes events on the changed object")
+	clusterName = flag.String("cluster-name", "", "(optional) name identifying the cluster in generated files, defaults to the api server host")
+	timezone, timeFormat = timeFlags(flag.CommandLine)
+
+	kubeconfig = kubeconfigFlag(flag.CommandLine)
+	server = flag.String("server", "", "(optional) url of the api server, used with -token-file instead of a kubeconfig")
+	tokenFile = flag.String("token-file", "", "(optional) file holding the bearer token for -server, read again when it changes")
+	caFile = flag.String("certificate-authority", "", "(optional) ca certificate file verifying -server, the system roots by default")
+	insecureTLS = flag.Bool("insecure-skip-tls-verify", false, "(optional) don't verify the certificate of -server, for test clusters only")
 
 	flag.Parse()
 
-	outputDirectory = *outputDir
-
-	// use the current context in kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err := applyProfile(flag.CommandLine, *profile); err != nil {
+		log.Fatal(err)
+	}
+	if err := setReportTime(*timezone, *timeFormat); err != nil {
+		log.Fatal(err)
+	}
+	resources, err := parseResources(*resourceList)
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	// create the clientset
-	clientset, err := kubernetes.NewForConfig(config)
+	if (*boundScopeOnly || *boundNamespacesOnly) && !resources["rbac"] {
+		// without rolebindings no namespace is bound, and nothing would be exported
+		log.Fatal("-bound-namespaces-only and -deployments-in-bound-namespaces need rbac in -resources")
+	}
+	policies, err := loadDataDir(*dataDir)
 	if err != nil {
 		log.Fatal(err)
 	}
+	serializer = serializerOptions{
+		Format:    *outputFormat,
+		Indent:    *yamlIndent,
+		FlowLists: *yamlFlowLists,
+		Header:    *header,
+		NoWrap:    *yamlNoWrap,
+		Multiline: *yamlMultiline,
+	}
+	if err := validateSerializerOptions(serializer, headerConfig{}); err != nil {
+		log.Fatal(err)
+	}
 
-	// go through our list of types, and simply grab all we can from the cluster
-	deployments, err := clientset.AppsV1().Deployments("").List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
+	// everything derived from the config, done again whenever a daemon's config changes
+	var windows *scanWindows
+	applyConfig := func(c scanConfig) error {
+		if err := validateSerializerOptions(serializer, c.Header); err != nil {
+			return err
+		}
+		if err := parseHeaderTemplate(c.Header); err != nil {
+			return err
+		}
+		if err := parseSubjectConfig(c.Subjects); err != nil {
+			return err
+		}
+		// only the daemon waits for them, but a broken schedule is an error either way
+		w, err := parseScanWindows(c.Schedule)
+		if err != nil {
+			return err
+		}
+		plugins, err := loadPlugins(c.Plugins, *pluginCache, *registryAuth)
+		if err != nil {
+			return err
+		}
+		c.Checks.Custom = append(append(append([]customCheck{}, c.Checks.Custom...), policies...), plugins.Checks...)
+		c.Pipeline = append(append([]pipelineStep{}, c.Pipeline...), plugins.Pipeline...)
+		if err := setRetention(c.Retention, *retentionClass, *legalHold); err != nil {
+			return err
+		}
+		setChecks(c.Checks, *disableChecks)
+		if err := parseCustomChecks(c.Checks.Custom); err != nil {
+			return err
+		}
+		steps, err := parsePipeline(c.Pipeline)
+		if err != nil {
+			return err
+		}
+		if err := validateTeams(c.Teams); err != nil {
+			return err
+		}
+		if err := validateHooks(c.Hooks); err != nil {
+			return err
+		}
+		if err := validateGolden(c.Golden); err != nil {
+			return err
+		}
+		setPluginPresets(plugins.Presets)
+		cfg, windows, transforms = c, w, steps
+		return nil
+	}
+	// a configmap is read once there is a client to read it with
+	if !isConfigMapSource(*configFile) {
+		c, err := loadConfig(*configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := applyConfig(c); err != nil {
+			log.Fatal(err)
+		}
+		if *explainSteps {
+			fmt.Print(explainPipeline(transforms))
+			return
+		}
+	}
+	if err := validateSeverity(*failOn); err != nil {
 		log.Fatal(err)
 	}
 
-	for _, deployment := range deployments.Items {
-		dumpToFile(extract(deployment), deployment.ObjectMeta.Namespace, deployment.ObjectMeta.Name, "deployment")
+	if !*includeSystem {
+		setSkippedNamespaces(*systemNamespaces)
 	}
 
-	/*
-		Most roles and roles bindings within the cluster are either default, or controlled by operators. In order to only extract those which are created for user access
-		we need to go through the list of bindings, and only extract those that have a roleRef (membership) that is a user / group that we care about - for example:
+	limits, err = parseLimits(*maxObjects, *maxOutputSize, *limitAction)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		RES-DEV-OPSH-DEVELOPER-FDS_TADPOLE
+	if *terraformFlavor != terraformManifest && *terraformFlavor != terraformRBAC {
+		log.Fatalf("unsupported terraform flavor %q: expected manifest or rbac", *terraformFlavor)
+	}
 
-		Need to work using bindings as the Roles themselves hold no reference to the binding objects
-	*/
+	if *serviceNow != "" && *serviceNow != "json" && *serviceNow != "csv" {
+		log.Fatalf("unsupported servicenow format %q: expected json or csv", *serviceNow)
+	}
 
-	bindings, err := clientset.RbacV1().RoleBindings("").List(context.TODO(), metav1.ListOptions{})
+	if *conflicts != conflictWarn && *conflicts != conflictFail {
+		log.Fatalf("unsupported -write-conflicts %q: expected warn or fail", *conflicts)
+	}
+	writeConflicts = *conflicts
+	skipUnchanged = *skipUnchangedObjects
+	keepRaw = *keepRawObjects
+	if err := setListConsistency(*consistency); err != nil {
+		log.Fatal(err)
+	}
+	samplePercent, err := parseSamplePercent(*sample)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if *samplePerNamespace < 0 {
+		log.Fatal("-sample-per-namespace can't be negative")
+	}
+	if err := validatePatterns("-deployment-service-accounts", *deploymentServiceAccounts); err != nil {
+		log.Fatal(err)
+	}
+	matchModeSet := false
+	flag.Visit(func(f *flag.Flag) {
+		matchModeSet = matchModeSet || f.Name == "match-mode"
+	})
+	if err := setMatchMode(*matchMode, *roleRefString, matchModeSet); err != nil {
+		log.Fatal(err)
+	}
 
-	userDefinedBindings := []rbacv1.RoleBinding{}
+	if *lint != "" && *lint != lintWarn && *lint != lintFail {
+		log.Fatalf("unsupported lint mode %q: expected warn or fail", *lint)
+	}
 
-	for _, binding := range bindings.Items {
-		subjects := binding.Subjects
-		if containsUserDefined(subjects, *roleRefString) {
-			userDefinedBindings = append(userDefinedBindings, binding)
+	outputDirectory = *outputDir
+	output = osFS{fsync: *fsync}
+	for _, t := range strings.Split(*compress, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			compressedTypes[t] = true
 		}
 	}
 
-	for _, binding := range userDefinedBindings {
+	var siem *siemWriter
+	if *siemAddress != "" {
+		siem, err = newSIEMWriter(*siemAddress, *siemFormat)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer siem.Close()
+	}
+
+	// use the current context in kubeconfig, unless told where the api server is and given a token for it
+	var config *rest.Config
+	contextNamespace := ""
+	if *server != "" || *tokenFile != "" {
+		if *kubeconfig != "" {
+			log.Fatal("-kubeconfig can't be used with -server and -token-file")
+		}
+		config, err = serverConfig(*server, *tokenFile, *caFile, *insecureTLS)
+	} else {
+		config, contextNamespace, err = loadKubeconfig(*kubeconfig)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.Timeout = *requestTimeout
+	if *maxCalls < 0 {
+		log.Fatal("-max-api-calls can't be negative")
+	}
+	maxAPICalls = *maxCalls
+	config.Wrap(wrapAPIBudget)
+	if err := validateScanLock(*lockMode, *lockTTL); err != nil {
+		log.Fatal(err)
+	}
+	scanLock = scanLockSettings{mode: *lockMode, namespace: leaseNamespace(*lockNamespace, contextNamespace), name: *lockName, ttl: *lockTTL}
 
-		dumpToFile(extract(binding), binding.ObjectMeta.Namespace, binding.ObjectMeta.Name, "binding")
+	// like kubectl, a namespace set on the context applies unless one is given, or every namespace is asked for
+	scanNamespace = *namespace
+	if scanNamespace == "" && !*allNamespaces && contextNamespace != "" {
+		scanNamespace = contextNamespace
+		log.Printf("scanning namespace %s from the kubeconfig context, use -all-namespaces to scan the whole cluster", scanNamespace)
+	}
+	if scanNamespace != "" {
+		// cluster bindings and admission policies need read access to the whole cluster, so they're only scanned when asked for
+		resourcesSet := false
+		flag.Visit(func(f *flag.Flag) {
+			resourcesSet = resourcesSet || f.Name == "resources"
+		})
+		if !resourcesSet {
+			delete(resources, "clusterrbac")
+			delete(resources, "admissionpolicies")
+		}
+	}
 
-		opts := metav1.ListOptions{
-			FieldSelector: fields.OneTermEqualSelector("metadata.name", binding.RoleRef.Name).String(),
+	if *clusterName == "" {
+		*clusterName = config.Host
+	}
+	clusterIdentity = *clusterName
+	apiServerHost = config.Host
+	var s3 *s3Target
+	if *uploadS3 != "" {
+		if s3, err = newS3Target(*uploadS3, *s3Endpoint, *s3Region, *s3PartSize, *s3Bandwidth, *s3Staging); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *pushTo != "" {
+		if *pushTokenFile == "" {
+			log.Fatal("-push-to needs -push-token-file")
 		}
-		roles, _ := clientset.RbacV1().Roles(binding.ObjectMeta.Namespace).List(context.TODO(), opts)
-		for _, role := range roles.Items {
-			dumpToFile(extract(role), role.ObjectMeta.Namespace, role.ObjectMeta.Name, "role")
+		if !validClusterName(*clusterName) {
+			log.Fatalf("the collector stores clusters by name, and %q can't be one: set -cluster-name", *clusterName)
 		}
+	}
 
+	// create the clientset
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	// repeat for cluster bindings
-	clusterBindings, err := clientset.RbacV1().ClusterRoleBindings().List(context.TODO(), metav1.ListOptions{})
+	dynamicClient, err := dynamic.NewForConfig(config)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	userDefinedClusterBindings := []rbacv1.ClusterRoleBinding{}
+	opts := scanOptions{
+		roleRefString:      *roleRefString,
+		resources:          resources,
+		clusterName:        *clusterName,
+		ownerLabel:         *ownerLabel,
+		backstage:          *backstage,
+		revisionHistory:    *revisionHistory,
+		envInventory:       *envInventory,
+		envAllow:           *envAllow,
+		sidecarReport:      *sidecarReport,
+		topologyReport:     *topologyReport,
+		imagePlatforms:     *imagePlatforms,
+		registryAuth:       *registryAuth,
+		requireArch:        *requireArch,
+		imagePinning:       *imagePinning,
+		exposureReport:     *exposureReport,
+		quotaCheck:         *quotaCheck,
+		baseline:           *baseline,
+		writeBaseline:      *writeBaselineFile,
+		failOn:             *failOn,
+		remediation:        *remediation,
+		status:             *status,
+		serviceNow:         *serviceNow,
+		sbom:               *sbom,
+		kindStats:          *kindStatistics,
+		samplePercent:      samplePercent,
+		deploymentSAs:      *deploymentServiceAccounts,
+		boundOnly:          *boundNamespacesOnly,
+		boundScope:         *boundScopeOnly,
+		samplePerNamespace: *samplePerNamespace,
+		accessReport:       *accessReport,
+		unmatchedReport:    *unmatchedReport,
+		namespaceGrants:    *namespaceGrantsView,
+		matchingRoles:      *matchingRoles,
+		roleUsage:          *roleUsage,
+		bySubject:          *bySubject,
+		subjectInventory:   *subjectInventory,
+		blastRadius:        *blastRadiusRanking,
+		presets:            *presetList,
+		lint:               *lint,
+		annotateNamespaces: *annotateNS,
+		auditLog:           *auditLog,
+		auditEvents:        *auditEvents,
+		gitCommit:          *gitCommit,
+		terraform:          *terraform,
+		terraformFlavor:    *terraformFlavor,
+	}
 
-	for _, binding := range clusterBindings.Items {
-		subjects := binding.Subjects
-		if containsUserDefined(subjects, *roleRefString) {
-			userDefinedClusterBindings = append(userDefinedClusterBindings, binding)
-		}
+	if err := validateGitCommit(*gitCommit); err != nil {
+		log.Fatal(err)
 	}
 
-	for _, binding := range userDefinedClusterBindings {
+	if *auditLog != "" && *auditEvents < 1 {
+		log.Fatal("-audit-events must be at least 1")
+	}
 
-		dumpToFile(extract(binding), binding.ObjectMeta.Namespace, binding.ObjectMeta.Name, "clusterbinding")
+	if *metricsAddr != "" {
+		if *interval == 0 {
+			log.Fatal("-metrics-addr needs -interval, a single scan exits before anything could scrape it")
+		}
+		opts.metrics = newMetricsServer(*metricsAddr)
+	}
 
-		role, err := clientset.RbacV1().ClusterRoles().Get(context.TODO(), binding.RoleRef.Name, metav1.GetOptions{})
-		if err != nil {
+	// a daemon picks up config changes between scans, see configreload.go
+	var watcher *configWatcher
+	if *configFile != "" && (*interval != 0 || isConfigMapSource(*configFile)) {
+		watcher = &configWatcher{source: *configFile, clientset: clientset, apply: applyConfig}
+		if _, err := watcher.reload(); err != nil {
 			log.Fatal(err)
 		}
+		if *explainSteps {
+			fmt.Print(explainPipeline(transforms))
+			return
+		}
+		if opts.metrics != nil {
+			opts.metrics.handle("/config", watcher)
+		}
+	}
 
-		dumpToFile(extract(role), role.ObjectMeta.Namespace, role.ObjectMeta.Name, "clusterrole")
+	if *leaderElect && *interval == 0 {
+		log.Fatal("-leader-elect needs -interval, a single scan has nothing to share with other replicas")
+	}
 
+	if *interval != 0 && (*cpuProfile != "" || *memProfile != "") {
+		log.Fatal("-cpuprofile and -memprofile profile a single scan, a daemon is profiled live with -pprof-addr")
+	}
+	if *pprofAddr != "" {
+		servePprof(*pprofAddr)
 	}
 
+	if *interval == 0 {
+		stopProfiling, err := startProfiling(*cpuProfile, *memProfile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = runScan(clientset, dynamicClient, siem, opts)
+		// log.Fatal skips deferred calls, the profiles of a failed scan are as interesting
+		stopProfiling()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *pushTo != "" {
+			if err := pushResults(*pushTo, *pushTokenFile, *clusterName, outputDirectory); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if s3 != nil {
+			if err := uploadToS3(s3, *clusterName, outputDirectory); err != nil {
+				log.Fatal(err)
+			}
+		}
+		return
+	}
+
+	/*
+		daemon mode: a failed scan is logged and retried on the next tick rather than stopping the daemon, and only
+		complete scans are compared against each other for rbac changes
+	*/
+	var tracker *rbacTracker
+	if *watchRBAC {
+		tracker = newRBACTracker(clientset, *clusterName, *alertWebhook, *alertEvents)
+	}
+	daemon := func() {
+		for {
+			if watcher != nil {
+				if changed, err := watcher.reload(); err != nil {
+					log.Printf("config not reloaded, keeping the active one: %v", err)
+				} else if changed {
+					log.Printf("config reloaded from %s", *configFile)
+				}
+			}
+			windows.wait()
+			if err := runScan(clientset, dynamicClient, siem, opts); err != nil {
+				log.Printf("scan failed: %v", err)
+			} else {
+				if tracker != nil {
+					if err := tracker.update(currentRBACState()); err != nil {
+						log.Print(err)
+					}
+				}
+				// the collector keeps the previous snapshot, the next run tries again
+				if *pushTo != "" {
+					if err := pushResults(*pushTo, *pushTokenFile, *clusterName, outputDirectory); err != nil {
+						log.Printf("push failed: %v", err)
+					}
+				}
+				// an unfinished upload is resumed after the next scan
+				if s3 != nil {
+					if err := uploadToS3(s3, *clusterName, outputDirectory); err != nil {
+						log.Printf("upload failed: %v", err)
+					}
+				}
+			}
+			time.Sleep(*interval)
+		}
+	}
+	if *leaderElect {
+		if err := runAsLeader(clientset, leaseNamespace(*leaseNS, contextNamespace), *leaseName, daemon); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	daemon()
 }
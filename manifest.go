@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const manifestFile string = "manifest.json"
+
+// versioned the same way, and with the same guarantees, as the result - see the result package
+const (
+	manifestAPIVersion string = "kube-scanner.io/v1"
+	manifestKind       string = "ExportManifest"
+)
+
+// describes an export as a whole: where it came from, and what produced it
+type exportManifest struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Tool       buildInfo `json:"tool"`
+	Cluster    string    `json:"cluster"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Objects    int       `json:"objects"`
+	Findings   int       `json:"findings"`
+	// see retention.go, left out when no class or legal hold was asked for
+	Retention *retentionInfo `json:"retention,omitempty"`
+	// see fingerprint.go, left out when the scan couldn't read kube-system
+	Fingerprint *clusterFingerprint `json:"fingerprint,omitempty"`
+	// see sample.go, left out of snapshots holding every deployment
+	Sample *sampleInfo `json:"sample,omitempty"`
+}
+
+func writeManifest(cluster string, startedAt time.Time) error {
+	m := exportManifest{
+		APIVersion:  manifestAPIVersion,
+		Kind:        manifestKind,
+		Tool:        currentBuildInfo(),
+		Cluster:     cluster,
+		StartedAt:   startedAt.UTC(),
+		FinishedAt:  time.Now().UTC(),
+		Objects:     len(exported),
+		Findings:    len(findings),
+		Retention:   currentRetention(startedAt),
+		Fingerprint: currentFingerprint,
+		Sample:      currentSample,
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeRootFile(manifestFile, b)
+}
+
+func readManifest(dir string) (exportManifest, error) {
+	m := exportManifest{}
+	b, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return m, err
+	}
+
+	switch m.APIVersion {
+	case "":
+		// written before the manifest was versioned, and otherwise identical to v1
+		m.APIVersion, m.Kind = manifestAPIVersion, manifestKind
+	case manifestAPIVersion:
+	default:
+		return m, fmt.Errorf("unsupported manifest version %q in %s: this release reads up to %s", m.APIVersion, dir, manifestAPIVersion)
+	}
+	return m, nil
+}
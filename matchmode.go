@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+/*
+	the rolestring was always matched anywhere in a subject name, so a short one like DEV also matches DEVICE-MANAGER.
+	-match-mode says how it matches instead: contains, still the default for now, prefix, suffix, exact or regex,
+	where the rolestring is a regular expression matched anywhere unless anchored
+*/
+
+const (
+	matchContains string = "contains"
+	matchPrefix   string = "prefix"
+	matchSuffix   string = "suffix"
+	matchExact    string = "exact"
+	matchRegex    string = "regex"
+)
+
+var (
+	subjectMatchMode = matchContains
+	subjectPattern   *regexp.Regexp
+)
+
+func setMatchMode(mode, lookFor string, explicit bool) error {
+	switch mode {
+	case matchContains, matchPrefix, matchSuffix, matchExact:
+	case matchRegex:
+		re, err := regexp.Compile(lookFor)
+		if err != nil {
+			return fmt.Errorf("-rolestring is not a valid regular expression; %w", err)
+		}
+		subjectPattern = re
+	default:
+		return fmt.Errorf("unsupported -match-mode %q: expected contains, prefix, suffix, exact or regex", mode)
+	}
+	subjectMatchMode = mode
+	if !explicit {
+		log.Printf("deprecated: -rolestring %s is matched anywhere in subject names, set -match-mode to choose how it matches - contains keeps this behaviour", lookFor)
+	}
+	return nil
+}
+
+func matchesRolestring(s, lookFor string) bool {
+	switch subjectMatchMode {
+	case matchPrefix:
+		return strings.HasPrefix(s, lookFor)
+	case matchSuffix:
+		return strings.HasSuffix(s, lookFor)
+	case matchExact:
+		return s == lookFor
+	case matchRegex:
+		// the pattern is compiled once, from the -rolestring every caller passes in - anything else is a bug, not a miss
+		if subjectPattern == nil || subjectPattern.String() != lookFor {
+			panic(fmt.Sprintf("matchesRolestring: %q is not the -rolestring the regex was compiled from", lookFor))
+		}
+		return subjectPattern.MatchString(s)
+	}
+	return strings.Contains(s, lookFor)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+)
+
+func useMatchMode(t *testing.T, mode, lookFor string) {
+	t.Helper()
+	savedMode, savedPattern := subjectMatchMode, subjectPattern
+	t.Cleanup(func() { subjectMatchMode, subjectPattern = savedMode, savedPattern })
+	if err := setMatchMode(mode, lookFor, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatchesRolestring(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		lookFor string
+		s       string
+		want    bool
+	}{
+		{name: "contains", mode: matchContains, lookFor: "DEV", s: "DEVICE-MANAGER", want: true},
+		{name: "contains miss", mode: matchContains, lookFor: "DEV", s: "OPS"},
+		{name: "prefix", mode: matchPrefix, lookFor: "DEV", s: "DEV-TEAM", want: true},
+		{name: "prefix miss", mode: matchPrefix, lookFor: "DEV", s: "TEAM-DEV"},
+		{name: "suffix", mode: matchSuffix, lookFor: "DEV", s: "TEAM-DEV", want: true},
+		{name: "suffix miss", mode: matchSuffix, lookFor: "DEV", s: "DEV-TEAM"},
+		{name: "exact", mode: matchExact, lookFor: "DEV", s: "DEV", want: true},
+		{name: "exact miss", mode: matchExact, lookFor: "DEV", s: "DEVS"},
+		{name: "exact is case sensitive", mode: matchExact, lookFor: "DEV", s: "dev"},
+		{name: "regex matches anywhere", mode: matchRegex, lookFor: "DEV-[0-9]+", s: "team-DEV-12", want: true},
+		{name: "anchored regex", mode: matchRegex, lookFor: "^DEV-[0-9]+$", s: "team-DEV-12"},
+		{name: "anchored regex match", mode: matchRegex, lookFor: "^DEV-[0-9]+$", s: "DEV-12", want: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			useMatchMode(t, tt.mode, tt.lookFor)
+			if got := matchesRolestring(tt.s, tt.lookFor); got != tt.want {
+				t.Errorf("matchesRolestring(%q, %q) in %s mode is %v, expected %v", tt.s, tt.lookFor, tt.mode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesRolestringOtherPattern(t *testing.T) {
+	useMatchMode(t, matchRegex, "^DEV")
+	defer func() {
+		if recover() == nil {
+			t.Error("matching a rolestring the regex wasn't compiled from didn't panic")
+		}
+	}()
+	matchesRolestring("DEV-TEAM", "^OPS")
+}
+
+func TestSetMatchMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		lookFor string
+		wantErr bool
+	}{
+		{name: "contains", mode: matchContains, lookFor: "DEV"},
+		{name: "regex", mode: matchRegex, lookFor: "^DEV-.*"},
+		{name: "invalid regex", mode: matchRegex, lookFor: "DEV-(", wantErr: true},
+		{name: "unsupported mode", mode: "glob", lookFor: "DEV*", wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			savedMode, savedPattern := subjectMatchMode, subjectPattern
+			t.Cleanup(func() { subjectMatchMode, subjectPattern = savedMode, savedPattern })
+			err := setMatchMode(tt.mode, tt.lookFor, true)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setMatchMode(%q, %q) gave error %v, expected an error: %v", tt.mode, tt.lookFor, err, tt.wantErr)
+			}
+			if err != nil && subjectMatchMode != savedMode {
+				t.Errorf("a failed setMatchMode changed the mode to %s", subjectMatchMode)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/nicgrobler/k8s/result"
+)
+
+/*
+	where no one identity may read the whole cluster, every team scans its own namespaces - merge puts those
+	exports back together into one tree, as if a single scan had written it. the object trees, result.json and the
+	path manifest are merged, the per-run reports are not, they only describe the namespaces of their own run.
+	an object exported by more than one run is a conflict when its content differs (the file header aside): the
+	merge fails, or with -on-conflict first keeps the copy of the export given first. merge.json records where
+	everything came from, and every conflict
+*/
+
+const mergeFile string = "merge.json"
+
+const (
+	mergeFail  string = "fail"
+	mergeFirst string = "first"
+)
+
+type mergeSource struct {
+	Dir       string    `json:"dir"`
+	StartedAt time.Time `json:"startedAt"`
+	Objects   int       `json:"objects"`
+}
+
+type mergeConflict struct {
+	Path string `json:"path"`
+	// the export whose copy was kept, then those which differ from it
+	Kept    string   `json:"kept"`
+	Dropped []string `json:"dropped"`
+}
+
+type mergeReport struct {
+	Cluster   string          `json:"cluster"`
+	Sources   []mergeSource   `json:"sources"`
+	Conflicts []mergeConflict `json:"conflicts"`
+}
+
+func mergeResults(results []*result.ScanResult) result.ScanResult {
+	merged := result.New()
+	objects, relationships, findings, errs := map[string]bool{}, map[result.Relationship]bool{}, map[result.Finding]bool{}, map[string]bool{}
+	for _, r := range results {
+		merged.Cluster = r.Cluster
+		if merged.StartedAt.IsZero() || r.StartedAt.Before(merged.StartedAt) {
+			merged.StartedAt = r.StartedAt
+		}
+		if r.FinishedAt.After(merged.FinishedAt) {
+			merged.FinishedAt = r.FinishedAt
+		}
+		for _, o := range r.Objects {
+			if key := o.Path; !objects[key] {
+				objects[key] = true
+				merged.Objects = append(merged.Objects, o)
+			}
+		}
+		for _, rel := range r.Relationships {
+			if !relationships[rel] {
+				relationships[rel] = true
+				merged.Relationships = append(merged.Relationships, rel)
+			}
+		}
+		for _, f := range r.Findings {
+			if !findings[f] {
+				findings[f] = true
+				merged.Findings = append(merged.Findings, f)
+			}
+		}
+		merged.Unsupported = mergeUnsupported(merged.Unsupported, r.Unsupported)
+		for _, e := range r.Errors {
+			b, _ := json.Marshal(e)
+			if !errs[string(b)] {
+				errs[string(b)] = true
+				merged.Errors = append(merged.Errors, e)
+			}
+		}
+	}
+	if len(merged.Errors) > 0 {
+		merged.ErrorSummary = errorSummary(merged.Errors)
+	}
+	sort.SliceStable(merged.Objects, func(i, j int) bool { return merged.Objects[i].Path < merged.Objects[j].Path })
+	return merged
+}
+
+func mergePathManifests(dirs []string) ([]pathManifestEntry, error) {
+	entries, seen := []pathManifestEntry{}, map[pathManifestEntry]bool{}
+	for _, dir := range dirs {
+		b, err := os.ReadFile(filepath.Join(dir, pathManifestFile))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list := []pathManifestEntry{}
+		if err := json.Unmarshal(b, &list); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Join(dir, pathManifestFile), err)
+		}
+		for _, e := range list {
+			if !seen[e] {
+				seen[e] = true
+				entries = append(entries, e)
+			}
+		}
+	}
+	return entries, nil
+}
+
+func writeMergeFile(out, name string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(out, name), b, 0644)
+}
+
+func runMerge(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	out := fs.String("out", "", "directory to write the merged export to, which must not exist yet")
+	onConflict := fs.String("on-conflict", mergeFail, "what to do with an object exported with different content by two runs: fail, or first to keep the copy from the export given first")
+	fs.Parse(args)
+	if *out == "" || fs.NArg() < 2 {
+		return errors.New("usage: merge -out <dir> [-on-conflict fail|first] <export> <export>...")
+	}
+	if *onConflict != mergeFail && *onConflict != mergeFirst {
+		return fmt.Errorf("unsupported -on-conflict %q: expected fail or first", *onConflict)
+	}
+	if _, err := os.Stat(*out); err == nil {
+		return fmt.Errorf("%s already exists, merge only writes a new directory", *out)
+	}
+
+	report := mergeReport{Sources: []mergeSource{}, Conflicts: []mergeConflict{}}
+	results := []*result.ScanResult{}
+	// every path, the export it is taken from, and the object it holds
+	from := map[string]string{}
+	objects := map[string]snapshotObject{}
+	conflicts := map[string]*mergeConflict{}
+	var fingerprint *clusterFingerprint
+	for _, dir := range fs.Args() {
+		res, err := readResultFile(dir)
+		if err != nil {
+			return fmt.Errorf("%s is not an export: %w", dir, err)
+		}
+		// two clusters merged would be one tree no scan could ever have written
+		if report.Cluster != "" && res.Cluster != report.Cluster {
+			return fmt.Errorf("%s is an export of cluster %s, not %s", dir, res.Cluster, report.Cluster)
+		}
+		report.Cluster = res.Cluster
+		results = append(results, res)
+		// the same name can still be two clusters, the fingerprint tells
+		if m, err := readManifest(dir); err == nil && m.Fingerprint != nil {
+			if fingerprint != nil && fingerprint.ID != m.Fingerprint.ID {
+				return fmt.Errorf("%s is of a different cluster than the exports before it, fingerprint %s rather than %s", dir, m.Fingerprint.ID, fingerprint.ID)
+			}
+			fingerprint = m.Fingerprint
+		}
+
+		snapshot, err := readSnapshot(dir)
+		if err != nil {
+			return err
+		}
+		report.Sources = append(report.Sources, mergeSource{Dir: dir, StartedAt: res.StartedAt, Objects: len(snapshot)})
+		for _, o := range snapshot {
+			kept, seen := objects[o.Path]
+			if !seen {
+				objects[o.Path], from[o.Path] = o, dir
+				continue
+			}
+			// parsed, so that the header comment with its date doesn't count
+			if reflect.DeepEqual(kept.Object, o.Object) {
+				continue
+			}
+			if *onConflict == mergeFail {
+				return fmt.Errorf("%s differs between %s and %s", o.Path, from[o.Path], dir)
+			}
+			if conflicts[o.Path] == nil {
+				conflicts[o.Path] = &mergeConflict{Path: o.Path, Kept: from[o.Path]}
+			}
+			conflicts[o.Path].Dropped = append(conflicts[o.Path].Dropped, dir)
+		}
+	}
+
+	paths := []string{}
+	for p := range objects {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		// the files are copied as they are, compressed or not, header and all
+		b, err := os.ReadFile(filepath.Join(from[p], filepath.FromSlash(p)))
+		if err != nil {
+			return err
+		}
+		file := filepath.Join(*out, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, b, 0644); err != nil {
+			return err
+		}
+		if c := conflicts[p]; c != nil {
+			report.Conflicts = append(report.Conflicts, *c)
+		}
+	}
+
+	merged := mergeResults(results)
+	if err := writeMergeFile(*out, result.FileName, merged); err != nil {
+		return err
+	}
+	entries, err := mergePathManifests(fs.Args())
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		if err := writeMergeFile(*out, pathManifestFile, entries); err != nil {
+			return err
+		}
+	}
+	if err := writeMergeFile(*out, manifestFile, exportManifest{
+		APIVersion:  manifestAPIVersion,
+		Kind:        manifestKind,
+		Tool:        currentBuildInfo(),
+		Cluster:     merged.Cluster,
+		StartedAt:   merged.StartedAt,
+		FinishedAt:  merged.FinishedAt,
+		Objects:     len(paths),
+		Findings:    len(merged.Findings),
+		Fingerprint: fingerprint,
+	}); err != nil {
+		return err
+	}
+	if err := writeMergeFile(*out, mergeFile, report); err != nil {
+		return err
+	}
+	log.Printf("merged %d exports into %s: %d objects, %d conflicts", fs.NArg(), *out, len(paths), len(report.Conflicts))
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+	prometheus metrics of the most recent run, in the text exposition format - served in daemon mode, where a scrape
+	between runs should see the last complete picture. the names are part of the interface: dashboards and alerts are
+	built on them, so they're only ever added to, and every series carries the cluster label for fleet-wide views
+*/
+
+const (
+	metricLastScan      string = "kube_scanner_last_scan_timestamp_seconds"
+	metricDuration      string = "kube_scanner_scan_duration_seconds"
+	metricSuccess       string = "kube_scanner_scan_success"
+	metricGrade         string = "kube_scanner_grade_info"
+	metricFindings      string = "kube_scanner_findings"
+	metricObjects       string = "kube_scanner_exported_objects"
+	metricScanErrors    string = "kube_scanner_scan_errors"
+	metricDriftedObject string = "kube_scanner_drifted_objects"
+)
+
+type metricsServer struct {
+	mu   sync.Mutex
+	body []byte
+	mux  *http.ServeMux
+}
+
+func newMetricsServer(addr string) *metricsServer {
+	m := &metricsServer{mux: http.NewServeMux()}
+	m.mux.Handle("/metrics", m)
+	go func() {
+		// the daemon keeps scanning even if nothing can scrape it
+		if err := http.ListenAndServe(addr, m.mux); err != nil {
+			log.Printf("metrics: %v", err)
+		}
+	}()
+	return m
+}
+
+func (m *metricsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	body := m.body
+	m.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(body)
+}
+
+// handle serves more of the daemon's state next to the metrics
+func (m *metricsServer) handle(pattern string, h http.Handler) {
+	m.mux.Handle(pattern, h)
+}
+
+func labelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+type metricWriter struct {
+	bytes.Buffer
+}
+
+func (w *metricWriter) header(name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+func (w *metricWriter) sample(name string, value float64, labels ...string) {
+	// labels come in name, value pairs
+	pairs := []string{}
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], labelValue(labels[i+1])))
+	}
+	fmt.Fprintf(w, "%s{%s} %g\n", name, strings.Join(pairs, ","), value)
+}
+
+func (m *metricsServer) update(status scanStatus) {
+	w := &metricWriter{}
+	cluster := status.Cluster
+
+	w.header(metricLastScan, "Start of the most recent scan, as a unix timestamp.")
+	w.sample(metricLastScan, float64(status.LastScan.Unix()), "cluster", cluster)
+
+	w.header(metricSuccess, "1 if the most recent scan succeeded, 0 if it failed.")
+	success := 0.0
+	if status.OK {
+		success = 1
+	}
+	w.sample(metricSuccess, success, "cluster", cluster)
+
+	w.header(metricDuration, "How long the most recent scan took.")
+	w.sample(metricDuration, status.finishedAt.Sub(status.LastScan).Seconds(), "cluster", cluster)
+
+	w.header(metricGrade, "Grade of the most recent scan, as the grade label.")
+	w.sample(metricGrade, 1, "cluster", cluster, "grade", status.Grade)
+
+	w.header(metricScanErrors, "Problems which left the most recent export incomplete.")
+	w.sample(metricScanErrors, float64(status.ScanErrors), "cluster", cluster)
+
+	if status.Drift != nil {
+		w.header(metricDriftedObject, "Objects added, removed or changed since the previous scan.")
+		w.sample(metricDriftedObject, float64(*status.Drift), "cluster", cluster)
+	}
+
+	counts := map[string]int{}
+	findingsMu.Lock()
+	for _, f := range findings {
+		counts[strings.Join([]string{f.Namespace, f.Severity, f.ID}, "|")]++
+	}
+	findingsMu.Unlock()
+	w.header(metricFindings, "Findings of the most recent scan, by namespace, severity and check.")
+	for _, key := range sortedCounts(counts) {
+		parts := strings.SplitN(key, "|", 3)
+		w.sample(metricFindings, float64(counts[key]), "cluster", cluster, "namespace", parts[0], "severity", parts[1], "check", parts[2])
+	}
+
+	counts = map[string]int{}
+	exportedMu.Lock()
+	for _, o := range exported {
+		counts[o.Namespace+"|"+o.Kind]++
+	}
+	exportedMu.Unlock()
+	w.header(metricObjects, "Objects written by the most recent scan, by namespace and kind.")
+	for _, key := range sortedCounts(counts) {
+		parts := strings.SplitN(key, "|", 2)
+		w.sample(metricObjects, float64(counts[key]), "cluster", cluster, "namespace", parts[0], "kind", parts[1])
+	}
+
+	m.mu.Lock()
+	m.body = w.Bytes()
+	m.mu.Unlock()
+}
+
+func sortedCounts(counts map[string]int) []string {
+	keys := []string{}
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+/*
+	what every matched binding grants, namespace by namespace. a rolebinding can refer to a role of its own
+	namespace or to a clusterrole - the latter grants a role defined once for the whole cluster, which changes
+	under every namespace it is bound in when it changes, and is kept apart here as a clusterrole grant. the
+	clusterrolebindings, which grant in every namespace, are listed once under *
+*/
+
+const namespaceGrantsReport string = "reports/namespace-grants"
+
+const (
+	// a role defined in, and granted in, the namespace
+	grantNamespaceRole string = "role"
+	// a clusterrole granted in the namespace only, through a rolebinding
+	grantClusterRoleInNamespace string = "clusterrole-in-namespace"
+	// a clusterrole granted in every namespace, through a clusterrolebinding
+	grantClusterWide string = "clusterrole-cluster-wide"
+)
+
+type namespaceGrant struct {
+	Grant     string              `json:"grant"`
+	Binding   string              `json:"binding"`
+	Role      string              `json:"role"`
+	Subjects  []string            `json:"subjects"`
+	Rules     []rbacv1.PolicyRule `json:"rules"`
+	namespace string
+}
+
+func subjectNames(subjects []rbacv1.Subject) []string {
+	names := []string{}
+	for _, s := range subjects {
+		names = append(names, subjectKey(s))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func grantedRules(clientset kubernetes.Interface, namespace string, ref rbacv1.RoleRef) ([]rbacv1.PolicyRule, error) {
+	rules, err := roleRules(clientset, namespace, ref)
+	if rules == nil {
+		// a missing role grants nothing
+		rules = []rbacv1.PolicyRule{}
+	}
+	return rules, err
+}
+
+func namespaceGrants(clientset kubernetes.Interface, bindings []rbacv1.RoleBinding, clusterBindings []rbacv1.ClusterRoleBinding) (map[string][]namespaceGrant, error) {
+	grants := map[string][]namespaceGrant{}
+	for _, b := range bindings {
+		rules, err := grantedRules(clientset, b.ObjectMeta.Namespace, b.RoleRef)
+		if err != nil {
+			return nil, err
+		}
+		grant := grantNamespaceRole
+		if b.RoleRef.Kind == "ClusterRole" {
+			grant = grantClusterRoleInNamespace
+		}
+		ns := b.ObjectMeta.Namespace
+		grants[ns] = append(grants[ns], namespaceGrant{Grant: grant, Binding: b.ObjectMeta.Name, Role: b.RoleRef.Kind + "/" + b.RoleRef.Name, Subjects: subjectNames(b.Subjects), Rules: rules, namespace: ns})
+	}
+	for _, b := range clusterBindings {
+		rules, err := grantedRules(clientset, "", b.RoleRef)
+		if err != nil {
+			return nil, err
+		}
+		grants[allNamespaces] = append(grants[allNamespaces], namespaceGrant{Grant: grantClusterWide, Binding: b.ObjectMeta.Name, Role: b.RoleRef.Kind + "/" + b.RoleRef.Name, Subjects: subjectNames(b.Subjects), Rules: rules, namespace: allNamespaces})
+	}
+	for _, list := range grants {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Grant != list[j].Grant {
+				return list[i].Grant > list[j].Grant
+			}
+			return list[i].Binding < list[j].Binding
+		})
+	}
+	return grants, nil
+}
+
+func writeNamespaceGrantsView(clientset kubernetes.Interface, bindings []rbacv1.RoleBinding, clusterBindings []rbacv1.ClusterRoleBinding) error {
+	grants, err := namespaceGrants(clientset, bindings, clusterBindings)
+	if err != nil {
+		return err
+	}
+
+	namespaces := []string{}
+	for ns := range grants {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	buffer := bytes.Buffer{}
+	w := csv.NewWriter(&buffer)
+	w.Write([]string{"namespace", "grant", "binding", "role", "subjects"})
+	for _, ns := range namespaces {
+		for _, g := range grants[ns] {
+			w.Write([]string{g.namespace, g.Grant, g.Binding, g.Role, strings.Join(g.Subjects, " ")})
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if err := writeRootFile(namespaceGrantsReport+".csv", buffer.Bytes()); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(grants, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeRootFile(namespaceGrantsReport+".json", b)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// namespaces owned by kubernetes or the platform itself, which almost never hold anything user-defined
+const defaultSystemNamespaces string = "kube-system,kube-public,kube-node-lease,openshift,openshift-*"
+
+// when set, namespaced objects are listed from this namespace alone rather than from the whole cluster
+var scanNamespace string
+
+// glob patterns of namespaces left out of the scan
+var skippedNamespaces []string
+
+func setSkippedNamespaces(list string) {
+	skippedNamespaces = nil
+	for _, pattern := range strings.Split(list, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			skippedNamespaces = append(skippedNamespaces, pattern)
+		}
+	}
+}
+
+func isSkippedNamespace(namespace string) bool {
+	if namespace == "" {
+		// cluster scoped
+		return false
+	}
+	if namespace == scanNamespace {
+		// asked for by name, so never skipped as a system namespace
+		return false
+	}
+	for _, pattern := range skippedNamespaces {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return true
+		}
+	}
+	return false
+}
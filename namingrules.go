@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+/*
+	naming rules hold subjects to the naming convention of the identity provider: a subject of a kind with rules has
+	to match one of them, so a rule per kind allowing only what is expected - groups of the identity provider, or no
+	users at all but a handful of robot accounts - flags whatever else was bound. names are checked as the cluster
+	has them, before normalizing, and system: names belong to kubernetes itself and are left alone
+
+		subjects:
+		  naming:
+		    - kind: Group
+		      pattern: '^oidc:OPSH-[A-Z0-9-]+$'
+		    - kind: User
+		      pattern: '^oidc:svc-'
+		      description: personal accounts are granted access through groups
+*/
+
+type namingRule struct {
+	// User, Group or ServiceAccount
+	Kind    string `json:"kind"`
+	Pattern string `json:"pattern"`
+	// why the rule exists, part of the finding
+	Description string `json:"description,omitempty"`
+	// of the findings, medium when not set
+	Severity string `json:"severity,omitempty"`
+}
+
+type compiledNamingRule struct {
+	namingRule
+	pattern *regexp.Regexp
+}
+
+// by subject kind
+var namingRules map[string][]compiledNamingRule
+
+func parseNamingRules(rules []namingRule) error {
+	namingRules = map[string][]compiledNamingRule{}
+	for _, r := range rules {
+		switch r.Kind {
+		case rbacv1.UserKind, rbacv1.GroupKind, rbacv1.ServiceAccountKind:
+		default:
+			return fmt.Errorf("naming rule %q: unsupported kind %q: expected User, Group or ServiceAccount", r.Pattern, r.Kind)
+		}
+		if r.Severity == "" {
+			r.Severity = severityMedium
+		}
+		if err := validateSeverity(r.Severity); err != nil {
+			return fmt.Errorf("naming rule %q: %w", r.Pattern, err)
+		}
+		p, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid naming rule pattern %q; %w", r.Pattern, err)
+		}
+		namingRules[r.Kind] = append(namingRules[r.Kind], compiledNamingRule{namingRule: r, pattern: p})
+	}
+	return nil
+}
+
+func namingViolation(s rbacv1.Subject) (compiledNamingRule, bool) {
+	// the rule reported is the first of the kind, when none of them matches
+	rules := namingRules[s.Kind]
+	if len(rules) == 0 || strings.HasPrefix(s.Name, "system:") {
+		return compiledNamingRule{}, false
+	}
+	for _, r := range rules {
+		if r.pattern.MatchString(s.Name) {
+			return compiledNamingRule{}, false
+		}
+	}
+	return rules[0], true
+}
+
+func checkSubjectNaming(bindings []rbacv1.RoleBinding, clusterBindings []rbacv1.ClusterRoleBinding) {
+	report := func(kind, namespace, name string, subjects []rbacv1.Subject) {
+		for _, s := range subjects {
+			r, violates := namingViolation(s)
+			if !violates {
+				continue
+			}
+			message := fmt.Sprintf("%s %s does not follow the naming convention %s", strings.ToLower(s.Kind), s.Name, r.Pattern)
+			if r.Description != "" {
+				message += ": " + r.Description
+			}
+			addFinding(finding{ID: "subject-naming", Severity: r.Severity, Kind: kind, Namespace: namespace, Name: name, Message: message})
+		}
+	}
+	for _, b := range bindings {
+		if !isSkippedNamespace(b.ObjectMeta.Namespace) {
+			report("RoleBinding", b.ObjectMeta.Namespace, b.ObjectMeta.Name, b.Subjects)
+		}
+	}
+	for _, b := range clusterBindings {
+		report("ClusterRoleBinding", "", b.ObjectMeta.Name, b.Subjects)
+	}
+}
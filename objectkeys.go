@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/nicgrobler/k8s/result"
+)
+
+/*
+	every output names an object by the same key, result.KeyOf: group/version/kind/namespace/name - result.json,
+	the event log, drift, verify-restore, the siem and the path manifest. files keep the layout of objectPath, the
+	path manifest and result.json map keys to them. findings only know the kind, so their api version is that of
+	the exported object they're about, or the one the scanner lists the kind with
+*/
+
+var findingKindVersions = map[string]string{
+	"Deployment":         "apps/v1",
+	"ReplicaSet":         "apps/v1",
+	"Namespace":          "v1",
+	"Service":            "v1",
+	"ResourceQuota":      "v1",
+	"Role":               "rbac.authorization.k8s.io/v1",
+	"RoleBinding":        "rbac.authorization.k8s.io/v1",
+	"ClusterRole":        "rbac.authorization.k8s.io/v1",
+	"ClusterRoleBinding": "rbac.authorization.k8s.io/v1",
+}
+
+func objectKey(apiVersion, kind, namespace, name string) string {
+	return result.KeyOf(result.ObjectRef{APIVersion: apiVersion, Kind: kind, Namespace: namespace, Name: name})
+}
+
+// the api versions of everything exported, by kind/namespace/name
+func exportedVersions() map[string]string {
+	exportedMu.Lock()
+	defer exportedMu.Unlock()
+	versions := map[string]string{}
+	for _, o := range exported {
+		versions[o.Kind+"/"+o.Namespace+"/"+o.Name] = o.APIVersion
+	}
+	return versions
+}
+
+func findingRef(f finding, versions map[string]string) result.ObjectRef {
+	apiVersion, ok := versions[f.Kind+"/"+f.Namespace+"/"+f.Name]
+	if !ok {
+		apiVersion = findingKindVersions[f.Kind]
+	}
+	return result.ObjectRef{APIVersion: apiVersion, Kind: f.Kind, Namespace: f.Namespace, Name: f.Name}.WithKey()
+}
+
+func keyedRef(r *result.ObjectRef) *result.ObjectRef {
+	if r == nil {
+		return nil
+	}
+	keyed := r.WithKey()
+	return &keyed
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+/*
+	the identity side of rbac on openshift: groups hold the users a Group subject stands for, and rolebinding
+	restrictions limit who bindings in a namespace may name at all - clusters which aren't openshift serve neither,
+	and the preset exports nothing there
+*/
+
+var openshiftRBACResources = map[string][]string{
+	"user.openshift.io":          {"groups"},
+	"authorization.openshift.io": {"rolebindingrestrictions"},
+}
+
+func openshiftRBACPreset(disc discovery.DiscoveryInterface, dyn dynamic.Interface) ([]schema.GroupVersionResource, error) {
+	return servedResources(disc, func(gv schema.GroupVersion, r metav1.APIResource) bool {
+		for _, name := range openshiftRBACResources[gv.Group] {
+			if r.Name == name {
+				return true
+			}
+		}
+		return false
+	})
+}
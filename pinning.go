@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/nicgrobler/k8s/result"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	imagePinningReport string = "reports/image-pinning"
+	digestPinsFile     string = "reports/digest-pins.yaml"
+)
+
+type imagePin struct {
+	Namespace  string `json:"namespace"`
+	Deployment string `json:"deployment"`
+	Container  string `json:"container"`
+	Init       bool   `json:"init,omitempty"`
+	Image      string `json:"image"`
+	Pinned     bool   `json:"pinned"`
+	Digest     string `json:"digest,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+func (c *registryClient) digest(ref imageRef) (string, error) {
+	if vendoredImages != nil {
+		image, err := lookupVendoredImage(ref)
+		if err == nil && image.Digest == "" {
+			err = fmt.Errorf("no digest for %s in the vendored images.yaml", vendoredImageKey(ref))
+		}
+		return image.Digest, err
+	}
+	// registries are asked for the digest alone first, some only send it along with the manifest itself
+	resp, err := c.get(ref, http.MethodHead, "/manifests/"+ref.reference(), manifestAccept)
+	if err == nil && resp.Digest != "" {
+		return resp.Digest, nil
+	}
+	resp, err = c.manifest(ref)
+	if err != nil {
+		return "", err
+	}
+	if resp.Digest != "" {
+		return resp.Digest, nil
+	}
+	sum := sha256.Sum256(resp.Body)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+func imagePins(deployments []appsv1.Deployment, client *registryClient) []imagePin {
+	resolved := map[string]string{}
+	failed := map[string]string{}
+	pins := []imagePin{}
+
+	for _, d := range deployments {
+		add := func(c corev1.Container, init bool) {
+			pin := imagePin{Namespace: d.ObjectMeta.Namespace, Deployment: d.ObjectMeta.Name, Container: c.Name, Init: init, Image: c.Image}
+			if _, _, digest := splitImage(c.Image); digest != "" {
+				pin.Pinned, pin.Digest = true, digest
+				pins = append(pins, pin)
+				return
+			}
+			// every image is only resolved once, however many workloads run it
+			if _, ok := resolved[c.Image]; !ok && failed[c.Image] == "" {
+				digest, err := client.digest(parseImageRef(c.Image))
+				if err != nil {
+					failed[c.Image] = err.Error()
+					recordError(&result.ObjectRef{Kind: "Image", Name: c.Image}, fmt.Errorf("failed to resolve digest; %w", err))
+				} else {
+					resolved[c.Image] = digest
+				}
+			}
+			pin.Digest, pin.Error = resolved[c.Image], failed[c.Image]
+			pins = append(pins, pin)
+		}
+		for _, c := range d.Spec.Template.Spec.InitContainers {
+			add(c, true)
+		}
+		for _, c := range d.Spec.Template.Spec.Containers {
+			add(c, false)
+		}
+	}
+	return pins
+}
+
+func pinnedImage(image, digest string) string {
+	// the tag stays in the reference for whoever reads it, the runtime only goes by the digest
+	return image + "@" + digest
+}
+
+func digestPinPatches(pins []imagePin) ([]byte, error) {
+	/*
+		one strategic merge patch per deployment, setting the image of every container running a tag to that tag
+		pinned to its digest - containers are merged by name, so the rest of the spec is left alone
+	*/
+	type container struct {
+		Name  string `json:"name"`
+		Image string `json:"image"`
+	}
+	type patch struct {
+		APIVersion string                 `json:"apiVersion"`
+		Kind       string                 `json:"kind"`
+		Metadata   map[string]string      `json:"metadata"`
+		Spec       map[string]interface{} `json:"spec"`
+	}
+
+	order := []string{}
+	containers := map[string][]container{}
+	initContainers := map[string][]container{}
+	for _, p := range pins {
+		if p.Pinned || p.Digest == "" {
+			continue
+		}
+		key := p.Namespace + "/" + p.Deployment
+		if containers[key] == nil && initContainers[key] == nil {
+			order = append(order, key)
+		}
+		c := container{Name: p.Container, Image: pinnedImage(p.Image, p.Digest)}
+		if p.Init {
+			initContainers[key] = append(initContainers[key], c)
+		} else {
+			containers[key] = append(containers[key], c)
+		}
+	}
+
+	buffer := bytes.Buffer{}
+	for _, key := range order {
+		parts := strings.SplitN(key, "/", 2)
+		podSpec := map[string]interface{}{}
+		if len(containers[key]) > 0 {
+			podSpec["containers"] = containers[key]
+		}
+		if len(initContainers[key]) > 0 {
+			podSpec["initContainers"] = initContainers[key]
+		}
+		b, err := yaml.Marshal(patch{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Metadata:   map[string]string{"name": parts[1], "namespace": parts[0]},
+			Spec:       map[string]interface{}{"template": map[string]interface{}{"spec": podSpec}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		buffer.WriteString("---\n")
+		buffer.Write(b)
+	}
+	return buffer.Bytes(), nil
+}
+
+func writeImagePinningReport(deployments []appsv1.Deployment, authFile string) error {
+	creds, err := loadRegistryCredentials(authFile)
+	if err != nil {
+		return err
+	}
+	pins := imagePins(deployments, newRegistryClient(creds))
+
+	order := []string{}
+	unpinned := map[string][]string{}
+	for _, p := range pins {
+		if p.Pinned {
+			continue
+		}
+		key := p.Namespace + "/" + p.Deployment
+		if unpinned[key] == nil {
+			order = append(order, key)
+		}
+		unpinned[key] = append(unpinned[key], p.Image)
+	}
+	for _, key := range order {
+		parts := strings.SplitN(key, "/", 2)
+		addFinding(finding{
+			ID:        "image-mutable-tag",
+			Severity:  severityLow,
+			Kind:      "Deployment",
+			Namespace: parts[0],
+			Name:      parts[1],
+			Message:   fmt.Sprintf("runs images by tag rather than by digest: %s", strings.Join(unpinned[key], ", ")),
+		})
+	}
+
+	b, err := json.MarshalIndent(pins, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeRootFile(imagePinningReport+".json", b); err != nil {
+		return err
+	}
+
+	buffer := bytes.Buffer{}
+	w := csv.NewWriter(&buffer)
+	w.Write([]string{"namespace", "deployment", "container", "image", "pinned", "digest", "error"})
+	for _, p := range pins {
+		pinned := "no"
+		if p.Pinned {
+			pinned = "yes"
+		}
+		w.Write([]string{p.Namespace, p.Deployment, p.Container, p.Image, pinned, p.Digest, p.Error})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if err := writeRootFile(imagePinningReport+".csv", buffer.Bytes()); err != nil {
+		return err
+	}
+
+	patches, err := digestPinPatches(pins)
+	if err != nil {
+		return err
+	}
+	return writeRootFile(digestPinsFile, patches)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+/*
+	every object goes through the same ordered steps on its way out: prune, the fields extract keeps, always comes
+	first, then every step of the pipeline config in the order listed - remove drops fields, redact overwrites
+	them, anonymize replaces them with a keyed hash that is stable between runs, and rewrite-image moves container
+	images to another registry. the result is what is hashed, compared and written, and raw copies (-keep-raw) go
+	through every step but prune. -explain-pipeline prints the steps and exits
+
+	the steps change the object files, and the outputs read back from them (custom checks, lint, golden,
+	terraform). everything else is built from the objects as they were listed: the subjects and role references of
+	result.json are put through the steps as well, but while a step hides fields (remove, redact or anonymize) the
+	messages of other findings are withheld, and the reports written from the listed objects are refused
+
+	paths are dotted with [*] for any list index, as for the drift ignores, and cover everything below them. the
+	name and namespace of an object can't be transformed, they are what it is filed and found under
+*/
+
+const (
+	stepPrune        string = "prune"
+	stepRemove       string = "remove"
+	stepRedact       string = "redact"
+	stepAnonymize    string = "anonymize"
+	stepRewriteImage string = "rewrite-image"
+
+	defaultRedaction string = "REDACTED"
+)
+
+type pipelineStep struct {
+	// shown by -explain-pipeline, the type when empty
+	Name string `json:"name,omitempty"`
+	Type string `json:"type"`
+	// kinds the step applies to, every kind when empty
+	Kinds []string `json:"kinds,omitempty"`
+	// remove, redact and anonymize
+	Paths []string `json:"paths,omitempty"`
+	// redact, REDACTED when empty
+	Replacement string `json:"replacement,omitempty"`
+	// anonymize: the key of the hash, given directly or as the name of an environment variable holding it
+	Salt    string `json:"salt,omitempty"`
+	SaltEnv string `json:"saltEnv,omitempty"`
+	// rewrite-image: images starting with from start with to instead
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+var (
+	transforms     []pipelineStep
+	containerImage = regexp.MustCompile(`(^|\.)(containers|initContainers|ephemeralContainers)\[[0-9]+\]\.image$`)
+)
+
+func (s pipelineStep) label() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Type
+}
+
+func (s pipelineStep) appliesTo(kind string) bool {
+	if len(s.Kinds) == 0 {
+		return true
+	}
+	for _, k := range s.Kinds {
+		if strings.EqualFold(k, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s pipelineStep) matches(kind, field string) bool {
+	for _, p := range s.Paths {
+		if (driftIgnore{Path: p}).matches(kind, field) {
+			return true
+		}
+	}
+	return false
+}
+
+func parsePipeline(steps []pipelineStep) ([]pipelineStep, error) {
+	parsed := []pipelineStep{}
+	for i, s := range steps {
+		switch s.Type {
+		case stepPrune:
+			// there for the reader of the config, it runs first wherever it is listed
+			if i != 0 {
+				return nil, fmt.Errorf("pipeline step %d: prune always runs first, list it first or not at all", i+1)
+			}
+			continue
+		case stepRemove, stepRedact, stepAnonymize:
+			if len(s.Paths) == 0 {
+				return nil, fmt.Errorf("pipeline step %s: %s needs paths", s.label(), s.Type)
+			}
+			for _, p := range s.Paths {
+				if p == "metadata" || p == "metadata.name" || p == "metadata.namespace" || p == "apiVersion" || p == "kind" {
+					return nil, fmt.Errorf("pipeline step %s: %s identifies the object and can't be transformed", s.label(), p)
+				}
+			}
+			if s.Type == stepRedact && s.Replacement == "" {
+				s.Replacement = defaultRedaction
+			}
+			if s.Type == stepAnonymize {
+				if s.SaltEnv != "" {
+					s.Salt = os.Getenv(s.SaltEnv)
+				}
+				if s.Salt == "" {
+					return nil, fmt.Errorf("pipeline step %s: anonymize needs a salt, or saltEnv naming a set environment variable", s.label())
+				}
+			}
+		case stepRewriteImage:
+			if s.From == "" {
+				return nil, fmt.Errorf("pipeline step %s: rewrite-image needs from", s.label())
+			}
+		default:
+			return nil, fmt.Errorf("pipeline step %d: unsupported type %q: expected prune, remove, redact, anonymize or rewrite-image", i+1, s.Type)
+		}
+		parsed = append(parsed, s)
+	}
+	return parsed, nil
+}
+
+func anonymized(salt string, v interface{}) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	fmt.Fprint(mac, v)
+	return "anon-" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// apply returns the value the field gets, and whether it is kept at all
+func (s pipelineStep) apply(kind, field string, v interface{}) (interface{}, bool) {
+	switch s.Type {
+	case stepRemove:
+		return v, !s.matches(kind, field)
+	case stepRedact:
+		if s.matches(kind, field) {
+			return s.Replacement, true
+		}
+	case stepAnonymize:
+		if s.matches(kind, field) {
+			return anonymized(s.Salt, v), true
+		}
+	case stepRewriteImage:
+		if image, ok := v.(string); ok && containerImage.MatchString(field) && strings.HasPrefix(image, s.From) {
+			return s.To + strings.TrimPrefix(image, s.From), true
+		}
+	}
+	return v, true
+}
+
+func transformFields(s pipelineStep, kind, prefix string, v interface{}) (interface{}, bool) {
+	if prefix != "" && s.Type == stepRemove && s.matches(kind, prefix) {
+		return nil, false
+	}
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, child := range value {
+			p := k
+			if prefix != "" {
+				p = prefix + "." + k
+			}
+			if p == "metadata.name" || p == "metadata.namespace" {
+				continue
+			}
+			if c, keep := transformFields(s, kind, p, child); keep {
+				value[k] = c
+			} else {
+				delete(value, k)
+			}
+		}
+		return value, true
+	case []interface{}:
+		kept := []interface{}{}
+		for i, child := range value {
+			if c, keep := transformFields(s, kind, fmt.Sprintf("%s[%d]", prefix, i), child); keep {
+				kept = append(kept, c)
+			}
+		}
+		return kept, true
+	}
+	// redacting or anonymizing a map or list covers every value below it, so only scalars are replaced
+	return s.apply(kind, prefix, v)
+}
+
+func transformObject(c runtime.Object) (runtime.Object, error) {
+	if len(transforms) == 0 {
+		return c, nil
+	}
+	if c.GetObjectKind().GroupVersionKind().Empty() {
+		if err := addTypeInformationToObject(c); err != nil {
+			return nil, err
+		}
+	}
+	kind := c.GetObjectKind().GroupVersionKind().Kind
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(c)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range transforms {
+		if s.appliesTo(kind) {
+			transformFields(s, kind, "", obj)
+		}
+	}
+	return &unstructured.Unstructured{Object: obj}, nil
+}
+
+// the role reference and subjects of a binding as its file holds them, for the relationships of result.json
+func transformedBinding(binding runtime.Object) (rbacv1.RoleRef, []rbacv1.Subject, error) {
+	t, err := transformObject(binding)
+	if err != nil {
+		return rbacv1.RoleRef{}, nil, err
+	}
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(t)
+	if err != nil {
+		return rbacv1.RoleRef{}, nil, err
+	}
+	fields := struct {
+		RoleRef  rbacv1.RoleRef   `json:"roleRef"`
+		Subjects []rbacv1.Subject `json:"subjects"`
+	}{}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj, &fields)
+	return fields.RoleRef, fields.Subjects, err
+}
+
+// the steps which take something out of the object files that outputs built from the listed objects would hold
+func hidingSteps(steps []pipelineStep) []string {
+	labels := []string{}
+	for _, s := range steps {
+		if s.Type == stepRemove || s.Type == stepRedact || s.Type == stepAnonymize {
+			labels = append(labels, s.label())
+		}
+	}
+	return labels
+}
+
+// flags of the reports written from the objects as they were listed, which would show what the pipeline hides
+func (o scanOptions) listedOutputs() []string {
+	outputs := []string{}
+	for flag, set := range map[string]bool{
+		"backstage": o.backstage, "env-inventory": o.envInventory, "sidecar-report": o.sidecarReport,
+		"topology-report": o.topologyReport, "image-platforms": o.imagePlatforms, "image-pinning": o.imagePinning,
+		"exposure-report": o.exposureReport, "remediation": o.remediation, "servicenow": o.serviceNow != "",
+		"sbom": o.sbom, "access-report": o.accessReport, "unmatched-report": o.unmatchedReport,
+		"namespace-grants": o.namespaceGrants, "clusterrole-usage": o.roleUsage, "by-subject": o.bySubject,
+		"subject-inventory": o.subjectInventory, "blast-radius": o.blastRadius,
+	} {
+		if set {
+			outputs = append(outputs, "-"+flag)
+		}
+	}
+	sort.Strings(outputs)
+	return outputs
+}
+
+func checkPipelineOutputs(steps []pipelineStep, outputs []string) error {
+	hiding := hidingSteps(steps)
+	if len(hiding) == 0 || len(outputs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("pipeline step %s hides fields of the exported objects, which %s would write as they were listed: leave out %s, or the step", hiding[0], outputs[0], strings.Join(outputs, ", "))
+}
+
+func explainPipeline(steps []pipelineStep) string {
+	b := strings.Builder{}
+	b.WriteString("the object files, and what is read back from them, go through these steps, in this order, before they are hashed, compared or written:\n")
+	b.WriteString("  1. prune (built in): keep only the fields selected for its kind, dropping status and most metadata\n")
+	for i, s := range steps {
+		kinds := "every kind"
+		if len(s.Kinds) > 0 {
+			kinds = strings.Join(s.Kinds, ", ")
+		}
+		what := ""
+		switch s.Type {
+		case stepRemove:
+			what = "remove " + strings.Join(s.Paths, ", ")
+		case stepRedact:
+			what = fmt.Sprintf("replace %s with %q", strings.Join(s.Paths, ", "), s.Replacement)
+		case stepAnonymize:
+			what = "replace " + strings.Join(s.Paths, ", ") + " with a keyed hash"
+		case stepRewriteImage:
+			what = fmt.Sprintf("rewrite container images starting with %s to start with %s", s.From, s.To)
+		}
+		label := s.Type
+		if s.Name != "" {
+			label = s.Name + " (" + s.Type + ")"
+		}
+		fmt.Fprintf(&b, "  %d. %s: %s, for %s\n", i+2, label, what, kinds)
+	}
+	if len(steps) == 0 {
+		b.WriteString("no further steps are configured, see pipeline in the config file\n")
+	}
+	b.WriteString("raw copies written with -keep-raw go through every step but prune\n")
+	b.WriteString("the subjects and role references of result.json go through the steps too, other outputs are built from the objects as listed\n")
+	if hiding := hidingSteps(steps); len(hiding) > 0 {
+		fmt.Fprintf(&b, "as %s hides fields, finding messages not read from the files are withheld and reports written from the listed objects are refused\n", strings.Join(hiding, ", "))
+	}
+	return b.String()
+}
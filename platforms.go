@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nicgrobler/k8s/result"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const imagePlatformReport string = "reports/image-platforms"
+
+type imagePlatforms struct {
+	Image     string   `json:"image"`
+	Platforms []string `json:"platforms"`
+	Supported bool     `json:"supported"`
+	Workloads []string `json:"workloads"`
+	Error     string   `json:"error,omitempty"`
+}
+
+type ociPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+func (p ociPlatform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+func manifestPlatforms(c *registryClient, ref imageRef) ([]string, error) {
+	/*
+		a multi-arch image is an index listing one manifest per platform, a single platform image only says what it
+		was built for in its config blob - attestations show up in indexes as unknown/unknown, and are left out
+	*/
+	if vendoredImages != nil {
+		image, err := lookupVendoredImage(ref)
+		if err == nil && len(image.Platforms) == 0 {
+			err = fmt.Errorf("no platforms for %s in the vendored images.yaml", vendoredImageKey(ref))
+		}
+		return image.Platforms, err
+	}
+	resp, err := c.manifest(ref)
+	if err != nil {
+		return nil, err
+	}
+	m := struct {
+		MediaType string `json:"mediaType"`
+		Manifests []struct {
+			Platform *ociPlatform `json:"platform"`
+		} `json:"manifests"`
+		Config struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+	}{}
+	if err := json.Unmarshal(resp.Body, &m); err != nil {
+		return nil, fmt.Errorf("unreadable manifest for %s; %w", ref.Repository, err)
+	}
+
+	platforms := []string{}
+	mediaType := m.MediaType
+	if mediaType == "" {
+		mediaType = strings.TrimSpace(strings.SplitN(resp.MediaType, ";", 2)[0])
+	}
+	if mediaType == mediaTypeOCIIndex || mediaType == mediaTypeDockerList || len(m.Manifests) > 0 {
+		for _, entry := range m.Manifests {
+			if entry.Platform != nil && entry.Platform.OS != "unknown" {
+				platforms = append(platforms, entry.Platform.String())
+			}
+		}
+		sort.Strings(platforms)
+		return platforms, nil
+	}
+
+	blob, err := c.blob(ref, m.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	p := ociPlatform{}
+	if err := json.Unmarshal(blob.Body, &p); err != nil {
+		return nil, fmt.Errorf("unreadable image config for %s; %w", ref.Repository, err)
+	}
+	return []string{p.String()}, nil
+}
+
+func supportsArch(platforms []string, arch string) bool {
+	// arch is either an architecture such as arm64, or a full os/architecture
+	for _, p := range platforms {
+		if p == arch || strings.HasPrefix(p+"/", arch+"/") {
+			return true
+		}
+		parts := strings.Split(p, "/")
+		if len(parts) > 1 && parts[1] == arch {
+			return true
+		}
+	}
+	return false
+}
+
+func imageWorkloads(deployments []appsv1.Deployment) map[string][]appsv1.Deployment {
+	images := map[string][]appsv1.Deployment{}
+	for _, d := range deployments {
+		seen := map[string]bool{}
+		containers := []corev1.Container{}
+		containers = append(containers, d.Spec.Template.Spec.InitContainers...)
+		containers = append(containers, d.Spec.Template.Spec.Containers...)
+		for _, c := range containers {
+			if !seen[c.Image] {
+				seen[c.Image] = true
+				images[c.Image] = append(images[c.Image], d)
+			}
+		}
+	}
+	return images
+}
+
+func writeImagePlatformReport(deployments []appsv1.Deployment, authFile, requireArch string) error {
+	creds, err := loadRegistryCredentials(authFile)
+	if err != nil {
+		return err
+	}
+	client := newRegistryClient(creds)
+
+	images := imageWorkloads(deployments)
+	names := []string{}
+	for image := range images {
+		names = append(names, image)
+	}
+	sort.Strings(names)
+
+	report := []imagePlatforms{}
+	for _, image := range names {
+		entry := imagePlatforms{Image: image, Platforms: []string{}, Workloads: []string{}}
+		for _, d := range images[image] {
+			entry.Workloads = append(entry.Workloads, d.ObjectMeta.Namespace+"/"+d.ObjectMeta.Name)
+		}
+
+		// a registry we can't reach leaves a gap in the report rather than failing the scan
+		platforms, err := manifestPlatforms(client, parseImageRef(image))
+		if err != nil {
+			entry.Error = err.Error()
+			recordError(&result.ObjectRef{Kind: "Image", Name: image}, fmt.Errorf("failed to read platforms; %w", err))
+			report = append(report, entry)
+			continue
+		}
+		entry.Platforms = platforms
+		entry.Supported = supportsArch(platforms, requireArch)
+		report = append(report, entry)
+
+		if entry.Supported {
+			continue
+		}
+		for _, d := range images[image] {
+			addFinding(finding{
+				ID:        "image-arch-unsupported",
+				Severity:  severityMedium,
+				Kind:      "Deployment",
+				Namespace: d.ObjectMeta.Namespace,
+				Name:      d.ObjectMeta.Name,
+				Message:   fmt.Sprintf("image %s is not built for %s, only for %s", image, requireArch, strings.Join(platforms, ", ")),
+			})
+		}
+	}
+
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeRootFile(imagePlatformReport+".json", b); err != nil {
+		return err
+	}
+
+	buffer := bytes.Buffer{}
+	w := csv.NewWriter(&buffer)
+	w.Write([]string{"image", "platforms", "supports " + requireArch, "workloads", "error"})
+	for _, e := range report {
+		supported := "no"
+		if e.Supported {
+			supported = "yes"
+		}
+		if e.Error != "" {
+			supported = "unknown"
+		}
+		w.Write([]string{e.Image, strings.Join(e.Platforms, " "), supported, strings.Join(e.Workloads, " "), e.Error})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return writeRootFile(imagePlatformReport+".csv", buffer.Bytes())
+}
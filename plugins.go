@@ -0,0 +1,274 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+/*
+	a central platform team can publish scanner configuration every cluster's scanner picks up: plugin bundles,
+	yaml files holding resource presets, custom checks and pipeline steps (remove, redact and friends), fetched over
+	https or from an oci registry. the plugins section of the config lists them:
+
+		plugins:
+		  - url: https://platform.example.com/kube-scanner/org.yaml
+		    sha256: 3b4c...
+		  - oci: ghcr.io/example/kube-scanner-plugins:v3
+		    sha256: 9f2e...
+
+	an oci bundle is an artifact whose one layer is the yaml, such as what
+	oras push <ref> org.yaml:application/vnd.kube-scanner.plugin.v1+yaml pushes, read with the credentials of
+	-registry-auth. sha256 pins the content of the bundle: anything else is refused, and a pinned bundle already in
+	-plugin-cache is used without being fetched again, so a scanner keeps working when the publisher is down. an
+	unpinned bundle is fetched on every config load, and the copy cached last time is used when that fails.
+	presets of a bundle are used with -preset like the built in ones, its checks are added to checks.custom and its
+	pipeline steps run after those of the config
+
+		presets:
+		  - name: istio
+		    groups: [networking.istio.io, security.istio.io]
+		    # every resource of the groups when empty
+		    resources: [virtualservices, destinationrules]
+		checks:
+		  - id: ...
+		pipeline:
+		  - type: remove
+		    paths: [metadata.annotations.example.com/build]
+*/
+
+const pluginMediaType string = "application/vnd.kube-scanner.plugin.v1+yaml"
+
+const maxPluginSize = 16 << 20
+
+type pluginSource struct {
+	URL string `json:"url,omitempty"`
+	OCI string `json:"oci,omitempty"`
+	// hex sha256 of the bundle file
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+type pluginBundle struct {
+	Presets  []pluginPreset `json:"presets,omitempty"`
+	Checks   []customCheck  `json:"checks,omitempty"`
+	Pipeline []pipelineStep `json:"pipeline,omitempty"`
+}
+
+type pluginPreset struct {
+	Name      string   `json:"name"`
+	Groups    []string `json:"groups"`
+	Resources []string `json:"resources,omitempty"`
+}
+
+// the presets of the plugins loaded with the config, next to the built in ones
+var pluginPresets = map[string]preset{}
+
+func defaultPluginCache() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "kube-scanner", "plugins")
+}
+
+func (s pluginSource) String() string {
+	if s.OCI != "" {
+		return "oci " + s.OCI
+	}
+	return s.URL
+}
+
+func loadPlugins(sources []pluginSource, cacheDir, registryAuth string) (pluginBundle, error) {
+	all := pluginBundle{}
+	names := map[string]string{}
+	for _, s := range sources {
+		if (s.URL == "") == (s.OCI == "") {
+			return all, fmt.Errorf("plugins: every plugin needs either a url or an oci reference")
+		}
+		if s.URL != "" && !strings.HasPrefix(s.URL, "https://") {
+			return all, fmt.Errorf("plugins: %s is not an https url", s.URL)
+		}
+		if s.SHA256 != "" {
+			if b, err := hex.DecodeString(s.SHA256); err != nil || len(b) != sha256.Size {
+				return all, fmt.Errorf("plugins: %s: sha256 must be 64 hex characters", s)
+			}
+			s.SHA256 = strings.ToLower(s.SHA256)
+		}
+
+		b, err := fetchPlugin(s, cacheDir, registryAuth)
+		if err != nil {
+			return all, fmt.Errorf("plugins: %s: %w", s, err)
+		}
+		bundle := pluginBundle{}
+		if err := yaml.UnmarshalStrict(b, &bundle); err != nil {
+			return all, fmt.Errorf("plugins: %s: %w", s, err)
+		}
+		for _, p := range bundle.Presets {
+			if p.Name == "" || len(p.Groups) == 0 {
+				return all, fmt.Errorf("plugins: %s: every preset needs a name and at least one group", s)
+			}
+			if _, ok := presets[p.Name]; ok {
+				return all, fmt.Errorf("plugins: %s: preset %s is built in", s, p.Name)
+			}
+			if other, ok := names[p.Name]; ok {
+				return all, fmt.Errorf("plugins: %s: preset %s is also defined by %s", s, p.Name, other)
+			}
+			names[p.Name] = s.String()
+		}
+		all.Presets = append(all.Presets, bundle.Presets...)
+		all.Checks = append(all.Checks, bundle.Checks...)
+		all.Pipeline = append(all.Pipeline, bundle.Pipeline...)
+	}
+	return all, nil
+}
+
+func fetchPlugin(s pluginSource, cacheDir, registryAuth string) ([]byte, error) {
+	// pinned bundles are cached by their checksum, unpinned ones by where they come from
+	cached := ""
+	if cacheDir != "" {
+		key := s.SHA256
+		if key == "" {
+			key = "source-" + sha256Hex([]byte(s.String()))
+		}
+		cached = filepath.Join(cacheDir, key+".yaml")
+	}
+	if s.SHA256 != "" && cached != "" {
+		if b, err := os.ReadFile(cached); err == nil && sha256Hex(b) == s.SHA256 {
+			return b, nil
+		}
+	}
+
+	var b []byte
+	var err error
+	if s.OCI != "" {
+		b, err = fetchOCIPlugin(s.OCI, registryAuth)
+	} else {
+		b, err = fetchHTTPSPlugin(s.URL)
+	}
+	if err != nil {
+		if s.SHA256 == "" && cached != "" {
+			if last, readErr := os.ReadFile(cached); readErr == nil {
+				log.Printf("plugins: %s: %v, using the copy cached last time", s, err)
+				return last, nil
+			}
+		}
+		return nil, err
+	}
+	if s.SHA256 == "" {
+		log.Printf("plugins: warning: %s is not pinned, its sha256 is %s", s, sha256Hex(b))
+	} else if sum := sha256Hex(b); sum != s.SHA256 {
+		return nil, fmt.Errorf("sha256 is %s, not the pinned %s", sum, s.SHA256)
+	}
+
+	if cached != "" {
+		if err := os.MkdirAll(cacheDir, 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(cached, b, 0644); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func fetchHTTPSPlugin(url string) ([]byte, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("answered %s", resp.Status)
+	}
+	// a byte more than a bundle may hold, so that a larger one is refused rather than cut short
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxPluginSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxPluginSize {
+		return nil, fmt.Errorf("bundle larger than %dMiB", maxPluginSize>>20)
+	}
+	return b, nil
+}
+
+func fetchOCIPlugin(reference, registryAuth string) ([]byte, error) {
+	creds, err := loadRegistryCredentials(registryAuth)
+	if err != nil {
+		return nil, err
+	}
+	client := newRegistryClient(creds)
+	ref := parseImageRef(reference)
+	m, err := client.manifest(ref)
+	if err != nil {
+		return nil, err
+	}
+	manifest := struct {
+		MediaType string `json:"mediaType"`
+		Layers    []struct {
+			MediaType string `json:"mediaType"`
+			Digest    string `json:"digest"`
+		} `json:"layers"`
+	}{}
+	if err := json.Unmarshal(m.Body, &manifest); err != nil {
+		return nil, fmt.Errorf("unreadable manifest; %w", err)
+	}
+	// the layer of the plugin media type, or the only one
+	digest := ""
+	for _, l := range manifest.Layers {
+		if l.MediaType == pluginMediaType {
+			digest = l.Digest
+		}
+	}
+	if digest == "" && len(manifest.Layers) == 1 {
+		digest = manifest.Layers[0].Digest
+	}
+	if digest == "" {
+		return nil, fmt.Errorf("expected an artifact with one layer, or a layer of type %s", pluginMediaType)
+	}
+	blob, err := client.blob(ref, digest)
+	if err != nil {
+		return nil, err
+	}
+	if "sha256:"+sha256Hex(blob.Body) != digest {
+		return nil, fmt.Errorf("layer %s doesn't match its digest", digest)
+	}
+	return blob.Body, nil
+}
+
+func setPluginPresets(specs []pluginPreset) {
+	pluginPresets = map[string]preset{}
+	for _, spec := range specs {
+		pluginPresets[spec.Name] = spec.preset()
+	}
+}
+
+func (p pluginPreset) preset() preset {
+	groups := map[string]bool{}
+	for _, g := range p.Groups {
+		groups[g] = true
+	}
+	resources := map[string]bool{}
+	for _, r := range p.Resources {
+		resources[r] = true
+	}
+	return func(disc discovery.DiscoveryInterface, dyn dynamic.Interface) ([]schema.GroupVersionResource, error) {
+		return servedResources(disc, func(gv schema.GroupVersion, r metav1.APIResource) bool {
+			return groups[gv.Group] && (len(resources) == 0 || resources[r.Name])
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+/*
+a preset is a named set of resources which are not known at compile time, and so are exported through the dynamic
+client - each preset resolves the resources it wants from what the cluster actually serves
+*/
+type preset func(disc discovery.DiscoveryInterface, dyn dynamic.Interface) ([]schema.GroupVersionResource, error)
+
+var presets = map[string]preset{
+	"crossplane":     crossplanePreset,
+	"openshift-rbac": openshiftRBACPreset,
+}
+
+func presetNames() string {
+	names := []string{}
+	for name := range presets {
+		names = append(names, name)
+	}
+	for name := range pluginPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func servedResources(disc discovery.DiscoveryInterface, match func(gv schema.GroupVersion, r metav1.APIResource) bool) ([]schema.GroupVersionResource, error) {
+	// partial discovery failures (typically broken aggregated apis) should not prevent us from exporting everything else
+	lists, err := disc.ServerPreferredResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+
+	gvrs := []schema.GroupVersionResource{}
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, r := range list.APIResources {
+			if strings.Contains(r.Name, "/") {
+				// subresources
+				continue
+			}
+			if match(gv, r) {
+				gvrs = append(gvrs, gv.WithResource(r.Name))
+			}
+		}
+	}
+	return gvrs, nil
+}
+
+func exportPreset(name string, disc discovery.DiscoveryInterface, dyn dynamic.Interface) error {
+	p, ok := presets[name]
+	if !ok {
+		p, ok = pluginPresets[name]
+	}
+	if !ok {
+		return fmt.Errorf("unknown preset %q: expected one of %s", name, presetNames())
+	}
+
+	gvrs, err := p(disc, dyn)
+	if err != nil {
+		return err
+	}
+	return exportResources("preset "+name, gvrs, dyn)
+}
+
+func exportResources(source string, gvrs []schema.GroupVersionResource, dyn dynamic.Interface) error {
+	for _, gvr := range gvrs {
+		// listed from a single namespace, cluster scoped types come back as not found and are left out
+		listStarted := time.Now()
+		list := &unstructured.UnstructuredList{}
+		err := listPerNamespace(gvr.String(), func(namespace string) error {
+			l, err := dyn.Resource(gvr).Namespace(namespace).List(context.TODO(), listOptions())
+			if err == nil {
+				list.Items = append(list.Items, l.Items...)
+			}
+			return err
+		})
+		if apierrors.IsNotFound(err) {
+			// asked for something this cluster doesn't have
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		recordListed(gvr.String(), len(list.Items))
+		timeList(gvr.Resource, listStarted)
+
+		count := 0
+		for i := range list.Items {
+			item := &list.Items[i]
+			if isSkippedNamespace(item.GetNamespace()) || outOfBoundScope(item.GetNamespace(), gvr.Group) {
+				continue
+			}
+			count++
+			// kinds are only unique within their group, so the group is part of the directory name
+			resourceType := strings.ToLower(item.GetKind())
+			if gvr.Group != "" {
+				resourceType += "." + gvr.Group
+			}
+			err = dumpToFile(extract(item), item.GetNamespace(), item.GetName(), resourceType)
+			if err != nil {
+				return err
+			}
+		}
+		log.Printf("%s: exported %d %s", source, count, gvr.String())
+	}
+	return nil
+}
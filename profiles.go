@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+a profile is a named bundle of flag values for a common use case - it only supplies defaults, so anything given
+explicitly on the command line still wins over the profile
+*/
+var profiles = map[string]map[string]string{
+	// just the user-defined access, nothing else
+	"minimal": {
+		"resources": "rbac,clusterrbac",
+	},
+	// everything needed to put the user-defined configuration back, written durably
+	"backup": {
+		"resources": "deployments,rbac,clusterrbac,admissionpolicies",
+		"preset":    "crossplane,openshift-rbac",
+		"fsync":     "true",
+	},
+	// access review: rbac only, findings reported
+	"audit": {
+		"resources":     "rbac,clusterrbac",
+		"preset":        "openshift-rbac",
+		"access-report": "true",
+		"blast-radius":  "true",
+	},
+	// what runs where, and who can touch it
+	"security": {
+		"resources":    "deployments,rbac,clusterrbac,admissionpolicies",
+		"sbom":         "true",
+		"blast-radius": "true",
+	},
+}
+
+const defaultResources string = "deployments,rbac,clusterrbac,admissionpolicies"
+
+var knownResources = map[string]bool{
+	"deployments":       true,
+	"rbac":              true,
+	"clusterrbac":       true,
+	"admissionpolicies": true,
+}
+
+func profileNames() string {
+	names := []string{}
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func applyProfile(fs *flag.FlagSet, name string) error {
+	if name == "" {
+		return nil
+	}
+	settings, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %q: expected one of %s", name, profileNames())
+	}
+
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for flagName, value := range settings {
+		if explicit[flagName] {
+			continue
+		}
+		if err := fs.Set(flagName, value); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func parseResources(list string) (map[string]bool, error) {
+	resources := map[string]bool{}
+	for _, r := range strings.Split(list, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		if !knownResources[r] {
+			return nil, fmt.Errorf("unknown resource set %q: expected deployments, rbac, clusterrbac or admissionpolicies", r)
+		}
+		resources[r] = true
+	}
+	return resources, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	rpprof "runtime/pprof"
+	"time"
+)
+
+/*
+	resource usage of a scan, for sizing the limits of the cronjob running it: -cpuprofile and -memprofile write
+	profiles of a single run for go tool pprof, -pprof-addr serves the live endpoints, which is what a daemon wants.
+	the endpoints get their own listener, so that they never end up next to the metrics on a port that is scraped
+*/
+
+func servePprof(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("pprof: %v", err)
+		}
+	}()
+}
+
+func startProfiling(cpuFile, memFile string) (func(), error) {
+	// the returned function writes the memory profile and stops the cpu profile, once the run is done
+	var cpu *os.File
+	if cpuFile != "" {
+		f, err := os.Create(cpuFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := rpprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to start cpu profile; %w", err)
+		}
+		cpu = f
+	}
+	startedAt := time.Now()
+
+	return func() {
+		if cpu != nil {
+			rpprof.StopCPUProfile()
+			cpu.Close()
+		}
+		if memFile != "" {
+			f, err := os.Create(memFile)
+			if err != nil {
+				log.Printf("memprofile: %v", err)
+				return
+			}
+			defer f.Close()
+			// allocs holds both what was allocated over the run and what is still in use, pprof picks with -sample_index
+			if err := rpprof.Lookup("allocs").WriteTo(f, 0); err != nil {
+				log.Printf("memprofile: %v", err)
+			}
+		}
+		// sys is what the process got from the os, and the closest to what a memory limit has to allow for
+		m := runtime.MemStats{}
+		runtime.ReadMemStats(&m)
+		log.Printf("resources: %s elapsed, %d cpu threads, %d MiB from the os, %d MiB heap in use, %d MiB allocated in total, %d gc runs",
+			time.Since(startedAt).Round(time.Millisecond), runtime.GOMAXPROCS(0), m.Sys>>20, m.HeapInuse>>20, m.TotalAlloc>>20, m.NumGC)
+	}, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes"
+)
+
+const quotaReport string = "reports/quota"
+
+type quotaCheck struct {
+	Namespace string `json:"namespace"`
+	Quota     string `json:"quota"`
+	Resource  string `json:"resource"`
+	Hard      string `json:"hard"`
+	Requested string `json:"requested"`
+	Used      string `json:"used,omitempty"`
+	Over      bool   `json:"overCommitted"`
+	Skipped   string `json:"skipped,omitempty"`
+}
+
+func podRequirements(spec corev1.PodSpec) corev1.ResourceList {
+	/*
+		the same sum the scheduler and quota admission use: every container added up, unless a single init container
+		asks for more, since init containers run one at a time before the rest start
+	*/
+	total := corev1.ResourceList{}
+	add := func(prefix string, list corev1.ResourceList, into corev1.ResourceList) {
+		for name, q := range list {
+			key := corev1.ResourceName(prefix + string(name))
+			sum := into[key]
+			sum.Add(q)
+			into[key] = sum
+		}
+	}
+	for _, c := range spec.Containers {
+		add("requests.", c.Resources.Requests, total)
+		add("limits.", c.Resources.Limits, total)
+	}
+	for _, c := range spec.InitContainers {
+		init := corev1.ResourceList{}
+		add("requests.", c.Resources.Requests, init)
+		add("limits.", c.Resources.Limits, init)
+		for name, q := range init {
+			if current := total[name]; q.Cmp(current) > 0 {
+				total[name] = q
+			}
+		}
+	}
+	return total
+}
+
+func namespaceRequirements(deployments []appsv1.Deployment) map[string]corev1.ResourceList {
+	// what each namespace needs with every deployment at its desired replicas
+	namespaces := map[string]corev1.ResourceList{}
+	for _, d := range deployments {
+		replicas := int64(1)
+		if d.Spec.Replicas != nil {
+			replicas = int64(*d.Spec.Replicas)
+		}
+		total, ok := namespaces[d.ObjectMeta.Namespace]
+		if !ok {
+			total = corev1.ResourceList{}
+			namespaces[d.ObjectMeta.Namespace] = total
+		}
+		for name, q := range podRequirements(d.Spec.Template.Spec) {
+			sum := total[name]
+			sum.Add(*resource.NewMilliQuantity(q.MilliValue()*replicas, q.Format))
+			total[name] = sum
+		}
+		pods := total[corev1.ResourcePods]
+		pods.Add(*resource.NewQuantity(replicas, resource.DecimalSI))
+		total[corev1.ResourcePods] = pods
+		deploymentCount := total["count/deployments.apps"]
+		deploymentCount.Add(*resource.NewQuantity(1, resource.DecimalSI))
+		total["count/deployments.apps"] = deploymentCount
+	}
+	return namespaces
+}
+
+func quotaResource(name corev1.ResourceName) corev1.ResourceName {
+	// quotas accept cpu and memory as shorthand for their requests
+	switch name {
+	case corev1.ResourceCPU, corev1.ResourceMemory, corev1.ResourceEphemeralStorage:
+		return corev1.ResourceName("requests." + string(name))
+	}
+	return name
+}
+
+func quotaChecks(deployments []appsv1.Deployment, quotas []corev1.ResourceQuota) []quotaCheck {
+	required := namespaceRequirements(deployments)
+	checks := []quotaCheck{}
+	for _, q := range quotas {
+		names := map[string]bool{}
+		for name := range q.Spec.Hard {
+			names[string(name)] = true
+		}
+		for _, name := range sortedKeys(names) {
+			check := quotaCheck{Namespace: q.ObjectMeta.Namespace, Quota: q.ObjectMeta.Name, Resource: name}
+			hard := q.Spec.Hard[corev1.ResourceName(name)]
+			check.Hard = hard.String()
+			if used, ok := q.Status.Used[corev1.ResourceName(name)]; ok {
+				check.Used = used.String()
+			}
+			// scoped quotas only count some pods, which an exported spec can't tell apart
+			if len(q.Spec.Scopes) > 0 || q.Spec.ScopeSelector != nil {
+				check.Skipped = "scoped quota"
+				checks = append(checks, check)
+				continue
+			}
+			key := quotaResource(corev1.ResourceName(name))
+			if !isWorkloadResource(key) {
+				check.Skipped = "not a workload resource"
+				checks = append(checks, check)
+				continue
+			}
+			requested := required[q.ObjectMeta.Namespace][key]
+			check.Requested = requested.String()
+			check.Over = requested.Cmp(hard) > 0
+			checks = append(checks, check)
+		}
+	}
+	return checks
+}
+
+func isWorkloadResource(name corev1.ResourceName) bool {
+	// services, secrets, storage and the like are counted by the quota but never requested by a deployment
+	s := string(name)
+	return name == corev1.ResourcePods || s == "count/deployments.apps" || strings.HasPrefix(s, "requests.") || strings.HasPrefix(s, "limits.")
+}
+
+func writeQuotaReport(clientset kubernetes.Interface, deployments []appsv1.Deployment) error {
+	listStarted := time.Now()
+	quotas, err := clientset.CoreV1().ResourceQuotas(scanNamespace).List(context.TODO(), listOptions())
+	if err != nil {
+		return err
+	}
+	recordListed("resourcequotas", len(quotas.Items))
+	timeList("resourcequotas", listStarted)
+
+	checks := quotaChecks(deployments, quotas.Items)
+	for _, c := range checks {
+		if !c.Over {
+			continue
+		}
+		addFinding(finding{
+			ID:        "quota-overcommitted",
+			Severity:  severityMedium,
+			Kind:      "ResourceQuota",
+			Namespace: c.Namespace,
+			Name:      c.Quota,
+			Message:   fmt.Sprintf("deployments need %s of %s, the quota allows %s - restoring this namespace will fail", c.Requested, c.Resource, c.Hard),
+		})
+	}
+
+	b, err := json.MarshalIndent(checks, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeRootFile(quotaReport+".json", b); err != nil {
+		return err
+	}
+
+	buffer := bytes.Buffer{}
+	w := csv.NewWriter(&buffer)
+	w.Write([]string{"namespace", "quota", "resource", "hard", "requested", "used", "over committed", "skipped"})
+	for _, c := range checks {
+		over := "no"
+		if c.Over {
+			over = "yes"
+		}
+		w.Write([]string{c.Namespace, c.Quota, c.Resource, c.Hard, c.Requested, c.Used, over, c.Skipped})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return writeRootFile(quotaReport+".csv", buffer.Bytes())
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+/*
+	extract keeps a few fields of every object, which is what a restore needs but not always what an investigation
+	does. with -keep-raw the object as the api returned it - status, annotations, managed fields and all - is also
+	written under raw/, at the same path as its pruned copy. raw copies are not part of result.json or the drift
+*/
+
+const rawDirectory string = "raw"
+
+var (
+	keepRaw    bool
+	rawObjects = map[string]runtime.Object{}
+	rawMu      sync.Mutex
+)
+
+func resetRawObjects() {
+	rawMu.Lock()
+	defer rawMu.Unlock()
+	rawObjects = map[string]runtime.Object{}
+}
+
+func rawKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+func rememberRaw(unknown interface{}) {
+	// lists hand out values, which have to be addressable to be runtime objects
+	obj, ok := unknown.(runtime.Object)
+	if !ok {
+		p := reflect.New(reflect.TypeOf(unknown))
+		p.Elem().Set(reflect.ValueOf(unknown))
+		if obj, ok = p.Interface().(runtime.Object); !ok {
+			return
+		}
+	}
+	obj = obj.DeepCopyObject()
+	if obj.GetObjectKind().GroupVersionKind().Empty() {
+		addTypeInformationToObject(obj)
+	}
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+	rawMu.Lock()
+	defer rawMu.Unlock()
+	rawObjects[rawKey(obj.GetObjectKind().GroupVersionKind().Kind, m.GetNamespace(), m.GetName())] = obj
+}
+
+func writeRaw(kind, namespace, name, resourceType string) error {
+	rawMu.Lock()
+	obj, ok := rawObjects[rawKey(kind, namespace, name)]
+	delete(rawObjects, rawKey(kind, namespace, name))
+	rawMu.Unlock()
+	if !ok || isIgnoredPath(path.Join(rawDirectory, objectPath(namespace, name, resourceType))) {
+		return nil
+	}
+
+	obj, err := transformObject(obj)
+	if err != nil {
+		return fmt.Errorf("failed to transform raw %s %s/%s; %w", resourceType, namespace, name, err)
+	}
+	encoded := bytes.Buffer{}
+	if err := encodeObject(obj, &encoded); err != nil {
+		return fmt.Errorf("failed to encode raw %s %s/%s; %w", resourceType, namespace, name, err)
+	}
+	formatted, err := formatYAML(encoded.Bytes(), kind, namespace, name)
+	if err != nil {
+		return fmt.Errorf("failed to format raw %s %s/%s; %w", resourceType, namespace, name, err)
+	}
+	w := newFileWriter()
+	w.rootDir = filepath.Join(outputDirectory, rawDirectory)
+	w.Write(formatted)
+	if err := w.flush(namespace, name, resourceType); err != nil {
+		return fmt.Errorf("failed to write raw %s %s/%s; %w", resourceType, namespace, name, err)
+	}
+	return nil
+}
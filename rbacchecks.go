@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nicgrobler/k8s/result"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// groups every (authenticated) caller, or every service account, is a member of
+var broadGroups = map[string]bool{
+	"system:authenticated":   true,
+	"system:unauthenticated": true,
+	"system:serviceaccounts": true,
+}
+
+func isBroadSubject(s rbacv1.Subject) bool {
+	if s.Kind != rbacv1.GroupKind {
+		return false
+	}
+	// system:serviceaccounts:<namespace> is every service account in a namespace
+	return broadGroups[s.Name] || strings.HasPrefix(s.Name, "system:serviceaccounts:")
+}
+
+var elevatedVerbs = map[string]bool{
+	"*": true, "create": true, "update": true, "patch": true, "delete": true, "deletecollection": true,
+	"escalate": true, "bind": true, "impersonate": true,
+}
+
+// resources every authenticated user is given create on by the default cluster roles
+var selfReviewResources = map[string]bool{
+	"selfsubjectaccessreviews": true,
+	"selfsubjectrulesreviews":  true,
+}
+
+func isElevatedRule(rule rbacv1.PolicyRule) bool {
+	/*
+		a rule is elevated if it writes anything (other than asking the api what the caller may do), touches every
+		resource, or can read secrets - non-resource urls are left alone, as the defaults hand those out widely
+	*/
+	for _, resource := range rule.Resources {
+		if resource == "*" {
+			return true
+		}
+		if resource == "secrets" {
+			return true
+		}
+		if selfReviewResources[resource] {
+			continue
+		}
+		for _, verb := range rule.Verbs {
+			if elevatedVerbs[verb] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isElevatedRole(ref rbacv1.RoleRef, rules []rbacv1.PolicyRule) bool {
+	if ref.Kind == "ClusterRole" && (ref.Name == "cluster-admin" || ref.Name == "admin" || ref.Name == "edit") {
+		return true
+	}
+	for _, rule := range rules {
+		if isElevatedRule(rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// several checks and reports need the rules behind the same bindings, so roles are only fetched once per run
+var (
+	rulesCache   = map[string][]rbacv1.PolicyRule{}
+	rulesCacheMu sync.Mutex
+)
+
+func roleRules(clientset kubernetes.Interface, namespace string, ref rbacv1.RoleRef) ([]rbacv1.PolicyRule, error) {
+	key := ref.Kind + "/" + ref.Name
+	if ref.Kind != "ClusterRole" {
+		key = namespace + "/" + key
+	}
+	rulesCacheMu.Lock()
+	rules, ok := rulesCache[key]
+	rulesCacheMu.Unlock()
+	if ok {
+		return rules, nil
+	}
+
+	rules, err := fetchRoleRules(clientset, namespace, ref)
+	if err != nil {
+		return nil, err
+	}
+	rulesCacheMu.Lock()
+	rulesCache[key] = rules
+	rulesCacheMu.Unlock()
+	return rules, nil
+}
+
+func fetchRoleRules(clientset kubernetes.Interface, namespace string, ref rbacv1.RoleRef) ([]rbacv1.PolicyRule, error) {
+	// a missing role grants nothing
+	if ref.Kind == "ClusterRole" {
+		role, err := clientset.RbacV1().ClusterRoles().Get(context.TODO(), ref.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		if apierrors.IsForbidden(err) && scanNamespace != "" {
+			// a namespace scan may well run without read access to cluster roles, which shouldn't end it
+			recordError(&result.ObjectRef{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRole", Name: ref.Name}, err)
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return role.Rules, nil
+	}
+	role, err := clientset.RbacV1().Roles(namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return role.Rules, nil
+}
+
+func broadSubjects(subjects []rbacv1.Subject) []string {
+	names := []string{}
+	for _, s := range subjects {
+		if isBroadSubject(s) {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+func checkBroadSubjects(clientset kubernetes.Interface, bindings []rbacv1.RoleBinding, clusterBindings []rbacv1.ClusterRoleBinding) error {
+	/*
+		this looks at every binding, not only the user-defined ones - granting elevated access to everyone is worth
+		knowing about whoever created it
+	*/
+	for _, b := range bindings {
+		broad := broadSubjects(b.Subjects)
+		if len(broad) == 0 || isSkippedNamespace(b.ObjectMeta.Namespace) {
+			continue
+		}
+		rules, err := roleRules(clientset, b.ObjectMeta.Namespace, b.RoleRef)
+		if err != nil {
+			return err
+		}
+		if isElevatedRole(b.RoleRef, rules) {
+			addFinding(finding{
+				ID:        "broad-subject-elevated",
+				Severity:  severityHigh,
+				Kind:      "RoleBinding",
+				Namespace: b.ObjectMeta.Namespace,
+				Name:      b.ObjectMeta.Name,
+				Message:   fmt.Sprintf("%s granted elevated %s %s", strings.Join(broad, ", "), strings.ToLower(b.RoleRef.Kind), b.RoleRef.Name),
+			})
+		}
+	}
+
+	for _, b := range clusterBindings {
+		broad := broadSubjects(b.Subjects)
+		if len(broad) == 0 {
+			continue
+		}
+		rules, err := roleRules(clientset, "", b.RoleRef)
+		if err != nil {
+			return err
+		}
+		if isElevatedRole(b.RoleRef, rules) {
+			addFinding(finding{
+				ID:       "broad-subject-elevated",
+				Severity: severityHigh,
+				Kind:     "ClusterRoleBinding",
+				Name:     b.ObjectMeta.Name,
+				Message:  fmt.Sprintf("%s granted elevated clusterrole %s cluster-wide", strings.Join(broad, ", "), b.RoleRef.Name),
+			})
+		}
+	}
+	return nil
+}
+
+func subjectKey(s rbacv1.Subject) string {
+	if s.Namespace != "" {
+		return s.Kind + ":" + s.Namespace + "/" + s.Name
+	}
+	return s.Kind + ":" + s.Name
+}
+
+func grantKeys(grants map[string][]string) []string {
+	// findings should come out in the same order on every run
+	keys := []string{}
+	for k := range grants {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func checkRedundantBindings(bindings []rbacv1.RoleBinding, clusterBindings []rbacv1.ClusterRoleBinding) {
+	/*
+		a subject granted the same role by more than one binding keeps its access when one of them is removed, which is
+		rarely what whoever removes it expects - that includes namespaced grants of a clusterrole the subject already
+		holds cluster-wide. bindings without subjects grant nothing at all. both are cleanup candidates.
+	*/
+	clusterGrants := map[string][]string{}
+	for _, b := range clusterBindings {
+		if len(b.Subjects) == 0 {
+			addFinding(finding{
+				ID:       "empty-binding",
+				Severity: severityLow,
+				Kind:     "ClusterRoleBinding",
+				Name:     b.ObjectMeta.Name,
+				Message:  fmt.Sprintf("binding of clusterrole %s has no subjects", b.RoleRef.Name),
+			})
+		}
+		for _, s := range b.Subjects {
+			key := b.RoleRef.Name + "|" + subjectKey(s)
+			clusterGrants[key] = append(clusterGrants[key], b.ObjectMeta.Name)
+		}
+	}
+	for _, key := range grantKeys(clusterGrants) {
+		if names := clusterGrants[key]; len(names) > 1 {
+			parts := strings.SplitN(key, "|", 2)
+			addFinding(finding{
+				ID:       "redundant-binding",
+				Severity: severityLow,
+				Kind:     "ClusterRoleBinding",
+				Name:     names[1],
+				Message:  fmt.Sprintf("%s is granted clusterrole %s by %d bindings: %s", parts[1], parts[0], len(names), strings.Join(names, ", ")),
+			})
+		}
+	}
+
+	namespaceGrants := map[string][]string{}
+	for _, b := range bindings {
+		if isSkippedNamespace(b.ObjectMeta.Namespace) {
+			continue
+		}
+		if len(b.Subjects) == 0 {
+			addFinding(finding{
+				ID:        "empty-binding",
+				Severity:  severityLow,
+				Kind:      "RoleBinding",
+				Namespace: b.ObjectMeta.Namespace,
+				Name:      b.ObjectMeta.Name,
+				Message:   fmt.Sprintf("binding of %s %s has no subjects", strings.ToLower(b.RoleRef.Kind), b.RoleRef.Name),
+			})
+		}
+		for _, s := range b.Subjects {
+			if b.RoleRef.Kind == "ClusterRole" {
+				if held := clusterGrants[b.RoleRef.Name+"|"+subjectKey(s)]; len(held) > 0 {
+					addFinding(finding{
+						ID:        "redundant-binding",
+						Severity:  severityLow,
+						Kind:      "RoleBinding",
+						Namespace: b.ObjectMeta.Namespace,
+						Name:      b.ObjectMeta.Name,
+						Message:   fmt.Sprintf("%s already holds clusterrole %s cluster-wide through %s", subjectKey(s), b.RoleRef.Name, strings.Join(held, ", ")),
+					})
+					continue
+				}
+			}
+			key := b.ObjectMeta.Namespace + "|" + b.RoleRef.Kind + "/" + b.RoleRef.Name + "|" + subjectKey(s)
+			namespaceGrants[key] = append(namespaceGrants[key], b.ObjectMeta.Name)
+		}
+	}
+	for _, key := range grantKeys(namespaceGrants) {
+		if names := namespaceGrants[key]; len(names) > 1 {
+			parts := strings.SplitN(key, "|", 3)
+			addFinding(finding{
+				ID:        "redundant-binding",
+				Severity:  severityLow,
+				Kind:      "RoleBinding",
+				Namespace: parts[0],
+				Name:      names[1],
+				Message:   fmt.Sprintf("%s is granted %s by %d bindings: %s", parts[2], strings.ToLower(parts[1]), len(names), strings.Join(names, ", ")),
+			})
+		}
+	}
+}
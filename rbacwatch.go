@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	rbacAdded   string = "added"
+	rbacRemoved string = "removed"
+	rbacChanged string = "changed"
+
+	// events are meant to be short, the full diff goes to the log and the webhook
+	maxEventMessage int = 1024
+)
+
+var rbacKinds = map[string]bool{
+	"RoleBinding":        true,
+	"Role":               true,
+	"ClusterRoleBinding": true,
+	"ClusterRole":        true,
+}
+
+// the matched rbac objects of the current run, as exported, keyed by kind/namespace/name
+var (
+	rbacState   = map[string][]byte{}
+	rbacStateMu sync.Mutex
+)
+
+func rbacKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+func recordRBAC(kind, namespace, name string, encoded []byte) {
+	if !rbacKinds[kind] {
+		return
+	}
+	rbacStateMu.Lock()
+	defer rbacStateMu.Unlock()
+	rbacState[rbacKey(kind, namespace, name)] = append([]byte{}, encoded...)
+}
+
+func resetRBACState() {
+	rbacStateMu.Lock()
+	defer rbacStateMu.Unlock()
+	rbacState = map[string][]byte{}
+}
+
+func currentRBACState() map[string][]byte {
+	rbacStateMu.Lock()
+	defer rbacStateMu.Unlock()
+	state := map[string][]byte{}
+	for k, v := range rbacState {
+		state[k] = v
+	}
+	return state
+}
+
+type rbacChange struct {
+	Cluster    string    `json:"cluster"`
+	Change     string    `json:"change"`
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Name       string    `json:"name"`
+	Diff       string    `json:"diff"`
+	DetectedAt time.Time `json:"detectedAt"`
+}
+
+func splitLines(b []byte) []string {
+	// keeps the line endings, which the diff expects, without inventing an empty last line
+	lines := strings.SplitAfter(string(b), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func unifiedDiff(key string, before, after []byte) (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(before),
+		B:        splitLines(after),
+		FromFile: "a/" + key,
+		ToFile:   "b/" + key,
+		Context:  3,
+	})
+}
+
+func diffRBAC(cluster string, previous, current map[string][]byte) ([]rbacChange, error) {
+	keys := map[string]bool{}
+	for k := range previous {
+		keys[k] = true
+	}
+	for k := range current {
+		keys[k] = true
+	}
+
+	changes := []rbacChange{}
+	now := time.Now().UTC()
+	for _, k := range sortedKeys(keys) {
+		before, had := previous[k]
+		after, has := current[k]
+		change := rbacChanged
+		switch {
+		case !had:
+			change = rbacAdded
+		case !has:
+			change = rbacRemoved
+		case bytes.Equal(before, after):
+			continue
+		}
+
+		diff, err := unifiedDiff(k, before, after)
+		if err != nil {
+			return nil, err
+		}
+		parts := strings.SplitN(k, "/", 3)
+		changes = append(changes, rbacChange{Cluster: cluster, Change: change, Kind: parts[0], Namespace: parts[1], Name: parts[2], Diff: diff, DetectedAt: now})
+	}
+	return changes, nil
+}
+
+// compares the matched rbac of every daemon run with that of the one before, and raises an alert per difference
+type rbacTracker struct {
+	clientset *kubernetes.Clientset
+	cluster   string
+	webhook   string
+	events    bool
+	client    *http.Client
+	previous  map[string][]byte
+}
+
+func newRBACTracker(clientset *kubernetes.Clientset, cluster, webhook string, events bool) *rbacTracker {
+	return &rbacTracker{
+		clientset: clientset,
+		cluster:   cluster,
+		webhook:   webhook,
+		events:    events,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (t *rbacTracker) update(current map[string][]byte) error {
+	// the first run is only the baseline, there's nothing to compare it to yet
+	if t.previous == nil {
+		t.previous = current
+		return nil
+	}
+	changes, err := diffRBAC(t.cluster, t.previous, current)
+	if err != nil {
+		return err
+	}
+	t.previous = current
+
+	errs := []string{}
+	for _, c := range changes {
+		if err := t.alert(c); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to send %d rbac alerts; %s", len(errs), strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (t *rbacTracker) alert(c rbacChange) error {
+	target := c.Name
+	if c.Namespace != "" {
+		target = c.Namespace + "/" + c.Name
+	}
+	log.Printf("rbac alert: %s %s %s\n%s", strings.ToLower(c.Kind), target, c.Change, c.Diff)
+
+	if t.webhook != "" {
+		if err := t.post(c); err != nil {
+			return err
+		}
+	}
+	if t.events {
+		if err := t.event(c, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *rbacTracker) post(c rbacChange) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Post(t.webhook, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s answered %s", t.webhook, resp.Status)
+	}
+	return nil
+}
+
+func (t *rbacTracker) event(c rbacChange, target string) error {
+	// cluster scoped objects have nowhere better to keep their events than the default namespace
+	namespace := c.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	message := fmt.Sprintf("%s %s %s\n%s", c.Kind, target, c.Change, c.Diff)
+	if len(message) > maxEventMessage {
+		message = truncateUTF8(message, maxEventMessage)
+	}
+
+	now := metav1.NewTime(c.DetectedAt)
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%s.%x", c.Name, strings.ToLower(c.Kind), c.DetectedAt.UnixNano()),
+			Namespace: namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: "rbac.authorization.k8s.io/v1",
+			Kind:       c.Kind,
+			Namespace:  c.Namespace,
+			Name:       c.Name,
+		},
+		Reason:         "RBACChanged",
+		Message:        message,
+		Type:           corev1.EventTypeWarning,
+		Source:         corev1.EventSource{Component: siemProduct},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	_, err := t.clientset.CoreV1().Events(namespace).Create(context.TODO(), event, metav1.CreateOptions{})
+	return err
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/homedir"
+)
+
+/*
+just enough of the registry v2 api to read manifests: the bearer token flow used by docker hub, ghcr, quay, harbor
+and friends, and basic auth for registries which ask for it - credentials come from a docker config.json
+*/
+
+const (
+	dockerHubRegistry string = "registry-1.docker.io"
+
+	mediaTypeDockerManifest string = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerList     string = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIManifest    string = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex       string = "application/vnd.oci.image.index.v1+json"
+)
+
+var manifestAccept = strings.Join([]string{mediaTypeOCIIndex, mediaTypeDockerList, mediaTypeOCIManifest, mediaTypeDockerManifest}, ", ")
+
+type imageRef struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+func (r imageRef) reference() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+func parseImageRef(image string) imageRef {
+	// the same defaults as the container runtime: docker hub, library/ for official images, and the latest tag
+	name, tag, digest := splitImage(image)
+	ref := imageRef{Registry: dockerHubRegistry, Repository: name, Tag: tag, Digest: digest}
+	if i := strings.Index(name, "/"); i >= 0 {
+		host := name[:i]
+		if strings.ContainsAny(host, ".:") || host == "localhost" {
+			ref.Registry, ref.Repository = host, name[i+1:]
+		}
+	}
+	if ref.Registry == "docker.io" || ref.Registry == "index.docker.io" {
+		ref.Registry = dockerHubRegistry
+	}
+	if ref.Registry == dockerHubRegistry && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	return ref
+}
+
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth     string `json:"auth"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"auths"`
+}
+
+func defaultRegistryAuth() string {
+	if home := homedir.HomeDir(); home != "" {
+		return filepath.Join(home, ".docker", "config.json")
+	}
+	return ""
+}
+
+type registryCredentials struct {
+	username string
+	password string
+}
+
+func loadRegistryCredentials(path string) (map[string]registryCredentials, error) {
+	creds := map[string]registryCredentials{}
+	if path == "" {
+		return creds, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return creds, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := dockerConfig{}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("failed to read registry credentials from %s; %w", path, err)
+	}
+	for host, a := range c.Auths {
+		cred := registryCredentials{username: a.Username, password: a.Password}
+		if a.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("invalid auth for %s in %s; %w", host, path, err)
+			}
+			parts := strings.SplitN(string(decoded), ":", 2)
+			if len(parts) == 2 {
+				cred = registryCredentials{username: parts[0], password: parts[1]}
+			}
+		}
+		// docker keeps docker hub under its index url
+		host = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://"), "/v1/")
+		if host == "index.docker.io" || host == "docker.io" {
+			host = dockerHubRegistry
+		}
+		creds[host] = cred
+	}
+	return creds, nil
+}
+
+type registryClient struct {
+	http   *http.Client
+	creds  map[string]registryCredentials
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+func newRegistryClient(creds map[string]registryCredentials) *registryClient {
+	return &registryClient{
+		http:   &http.Client{Timeout: 30 * time.Second},
+		creds:  creds,
+		tokens: map[string]string{},
+	}
+}
+
+type registryResponse struct {
+	MediaType string
+	Digest    string
+	Body      []byte
+}
+
+func (c *registryClient) get(ref imageRef, method, path, accept string) (registryResponse, error) {
+	u := "https://" + ref.Registry + "/v2/" + ref.Repository + path
+	scope := "repository:" + ref.Repository + ":pull"
+
+	do := func(authorization string) (*http.Response, error) {
+		req, err := http.NewRequest(method, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		return c.http.Do(req)
+	}
+
+	c.mu.Lock()
+	authorization := c.tokens[ref.Registry+"|"+scope]
+	c.mu.Unlock()
+
+	resp, err := do(authorization)
+	if err != nil {
+		return registryResponse{}, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		authorization, err = c.authorize(ref.Registry, scope, challenge)
+		if err != nil {
+			return registryResponse{}, err
+		}
+		c.mu.Lock()
+		c.tokens[ref.Registry+"|"+scope] = authorization
+		c.mu.Unlock()
+		resp, err = do(authorization)
+		if err != nil {
+			return registryResponse{}, err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return registryResponse{}, fmt.Errorf("registry %s answered %s for %s", ref.Registry, resp.Status, ref.Repository+path)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return registryResponse{}, err
+	}
+	return registryResponse{MediaType: resp.Header.Get("Content-Type"), Digest: resp.Header.Get("Docker-Content-Digest"), Body: body}, nil
+}
+
+func parseChallenge(challenge string) (scheme string, params map[string]string) {
+	// Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+	params = map[string]string{}
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	scheme = strings.ToLower(parts[0])
+	if len(parts) < 2 {
+		return scheme, params
+	}
+	for _, p := range strings.Split(parts[1], ",") {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) == 2 {
+			params[strings.ToLower(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+	return scheme, params
+}
+
+func (c *registryClient) authorize(registry, scope, challenge string) (string, error) {
+	cred, hasCred := c.creds[registry]
+	scheme, params := parseChallenge(challenge)
+
+	switch scheme {
+	case "basic":
+		if !hasCred {
+			return "", fmt.Errorf("registry %s needs credentials, and none were found for it", registry)
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(cred.username+":"+cred.password)), nil
+
+	case "bearer":
+		realm := params["realm"]
+		if realm == "" {
+			return "", fmt.Errorf("registry %s asked for a token without saying where to get it", registry)
+		}
+		q := url.Values{}
+		if params["service"] != "" {
+			q.Set("service", params["service"])
+		}
+		q.Set("scope", scope)
+		req, err := http.NewRequest(http.MethodGet, realm+"?"+q.Encode(), nil)
+		if err != nil {
+			return "", err
+		}
+		if hasCred {
+			req.SetBasicAuth(cred.username, cred.password)
+		}
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("token service for %s answered %s", registry, resp.Status)
+		}
+		token := struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}{}
+		if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+			return "", err
+		}
+		if token.Token == "" {
+			token.Token = token.AccessToken
+		}
+		return "Bearer " + token.Token, nil
+	}
+	return "", fmt.Errorf("registry %s uses unsupported authentication %q", registry, scheme)
+}
+
+func (c *registryClient) manifest(ref imageRef) (registryResponse, error) {
+	return c.get(ref, http.MethodGet, "/manifests/"+ref.reference(), manifestAccept)
+}
+
+func (c *registryClient) blob(ref imageRef, digest string) (registryResponse, error) {
+	return c.get(ref, http.MethodGet, "/blobs/"+digest, "")
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nicgrobler/k8s/result"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+/*
+	findings with an obvious fix get a patch proposing it: rfc 6902 json patches, one file per object under
+	remediation/, and a kustomization patching the exported manifests with them, so that kustomize build remediation
+	shows the result - nothing is applied, the patches are there to be reviewed, adjusted and applied by the team
+	owning the workload
+*/
+
+const remediationDirectory string = "remediation"
+
+type remediationConfig struct {
+	// labels every deployment should carry, and the placeholder value a patch sets them to
+	Labels map[string]string `json:"labels,omitempty"`
+	// set on containers which have none, defaulting to defaultRequests and defaultLimits
+	Requests map[string]string `json:"requests,omitempty"`
+	Limits   map[string]string `json:"limits,omitempty"`
+}
+
+var (
+	defaultRequests = map[string]string{"cpu": "100m", "memory": "128Mi"}
+	defaultLimits   = map[string]string{"cpu": "500m", "memory": "512Mi"}
+)
+
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+func jsonPointer(parts ...string) string {
+	// ~ and / are the only characters escaped in a json pointer, label keys often hold the latter
+	escaped := []string{}
+	for _, p := range parts {
+		escaped = append(escaped, strings.Replace(strings.Replace(p, "~", "~0", -1), "/", "~1", -1))
+	}
+	return "/" + strings.Join(escaped, "/")
+}
+
+func resourceDefaults(configured, defaults map[string]string) (corev1.ResourceList, error) {
+	if len(configured) == 0 {
+		configured = defaults
+	}
+	list := corev1.ResourceList{}
+	for name, value := range configured {
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("remediation: invalid %s %q; %w", name, value, err)
+		}
+		list[corev1.ResourceName(name)] = q
+	}
+	return list, nil
+}
+
+func isLatestImage(image string) bool {
+	_, tag, digest := splitImage(image)
+	return digest == "" && (tag == "" || tag == "latest")
+}
+
+func remediateDeployment(d appsv1.Deployment, c remediationConfig, requests, limits corev1.ResourceList, digests map[string]string) []patchOperation {
+	ops := []patchOperation{}
+
+	missing := []string{}
+	for _, key := range sortedMapKeys(c.Labels) {
+		if _, ok := d.ObjectMeta.Labels[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		addFinding(finding{
+			ID:        "missing-label",
+			Severity:  severityLow,
+			Kind:      "Deployment",
+			Namespace: d.ObjectMeta.Namespace,
+			Name:      d.ObjectMeta.Name,
+			Message:   fmt.Sprintf("missing labels %s", strings.Join(missing, ", ")),
+		})
+		if len(d.ObjectMeta.Labels) == 0 {
+			labels := map[string]string{}
+			for _, key := range missing {
+				labels[key] = c.Labels[key]
+			}
+			ops = append(ops, patchOperation{Op: "add", Path: "/metadata/labels", Value: labels})
+		} else {
+			for _, key := range missing {
+				ops = append(ops, patchOperation{Op: "add", Path: jsonPointer("metadata", "labels", key), Value: c.Labels[key]})
+			}
+		}
+	}
+
+	unlimited := []string{}
+	latest := []string{}
+	for _, field := range []string{"initContainers", "containers"} {
+		containers := d.Spec.Template.Spec.Containers
+		if field == "initContainers" {
+			containers = d.Spec.Template.Spec.InitContainers
+		}
+		for i, container := range containers {
+			// the api server always returns resources, if only as an empty object, so its fields can be added to
+			base := []string{"spec", "template", "spec", field, fmt.Sprint(i)}
+			if len(container.Resources.Limits) == 0 {
+				unlimited = append(unlimited, container.Name)
+				ops = append(ops, patchOperation{Op: "add", Path: jsonPointer(append(base, "resources", "limits")...), Value: limits})
+				if len(container.Resources.Requests) == 0 {
+					ops = append(ops, patchOperation{Op: "add", Path: jsonPointer(append(base, "resources", "requests")...), Value: requests})
+				}
+			}
+			if isLatestImage(container.Image) {
+				latest = append(latest, container.Image)
+				if digest, ok := digests[container.Image]; ok {
+					// the test makes the patch fail, rather than pin the wrong thing, should the image have changed since
+					image := jsonPointer(append(base, "image")...)
+					ops = append(ops,
+						patchOperation{Op: "test", Path: image, Value: container.Image},
+						patchOperation{Op: "replace", Path: image, Value: pinnedImage(container.Image, digest)},
+					)
+				}
+			}
+		}
+	}
+	if len(unlimited) > 0 {
+		sort.Strings(unlimited)
+		addFinding(finding{
+			ID:        "missing-resource-limits",
+			Severity:  severityLow,
+			Kind:      "Deployment",
+			Namespace: d.ObjectMeta.Namespace,
+			Name:      d.ObjectMeta.Name,
+			Message:   fmt.Sprintf("containers without resource limits: %s", strings.Join(unlimited, ", ")),
+		})
+	}
+	if len(latest) > 0 {
+		sort.Strings(latest)
+		addFinding(finding{
+			ID:        "image-latest-tag",
+			Severity:  severityMedium,
+			Kind:      "Deployment",
+			Namespace: d.ObjectMeta.Namespace,
+			Name:      d.ObjectMeta.Name,
+			Message:   fmt.Sprintf("runs images by the latest tag: %s", strings.Join(latest, ", ")),
+		})
+	}
+	return ops
+}
+
+func sortedMapKeys(m map[string]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func latestDigests(deployments []appsv1.Deployment, client *registryClient) map[string]string {
+	// only images run by the latest tag are looked up, pinning them is the fix - an unreachable registry leaves the image unpatched
+	digests := map[string]string{}
+	failed := map[string]bool{}
+	for _, d := range deployments {
+		containers := append(append([]corev1.Container{}, d.Spec.Template.Spec.InitContainers...), d.Spec.Template.Spec.Containers...)
+		for _, c := range containers {
+			if !isLatestImage(c.Image) || failed[c.Image] || digests[c.Image] != "" {
+				continue
+			}
+			digest, err := client.digest(parseImageRef(c.Image))
+			if err != nil {
+				failed[c.Image] = true
+				recordError(&result.ObjectRef{Kind: "Image", Name: c.Image}, fmt.Errorf("failed to resolve digest; %w", err))
+				continue
+			}
+			digests[c.Image] = digest
+		}
+	}
+	return digests
+}
+
+func writeRemediation(deployments []appsv1.Deployment, c remediationConfig, authFile string) error {
+	requests, err := resourceDefaults(c.Requests, defaultRequests)
+	if err != nil {
+		return err
+	}
+	limits, err := resourceDefaults(c.Limits, defaultLimits)
+	if err != nil {
+		return err
+	}
+	creds, err := loadRegistryCredentials(authFile)
+	if err != nil {
+		return err
+	}
+	digests := latestDigests(deployments, newRegistryClient(creds))
+
+	type target struct {
+		Group     string `json:"group"`
+		Version   string `json:"version"`
+		Kind      string `json:"kind"`
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+	}
+	type patchEntry struct {
+		Path   string `json:"path"`
+		Target target `json:"target"`
+	}
+	patches := []patchEntry{}
+	resources := []string{}
+
+	// the exported manifests are the kustomization's resources, compressed ones can't be read by kustomize
+	exportedPaths := map[string]string{}
+	exportedMu.Lock()
+	for _, o := range exported {
+		if o.Kind == "Deployment" && !strings.HasSuffix(o.Path, compressedSuffix) {
+			exportedPaths[o.Namespace+"/"+o.Name] = o.Path
+		}
+	}
+	exportedMu.Unlock()
+
+	for _, d := range deployments {
+		ops := remediateDeployment(d, c, requests, limits, digests)
+		if len(ops) == 0 {
+			continue
+		}
+		b, err := json.MarshalIndent(ops, "", "  ")
+		if err != nil {
+			return err
+		}
+		name := d.ObjectMeta.Namespace + "/deployment-" + d.ObjectMeta.Name + ".json"
+		if err := writeRootFile(remediationDirectory+"/"+name, b); err != nil {
+			return err
+		}
+		if p, ok := exportedPaths[d.ObjectMeta.Namespace+"/"+d.ObjectMeta.Name]; ok {
+			resources = append(resources, "../"+p)
+		}
+		patches = append(patches, patchEntry{
+			Path:   name,
+			Target: target{Group: "apps", Version: "v1", Kind: "Deployment", Namespace: d.ObjectMeta.Namespace, Name: d.ObjectMeta.Name},
+		})
+	}
+
+	kustomization, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": "kustomize.config.k8s.io/v1beta1",
+		"kind":       "Kustomization",
+		"resources":  resources,
+		"patches":    patches,
+	})
+	if err != nil {
+		return err
+	}
+	return writeRootFile(remediationDirectory+"/kustomization.yaml", kustomization)
+}
@@ -0,0 +1,234 @@
+// Package result holds the structured outcome of a kube-scanner run, as written to result.json at the root of every
+// export. Downstream tools should read this rather than walking the exported file tree.
+//
+// The format is versioned by its apiVersion field. Within a version, fields are only ever added; renaming or removing
+// a field means a new version, and Decode keeps converting every older version to the current one, so that archives
+// of old results stay readable by new releases.
+package result
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// FileName is where the result is written, relative to the output directory.
+const FileName string = "result.json"
+
+// The current version of the format, and the kind recorded alongside it.
+const (
+	APIVersion string = "kube-scanner.io/v1"
+	Kind       string = "ScanResult"
+)
+
+// ScanResult is everything a single run exported, found, and failed on.
+type ScanResult struct {
+	APIVersion    string         `json:"apiVersion"`
+	Kind          string         `json:"kind"`
+	Cluster       string         `json:"cluster"`
+	StartedAt     time.Time      `json:"startedAt"`
+	FinishedAt    time.Time      `json:"finishedAt"`
+	Objects       []Object       `json:"objects"`
+	Relationships []Relationship `json:"relationships"`
+	Findings      []Finding      `json:"findings"`
+	Errors        []Error        `json:"errors"`
+	// ErrorSummary counts the errors of every class that occurred, most frequent first.
+	ErrorSummary []ErrorClassSummary `json:"errorSummary,omitempty"`
+	// Unsupported counts the objects skipped because the scanner can't export their type, left out when none were.
+	Unsupported []UnsupportedType `json:"unsupported,omitempty"`
+}
+
+// ObjectRef identifies an object, or an RBAC subject, without saying anything about its content.
+type ObjectRef struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	// Key is KeyOf the reference, left out by releases from before keys were added.
+	Key string `json:"key,omitempty"`
+}
+
+// CoreGroup stands in for the unnamed core API group in keys.
+const CoreGroup string = "core"
+
+// KeyOf returns the canonical key of an object, the same in every output of a run: group/version/kind/namespace/name,
+// such as apps/v1/Deployment/shop/web, or rbac.authorization.k8s.io/v1/ClusterRole//admin for a cluster scoped
+// object. Users and groups carry no API version, and their group and version are empty: //Group//developers.
+func KeyOf(r ObjectRef) string {
+	group, version := "", r.APIVersion
+	if i := strings.Index(r.APIVersion, "/"); i >= 0 {
+		group, version = r.APIVersion[:i], r.APIVersion[i+1:]
+	} else if r.APIVersion != "" {
+		group = CoreGroup
+	}
+	return strings.Join([]string{group, version, r.Kind, r.Namespace, r.Name}, "/")
+}
+
+// WithKey returns the reference with its Key set.
+func (r ObjectRef) WithKey() ObjectRef {
+	r.Key = KeyOf(r)
+	return r
+}
+
+// ParseKey is the reverse of KeyOf.
+func ParseKey(key string) (ObjectRef, error) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 5 || parts[2] == "" || parts[4] == "" {
+		return ObjectRef{}, fmt.Errorf("invalid object key %q: expected group/version/kind/namespace/name", key)
+	}
+	r := ObjectRef{Kind: parts[2], Namespace: parts[3], Name: parts[4], Key: key}
+	switch {
+	case parts[0] == CoreGroup:
+		r.APIVersion = parts[1]
+	case parts[0] != "" || parts[1] != "":
+		r.APIVersion = parts[0] + "/" + parts[1]
+	}
+	return r, nil
+}
+
+// Object is an exported object, and where it was written to.
+type Object struct {
+	ObjectRef
+	Path string `json:"path"`
+	// LastModified is the newest managedFields entry of the object, left out when it had none.
+	LastModified *Modification `json:"lastModified,omitempty"`
+	// SHA256 is the hash of the object as serialised, without the file header, which only changes with the object.
+	SHA256 string `json:"sha256,omitempty"`
+	// AuditEvents are the most recent writes to the object found in the audit log, newest first.
+	AuditEvents []AuditEvent `json:"auditEvents,omitempty"`
+}
+
+// AuditEvent is a single successful write to an object, as recorded in the audit log.
+type AuditEvent struct {
+	User string    `json:"user"`
+	Verb string    `json:"verb"`
+	Time time.Time `json:"time"`
+}
+
+// Modification says which field manager last wrote an object, and when.
+type Modification struct {
+	Manager   string    `json:"manager"`
+	Operation string    `json:"operation"`
+	Time      time.Time `json:"time"`
+}
+
+// Relationship types.
+const (
+	// RoleRef links a binding to the role it grants.
+	RoleRef string = "roleRef"
+	// Subject links a binding to a subject it grants the role to.
+	Subject string = "subject"
+)
+
+// Relationship is a directed link between two objects, for example a binding and the role it refers to.
+type Relationship struct {
+	Type string    `json:"type"`
+	From ObjectRef `json:"from"`
+	To   ObjectRef `json:"to"`
+}
+
+// Finding is something the scan noticed which a human should probably look at.
+type Finding struct {
+	ID       string    `json:"id"`
+	Severity string    `json:"severity"`
+	Object   ObjectRef `json:"object"`
+	Message  string    `json:"message"`
+}
+
+// Error classes, for automation to branch on without parsing messages.
+const (
+	// ErrorAuth is a request the cluster refused to authenticate or authorise.
+	ErrorAuth string = "auth"
+	// ErrorNotFound is an object or resource the cluster doesn't have.
+	ErrorNotFound string = "not-found"
+	// ErrorThrottled is a request the cluster was too busy to serve.
+	ErrorThrottled string = "throttled"
+	// ErrorSerialization is an object or file which couldn't be encoded or decoded.
+	ErrorSerialization string = "serialization"
+	// ErrorIO is a failure reading or writing files, or talking to the network.
+	ErrorIO string = "io"
+	// ErrorOther is anything else.
+	ErrorOther string = "other"
+)
+
+// Error is a problem which did not stop the run, but means the export may be incomplete.
+type Error struct {
+	Object  *ObjectRef `json:"object,omitempty"`
+	Message string     `json:"message"`
+	// Class is one of the error classes, left out by releases from before errors were classified.
+	Class string `json:"class,omitempty"`
+}
+
+// ErrorClassSummary is how often errors of one class occurred, and the objects they affected.
+type ErrorClassSummary struct {
+	Class   string      `json:"class"`
+	Count   int         `json:"count"`
+	Objects []ObjectRef `json:"objects"`
+}
+
+// UnsupportedType is a type objects were skipped for, because the scanner doesn't know how to export it.
+type UnsupportedType struct {
+	// GVK is group/version/kind, empty when the type isn't a Kubernetes object.
+	GVK string `json:"gvk,omitempty"`
+	// GoType is the Go type handed to the export, such as *v1.Deployment.
+	GoType string `json:"goType"`
+	Count  int    `json:"count"`
+}
+
+// New returns an empty result of the current version.
+func New() ScanResult {
+	return ScanResult{
+		APIVersion:    APIVersion,
+		Kind:          Kind,
+		Objects:       []Object{},
+		Relationships: []Relationship{},
+		Findings:      []Finding{},
+		Errors:        []Error{},
+	}
+}
+
+// Decode reads a result of any known version from r, converted to the current version.
+func Decode(r io.Reader) (*ScanResult, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	versioned := struct {
+		APIVersion string `json:"apiVersion"`
+	}{}
+	if err := json.Unmarshal(b, &versioned); err != nil {
+		return nil, err
+	}
+
+	switch versioned.APIVersion {
+	case "":
+		// written before the format was versioned: identical to v1, less the version fields
+		res := &ScanResult{}
+		if err := json.Unmarshal(b, res); err != nil {
+			return nil, err
+		}
+		res.APIVersion, res.Kind = APIVersion, Kind
+		return res, nil
+
+	case APIVersion:
+		res := &ScanResult{}
+		if err := json.Unmarshal(b, res); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("unsupported result version %q: this release reads up to %s", versioned.APIVersion, APIVersion)
+}
+
+// ReadFile reads the result written to path.
+func ReadFile(path string) (*ScanResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Decode(f)
+}
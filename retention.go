@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+/*
+	retention is recorded in the manifest of every snapshot, so that it travels with the data: the class it was
+	written under, when that makes it expire, and whether it is under legal hold. prune walks a directory of
+	snapshots (dated output directories, or a collector store) and removes the expired ones - a snapshot under
+	legal hold is never removed, and neither is one without retention metadata, deleting by default is the one
+	mistake that can't be undone. hold places a hold on snapshots after the fact, or releases it
+*/
+
+type retentionConfig struct {
+	// retention classes by name, such as standard or compliance
+	Classes map[string]retentionClass `json:"classes,omitempty"`
+	// class of every snapshot not given one with -retention-class
+	DefaultClass string `json:"defaultClass,omitempty"`
+}
+
+type retentionClass struct {
+	Days int `json:"days"`
+}
+
+type retentionInfo struct {
+	Class string `json:"class,omitempty"`
+	// when the class allows the snapshot to be removed, left out for classes kept forever
+	ExpiresAt       *time.Time `json:"expiresAt,omitempty"`
+	LegalHold       bool       `json:"legalHold,omitempty"`
+	LegalHoldReason string     `json:"legalHoldReason,omitempty"`
+	LegalHoldSince  *time.Time `json:"legalHoldSince,omitempty"`
+}
+
+var (
+	retentionClassName string
+	legalHoldReason    string
+)
+
+func setRetention(c retentionConfig, class, holdReason string) error {
+	if class == "" {
+		class = c.DefaultClass
+	}
+	if class != "" {
+		if _, ok := c.Classes[class]; !ok {
+			return fmt.Errorf("unknown retention class %q: expected one of %s", class, retentionClassNames(c))
+		}
+	}
+	retentionClassName = class
+	legalHoldReason = holdReason
+	return nil
+}
+
+func retentionClassNames(c retentionConfig) string {
+	names := map[string]bool{}
+	for name := range c.Classes {
+		names[name] = true
+	}
+	if len(names) == 0 {
+		return "none, retention.classes of the config file is empty"
+	}
+	return fmt.Sprint(sortedKeys(names))
+}
+
+func expiry(c retentionClass, startedAt time.Time) *time.Time {
+	// zero days keeps the snapshot forever
+	if c.Days <= 0 {
+		return nil
+	}
+	t := startedAt.UTC().AddDate(0, 0, c.Days)
+	return &t
+}
+
+func currentRetention(startedAt time.Time) *retentionInfo {
+	if retentionClassName == "" && legalHoldReason == "" {
+		return nil
+	}
+	r := &retentionInfo{Class: retentionClassName}
+	if retentionClassName != "" {
+		r.ExpiresAt = expiry(cfg.Retention.Classes[retentionClassName], startedAt)
+	}
+	if legalHoldReason != "" {
+		now := startedAt.UTC()
+		r.LegalHold, r.LegalHoldReason, r.LegalHoldSince = true, legalHoldReason, &now
+	}
+	return r
+}
+
+func snapshotDirectories(root string) ([]string, error) {
+	// every directory holding a manifest is a snapshot, and nothing below one is looked at
+	dirs := []string{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		if _, err := os.Stat(filepath.Join(p, manifestFile)); err == nil {
+			dirs = append(dirs, p)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	sort.Strings(dirs)
+	return dirs, err
+}
+
+func writeManifestFile(dir string, m exportManifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, manifestFile), b, 0644)
+}
+
+func pruneDecision(m exportManifest, c retentionConfig, now time.Time) (bool, string) {
+	r := m.Retention
+	switch {
+	case r == nil || r.Class == "":
+		return false, "no retention class"
+	case r.LegalHold:
+		return false, "legal hold: " + r.LegalHoldReason
+	}
+	// the class as configured now wins over the expiry recorded when the snapshot was written
+	expiresAt := r.ExpiresAt
+	if class, ok := c.Classes[r.Class]; ok {
+		expiresAt = expiry(class, m.StartedAt)
+	}
+	if expiresAt == nil {
+		return false, fmt.Sprintf("class %s is kept forever", r.Class)
+	}
+	if now.Before(*expiresAt) {
+		return false, fmt.Sprintf("class %s, expires %s", r.Class, reportTime(*expiresAt))
+	}
+	return true, fmt.Sprintf("class %s, expired %s", r.Class, reportTime(*expiresAt))
+}
+
+func runPrune(args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	configFile := fs.String("config", "", "(optional) config file, whose retention classes win over the expiry recorded in each snapshot")
+	dryRun := fs.Bool("dry-run", false, "only print what would be removed")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: prune [-config file] [-dry-run] <directory of snapshots>")
+	}
+	c, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+
+	dirs, err := snapshotDirectories(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	removed := 0
+	for _, dir := range dirs {
+		m, err := readManifest(dir)
+		if err != nil {
+			// a snapshot we can't read is one we can't know the retention of
+			log.Printf("keeping %s: %v", dir, err)
+			continue
+		}
+		prune, reason := pruneDecision(m, c.Retention, now)
+		if !prune {
+			log.Printf("keeping %s: %s", dir, reason)
+			continue
+		}
+		if *dryRun {
+			fmt.Printf("would remove %s: %s\n", dir, reason)
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		removed++
+		fmt.Printf("removed %s: %s\n", dir, reason)
+	}
+	log.Printf("prune: %d of %d snapshots removed", removed, len(dirs))
+	return nil
+}
+
+func runHold(args []string) error {
+	fs := flag.NewFlagSet("hold", flag.ExitOnError)
+	reason := fs.String("reason", "", "why the snapshots are held, for example a case reference - required to place a hold")
+	release := fs.Bool("release", false, "release the hold instead")
+	fs.Parse(args)
+	if fs.NArg() == 0 || (*reason == "" && !*release) {
+		return errors.New("usage: hold -reason text <snapshot>... | hold -release <snapshot>...")
+	}
+
+	for _, dir := range fs.Args() {
+		m, err := readManifest(dir)
+		if err != nil {
+			return err
+		}
+		if m.Retention == nil {
+			m.Retention = &retentionInfo{}
+		}
+		if *release {
+			m.Retention.LegalHold, m.Retention.LegalHoldReason, m.Retention.LegalHoldSince = false, "", nil
+		} else {
+			now := time.Now().UTC()
+			m.Retention.LegalHold, m.Retention.LegalHoldReason, m.Retention.LegalHoldSince = true, *reason, &now
+		}
+		if err := writeManifestFile(dir, m); err != nil {
+			return err
+		}
+		log.Printf("%s: legal hold %t", dir, m.Retention.LegalHold)
+	}
+	return nil
+}
+
+func isLegalHold(dir string) bool {
+	m, err := readManifest(dir)
+	return err == nil && m.Retention != nil && m.Retention.LegalHold
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPruneDecision(t *testing.T) {
+	started := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	recorded := started.AddDate(0, 0, 30)
+	c := retentionConfig{Classes: map[string]retentionClass{
+		"standard":   {Days: 10},
+		"compliance": {Days: 0},
+	}}
+	tests := []struct {
+		name      string
+		retention *retentionInfo
+		now       time.Time
+		prune     bool
+		reason    string
+	}{
+		{name: "no retention", now: started.AddDate(1, 0, 0), reason: "no retention class"},
+		{name: "no class", retention: &retentionInfo{}, now: started.AddDate(1, 0, 0), reason: "no retention class"},
+		{name: "legal hold", retention: &retentionInfo{Class: "standard", LegalHold: true, LegalHoldReason: "case 12"}, now: started.AddDate(1, 0, 0), reason: "legal hold: case 12"},
+		{name: "kept forever", retention: &retentionInfo{Class: "compliance"}, now: started.AddDate(10, 0, 0), reason: "class compliance is kept forever"},
+		{name: "not expired", retention: &retentionInfo{Class: "standard"}, now: started.AddDate(0, 0, 9), reason: "class standard, expires 2026-01-11T00:00:00Z"},
+		{name: "expired", retention: &retentionInfo{Class: "standard"}, now: started.AddDate(0, 0, 10), prune: true, reason: "class standard, expired 2026-01-11T00:00:00Z"},
+		// the class as configured now wins over what was recorded
+		{name: "configured class wins", retention: &retentionInfo{Class: "standard", ExpiresAt: &recorded}, now: started.AddDate(0, 0, 20), prune: true, reason: "class standard, expired 2026-01-11T00:00:00Z"},
+		{name: "recorded expiry of a class no longer configured", retention: &retentionInfo{Class: "old", ExpiresAt: &recorded}, now: started.AddDate(0, 0, 20), reason: "class old, expires 2026-01-31T00:00:00Z"},
+		{name: "class no longer configured, kept forever", retention: &retentionInfo{Class: "old"}, now: started.AddDate(10, 0, 0), reason: "class old is kept forever"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			prune, reason := pruneDecision(exportManifest{StartedAt: started, Retention: tt.retention}, c, tt.now)
+			if prune != tt.prune || reason != tt.reason {
+				t.Errorf("got %v, %q, expected %v, %q", prune, reason, tt.prune, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const revisionAnnotation string = "deployment.kubernetes.io/revision"
+
+func revision(rs appsv1.ReplicaSet) int {
+	n, _ := strconv.Atoi(rs.ObjectMeta.Annotations[revisionAnnotation])
+	return n
+}
+
+func revisionHistory(replicaSets []appsv1.ReplicaSet, d appsv1.Deployment, keep int) []appsv1.ReplicaSet {
+	// the replicasets a deployment owns are its revisions, newest first - the current spec is one of them
+	owned := []appsv1.ReplicaSet{}
+	for _, rs := range replicaSets {
+		if rs.ObjectMeta.Namespace != d.ObjectMeta.Namespace {
+			continue
+		}
+		if owner := metav1.GetControllerOf(&rs); owner != nil && owner.UID == d.ObjectMeta.UID {
+			owned = append(owned, rs)
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool { return revision(owned[i]) > revision(owned[j]) })
+	if len(owned) > keep {
+		owned = owned[:keep]
+	}
+	return owned
+}
+
+func exportRevisionHistory(clientset kubernetes.Interface, deployments []appsv1.Deployment, keep int) error {
+	/*
+		the pod templates of earlier revisions only live in their replicasets, so without them a restored deployment
+		can't be rolled back - one list for the whole cluster is cheaper than one per namespace
+	*/
+	listStarted := time.Now()
+	replicaSets := &appsv1.ReplicaSetList{}
+	err := listPerNamespace("replicasets", func(namespace string) error {
+		list, err := clientset.AppsV1().ReplicaSets(namespace).List(context.TODO(), listOptions())
+		if err == nil {
+			replicaSets.Items = append(replicaSets.Items, list.Items...)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	recordListed("replicasets", len(replicaSets.Items))
+	timeList("replicasets", listStarted)
+
+	for _, d := range deployments {
+		for _, rs := range revisionHistory(replicaSets.Items, d, keep) {
+			err = dumpToFile(extract(rs), rs.ObjectMeta.Namespace, rs.ObjectMeta.Name, "replicaset")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
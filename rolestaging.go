@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+/*
+	roles are normally only reached through a matched binding, which misses the ones staged ahead of their bindings.
+	with -export-matching-roles, roles whose own name, or one of whose labels, holds the rolestring are exported as
+	well - clusterroles too when cluster rbac is scanned. roles already exported through a binding are left alone
+*/
+
+func roleMatches(meta metav1.ObjectMeta, lookFor string) bool {
+	if isUserDefined(meta.Name, lookFor) {
+		return true
+	}
+	for k, v := range meta.Labels {
+		if isUserDefined(k, lookFor) || isUserDefined(v, lookFor) {
+			return true
+		}
+	}
+	return false
+}
+
+func isExported(kind, namespace, name string) bool {
+	exportedMu.Lock()
+	defer exportedMu.Unlock()
+	for _, o := range exported {
+		if o.Kind == kind && o.Namespace == namespace && o.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func exportMatchingRoles(clientset *kubernetes.Clientset, lookFor string, clusterRoles bool) error {
+	listStarted := time.Now()
+	roles := &rbacv1.RoleList{}
+	err := listPerNamespace("roles", func(namespace string) error {
+		list, err := clientset.RbacV1().Roles(namespace).List(context.TODO(), listOptions())
+		if err == nil {
+			roles.Items = append(roles.Items, list.Items...)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	recordListed("roles", len(roles.Items))
+	timeList("roles", listStarted)
+	for _, role := range roles.Items {
+		if isSkippedNamespace(role.ObjectMeta.Namespace) || !roleMatches(role.ObjectMeta, lookFor) || isExported("Role", role.ObjectMeta.Namespace, role.ObjectMeta.Name) {
+			continue
+		}
+		if err := dumpToFile(extract(role), role.ObjectMeta.Namespace, role.ObjectMeta.Name, "role"); err != nil {
+			return err
+		}
+	}
+
+	if !clusterRoles {
+		return nil
+	}
+	listStarted = time.Now()
+	list, err := clientset.RbacV1().ClusterRoles().List(context.TODO(), listOptions())
+	if err != nil {
+		return err
+	}
+	recordListed("clusterroles", len(list.Items))
+	timeList("clusterroles", listStarted)
+	for i := range list.Items {
+		role := &list.Items[i]
+		if !roleMatches(role.ObjectMeta, lookFor) || isExported("ClusterRole", "", role.ObjectMeta.Name) {
+			continue
+		}
+		if err := dumpToFile(extract(role), "", role.ObjectMeta.Name, "clusterrole"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
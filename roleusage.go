@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+/*
+	a clusterrole is exported because one matched binding grants it, but shared roles are usually granted by many
+	more - cluster-wide and in single namespaces, to subjects the scan doesn't care about. for every exported
+	clusterrole this lists all the bindings referring to it, so that a review of a role change sees everyone it
+	reaches, with exported telling the bindings in the export apart from the rest
+*/
+
+const clusterRoleUsageReport string = "reports/clusterrole-usage"
+
+type roleUsageBinding struct {
+	Kind string `json:"kind"`
+	// empty for clusterrolebindings
+	Namespace string   `json:"namespace,omitempty"`
+	Name      string   `json:"name"`
+	Subjects  []string `json:"subjects"`
+	Exported  bool     `json:"exported"`
+}
+
+type clusterRoleUsage struct {
+	ClusterRole string             `json:"clusterRole"`
+	Path        string             `json:"path"`
+	Bindings    []roleUsageBinding `json:"bindings"`
+}
+
+func bindingSubjects(subjects []rbacv1.Subject) []string {
+	keys := []string{}
+	for _, s := range subjects {
+		keys = append(keys, subjectKey(s))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func clusterRoleUsages(bindings []rbacv1.RoleBinding, clusterBindings []rbacv1.ClusterRoleBinding, roleRefString string) []clusterRoleUsage {
+	usages := []clusterRoleUsage{}
+	exportedMu.Lock()
+	for _, o := range exported {
+		if o.Kind == "ClusterRole" {
+			usages = append(usages, clusterRoleUsage{ClusterRole: o.Name, Path: o.Path, Bindings: []roleUsageBinding{}})
+		}
+	}
+	exportedMu.Unlock()
+	sort.Slice(usages, func(i, j int) bool { return usages[i].ClusterRole < usages[j].ClusterRole })
+
+	index := map[string]int{}
+	for i, u := range usages {
+		index[u.ClusterRole] = i
+	}
+	// every binding listed, skipped namespaces included - they reach the role as much as any other
+	for _, b := range clusterBindings {
+		if i, ok := index[b.RoleRef.Name]; ok && b.RoleRef.Kind == "ClusterRole" {
+			usages[i].Bindings = append(usages[i].Bindings, roleUsageBinding{
+				Kind:     "ClusterRoleBinding",
+				Name:     b.ObjectMeta.Name,
+				Subjects: bindingSubjects(b.Subjects),
+				Exported: containsUserDefined(b.Subjects, roleRefString),
+			})
+		}
+	}
+	for _, b := range bindings {
+		if i, ok := index[b.RoleRef.Name]; ok && b.RoleRef.Kind == "ClusterRole" {
+			usages[i].Bindings = append(usages[i].Bindings, roleUsageBinding{
+				Kind:      "RoleBinding",
+				Namespace: b.ObjectMeta.Namespace,
+				Name:      b.ObjectMeta.Name,
+				Subjects:  bindingSubjects(b.Subjects),
+				Exported:  !isSkippedNamespace(b.ObjectMeta.Namespace) && containsUserDefined(b.Subjects, roleRefString),
+			})
+		}
+	}
+	for _, u := range usages {
+		sort.SliceStable(u.Bindings, func(i, j int) bool {
+			a, b := u.Bindings[i], u.Bindings[j]
+			if a.Kind != b.Kind {
+				return a.Kind < b.Kind
+			}
+			return a.Namespace+"/"+a.Name < b.Namespace+"/"+b.Name
+		})
+	}
+	return usages
+}
+
+func writeClusterRoleUsageReport(bindings []rbacv1.RoleBinding, clusterBindings []rbacv1.ClusterRoleBinding, roleRefString string) error {
+	usages := clusterRoleUsages(bindings, clusterBindings, roleRefString)
+
+	buffer := bytes.Buffer{}
+	w := csv.NewWriter(&buffer)
+	w.Write([]string{"clusterrole", "kind", "namespace", "binding", "subjects", "exported"})
+	for _, u := range usages {
+		for _, b := range u.Bindings {
+			w.Write([]string{u.ClusterRole, b.Kind, b.Namespace, b.Name, strings.Join(b.Subjects, " "), strconv.FormatBool(b.Exported)})
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if err := writeRootFile(clusterRoleUsageReport+".csv", buffer.Bytes()); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(usages, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeRootFile(clusterRoleUsageReport+".json", b)
+}
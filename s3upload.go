@@ -0,0 +1,471 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+/*
+	-upload-s3 sends the output directory as a tar.gz to an s3 bucket, or anything speaking the s3 api such as
+	minio, after every successful scan. full-cluster archives run to gigabytes and on-prem links are not to be
+	trusted, so the archive goes up as a multipart upload: every part is retried on its own, and -s3-bandwidth
+	keeps the upload from saturating the link. the archive and the state of its upload are kept in -s3-staging
+	until the upload completed - uploads a previous run didn't finish are resumed, from the last part that made
+	it, before the next archive goes up. requests are signed with aws signature v4, from the usual
+	AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN, and use path-style urls
+*/
+
+const (
+	// the smallest part s3 accepts, bar the last one
+	minPartSize int64 = 5 * 1024 * 1024
+	// and the most parts one upload may have
+	maxParts int64 = 10000
+
+	partAttempts  = 5
+	uploadSuffix  = ".upload.json"
+	archiveSuffix = ".tar.gz"
+	emptySHA256   = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+type s3Target struct {
+	endpoint     *url.URL
+	region       string
+	bucket       string
+	prefix       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	partSize     int64
+	// bytes per second, zero for no limit
+	bandwidth int64
+	staging   string
+	client    *http.Client
+}
+
+// what is needed to pick an upload up again, saved next to its archive after every part
+type s3Upload struct {
+	Key      string   `json:"key"`
+	Archive  string   `json:"archive"`
+	UploadID string   `json:"uploadId,omitempty"`
+	PartSize int64    `json:"partSize"`
+	Parts    []s3Part `json:"parts"`
+	file     string
+}
+
+type s3Part struct {
+	PartNumber int    `xml:"PartNumber" json:"partNumber"`
+	ETag       string `xml:"ETag" json:"etag"`
+}
+
+type s3Error struct {
+	status  int
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	return fmt.Sprintf("s3 answered %d %s: %s", e.status, e.Code, e.Message)
+}
+
+func newS3Target(target, endpoint, region, partSize, bandwidth, staging string) (*s3Target, error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("invalid -upload-s3 %q: expected s3://bucket/prefix", target)
+	}
+	t := &s3Target{
+		region:       region,
+		bucket:       u.Host,
+		prefix:       strings.Trim(u.Path, "/"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		staging:      staging,
+		// a part at a low -s3-bandwidth takes a while
+		client: &http.Client{Timeout: 30 * time.Minute},
+	}
+	if t.accessKey == "" || t.secretKey == "" {
+		return nil, errors.New("-upload-s3 needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if t.region == "" {
+		t.region = os.Getenv("AWS_REGION")
+	}
+	if t.region == "" {
+		t.region = "us-east-1"
+	}
+	if endpoint == "" {
+		endpoint = "https://s3." + t.region + ".amazonaws.com"
+	}
+	if t.endpoint, err = url.Parse(endpoint); err != nil || t.endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid -s3-endpoint %q", endpoint)
+	}
+
+	size, err := resource.ParseQuantity(partSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -s3-part-size %q; %w", partSize, err)
+	}
+	if t.partSize = size.Value(); t.partSize < minPartSize {
+		return nil, fmt.Errorf("-s3-part-size %s is below the 5Mi s3 accepts", partSize)
+	}
+	if bandwidth != "" {
+		rate, err := resource.ParseQuantity(bandwidth)
+		if err != nil || rate.Value() <= 0 {
+			return nil, fmt.Errorf("invalid -s3-bandwidth %q: expected bytes per second, such as 10Mi", bandwidth)
+		}
+		t.bandwidth = rate.Value()
+	}
+	if t.staging == "" {
+		t.staging = filepath.Join(os.TempDir(), "kube-scanner-upload")
+	}
+	return t, os.MkdirAll(t.staging, 0700)
+}
+
+// uriEncode escapes the way signature v4 expects, which isn't quite what net/url does
+func uriEncode(s string, keepSlash bool) string {
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '.' || c == '_' || c == '~' || (c == '/' && keepSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// sign adds the signature v4 headers, signing host and every header already set
+func (t *s3Target) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if t.sessionToken != "" {
+		req.Header.Set("x-amz-security-token", t.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := []string{}
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	canonicalHeaders := strings.Builder{}
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := []string{}
+	for k, vs := range req.URL.Query() {
+		for _, v := range vs {
+			query = append(query, uriEncode(k, false)+"="+uriEncode(v, false))
+		}
+	}
+	sort.Strings(query)
+
+	canonical := strings.Join([]string{req.Method, req.URL.EscapedPath(), strings.Join(query, "&"), canonicalHeaders.String(), signedHeaders, payloadHash}, "\n")
+	scope := date + "/" + t.region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+t.secretKey), date)
+	for _, part := range []string{t.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", t.accessKey, scope, signedHeaders, signature))
+}
+
+func (t *s3Target) do(method, key, query string, body io.Reader, payloadHash string, size int64) (*http.Response, []byte, error) {
+	target := *t.endpoint
+	target.Path = "/" + t.bucket + "/" + key
+	target.RawPath = "/" + uriEncode(t.bucket, false) + "/" + uriEncode(key, true)
+	target.RawQuery = query
+	req, err := http.NewRequest(method, target.String(), body)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.ContentLength = size
+	t.sign(req, payloadHash, time.Now())
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, nil, err
+	}
+	// completing an upload can fail with a 200 and an error in the body
+	if resp.StatusCode/100 != 2 || bytes.Contains(b, []byte("<Error>")) {
+		e := &s3Error{status: resp.StatusCode}
+		xml.Unmarshal(b, e)
+		return nil, nil, e
+	}
+	return resp, b, nil
+}
+
+func (u *s3Upload) save() error {
+	b, err := json.MarshalIndent(u, "", "  ")
+	if err != nil {
+		return err
+	}
+	// written aside and renamed, a crash mid-write must not lose the parts already sent
+	tmp := u.file + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, u.file)
+}
+
+func (u *s3Upload) done(part int) bool {
+	for _, p := range u.Parts {
+		if p.PartNumber == part {
+			return true
+		}
+	}
+	return false
+}
+
+// throttle keeps every read of an upload to the bandwidth, averaged over at most a second of credit
+type throttle struct {
+	mu    sync.Mutex
+	rate  int64
+	start time.Time
+	sent  int64
+}
+
+func (t *throttle) wait(n int) {
+	if t == nil || t.rate == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if t.start.IsZero() {
+		t.start = now
+	}
+	t.sent += int64(n)
+	due := time.Duration(float64(t.sent) / float64(t.rate) * float64(time.Second))
+	elapsed := now.Sub(t.start)
+	if elapsed-due > time.Second {
+		// idle time, such as a backoff, doesn't turn into a burst
+		t.start = now.Add(-due - time.Second)
+		elapsed = due + time.Second
+	}
+	if due > elapsed {
+		time.Sleep(due - elapsed)
+	}
+}
+
+type throttledReader struct {
+	r io.Reader
+	t *throttle
+}
+
+func (r throttledReader) Read(p []byte) (int, error) {
+	// small reads, so that the throttle evens out instead of sleeping a whole buffer at a time
+	if len(p) > 32*1024 {
+		p = p[:32*1024]
+	}
+	n, err := r.r.Read(p)
+	r.t.wait(n)
+	return n, err
+}
+
+func (t *s3Target) uploadPart(u *s3Upload, f *os.File, part int, offset, size int64, limit *throttle) (string, error) {
+	data := io.NewSectionReader(f, offset, size)
+	h := sha256.New()
+	if _, err := io.Copy(h, data); err != nil {
+		return "", err
+	}
+	if _, err := data.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	query := "partNumber=" + strconv.Itoa(part) + "&uploadId=" + uriEncode(u.UploadID, false)
+	resp, _, err := t.do(http.MethodPut, u.Key, query, throttledReader{data, limit}, hex.EncodeToString(h.Sum(nil)), size)
+	if err != nil {
+		return "", err
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+func (t *s3Target) resume(u *s3Upload, limit *throttle) error {
+	f, err := os.Open(u.Archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	if u.UploadID == "" {
+		// the part size is that of the upload, and grows for archives which would need too many parts
+		u.PartSize, u.Parts = t.partSize, []s3Part{}
+		if parts := int64(math.Ceil(float64(size) / float64(u.PartSize))); parts > maxParts {
+			u.PartSize = (size + maxParts - 1) / maxParts
+		}
+		_, body, err := t.do(http.MethodPost, u.Key, "uploads=", nil, emptySHA256, 0)
+		if err != nil {
+			return err
+		}
+		initiated := struct {
+			UploadID string `xml:"UploadId"`
+		}{}
+		if err := xml.Unmarshal(body, &initiated); err != nil || initiated.UploadID == "" {
+			return fmt.Errorf("s3 started no upload of %s: %s", u.Key, strings.TrimSpace(string(body)))
+		}
+		u.UploadID = initiated.UploadID
+		if err := u.save(); err != nil {
+			return err
+		}
+	}
+
+	parts := int((size + u.PartSize - 1) / u.PartSize)
+	if parts == 0 {
+		parts = 1
+	}
+	for part := 1; part <= parts; part++ {
+		if u.done(part) {
+			continue
+		}
+		offset := int64(part-1) * u.PartSize
+		length := u.PartSize
+		if offset+length > size {
+			length = size - offset
+		}
+		var etag string
+		for attempt := 1; ; attempt++ {
+			if etag, err = t.uploadPart(u, f, part, offset, length, limit); err == nil {
+				break
+			}
+			if attempt == partAttempts {
+				return fmt.Errorf("part %d of %s failed %d times; %w", part, u.Key, attempt, err)
+			}
+			backoff := time.Duration(1<<uint(attempt)) * time.Second
+			log.Printf("part %d of %s failed, retrying in %s: %v", part, u.Key, backoff, err)
+			time.Sleep(backoff)
+		}
+		u.Parts = append(u.Parts, s3Part{PartNumber: part, ETag: etag})
+		if err := u.save(); err != nil {
+			return err
+		}
+	}
+
+	sort.Slice(u.Parts, func(i, j int) bool { return u.Parts[i].PartNumber < u.Parts[j].PartNumber })
+	complete, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: u.Parts})
+	if err != nil {
+		return err
+	}
+	_, _, err = t.do(http.MethodPost, u.Key, "uploadId="+uriEncode(u.UploadID, false), bytes.NewReader(complete), sha256Hex(complete), int64(len(complete)))
+	return err
+}
+
+func (t *s3Target) finish(u *s3Upload, limit *throttle) error {
+	err := t.resume(u, limit)
+	var e *s3Error
+	if errors.As(err, &e) && e.Code == "NoSuchUpload" {
+		// aborted on the bucket side, by a lifecycle rule perhaps - all that's left is to start over
+		log.Printf("upload of %s is gone from the bucket, starting it again", u.Key)
+		u.UploadID = ""
+		err = t.resume(u, limit)
+	}
+	if err != nil {
+		return err
+	}
+	os.Remove(u.Archive)
+	os.Remove(u.file)
+	log.Printf("uploaded s3://%s/%s", t.bucket, u.Key)
+	return nil
+}
+
+func uploadToS3(t *s3Target, cluster, dir string) error {
+	limit := &throttle{rate: t.bandwidth}
+
+	// what earlier runs left unfinished goes first, the oldest archive first
+	pending, err := filepath.Glob(filepath.Join(t.staging, "*"+uploadSuffix))
+	if err != nil {
+		return err
+	}
+	sort.Strings(pending)
+	for _, file := range pending {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		u := &s3Upload{file: file}
+		if err := json.Unmarshal(b, u); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		log.Printf("resuming the upload of %s, %d parts already sent", u.Key, len(u.Parts))
+		if err := t.finish(u, limit); err != nil {
+			return err
+		}
+	}
+
+	stamp := snapshotName(time.Now())
+	key := stamp + archiveSuffix
+	if cluster != "" {
+		key = sanitizePathComponent(cluster) + "/" + key
+	}
+	if t.prefix != "" {
+		key = t.prefix + "/" + key
+	}
+	// the staging names sort by when the archive was written
+	base := filepath.Join(t.staging, stamp+"-"+sha256Hex([]byte(key))[:12])
+	u := &s3Upload{Key: key, Archive: base + archiveSuffix, file: base + uploadSuffix}
+	f, err := os.Create(u.Archive)
+	if err != nil {
+		return err
+	}
+	if err := writeArchive(f, dir); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := u.save(); err != nil {
+		return err
+	}
+	return t.finish(u, limit)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+/*
+	a quick look at an enormous cluster doesn't need every workload: with -sample and -sample-per-namespace only a
+	share of the deployments of every namespace is exported, and everything built from them - reports, findings,
+	revision history - only sees those. rbac is always exported in full. which deployments are picked is decided
+	by a hash of their name, so the same cluster samples the same way every run and sampled snapshots line up. the
+	manifest records that a snapshot was sampled, its drift against a full one is not meaningful
+*/
+
+type sampleInfo struct {
+	Percent      int `json:"percent,omitempty"`
+	PerNamespace int `json:"perNamespace,omitempty"`
+	// deployments exported, of how many in scope
+	Deployments int `json:"deployments"`
+	Of          int `json:"of"`
+}
+
+var currentSample *sampleInfo
+
+func parseSamplePercent(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	p, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(s), "%"))
+	if err != nil || p < 1 || p > 100 {
+		return 0, fmt.Errorf("invalid -sample %q: expected a percentage from 1%% to 100%%", s)
+	}
+	return p, nil
+}
+
+func sampleOrder(d appsv1.Deployment) string {
+	sum := sha256.Sum256([]byte(d.ObjectMeta.Namespace + "/" + d.ObjectMeta.Name))
+	return string(sum[:])
+}
+
+func sampleDeployments(deployments []appsv1.Deployment, percent, perNamespace int) []appsv1.Deployment {
+	if percent == 0 && perNamespace == 0 {
+		currentSample = nil
+		return deployments
+	}
+	byNamespace := map[string][]appsv1.Deployment{}
+	for _, d := range deployments {
+		byNamespace[d.ObjectMeta.Namespace] = append(byNamespace[d.ObjectMeta.Namespace], d)
+	}
+	picked := map[string]bool{}
+	for _, list := range byNamespace {
+		sort.Slice(list, func(i, j int) bool { return sampleOrder(list[i]) < sampleOrder(list[j]) })
+		n := len(list)
+		if percent > 0 {
+			// at least one of every namespace, a namespace left out entirely is not represented
+			n = int(math.Ceil(float64(len(list)) * float64(percent) / 100))
+		}
+		if perNamespace > 0 && n > perNamespace {
+			n = perNamespace
+		}
+		for _, d := range list[:n] {
+			picked[d.ObjectMeta.Namespace+"/"+d.ObjectMeta.Name] = true
+		}
+	}
+
+	// in the order listed, as everything after expects
+	sampled := []appsv1.Deployment{}
+	for _, d := range deployments {
+		if picked[d.ObjectMeta.Namespace+"/"+d.ObjectMeta.Name] {
+			sampled = append(sampled, d)
+		}
+	}
+	currentSample = &sampleInfo{Percent: percent, PerNamespace: perNamespace, Deployments: len(sampled), Of: len(deployments)}
+	log.Printf("sampled %d of %d deployments", len(sampled), len(deployments))
+	return sampled
+}
@@ -0,0 +1,667 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nicgrobler/k8s/result"
+	appsv1 "k8s.io/api/apps/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// everything a single scan needs to know, taken from the flags once at startup
+type scanOptions struct {
+	roleRefString    string
+	resources        map[string]bool
+	clusterName      string
+	ownerLabel       string
+	backstage        bool
+	revisionHistory  int
+	envInventory     bool
+	envAllow         string
+	sidecarReport    bool
+	topologyReport   bool
+	imagePlatforms   bool
+	registryAuth     string
+	requireArch      string
+	imagePinning     bool
+	exposureReport   bool
+	quotaCheck       bool
+	baseline         string
+	writeBaseline    string
+	failOn           string
+	remediation      bool
+	status           bool
+	metrics          *metricsServer
+	serviceNow       string
+	sbom             bool
+	kindStats        bool
+	accessReport     bool
+	unmatchedReport  bool
+	namespaceGrants  bool
+	matchingRoles    bool
+	roleUsage        bool
+	bySubject        bool
+	subjectInventory bool
+	blastRadius      bool
+	presets          string
+	lint             string
+	// see deploymentfilter.go
+	deploymentSAs string
+	boundOnly     bool
+	boundScope    bool
+	// see sample.go, 0 for no sampling
+	samplePercent      int
+	samplePerNamespace int
+	// writes the last-scan annotations to every scanned namespace
+	annotateNamespaces bool
+	terraform          bool
+	terraformFlavor    string
+	auditLog           string
+	auditEvents        int
+	// one of the gitCommit modes, see gitcommit.go
+	gitCommit string
+}
+
+func resetScanState() {
+	// in daemon mode every run starts from nothing, so that reports only describe what the cluster holds now
+	exportedMu.Lock()
+	exported = nil
+	exportedMu.Unlock()
+
+	findingsMu.Lock()
+	findings = nil
+	findingsMu.Unlock()
+
+	resultMu.Lock()
+	relationships = nil
+	scanErrors = nil
+	resultMu.Unlock()
+
+	rulesCacheMu.Lock()
+	rulesCache = map[string][]rbacv1.PolicyRule{}
+	rulesCacheMu.Unlock()
+
+	resetRBACState()
+	resetDigests()
+	resetWriteRegistry()
+	resetModifications()
+	resetKindStats()
+	resetUnsupported()
+	resetRawObjects()
+	resetEvents()
+	resetLimitCounts()
+}
+
+func runScan(clientset *kubernetes.Clientset, dynamicClient dynamic.Interface, siem *siemWriter, opts scanOptions) (err error) {
+	// checked on every run, as a daemon's pipeline changes with its config
+	if err := checkPipelineOutputs(transforms, opts.listedOutputs()); err != nil {
+		return err
+	}
+	// a run which can't have the lock leaves everything as the one holding it writes it
+	releaseLock, err := acquireScanLock(clientset)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if lockErr := releaseLock(); err == nil {
+			err = lockErr
+		}
+	}()
+	resetScanState()
+	startDegradedMode(clientset)
+	startAPICalls()
+	defer stopAPICalls()
+	startedAt := time.Now()
+	outputIgnores, err = loadIgnoreFile(outputDirectory)
+	if err != nil {
+		return err
+	}
+	// before this run's result replaces it
+	loadPreviousHashes(outputDirectory)
+	currentFingerprint = readClusterFingerprint(clientset)
+
+	// the event log is written however the run ends, it's most useful when it didn't end well
+	complete := false
+	defer func() {
+		if err != nil {
+			recordEvent(scanEvent{Action: eventError, Message: err.Error()})
+		}
+		if opts.status || opts.metrics != nil {
+			status := buildStatus(opts.clusterName, startedAt, err, complete)
+			if opts.metrics != nil {
+				opts.metrics.update(status)
+			}
+			if opts.status {
+				if werr := writeStatus(status); werr != nil && err == nil {
+					err = werr
+				}
+			}
+		}
+		if werr := writeEvents(); werr != nil && err == nil {
+			err = werr
+		}
+	}()
+	// bindings are listed and matched before anything is exported, some of the deployment filters need to know which matched
+	bindings := &rbacv1.RoleBindingList{}
+	if opts.resources["rbac"] {
+		listStarted := time.Now()
+		err = listPerNamespace("rolebindings", func(namespace string) error {
+			list, err := clientset.RbacV1().RoleBindings(namespace).List(context.TODO(), listOptions())
+			if err == nil {
+				bindings.Items = append(bindings.Items, list.Items...)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		recordListed("rolebindings", len(bindings.Items))
+		timeList("rolebindings", listStarted)
+	}
+
+	// matching and reporting work on the normalized subject names, the export keeps the bindings as listed
+	listedBindings := bindings.Items
+	bindings.Items = normalizeRoleBindings(listedBindings)
+
+	userDefinedBindings := []rbacv1.RoleBinding{}
+	exportBindings := []rbacv1.RoleBinding{}
+
+	for i, binding := range bindings.Items {
+		if isSkippedNamespace(binding.ObjectMeta.Namespace) {
+			continue
+		}
+		subjects := binding.Subjects
+		if containsUserDefined(subjects, opts.roleRefString) {
+			userDefinedBindings = append(userDefinedBindings, binding)
+			exportBindings = append(exportBindings, listedBindings[i])
+		}
+	}
+
+	setBoundScope(opts.boundScope, userDefinedBindings)
+
+	// go through our list of types, and simply grab all we can from the cluster
+	deployments := &appsv1.DeploymentList{}
+	if opts.resources["deployments"] {
+		listStarted := time.Now()
+		err = listPerNamespace("deployments", func(namespace string) error {
+			list, err := clientset.AppsV1().Deployments(namespace).List(context.TODO(), listOptions())
+			if err == nil {
+				deployments.Items = append(deployments.Items, list.Items...)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		recordListed("deployments", len(deployments.Items))
+		timeList("deployments", listStarted)
+	}
+
+	// everything built from the deployments below should agree on which ones were in scope
+	inScope := []appsv1.Deployment{}
+	for _, deployment := range deployments.Items {
+		if !isSkippedNamespace(deployment.ObjectMeta.Namespace) {
+			inScope = append(inScope, deployment)
+		}
+	}
+	inScope = filterDeployments(inScope, deploymentFilters(opts, userDefinedBindings))
+	deployments.Items = sampleDeployments(inScope, opts.samplePercent, opts.samplePerNamespace)
+
+	/*
+		Most roles and roles bindings within the cluster are either default, or controlled by operators. In order to only extract those which are created for user access
+		we need to go through the list of bindings, and only extract those that have a roleRef (membership) that is a user / group that we care about - for example:
+
+		RES-DEV-OPSH-DEVELOPER-FDS_TADPOLE
+
+		Need to work using bindings as the Roles themselves hold no reference to the binding objects
+	*/
+
+	// namespaced objects are written one namespace at a time, with the namespace hooks run around each
+	deploymentsIn := map[string][]appsv1.Deployment{}
+	for _, deployment := range deployments.Items {
+		deploymentsIn[deployment.ObjectMeta.Namespace] = append(deploymentsIn[deployment.ObjectMeta.Namespace], deployment)
+	}
+	bindingsIn := map[string][]int{}
+	for i, binding := range userDefinedBindings {
+		bindingsIn[binding.ObjectMeta.Namespace] = append(bindingsIn[binding.ObjectMeta.Namespace], i)
+	}
+	withObjects := []string{}
+	for namespace := range deploymentsIn {
+		withObjects = append(withObjects, namespace)
+	}
+	for namespace := range bindingsIn {
+		withObjects = append(withObjects, namespace)
+	}
+	for _, ns := range scanNamespaceOrder(withObjects, hooksConfigured(cfg.Hooks)) {
+		namespace := ns.ObjectMeta.Name
+		runNamespaceHooks(hookBefore, cfg.Hooks.BeforeNamespace, opts.clusterName, ns)
+		for _, deployment := range deploymentsIn[namespace] {
+			err = dumpToFile(extract(deployment), deployment.ObjectMeta.Namespace, deployment.ObjectMeta.Name, "deployment")
+			if err != nil {
+				return err
+			}
+		}
+		for _, i := range bindingsIn[namespace] {
+			err = exportRoleBinding(clientset, userDefinedBindings[i], exportBindings[i])
+			if err != nil {
+				return err
+			}
+		}
+		runNamespaceHooks(hookAfter, cfg.Hooks.AfterNamespace, opts.clusterName, ns)
+	}
+
+	if opts.revisionHistory > 0 {
+		err = exportRevisionHistory(clientset, deployments.Items, opts.revisionHistory)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.envInventory {
+		err = writeEnvInventory(deployments.Items, opts.envAllow)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.sidecarReport {
+		err = writeSidecarReport(deployments.Items)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.topologyReport {
+		err = writeTopologyReport(deployments.Items)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.imagePlatforms {
+		err = writeImagePlatformReport(deployments.Items, opts.registryAuth, opts.requireArch)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.imagePinning {
+		err = writeImagePinningReport(deployments.Items, opts.registryAuth)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.quotaCheck {
+		err = writeQuotaReport(clientset, deployments.Items)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.remediation {
+		err = writeRemediation(deployments.Items, cfg.Remediation, opts.registryAuth)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.exposureReport {
+		err = writeExposureReport(clientset, dynamicClient, deployments.Items)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.backstage {
+		err = writeBackstageCatalog(deployments.Items, opts.ownerLabel)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.serviceNow != "" {
+		err = writeServiceNowImportSet(opts.serviceNow, opts.clusterName, deployments.Items, opts.ownerLabel)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.sbom {
+		err = writeCycloneDX(opts.clusterName, deployments.Items)
+		if err != nil {
+			return err
+		}
+	}
+
+	// repeat for cluster bindings
+	clusterBindings := &rbacv1.ClusterRoleBindingList{}
+	if opts.resources["clusterrbac"] {
+		listStarted := time.Now()
+		clusterBindings, err = clientset.RbacV1().ClusterRoleBindings().List(context.TODO(), listOptions())
+		if err != nil {
+			return err
+		}
+		recordListed("clusterrolebindings", len(clusterBindings.Items))
+		timeList("clusterrolebindings", listStarted)
+	}
+
+	listedClusterBindings := clusterBindings.Items
+	clusterBindings.Items = normalizeClusterRoleBindings(listedClusterBindings)
+
+	userDefinedClusterBindings := []rbacv1.ClusterRoleBinding{}
+	exportClusterBindings := []rbacv1.ClusterRoleBinding{}
+
+	for i, binding := range clusterBindings.Items {
+		subjects := binding.Subjects
+		if containsUserDefined(subjects, opts.roleRefString) {
+			userDefinedClusterBindings = append(userDefinedClusterBindings, binding)
+			exportClusterBindings = append(exportClusterBindings, listedClusterBindings[i])
+		}
+	}
+
+	for i, binding := range userDefinedClusterBindings {
+
+		err = dumpToFile(extract(exportClusterBindings[i]), binding.ObjectMeta.Namespace, binding.ObjectMeta.Name, "clusterbinding")
+		if err != nil {
+			return err
+		}
+
+		ref := result.ObjectRef{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRoleBinding", Name: binding.ObjectMeta.Name}
+		recordMatched(ref)
+		roleRef, subjects, err := transformedBinding(&binding)
+		if err != nil {
+			return err
+		}
+		recordBinding(ref, roleRef, subjects)
+
+		role, err := clientset.RbacV1().ClusterRoles().Get(context.TODO(), binding.RoleRef.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			// the binding grants nothing, and there is no role to write
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		err = dumpToFile(extract(role), role.ObjectMeta.Namespace, role.ObjectMeta.Name, "clusterrole")
+		if err != nil {
+			return err
+		}
+
+	}
+
+	if len(userDefinedClusterBindings) > 0 {
+		err = checkSubjectNamespaces(clientset, userDefinedClusterBindings)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.matchingRoles && opts.resources["rbac"] {
+		err = exportMatchingRoles(clientset, opts.roleRefString, opts.resources["clusterrbac"])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = checkBroadSubjects(clientset, bindings.Items, clusterBindings.Items)
+	if err != nil {
+		return err
+	}
+	checkRedundantBindings(bindings.Items, clusterBindings.Items)
+	// as the identity provider named them, not as normalized
+	checkSubjectNaming(listedBindings, listedClusterBindings)
+
+	if opts.subjectInventory {
+		err = writeSubjectInventory(clientset.Discovery(), dynamicClient, userDefinedBindings, userDefinedClusterBindings, opts.roleRefString)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.bySubject {
+		err = writeSubjectViews(userDefinedBindings, userDefinedClusterBindings, opts.roleRefString)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.roleUsage {
+		err = writeClusterRoleUsageReport(bindings.Items, clusterBindings.Items, opts.roleRefString)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.unmatchedReport {
+		err = writeUnmatchedBindingsReport(bindings.Items, clusterBindings.Items, opts.roleRefString)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.namespaceGrants {
+		err = writeNamespaceGrantsView(clientset, userDefinedBindings, userDefinedClusterBindings)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.accessReport {
+		err = writeGroupAccessReport(userDefinedBindings, userDefinedClusterBindings, opts.roleRefString)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.blastRadius {
+		err = writeBlastRadiusReport(clientset, userDefinedBindings, userDefinedClusterBindings)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.resources["admissionpolicies"] {
+		err = exportAdmissionPolicies(clientset.Discovery(), dynamicClient)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.presets != "" {
+		for _, name := range strings.Split(opts.presets, ",") {
+			err = exportPreset(strings.TrimSpace(name), clientset.Discovery(), dynamicClient)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	lintFailures := 0
+	if opts.lint != "" {
+		lintFailures, err = lintExport(exported, opts.lint)
+		if err != nil {
+			return err
+		}
+	}
+
+	checkDeprecations(exported)
+
+	err = runCustomChecks(exported)
+	if err != nil {
+		return err
+	}
+
+	err = checkGolden(cfg.Golden, exported)
+	if err != nil {
+		return err
+	}
+
+	err = writePathManifest(exported)
+	if err != nil {
+		return err
+	}
+
+	if opts.terraform {
+		err = writeTerraformImports(exported, opts.terraformFlavor)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.writeBaseline != "" {
+		err = writeBaseline(opts.writeBaseline)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.baseline != "" {
+		accepted, err := loadBaseline(opts.baseline)
+		if err != nil {
+			return err
+		}
+		if suppressed, _ := applyBaseline(accepted); suppressed > 0 {
+			log.Printf("%d findings accepted in baseline %s", suppressed, opts.baseline)
+		}
+	}
+
+	if opts.auditLog != "" {
+		err = correlateAuditLog(opts.auditLog, opts.auditEvents)
+		if err != nil {
+			return err
+		}
+	}
+
+	// calls refused along the way may only have been recorded as errors, the run still failed
+	err = apiBudgetExceeded()
+	if err != nil {
+		return err
+	}
+
+	err = writeManifest(opts.clusterName, startedAt)
+	if err != nil {
+		return err
+	}
+
+	err = writeInaccessibleNamespaces()
+	if err != nil {
+		return err
+	}
+
+	err = writeResult(opts.clusterName, startedAt)
+	if err != nil {
+		return err
+	}
+	logUnchanged()
+	logErrorSummary()
+	logUnsupported()
+	logAPICalls()
+	if opts.kindStats {
+		if err := writeKindStats(); err != nil {
+			return err
+		}
+	}
+
+	// everything was exported and written, whatever the checks below decide
+	complete = true
+
+	/*
+		ship whatever we found to the siem, if one was configured. a message is retried a few times, but once one
+		can't be sent the siem is given up on for the rest of the run, rather than every finding waiting out its
+		retries: the run carries on and fails at the end
+	*/
+	var siemErr error
+	if siem != nil {
+		versions := exportedVersions()
+		for i, f := range findings {
+			if siemErr = siem.send(f, findingRef(f, versions).Key); siemErr != nil {
+				log.Printf("siem: giving up for this run, %d findings not sent: %v", len(findings)-i, siemErr)
+				break
+			}
+		}
+	}
+
+	if opts.annotateNamespaces {
+		annotateNamespaces(clientset, startedAt)
+	}
+
+	if opts.gitCommit != "" {
+		err = commitExport(outputDirectory, opts.gitCommit, opts.clusterName, startedAt)
+		if err != nil {
+			return err
+		}
+	}
+	if len(cfg.Teams) > 0 {
+		if err := fanOutTeams(cfg.Teams, opts.clusterName, startedAt); err != nil {
+			return err
+		}
+	}
+
+	// with a baseline and no threshold, anything new fails the run
+	failOn := opts.failOn
+	if failOn == "" && opts.baseline != "" {
+		failOn = severityLow
+	}
+	if failOn != "" {
+		if failing := findingsAtOrAbove(failOn); failing > 0 {
+			if opts.baseline != "" {
+				return fmt.Errorf("%d findings of %s severity or above are not in baseline %s", failing, failOn, opts.baseline)
+			}
+			return fmt.Errorf("%d findings of %s severity or above", failing, failOn)
+		}
+	}
+	if opts.lint == lintFail && lintFailures > 0 {
+		return fmt.Errorf("lint: %d exported files have problems", lintFailures)
+	}
+
+	return siemErr
+}
+
+func exportRoleBinding(clientset *kubernetes.Clientset, binding, listed rbacv1.RoleBinding) error {
+	// binding is normalized for matching, listed is what gets written
+	err := dumpToFile(extract(listed), binding.ObjectMeta.Namespace, binding.ObjectMeta.Name, "binding")
+	if err != nil {
+		return err
+	}
+
+	ref := result.ObjectRef{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "RoleBinding", Namespace: binding.ObjectMeta.Namespace, Name: binding.ObjectMeta.Name}
+	recordMatched(ref)
+	roleRef, subjects, err := transformedBinding(&binding)
+	if err != nil {
+		return err
+	}
+	recordBinding(ref, roleRef, subjects)
+
+	// a binding to a clusterrole grants that, not a role of the same name in the namespace
+	roles := &rbacv1.RoleList{}
+	var lookupErr error
+	if binding.RoleRef.Kind == "Role" {
+		roleOptions := listOptions()
+		roleOptions.FieldSelector = fields.OneTermEqualSelector("metadata.name", binding.RoleRef.Name).String()
+		listStarted := time.Now()
+		roles, lookupErr = clientset.RbacV1().Roles(binding.ObjectMeta.Namespace).List(context.TODO(), roleOptions)
+		if lookupErr != nil {
+			recordError(&ref, fmt.Errorf("failed to look up role %s; %w", binding.RoleRef.Name, lookupErr))
+		} else {
+			recordListed("roles", len(roles.Items))
+			timeList("roles", listStarted)
+		}
+	}
+	for _, role := range roles.Items {
+		err = dumpToFile(extract(role), role.ObjectMeta.Namespace, role.ObjectMeta.Name, "role")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
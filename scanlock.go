@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+/*
+	-scan-lock stops two scans from writing the same output directory, or git branch, at once - a cronjob whose
+	previous run is still going, or two people scanning by hand. with lease, the lock is a lease in the cluster,
+	for runs in pods which don't share a disk; with file, a file next to the output directory. a run which finds
+	the lock held fails without touching anything. the holder renews the lock while it scans, and a lock left
+	unrenewed for -scan-lock-ttl is taken over, so that a run which was killed doesn't block its retries for good.
+	a lease needs get, create, update and delete on leases in its namespace
+
+	renewing and releasing first check the lock is still ours: a run which lost it, to a takeover after it went
+	unrenewed or because a renewal failed, stops writing at once and fails, rather than carry on next to the new
+	holder. a stale lock file is taken over by one run at a time, whichever creates lockfile.takeover first
+*/
+
+const (
+	scanLockFile  string = "file"
+	scanLockLease string = "lease"
+)
+
+type scanLockSettings struct {
+	mode      string
+	namespace string
+	name      string
+	ttl       time.Duration
+}
+
+var scanLock scanLockSettings
+
+// set once the running scan no longer holds its lock, and checked before anything is written
+var (
+	scanLockLost   error
+	scanLockLostMu sync.Mutex
+)
+
+func lostScanLock() error {
+	scanLockLostMu.Lock()
+	defer scanLockLostMu.Unlock()
+	return scanLockLost
+}
+
+func setLostScanLock(err error) {
+	scanLockLostMu.Lock()
+	defer scanLockLostMu.Unlock()
+	if scanLockLost == nil {
+		scanLockLost = fmt.Errorf("stopped: lost the scan lock, the output directory only holds part of the scan; %w", err)
+	}
+}
+
+// what a lock file holds, for whoever finds it in the way
+type lockHolder struct {
+	Holder  string    `json:"holder"`
+	Renewed time.Time `json:"renewed"`
+}
+
+func validateScanLock(mode string, ttl time.Duration) error {
+	switch mode {
+	case "", scanLockFile, scanLockLease:
+	default:
+		return fmt.Errorf("unsupported -scan-lock %q: expected file or lease", mode)
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("-scan-lock-ttl has to be positive, got %s", ttl)
+	}
+	return nil
+}
+
+func acquireScanLock(clientset kubernetes.Interface) (func() error, error) {
+	// returns what releases the lock, which also stops renewing it, and fails when the lock was lost meanwhile
+	scanLockLostMu.Lock()
+	scanLockLost = nil
+	scanLockLostMu.Unlock()
+	var renew, release func() error
+	switch scanLock.mode {
+	case "":
+		return func() error { return nil }, nil
+	case scanLockFile:
+		file, err := filepath.Abs(outputDirectory)
+		if err != nil {
+			return nil, err
+		}
+		file += ".lock"
+		if err := takeLockFile(file); err != nil {
+			return nil, err
+		}
+		renew = func() error { return renewLockFile(file) }
+		release = func() error { return releaseLockFile(file) }
+	case scanLockLease:
+		if err := takeLease(clientset); err != nil {
+			return nil, err
+		}
+		renew = func() error { return renewLease(clientset) }
+		release = func() error { return releaseLease(clientset) }
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(scanLock.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := renew(); err != nil {
+					log.Printf("failed to renew the scan lock, stopping: %v", err)
+					setLostScanLock(err)
+					return
+				}
+			}
+		}
+	}()
+	return func() error {
+		close(stop)
+		<-done
+		if err := lostScanLock(); err != nil {
+			// whatever holds it now is not ours to release
+			return err
+		}
+		if err := release(); err != nil {
+			log.Printf("failed to release the scan lock: %v", err)
+		}
+		return nil
+	}, nil
+}
+
+func staleSince(renewed time.Time) bool {
+	return time.Since(renewed) > scanLock.ttl
+}
+
+func takeLockFile(file string) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err == nil {
+		f.Close()
+		return writeLockFile(file)
+	}
+	if !os.IsExist(err) {
+		return err
+	}
+	if err := lockFileHeld(file); err != nil {
+		return err
+	}
+
+	// only the run which creates the takeover file may replace a stale lock, and it looks again once it has
+	takeover := file + ".takeover"
+	t, err := os.OpenFile(takeover, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		info, statErr := os.Stat(takeover)
+		if statErr != nil || !staleSince(info.ModTime()) {
+			return fmt.Errorf("scan lock %s is being taken over by another run", file)
+		}
+		// left behind by a run killed while taking over
+		os.Remove(takeover)
+		t, err = os.OpenFile(takeover, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	t.Close()
+	defer os.Remove(takeover)
+	if err := lockFileHeld(file); err != nil {
+		return err
+	}
+	log.Printf("taking over the stale scan lock %s", file)
+	if err := writeLockFile(file); err != nil {
+		return err
+	}
+	return checkLockFile(file)
+}
+
+// fails unless the lock file went unrenewed for longer than the ttl
+func lockFileHeld(file string) error {
+	held, err := readLockFile(file)
+	if err != nil {
+		// a lock which can't be read is somebody's all the same, until it is old enough to be stale
+		info, statErr := os.Stat(file)
+		if statErr != nil || !staleSince(info.ModTime()) {
+			return fmt.Errorf("scan lock %s is held, and unreadable; %w", file, err)
+		}
+		return nil
+	}
+	if !staleSince(held.Renewed) {
+		return fmt.Errorf("scan lock %s is held by %s, renewed %s", file, held.Holder, reportTime(held.Renewed))
+	}
+	return nil
+}
+
+func readLockFile(file string) (lockHolder, error) {
+	held := lockHolder{}
+	b, err := os.ReadFile(file)
+	if err == nil {
+		err = json.Unmarshal(b, &held)
+	}
+	return held, err
+}
+
+// fails unless the lock file names this run as its holder
+func checkLockFile(file string) error {
+	id, err := leaderIdentity()
+	if err != nil {
+		return err
+	}
+	held, err := readLockFile(file)
+	if err != nil {
+		return err
+	}
+	if held.Holder != id {
+		return fmt.Errorf("scan lock %s was taken over by %s", file, held.Holder)
+	}
+	return nil
+}
+
+func renewLockFile(file string) error {
+	if err := checkLockFile(file); err != nil {
+		return err
+	}
+	return writeLockFile(file)
+}
+
+func releaseLockFile(file string) error {
+	if err := checkLockFile(file); err != nil {
+		return err
+	}
+	return os.Remove(file)
+}
+
+func writeLockFile(file string) error {
+	id, err := leaderIdentity()
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(lockHolder{Holder: id, Renewed: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	// renamed into place, so that the lock is never seen half written
+	tmp := fmt.Sprintf("%s.%s.tmp", file, id)
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func takeLease(clientset kubernetes.Interface) error {
+	id, err := leaderIdentity()
+	if err != nil {
+		return err
+	}
+	leases := clientset.CoordinationV1().Leases(scanLock.namespace)
+	seconds := int32(scanLock.ttl.Seconds())
+	now := metav1.NewMicroTime(time.Now())
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: scanLock.namespace, Name: scanLock.name},
+		Spec:       coordinationv1.LeaseSpec{HolderIdentity: &id, LeaseDurationSeconds: &seconds, AcquireTime: &now, RenewTime: &now},
+	}
+	_, err = leases.Create(context.TODO(), lease, metav1.CreateOptions{})
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	existing, err := leases.Get(context.TODO(), scanLock.name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	holder := ""
+	if existing.Spec.HolderIdentity != nil {
+		holder = *existing.Spec.HolderIdentity
+	}
+	if existing.Spec.RenewTime != nil && !staleSince(existing.Spec.RenewTime.Time) {
+		return fmt.Errorf("scan lock lease %s/%s is held by %s, renewed %s", scanLock.namespace, scanLock.name, holder, reportTime(existing.Spec.RenewTime.Time))
+	}
+	log.Printf("taking over the stale scan lock lease %s/%s of %s", scanLock.namespace, scanLock.name, holder)
+	existing.Spec = lease.Spec
+	// the resource version read above makes sure nobody else took it over in the meantime
+	_, err = leases.Update(context.TODO(), existing, metav1.UpdateOptions{})
+	return err
+}
+
+// the lease, as long as this run still holds it
+func heldLease(clientset kubernetes.Interface) (*coordinationv1.Lease, error) {
+	id, err := leaderIdentity()
+	if err != nil {
+		return nil, err
+	}
+	lease, err := clientset.CoordinationV1().Leases(scanLock.namespace).Get(context.TODO(), scanLock.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != id {
+		holder := ""
+		if lease.Spec.HolderIdentity != nil {
+			holder = *lease.Spec.HolderIdentity
+		}
+		return nil, fmt.Errorf("scan lock lease %s/%s was taken over by %s", scanLock.namespace, scanLock.name, holder)
+	}
+	return lease, nil
+}
+
+func renewLease(clientset kubernetes.Interface) error {
+	lease, err := heldLease(clientset)
+	if err != nil {
+		return err
+	}
+	now := metav1.NewMicroTime(time.Now())
+	lease.Spec.RenewTime = &now
+	// a takeover since the lease was read changes its resource version, and fails the update
+	_, err = clientset.CoordinationV1().Leases(scanLock.namespace).Update(context.TODO(), lease, metav1.UpdateOptions{})
+	return err
+}
+
+func releaseLease(clientset kubernetes.Interface) error {
+	lease, err := heldLease(clientset)
+	if err != nil {
+		return err
+	}
+	// only the lease as read, not one somebody took over since
+	return clientset.CoordinationV1().Leases(scanLock.namespace).Delete(context.TODO(), scanLock.name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &lease.UID, ResourceVersion: &lease.ResourceVersion},
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeHolder(t *testing.T, file, holder string, renewed time.Time) {
+	b, err := json.Marshal(lockHolder{Holder: holder, Renewed: renewed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTakeLockFile(t *testing.T) {
+	previous := scanLock
+	scanLock = scanLockSettings{mode: scanLockFile, ttl: time.Minute}
+	t.Cleanup(func() { scanLock = previous })
+
+	tests := []struct {
+		name string
+		// sets up the lock file and what is next to it, nothing when nil
+		setup func(t *testing.T, file string)
+		taken bool
+	}{
+		{name: "free", taken: true},
+		{name: "held", setup: func(t *testing.T, file string) {
+			writeHolder(t, file, "other_1", time.Now())
+		}},
+		{name: "stale", taken: true, setup: func(t *testing.T, file string) {
+			writeHolder(t, file, "other_1", time.Now().Add(-time.Hour))
+		}},
+		{name: "stale, being taken over", setup: func(t *testing.T, file string) {
+			writeHolder(t, file, "other_1", time.Now().Add(-time.Hour))
+			writeHolder(t, file+".takeover", "", time.Time{})
+		}},
+		{name: "stale, left behind by a killed takeover", taken: true, setup: func(t *testing.T, file string) {
+			writeHolder(t, file, "other_1", time.Now().Add(-time.Hour))
+			writeHolder(t, file+".takeover", "", time.Time{})
+			old := time.Now().Add(-time.Hour)
+			if err := os.Chtimes(file+".takeover", old, old); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{name: "unreadable", setup: func(t *testing.T, file string) {
+			if err := os.WriteFile(file, []byte("{"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "out.lock")
+			if tt.setup != nil {
+				tt.setup(t, file)
+			}
+			err := takeLockFile(file)
+			if tt.taken != (err == nil) {
+				t.Fatalf("taken: %v, expected %v", err, tt.taken)
+			}
+			if tt.taken {
+				if err := checkLockFile(file); err != nil {
+					t.Errorf("lock not held after taking it: %v", err)
+				}
+				if _, err := os.Stat(file + ".takeover"); !os.IsNotExist(err) {
+					t.Errorf("takeover file left behind: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestLockFileTakenOver(t *testing.T) {
+	previous := scanLock
+	scanLock = scanLockSettings{mode: scanLockFile, ttl: time.Minute}
+	t.Cleanup(func() { scanLock = previous })
+
+	file := filepath.Join(t.TempDir(), "out.lock")
+	if err := takeLockFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := renewLockFile(file); err != nil {
+		t.Fatalf("renewing a held lock: %v", err)
+	}
+	writeHolder(t, file, "other_1", time.Now())
+	if err := renewLockFile(file); err == nil {
+		t.Error("renewed a lock somebody else holds")
+	}
+	if err := releaseLockFile(file); err == nil {
+		t.Error("released a lock somebody else holds")
+	}
+	if held, err := readLockFile(file); err != nil || held.Holder != "other_1" {
+		t.Errorf("lock of the new holder changed: %+v, %v", held, err)
+	}
+}
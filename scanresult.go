@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/nicgrobler/k8s/result"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+var (
+	relationships []result.Relationship
+	scanErrors    []result.Error
+	resultMu      sync.Mutex
+)
+
+func recordRelationship(r result.Relationship) {
+	r.From, r.To = r.From.WithKey(), r.To.WithKey()
+	resultMu.Lock()
+	defer resultMu.Unlock()
+	relationships = append(relationships, r)
+}
+
+// for problems which leave the export incomplete, but shouldn't stop it
+func recordError(obj *result.ObjectRef, err error) {
+	resultMu.Lock()
+	obj = keyedRef(obj)
+	scanErrors = append(scanErrors, result.Error{Object: obj, Message: err.Error(), Class: classifyError(err)})
+	resultMu.Unlock()
+	recordEvent(scanEvent{Action: eventError, Object: obj, Message: err.Error()})
+}
+
+func recordBinding(binding result.ObjectRef, ref rbacv1.RoleRef, subjects []rbacv1.Subject) {
+	role := result.ObjectRef{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: ref.Kind, Name: ref.Name}
+	if ref.Kind == "Role" {
+		role.Namespace = binding.Namespace
+	}
+	recordRelationship(result.Relationship{Type: result.RoleRef, From: binding, To: role})
+
+	for _, s := range subjects {
+		recordRelationship(result.Relationship{Type: result.Subject, From: binding, To: result.ObjectRef{Kind: s.Kind, Namespace: s.Namespace, Name: s.Name}})
+	}
+}
+
+func buildResult(cluster string, startedAt time.Time) result.ScanResult {
+	res := result.New()
+	res.Cluster = cluster
+	res.StartedAt = startedAt.UTC()
+	res.FinishedAt = time.Now().UTC()
+
+	exportedMu.Lock()
+	for _, o := range exported {
+		res.Objects = append(res.Objects, result.Object{
+			ObjectRef:    result.ObjectRef{APIVersion: o.APIVersion, Kind: o.Kind, Namespace: o.Namespace, Name: o.Name}.WithKey(),
+			Path:         o.Path,
+			LastModified: o.LastModified,
+			AuditEvents:  o.AuditEvents,
+			SHA256:       o.SHA256,
+		})
+	}
+	exportedMu.Unlock()
+
+	versions := exportedVersions()
+	findingsMu.Lock()
+	for _, f := range findings {
+		res.Findings = append(res.Findings, result.Finding{
+			ID:       f.ID,
+			Severity: f.Severity,
+			Object:   findingRef(f, versions),
+			Message:  f.Message,
+		})
+	}
+	findingsMu.Unlock()
+
+	resultMu.Lock()
+	res.Relationships = append(res.Relationships, relationships...)
+	res.Errors = append(res.Errors, scanErrors...)
+	if len(scanErrors) > 0 {
+		res.ErrorSummary = errorSummary(scanErrors)
+	}
+	resultMu.Unlock()
+	if summary := unsupportedSummary(); len(summary) > 0 {
+		res.Unsupported = summary
+	}
+
+	return res
+}
+
+func writeResult(cluster string, startedAt time.Time) error {
+	b, err := json.MarshalIndent(buildResult(cluster, startedAt), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeRootFile(result.FileName, b)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	scan windows keep a daemon from scanning outside the hours it is allowed to - change windows which forbid even
+	read-heavy jobs during trading hours. every window is a cron expression (minute hour day-of-month month
+	day-of-week) matching the minutes a scan may start in, and the daemon pauses until the next matching minute
+	whenever a scan is due outside all of them. a scan which started inside a window is never interrupted
+*/
+
+type scheduleConfig struct {
+	// cron expressions, such as "* 18-23,0-6 * * 1-5" for weekday nights - no windows means scans run at any time
+	Windows []string `json:"windows,omitempty"`
+	// timezone the windows are in, such as Europe/London - local time when empty
+	Timezone string `json:"timezone,omitempty"`
+}
+
+type cronField map[int]bool
+
+type scanWindow struct {
+	expression                             string
+	minutes, hours, days, months, weekdays cronField
+	// cron runs on either day field when both are restricted, rather than on both
+	anyDay, anyWeekday bool
+}
+
+type scanWindows struct {
+	windows  []scanWindow
+	location *time.Location
+}
+
+func parseCronField(s string, min, max int) (cronField, error) {
+	field := cronField{}
+	for _, part := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			step, part = n, part[:i]
+		}
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			to = from
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid range %q", part)
+				}
+			} else if step > 1 {
+				// 5/15 is every 15 from 5 on
+				to = max
+			}
+		}
+		if from < min || to > max || from > to {
+			return nil, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+		for v := from; v <= to; v += step {
+			field[v] = true
+		}
+	}
+	return field, nil
+}
+
+func parseScanWindow(expression string) (scanWindow, error) {
+	parts := strings.Fields(expression)
+	if len(parts) != 5 {
+		return scanWindow{}, fmt.Errorf("scan window %q: expected minute hour day-of-month month day-of-week", expression)
+	}
+	w := scanWindow{expression: expression, anyDay: parts[2] == "*", anyWeekday: parts[4] == "*"}
+	fields := []*cronField{&w.minutes, &w.hours, &w.days, &w.months, &w.weekdays}
+	bounds := [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	for i, part := range parts {
+		f, err := parseCronField(part, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return scanWindow{}, fmt.Errorf("scan window %q: %w", expression, err)
+		}
+		*fields[i] = f
+	}
+	// sunday is both 0 and 7
+	if w.weekdays[7] {
+		w.weekdays[0] = true
+	}
+	return w, nil
+}
+
+func (w scanWindow) matches(t time.Time) bool {
+	if !w.minutes[t.Minute()] || !w.hours[t.Hour()] || !w.months[int(t.Month())] {
+		return false
+	}
+	day, weekday := w.days[t.Day()], w.weekdays[int(t.Weekday())]
+	switch {
+	case w.anyDay && w.anyWeekday:
+		return true
+	case w.anyDay:
+		return weekday
+	case w.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
+
+func parseScanWindows(c scheduleConfig) (*scanWindows, error) {
+	if len(c.Windows) == 0 {
+		return nil, nil
+	}
+	s := &scanWindows{location: time.Local}
+	if c.Timezone != "" {
+		loc, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("schedule.timezone: %w", err)
+		}
+		s.location = loc
+	}
+	for _, expression := range c.Windows {
+		w, err := parseScanWindow(expression)
+		if err != nil {
+			return nil, err
+		}
+		s.windows = append(s.windows, w)
+	}
+	if s.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("schedule.windows never open: %s", strings.Join(c.Windows, "; "))
+	}
+	return s, nil
+}
+
+// open reports whether a scan may start at t
+func (s *scanWindows) open(t time.Time) bool {
+	t = t.In(s.location)
+	for _, w := range s.windows {
+		if w.matches(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// next is the first minute from t on in which a scan may start, zero when there is none within a year
+func (s *scanWindows) next(t time.Time) time.Time {
+	if s.open(t) {
+		return t
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for end := t.AddDate(1, 0, 0); t.Before(end); t = t.Add(time.Minute) {
+		if s.open(t) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *scanWindows) wait() {
+	if s == nil {
+		return
+	}
+	now := time.Now()
+	next := s.next(now)
+	if next.Equal(now) {
+		return
+	}
+	log.Printf("outside the scan windows, pausing until %s", next.In(s.location).Format(time.RFC3339))
+	time.Sleep(time.Until(next))
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	semver "k8s.io/apimachinery/pkg/util/version"
+)
+
+/*
+releases are expected to carry one binary per platform named kube-scanner_<os>_<arch>[.exe], a checksums.txt in
+sha256sum format covering them, and checksums.txt.sig - a base64 ed25519 signature of checksums.txt
+*/
+const (
+	checksumsAsset string = "checksums.txt"
+	signatureAsset string = "checksums.txt.sig"
+)
+
+// base64 ed25519 public key the release checksums are signed with, set at build time
+var releasePublicKey = ""
+
+func releaseBinaryName() string {
+	name := fmt.Sprintf("kube-scanner_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+func download(url string) ([]byte, error) {
+	client := http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download of %s failed: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func findAsset(r release, name string) (releaseAsset, error) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, nil
+		}
+	}
+	return releaseAsset{}, fmt.Errorf("release %s has no asset %s", r.TagName, name)
+}
+
+func expectedChecksum(checksums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("%s does not list %s", checksumsAsset, name)
+}
+
+func verifySignature(publicKey string, message, signature []byte) error {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid release public key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("invalid release signature; %w", err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), message, sig) {
+		return fmt.Errorf("release checksums do not match their signature")
+	}
+	return nil
+}
+
+func compareRelease(current, latest string) (int, error) {
+	// how latest compares to the running version: a build which isn't a release, like dev, is older than any
+	l, err := semver.ParseSemantic(latest)
+	if err != nil {
+		return 0, fmt.Errorf("release %s is not a semantic version, so whether it is newer can't be told", latest)
+	}
+	c, err := semver.ParseSemantic(current)
+	if err != nil {
+		return 1, nil
+	}
+	switch {
+	case c.LessThan(l):
+		return 1, nil
+	case l.LessThan(c):
+		return -1, nil
+	}
+	return 0, nil
+}
+
+func replaceExecutable(binary []byte) error {
+	/*
+		write next to the running binary, then rename over it so that a failure part way never leaves a broken binary
+		windows won't let a running executable be replaced, but will let it be renamed out of the way
+	*/
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	self, err = filepath.EvalSymlinks(self)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(self), ".kube-scanner-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "windows" {
+		old := self + ".old"
+		os.Remove(old)
+		if err := os.Rename(self, old); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), self)
+}
+
+func runSelfUpdate(args []string) error {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	releaseURL := fs.String("release-url", defaultReleaseURL, "endpoint describing the latest release")
+	publicKey := fs.String("public-key", releasePublicKey, "base64 ed25519 key the release checksums are signed with")
+	force := fs.Bool("force", false, "update even when already running the latest release")
+	allowDowngrade := fs.Bool("allow-downgrade", false, "install the latest release even when it is older than this one, or not a semantic version")
+	skipSignature := fs.Bool("insecure-skip-signature", false, "(optional) update without a public key, trusting a checksum served from the same place as the binary")
+	fs.Parse(args)
+
+	// whoever can replace the binary can replace checksums.txt too, only the signature says who built it
+	if *publicKey == "" && !*skipSignature {
+		return errors.New("self-update: no release public key configured: pass -public-key, or -insecure-skip-signature to trust the checksum alone")
+	}
+
+	latest, err := latestRelease(*releaseURL)
+	if err != nil {
+		return err
+	}
+	newer, err := compareRelease(version, latest.TagName)
+	switch {
+	case err != nil && !*allowDowngrade:
+		return fmt.Errorf("self-update: %w: pass -allow-downgrade to install it anyway", err)
+	case err == nil && newer < 0 && !*allowDowngrade:
+		return fmt.Errorf("self-update: the latest release %s is older than %s: pass -allow-downgrade to install it anyway", latest.TagName, version)
+	case err == nil && newer == 0 && !*force:
+		fmt.Printf("kube-scanner %s is up to date\n", version)
+		return nil
+	}
+
+	checksumsURL, err := findAsset(latest, checksumsAsset)
+	if err != nil {
+		return err
+	}
+	checksums, err := download(checksumsURL.URL)
+	if err != nil {
+		return err
+	}
+
+	if *publicKey != "" {
+		sigURL, err := findAsset(latest, signatureAsset)
+		if err != nil {
+			return err
+		}
+		sig, err := download(sigURL.URL)
+		if err != nil {
+			return err
+		}
+		if err := verifySignature(*publicKey, checksums, sig); err != nil {
+			return err
+		}
+	} else {
+		log.Printf("warning: -insecure-skip-signature given, verifying the checksum only")
+	}
+
+	name := releaseBinaryName()
+	want, err := expectedChecksum(checksums, name)
+	if err != nil {
+		return err
+	}
+	binaryURL, err := findAsset(latest, name)
+	if err != nil {
+		return err
+	}
+	binary, err := download(binaryURL.URL)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(binary)
+	if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, want) {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", name, want, got)
+	}
+
+	if err := replaceExecutable(binary); err != nil {
+		return err
+	}
+	fmt.Printf("updated kube-scanner %s -> %s\n", version, latest.TagName)
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCompareRelease(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		latest  string
+		want    int
+		wantErr bool
+	}{
+		{name: "newer", current: "v1.2.0", latest: "v1.3.0", want: 1},
+		{name: "newer patch", current: "v1.2.9", latest: "v1.2.10", want: 1},
+		{name: "same", current: "v1.2.0", latest: "v1.2.0"},
+		{name: "same without the v", current: "v1.2.0", latest: "1.2.0"},
+		{name: "older", current: "v1.3.0", latest: "v1.2.0", want: -1},
+		{name: "release after its pre-release", current: "v1.3.0-rc.1", latest: "v1.3.0", want: 1},
+		{name: "pre-release before its release", current: "v1.3.0", latest: "v1.3.0-rc.1", want: -1},
+		{name: "dev build", current: "dev", latest: "v1.0.0", want: 1},
+		{name: "not a version", current: "v1.2.0", latest: "nightly", wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := compareRelease(tt.current, tt.latest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("compareRelease(%q, %q) gave error %v, expected an error: %v", tt.current, tt.latest, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("compareRelease(%q, %q) is %d, expected %d", tt.current, tt.latest, got, tt.want)
+			}
+		})
+	}
+}
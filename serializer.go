@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// how exported objects are laid out as yaml - which never holds anchors or aliases, the kubernetes serializer
+// doesn't write them and re-encoding keeps it that way
+type serializerOptions struct {
+	// yaml, or canonical-json which none of the options below apply to, see canonicaljson.go
+	Format string
+	// spaces per indentation level
+	Indent int
+	// render lists holding only scalars inline, as [a, b, c]
+	FlowLists bool
+	// start every file with a comment saying where and when it was exported
+	Header bool
+	// keep long strings on one line, the kubernetes serializer folds them at 80 columns
+	NoWrap bool
+	// how strings holding line breaks are written: literal blocks (|) or double quoted with \n, as chosen for each
+	// string when empty
+	Multiline string
+}
+
+const (
+	multilineLiteral string = "literal"
+	multilineQuoted  string = "quoted"
+)
+
+var serializer = serializerOptions{Indent: 2}
+
+// identifies the cluster in generated file headers
+var clusterIdentity string
+
+func (o serializerOptions) reformats() bool {
+	// the kubernetes serializer already writes the defaults, so only re-encode when something differs
+	return o.Indent != 2 || o.FlowLists || o.NoWrap || o.Multiline != ""
+}
+
+func styleMultilineStrings(n *yamlv3.Node, style yamlv3.Style) {
+	if n.Kind == yamlv3.ScalarNode && n.ShortTag() == "!!str" && strings.Contains(n.Value, "\n") {
+		n.Style = style
+	}
+	for _, c := range n.Content {
+		styleMultilineStrings(c, style)
+	}
+}
+
+func flowScalarLists(n *yamlv3.Node) {
+	if n.Kind == yamlv3.SequenceNode && len(n.Content) > 0 {
+		scalars := true
+		for _, c := range n.Content {
+			if c.Kind != yamlv3.ScalarNode {
+				scalars = false
+				break
+			}
+		}
+		if scalars {
+			n.Style = yamlv3.FlowStyle
+		}
+	}
+	for _, c := range n.Content {
+		flowScalarLists(c)
+	}
+}
+
+// replaces the standard header when set, see headerConfig
+var headerTemplate *template.Template
+
+type headerData struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Cluster   string
+	Date      string
+	Version   string
+	Values    map[string]string
+}
+
+func parseHeaderTemplate(c headerConfig) error {
+	headerTemplate = nil
+	if c.Template == "" {
+		return nil
+	}
+	t, err := template.New("header").Option("missingkey=error").Parse(c.Template)
+	if err != nil {
+		return fmt.Errorf("invalid header template; %w", err)
+	}
+	headerTemplate = t
+	return nil
+}
+
+func headerComment(kind, namespace, name string) (string, error) {
+	date := reportTime(time.Now())
+	if headerTemplate == nil {
+		object := kind + " " + name
+		if namespace != "" {
+			object = kind + " " + namespace + "/" + name
+		}
+		return fmt.Sprintf("# %s exported by kube-scanner %s on %s from cluster %s\n", object, version, date, clusterIdentity), nil
+	}
+
+	rendered := bytes.Buffer{}
+	err := headerTemplate.Execute(&rendered, headerData{
+		Kind:      kind,
+		Namespace: namespace,
+		Name:      name,
+		Cluster:   clusterIdentity,
+		Date:      date,
+		Version:   version,
+		Values:    cfg.Header.Values,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// every line must be a comment, whatever the template produced, or the file would no longer be valid yaml
+	comment := strings.Builder{}
+	for _, line := range strings.Split(strings.TrimRight(rendered.String(), "\n"), "\n") {
+		if line == "" {
+			comment.WriteString("#\n")
+		} else {
+			comment.WriteString("# " + line + "\n")
+		}
+	}
+	return comment.String(), nil
+}
+
+func formatYAML(data []byte, kind, namespace, name string) ([]byte, error) {
+	if serializer.Format == formatCanonicalJSON {
+		// already canonical, and without a place for comments
+		return data, nil
+	}
+	if serializer.reformats() {
+		// re-encoding through a node tree keeps the key order the kubernetes serializer chose, and never wraps lines
+		doc := yamlv3.Node{}
+		if err := yamlv3.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		if serializer.FlowLists {
+			flowScalarLists(&doc)
+		}
+		switch serializer.Multiline {
+		case multilineLiteral:
+			styleMultilineStrings(&doc, yamlv3.LiteralStyle)
+		case multilineQuoted:
+			styleMultilineStrings(&doc, yamlv3.DoubleQuotedStyle)
+		}
+		buffer := bytes.Buffer{}
+		enc := yamlv3.NewEncoder(&buffer)
+		enc.SetIndent(serializer.Indent)
+		if err := enc.Encode(&doc); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+		data = buffer.Bytes()
+	}
+
+	if serializer.Header || headerTemplate != nil {
+		header, err := headerComment(kind, namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		data = append([]byte(header), data...)
+	}
+	return data, nil
+}
+
+// the header config is checked along with the flags, as its template is a header too
+func validateSerializerOptions(o serializerOptions, h headerConfig) error {
+	if o.Indent < 2 || o.Indent > 9 {
+		return fmt.Errorf("yaml indent must be between 2 and 9, got %d", o.Indent)
+	}
+	if o.Multiline != "" && o.Multiline != multilineLiteral && o.Multiline != multilineQuoted {
+		return fmt.Errorf("unsupported -yaml-multiline %q: expected literal or quoted", o.Multiline)
+	}
+	switch o.Format {
+	case "", formatYAMLOutput:
+	case formatCanonicalJSON:
+		if o.reformats() || o.Header {
+			return errors.New("the yaml options and -header don't apply to canonical-json output")
+		}
+		if h.Template != "" {
+			return errors.New("header.template of the config doesn't apply to canonical-json output")
+		}
+	default:
+		return fmt.Errorf("unsupported -output-format %q: expected yaml or canonical-json", o.Format)
+	}
+	return nil
+}
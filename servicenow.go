@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+const (
+	cmdbClassCluster    string = "cmdb_ci_kubernetes_cluster"
+	cmdbClassNamespace  string = "cmdb_ci_kubernetes_namespace"
+	cmdbClassDeployment string = "cmdb_ci_kubernetes_deployment"
+)
+
+// a single row of a ServiceNow import set - the field names follow the CMDB kubernetes CI classes
+type cmdbRecord struct {
+	Class     string `json:"sys_class_name"`
+	Name      string `json:"name"`
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace,omitempty"`
+	Replicas  string `json:"replicas,omitempty"`
+	Images    string `json:"images,omitempty"`
+	Owner     string `json:"owner,omitempty"`
+}
+
+var cmdbColumns = []string{"sys_class_name", "name", "cluster", "namespace", "replicas", "images", "owner"}
+
+func cmdbRecords(cluster string, deployments []appsv1.Deployment, ownerLabel string) []cmdbRecord {
+	records := []cmdbRecord{{Class: cmdbClassCluster, Name: cluster, Cluster: cluster}}
+
+	namespaces := map[string]bool{}
+	workloads := []cmdbRecord{}
+	for _, d := range deployments {
+		namespaces[d.ObjectMeta.Namespace] = true
+
+		images := []string{}
+		for _, c := range d.Spec.Template.Spec.Containers {
+			images = append(images, c.Image)
+		}
+		replicas := ""
+		if d.Spec.Replicas != nil {
+			replicas = strconv.Itoa(int(*d.Spec.Replicas))
+		}
+
+		workloads = append(workloads, cmdbRecord{
+			Class:     cmdbClassDeployment,
+			Name:      d.ObjectMeta.Name,
+			Cluster:   cluster,
+			Namespace: d.ObjectMeta.Namespace,
+			Replicas:  replicas,
+			Images:    strings.Join(images, ","),
+			Owner:     d.ObjectMeta.Labels[ownerLabel],
+		})
+	}
+
+	names := []string{}
+	for ns := range namespaces {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+	for _, ns := range names {
+		records = append(records, cmdbRecord{Class: cmdbClassNamespace, Name: ns, Cluster: cluster, Namespace: ns})
+	}
+
+	return append(records, workloads...)
+}
+
+func writeServiceNowImportSet(format, cluster string, deployments []appsv1.Deployment, ownerLabel string) error {
+	records := cmdbRecords(cluster, deployments, ownerLabel)
+
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(map[string][]cmdbRecord{"records": records}, "", "  ")
+		if err != nil {
+			return err
+		}
+		return writeRootFile("servicenow.json", b)
+
+	case "csv":
+		buffer := bytes.Buffer{}
+		w := csv.NewWriter(&buffer)
+		w.Write(cmdbColumns)
+		for _, r := range records {
+			w.Write([]string{r.Class, r.Name, r.Cluster, r.Namespace, r.Replicas, r.Images, r.Owner})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		return writeRootFile("servicenow.csv", buffer.Bytes())
+	}
+
+	return fmt.Errorf("unsupported servicenow format %q: expected json or csv", format)
+}
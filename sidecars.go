@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+const sidecarReport string = "reports/sidecars"
+
+// well known sidecars, recognised by container name or by the last element of the image repository
+var knownSidecars = map[string]string{
+	"istio-proxy":             "istio-proxy",
+	"proxyv2":                 "istio-proxy",
+	"vault-agent":             "vault-agent",
+	"vault":                   "vault-agent",
+	"fluent-bit":              "fluent-bit",
+	"linkerd-proxy":           "linkerd-proxy",
+	"envoy":                   "envoy",
+	"cloud-sql-proxy":         "cloud-sql-proxy",
+	"oauth2-proxy":            "oauth2-proxy",
+	"datadog-agent":           "datadog-agent",
+	"otel-collector":          "otel-collector",
+	"opentelemetry-collector": "otel-collector",
+}
+
+/*
+sidecars injected by a webhook only show up in the pods, never in the deployment - those are recognised from the
+pod template annotations and labels which ask for the injection, and have no version to report
+*/
+var injectionMarkers = []struct{ key, sidecar string }{
+	{"sidecar.istio.io/inject", "istio-proxy"},
+	{"vault.hashicorp.com/agent-inject", "vault-agent"},
+	{"linkerd.io/inject", "linkerd-proxy"},
+}
+
+const injectedVersion string = "injected"
+
+type sidecarUse struct {
+	Namespace  string `json:"namespace"`
+	Deployment string `json:"deployment"`
+	Type       string `json:"type"`
+	Name       string `json:"name"`
+	Image      string `json:"image,omitempty"`
+	Version    string `json:"version"`
+}
+
+type sidecarSummary struct {
+	Type       string   `json:"type"`
+	Name       string   `json:"name"`
+	Version    string   `json:"version"`
+	Workloads  int      `json:"workloads"`
+	Namespaces []string `json:"namespaces"`
+}
+
+func sidecarName(containerName, image string) string {
+	if s := knownSidecars[containerName]; s != "" {
+		return s
+	}
+	name, _, _ := splitImage(image)
+	return knownSidecars[path.Base(name)]
+}
+
+func imageVersion(image string) string {
+	_, tag, digest := splitImage(image)
+	if tag != "" {
+		return tag
+	}
+	if digest != "" {
+		return digest
+	}
+	return "latest"
+}
+
+func sidecarUsage(deployments []appsv1.Deployment) []sidecarUse {
+	uses := []sidecarUse{}
+	for _, d := range deployments {
+		use := sidecarUse{Namespace: d.ObjectMeta.Namespace, Deployment: d.ObjectMeta.Name}
+		template := d.Spec.Template
+
+		for _, c := range template.Spec.InitContainers {
+			u := use
+			u.Type, u.Name, u.Image, u.Version = "init", c.Name, c.Image, imageVersion(c.Image)
+			if s := sidecarName(c.Name, c.Image); s != "" {
+				u.Name = s
+			}
+			uses = append(uses, u)
+		}
+
+		found := map[string]bool{}
+		for _, c := range template.Spec.Containers {
+			s := sidecarName(c.Name, c.Image)
+			if s == "" {
+				continue
+			}
+			found[s] = true
+			u := use
+			u.Type, u.Name, u.Image, u.Version = "sidecar", s, c.Image, imageVersion(c.Image)
+			uses = append(uses, u)
+		}
+
+		for _, marker := range injectionMarkers {
+			value := template.ObjectMeta.Annotations[marker.key]
+			if value == "" {
+				value = template.ObjectMeta.Labels[marker.key]
+			}
+			if found[marker.sidecar] || (value != "true" && value != "enabled") {
+				continue
+			}
+			u := use
+			u.Type, u.Name, u.Version = "sidecar", marker.sidecar, injectedVersion
+			uses = append(uses, u)
+		}
+	}
+	return uses
+}
+
+func summarizeSidecars(uses []sidecarUse) []sidecarSummary {
+	// one line per sidecar and version, which is what an upgrade is planned against
+	type key struct{ typ, name, version string }
+	workloads := map[key]map[string]bool{}
+	namespaces := map[key]map[string]bool{}
+	for _, u := range uses {
+		k := key{u.Type, u.Name, u.Version}
+		if workloads[k] == nil {
+			workloads[k] = map[string]bool{}
+			namespaces[k] = map[string]bool{}
+		}
+		workloads[k][u.Namespace+"/"+u.Deployment] = true
+		namespaces[k][u.Namespace] = true
+	}
+
+	summaries := []sidecarSummary{}
+	for k, w := range workloads {
+		summaries = append(summaries, sidecarSummary{Type: k.typ, Name: k.name, Version: k.version, Workloads: len(w), Namespaces: sortedKeys(namespaces[k])})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.Type != b.Type {
+			return a.Type > b.Type
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Version < b.Version
+	})
+	return summaries
+}
+
+func writeSidecarReport(deployments []appsv1.Deployment) error {
+	uses := sidecarUsage(deployments)
+	summaries := summarizeSidecars(uses)
+
+	b, err := json.MarshalIndent(map[string]interface{}{"summary": summaries, "workloads": uses}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeRootFile(sidecarReport+".json", b); err != nil {
+		return err
+	}
+
+	buffer := bytes.Buffer{}
+	w := csv.NewWriter(&buffer)
+	w.Write([]string{"type", "name", "version", "workloads", "namespaces"})
+	for _, s := range summaries {
+		w.Write([]string{s.Type, s.Name, s.Version, strconv.Itoa(s.Workloads), strings.Join(s.Namespaces, " ")})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return writeRootFile(sidecarReport+".csv", buffer.Bytes())
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	siemVendor  string = "nicgrobler"
+	siemProduct string = "kube-scanner"
+	// sends of a message, each on a fresh connection after the first
+	siemAttempts int = 4
+	// a collector which doesn't answer counts as a failed send rather than holding up the run
+	siemTimeout time.Duration = 10 * time.Second
+)
+
+type siemWriter struct {
+	// nil after a failed write, until the next send dials again
+	conn     net.Conn
+	network  string
+	host     string
+	format   string
+	hostname string
+}
+
+func newSIEMWriter(address, format string) (*siemWriter, error) {
+	/*
+		address is of the form udp://host:port or tcp://host:port - when no scheme is given, udp is assumed
+		as that is what most syslog collectors listen on by default
+	*/
+	if format != "cef" && format != "leef" {
+		return nil, fmt.Errorf("unsupported siem format %q: expected cef or leef", format)
+	}
+
+	network := "udp"
+	host := address
+	if strings.Contains(address, "://") {
+		u, err := url.Parse(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid siem address %q; %w", address, err)
+		}
+		network = u.Scheme
+		host = u.Host
+	}
+	if network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("unsupported siem transport %q: expected udp or tcp", network)
+	}
+
+	conn, err := net.DialTimeout(network, host, siemTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+
+	return &siemWriter{
+		conn:     conn,
+		network:  network,
+		host:     host,
+		format:   format,
+		hostname: hostname,
+	}, nil
+}
+
+func (s *siemWriter) send(f finding, key string) error {
+	msg := formatCEF(f, key)
+	if s.format == "leef" {
+		msg = formatLEEF(f, key)
+	}
+
+	// RFC 5424 framing, facility is user-level
+	line := fmt.Sprintf("<%d>1 %s %s %s - - - %s", 8+syslogSeverity(f.Severity), time.Now().UTC().Format(time.RFC3339), s.hostname, siemProduct, msg)
+	if s.network == "tcp" {
+		line += "\n"
+	}
+	/*
+		a daemon keeps the one connection for as long as it runs, and a tcp collector which restarted or dropped
+		it would otherwise fail every send from then on: a failed write closes it, and the message is sent again
+		on a new one
+	*/
+	for attempt := 1; ; attempt++ {
+		err := s.write([]byte(line))
+		if err == nil {
+			return nil
+		}
+		if attempt == siemAttempts {
+			return fmt.Errorf("failed to send to the siem at %s %d times; %w", s.host, attempt, err)
+		}
+		backoff := time.Duration(1<<uint(attempt)) * time.Second
+		log.Printf("sending to the siem at %s failed, dialling again in %s: %v", s.host, backoff, err)
+		time.Sleep(backoff)
+	}
+}
+
+func (s *siemWriter) write(line []byte) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.host, siemTimeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(siemTimeout))
+	if _, err := s.conn.Write(line); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *siemWriter) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+func syslogSeverity(severity string) int {
+	switch severity {
+	case severityHigh:
+		return 2
+	case severityMedium:
+		return 4
+	}
+	return 6
+}
+
+func numericSeverity(severity string) int {
+	// both CEF and LEEF use a 0-10 scale
+	switch severity {
+	case severityHigh:
+		return 8
+	case severityMedium:
+		return 5
+	}
+	return 3
+}
+
+func cefHeaderEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`).Replace(s)
+}
+
+func cefExtensionEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+func formatCEF(f finding, key string) string {
+	// CEF:Version|Device Vendor|Device Product|Device Version|Signature ID|Name|Severity|Extension
+	ext := []string{
+		"cs1Label=namespace", "cs1=" + cefExtensionEscape(f.Namespace),
+		"cs2Label=kind", "cs2=" + cefExtensionEscape(f.Kind),
+		"cs3Label=name", "cs3=" + cefExtensionEscape(f.Name),
+		"cs4Label=key", "cs4=" + cefExtensionEscape(key),
+		"msg=" + cefExtensionEscape(f.Message),
+	}
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		cefHeaderEscape(siemVendor),
+		cefHeaderEscape(siemProduct),
+		cefHeaderEscape(version),
+		cefHeaderEscape(f.ID),
+		cefHeaderEscape(f.Message),
+		numericSeverity(f.Severity),
+		strings.Join(ext, " "),
+	)
+}
+
+func leefEscape(s string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(s)
+}
+
+func formatLEEF(f finding, key string) string {
+	// LEEF:Version|Vendor|Product|Version|EventID|key=value<tab>key=value
+	attrs := []string{
+		fmt.Sprintf("sev=%d", numericSeverity(f.Severity)),
+		"cat=" + leefEscape(f.ID),
+		"namespace=" + leefEscape(f.Namespace),
+		"kind=" + leefEscape(f.Kind),
+		"name=" + leefEscape(f.Name),
+		"key=" + leefEscape(key),
+		"msg=" + leefEscape(f.Message),
+	}
+	return fmt.Sprintf("LEEF:1.0|%s|%s|%s|%s|%s",
+		strings.ReplaceAll(siemVendor, "|", " "),
+		strings.ReplaceAll(siemProduct, "|", " "),
+		strings.ReplaceAll(version, "|", " "),
+		strings.ReplaceAll(f.ID, "|", " "),
+		strings.Join(attrs, "\t"),
+	)
+}
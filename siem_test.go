@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func TestCEFEscape(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		header    string
+		extension string
+	}{
+		{name: "plain", in: "edit", header: "edit", extension: "edit"},
+		{name: "pipe", in: "a|b", header: `a\|b`, extension: "a|b"},
+		{name: "backslash", in: `a\b`, header: `a\\b`, extension: `a\\b`},
+		{name: "equals", in: "a=b", header: "a=b", extension: `a\=b`},
+		{name: "line breaks", in: "a\nb\rc", header: "a\nb\rc", extension: `a\nb\rc`},
+		{name: "escaped once", in: `\|`, header: `\\\|`, extension: `\\|`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cefHeaderEscape(tt.in); got != tt.header {
+				t.Errorf("header %q, expected %q", got, tt.header)
+			}
+			if got := cefExtensionEscape(tt.in); got != tt.extension {
+				t.Errorf("extension %q, expected %q", got, tt.extension)
+			}
+		})
+	}
+}
+
+func TestLEEFEscape(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "edit", want: "edit"},
+		{in: "a\tb", want: "a b"},
+		{in: "a\nb\r", want: "a b "},
+		{in: "a|b=c", want: "a|b=c"},
+	}
+	for _, tt := range tests {
+		if got := leefEscape(tt.in); got != tt.want {
+			t.Errorf("leefEscape(%q) is %q, expected %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFormatFinding(t *testing.T) {
+	f := finding{ID: "broad-subject-elevated", Severity: severityHigh, Kind: "RoleBinding", Namespace: "shop", Name: "all|edit", Message: "system:authenticated granted elevated role edit=x"}
+	key := "rbac.authorization.k8s.io/v1/RoleBinding/shop/all|edit"
+	tests := []struct {
+		name   string
+		format func(finding, string) string
+		want   string
+	}{
+		{
+			name:   "cef",
+			format: formatCEF,
+			want:   `CEF:0|nicgrobler|kube-scanner|` + version + `|broad-subject-elevated|system:authenticated granted elevated role edit=x|8|cs1Label=namespace cs1=shop cs2Label=kind cs2=RoleBinding cs3Label=name cs3=all|edit cs4Label=key cs4=rbac.authorization.k8s.io/v1/RoleBinding/shop/all|edit msg=system:authenticated granted elevated role edit\=x`,
+		},
+		{
+			name:   "leef",
+			format: formatLEEF,
+			want:   "LEEF:1.0|nicgrobler|kube-scanner|" + version + "|broad-subject-elevated|sev=8\tcat=broad-subject-elevated\tnamespace=shop\tkind=RoleBinding\tname=all|edit\tkey=rbac.authorization.k8s.io/v1/RoleBinding/shop/all|edit\tmsg=system:authenticated granted elevated role edit=x",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.format(f, key); got != tt.want {
+				t.Errorf("got\n%s\nexpected\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// an object read back from a previously written output directory
+type snapshotObject struct {
+	Path   string
+	Object map[string]interface{}
+}
+
+func (o snapshotObject) metadata(field string) string {
+	m, _ := o.Object["metadata"].(map[string]interface{})
+	s, _ := m[field].(string)
+	return s
+}
+
+func (o snapshotObject) kind() string {
+	s, _ := o.Object["kind"].(string)
+	return s
+}
+
+func (o snapshotObject) apiVersion() string {
+	s, _ := o.Object["apiVersion"].(string)
+	return s
+}
+
+func readSnapshot(dir string) ([]snapshotObject, error) {
+	return readSnapshotFS(os.DirFS(dir))
+}
+
+func readSnapshotFS(fsys fs.FS) ([]snapshotObject, error) {
+	/*
+		only the object trees are read - anything else under the output directory is a report generated from them
+		objects are returned in path order, so that everything built from them is stable between runs
+	*/
+	objects := []snapshotObject{}
+	for _, tree := range []string{"namespaces", "non_namespaced"} {
+		if _, err := fs.Stat(fsys, tree); os.IsNotExist(err) {
+			continue
+		}
+		err := fs.WalkDir(fsys, tree, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			b, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				return err
+			}
+			if strings.HasSuffix(p, compressedSuffix) {
+				b, err = gunzipBytes(b)
+				if err != nil {
+					return fmt.Errorf("failed to decompress %s; %w", p, err)
+				}
+			}
+			obj := map[string]interface{}{}
+			if err := yaml.Unmarshal(b, &obj); err != nil {
+				return err
+			}
+			objects = append(objects, snapshotObject{Path: path.Clean(p), Object: obj})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Path < objects[j].Path })
+	return objects, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+/*
+	status.json is the run boiled down to what a dashboard or badge shows: a grade, finding counts and how much changed
+	since the previous run - small enough to be polled, and rewritten after every run, failed ones included
+*/
+
+const statusFile string = "status.json"
+
+type scanStatus struct {
+	Cluster    string         `json:"cluster"`
+	LastScan   time.Time      `json:"lastScan"`
+	Duration   string         `json:"duration"`
+	OK         bool           `json:"ok"`
+	Error      string         `json:"error,omitempty"`
+	ErrorClass string         `json:"errorClass,omitempty"`
+	Grade      string         `json:"grade"`
+	Findings   map[string]int `json:"findings"`
+	Objects    int            `json:"objects"`
+	ScanErrors int            `json:"scanErrors"`
+	// scan errors by class, see the error classes of the result package
+	ErrorClasses map[string]int `json:"errorClasses,omitempty"`
+	// objects added, removed or changed since the previous complete run of this process, left out on the first
+	Drift *int `json:"drift,omitempty"`
+
+	finishedAt time.Time
+}
+
+var (
+	objectDigests   = map[string][sha256.Size]byte{}
+	previousDigests map[string][sha256.Size]byte
+	digestsMu       sync.Mutex
+)
+
+func recordDigest(kind, namespace, name string, data []byte) {
+	digestsMu.Lock()
+	defer digestsMu.Unlock()
+	objectDigests[kind+"/"+namespace+"/"+name] = sha256.Sum256(data)
+}
+
+func resetDigests() {
+	digestsMu.Lock()
+	defer digestsMu.Unlock()
+	objectDigests = map[string][sha256.Size]byte{}
+}
+
+func driftSincePrevious(complete bool) *int {
+	// only complete runs are compared, and become what the next run is compared with
+	digestsMu.Lock()
+	defer digestsMu.Unlock()
+	if !complete {
+		return nil
+	}
+	defer func() { previousDigests = objectDigests }()
+	if previousDigests == nil {
+		return nil
+	}
+	drift := 0
+	for key, sum := range objectDigests {
+		if previous, ok := previousDigests[key]; !ok || previous != sum {
+			drift++
+		}
+	}
+	for key := range previousDigests {
+		if _, ok := objectDigests[key]; !ok {
+			drift++
+		}
+	}
+	return &drift
+}
+
+func grade(counts map[string]int) string {
+	// anything high fails outright, medium findings cost more the more there are
+	switch {
+	case counts[severityHigh] > 0:
+		return "F"
+	case counts[severityMedium] > 5:
+		return "D"
+	case counts[severityMedium] > 0:
+		return "C"
+	case counts[severityLow] > 0:
+		return "B"
+	}
+	return "A"
+}
+
+func buildStatus(cluster string, startedAt time.Time, scanErr error, complete bool) scanStatus {
+	finishedAt := time.Now()
+	status := scanStatus{
+		Cluster:    cluster,
+		LastScan:   startedAt.UTC(),
+		Duration:   finishedAt.Sub(startedAt).Round(time.Millisecond).String(),
+		finishedAt: finishedAt,
+		OK:         scanErr == nil,
+		Findings:   map[string]int{severityHigh: 0, severityMedium: 0, severityLow: 0},
+	}
+	if scanErr != nil {
+		status.Error = scanErr.Error()
+		status.ErrorClass = classifyError(scanErr)
+	}
+
+	findingsMu.Lock()
+	for _, f := range findings {
+		status.Findings[f.Severity]++
+	}
+	findingsMu.Unlock()
+	status.Grade = grade(status.Findings)
+
+	exportedMu.Lock()
+	status.Objects = len(exported)
+	exportedMu.Unlock()
+	resultMu.Lock()
+	status.ScanErrors = len(scanErrors)
+	resultMu.Unlock()
+	if status.ScanErrors > 0 {
+		status.ErrorClasses = errorClassCounts()
+	}
+
+	status.Drift = driftSincePrevious(complete)
+	return status
+}
+
+func writeStatus(status scanStatus) error {
+	b, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeRootFile(statusFile, b)
+}
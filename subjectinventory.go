@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nicgrobler/k8s/result"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+/*
+	every matched user and group, and the bindings granting them anything. a Group subject is only a name to
+	kubernetes, but openshift keeps the members of its own groups in user.openshift.io Groups - where the cluster
+	serves those, the Group object of every matched group is exported and its users listed alongside it
+*/
+
+const subjectInventoryReport string = "reports/subject-inventory"
+
+var openshiftGroups = schema.GroupVersionResource{Group: "user.openshift.io", Version: "v1", Resource: "groups"}
+
+type subjectGrant struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	RoleRef   string `json:"roleRef"`
+}
+
+type subjectEntry struct {
+	Kind   string         `json:"kind"`
+	Name   string         `json:"name"`
+	Grants []subjectGrant `json:"grants"`
+	// users of the openshift group of that name, when there is one
+	Members []string `json:"members,omitempty"`
+}
+
+func subjectEntries(bindings []rbacv1.RoleBinding, clusterBindings []rbacv1.ClusterRoleBinding, lookFor string) []*subjectEntry {
+	entries := map[string]*subjectEntry{}
+	add := func(s rbacv1.Subject, grant subjectGrant) {
+		if (s.Kind != rbacv1.UserKind && s.Kind != rbacv1.GroupKind) || !isUserDefined(s.Name, lookFor) {
+			return
+		}
+		id := subjectKey(s)
+		if entries[id] == nil {
+			entries[id] = &subjectEntry{Kind: s.Kind, Name: s.Name, Grants: []subjectGrant{}}
+		}
+		entries[id].Grants = append(entries[id].Grants, grant)
+	}
+	for _, b := range bindings {
+		for _, s := range b.Subjects {
+			add(s, subjectGrant{Kind: "RoleBinding", Namespace: b.ObjectMeta.Namespace, Name: b.ObjectMeta.Name, RoleRef: b.RoleRef.Kind + "/" + b.RoleRef.Name})
+		}
+	}
+	for _, b := range clusterBindings {
+		for _, s := range b.Subjects {
+			add(s, subjectGrant{Kind: "ClusterRoleBinding", Name: b.ObjectMeta.Name, RoleRef: b.RoleRef.Kind + "/" + b.RoleRef.Name})
+		}
+	}
+
+	keys := []string{}
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	sorted := []*subjectEntry{}
+	for _, k := range keys {
+		sorted = append(sorted, entries[k])
+	}
+	return sorted
+}
+
+func servesOpenShiftGroups(disc discovery.DiscoveryInterface) (bool, error) {
+	_, err := disc.ServerResourcesForGroupVersion(openshiftGroups.GroupVersion().String())
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func expandGroups(entries []*subjectEntry, dyn dynamic.Interface) error {
+	for _, e := range entries {
+		if e.Kind != rbacv1.GroupKind {
+			continue
+		}
+		obj, err := dyn.Resource(openshiftGroups).Get(context.TODO(), e.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			// groups from an identity provider, or system groups, have no object
+			continue
+		}
+		if err != nil {
+			recordError(&result.ObjectRef{APIVersion: openshiftGroups.GroupVersion().String(), Kind: "Group", Name: e.Name}, fmt.Errorf("failed to read group; %w", err))
+			continue
+		}
+		users, _, err := unstructured.NestedStringSlice(obj.Object, "users")
+		if err != nil {
+			recordError(&result.ObjectRef{APIVersion: openshiftGroups.GroupVersion().String(), Kind: "Group", Name: e.Name}, fmt.Errorf("unreadable users; %w", err))
+		}
+		sort.Strings(users)
+		e.Members = users
+		if err := dumpToFile(extract(obj), "", obj.GetName(), "group."+openshiftGroups.Group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeSubjectInventory(disc discovery.DiscoveryInterface, dyn dynamic.Interface, bindings []rbacv1.RoleBinding, clusterBindings []rbacv1.ClusterRoleBinding, lookFor string) error {
+	entries := subjectEntries(bindings, clusterBindings, lookFor)
+	groups, err := servesOpenShiftGroups(disc)
+	if err != nil {
+		return err
+	}
+	if groups {
+		if err := expandGroups(entries, dyn); err != nil {
+			return err
+		}
+	}
+
+	buffer := bytes.Buffer{}
+	w := csv.NewWriter(&buffer)
+	w.Write([]string{"kind", "name", "binding", "roleref", "members"})
+	for _, e := range entries {
+		for _, g := range e.Grants {
+			binding := g.Kind + " " + g.Name
+			if g.Namespace != "" {
+				binding = g.Kind + " " + g.Namespace + "/" + g.Name
+			}
+			w.Write([]string{e.Kind, e.Name, binding, g.RoleRef, strings.Join(e.Members, " ")})
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if err := writeRootFile(subjectInventoryReport+".csv", buffer.Bytes()); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeRootFile(subjectInventoryReport+".json", b)
+}
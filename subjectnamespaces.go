@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nicgrobler/k8s/result"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+/*
+	a clusterrolebinding names service accounts by namespace, and restoring it into a cluster without that
+	namespace (or from an export which left the namespace out) succeeds, granting nothing until someone creates
+	an account of that name there. matched bindings are checked for both, the first is a finding of its own, the
+	second a warning that the export alone won't restore what the binding grants
+*/
+
+func checkSubjectNamespaces(clientset *kubernetes.Clientset, bindings []rbacv1.ClusterRoleBinding) error {
+	existing := map[string]bool{}
+	listStarted := time.Now()
+	list, err := clientset.CoreV1().Namespaces().List(context.TODO(), listOptions())
+	switch {
+	case apierrors.IsForbidden(err):
+		// scoped scanners often can't list namespaces, what the export left out can still be told
+		recordError(&result.ObjectRef{APIVersion: "v1", Kind: "Namespace"}, fmt.Errorf("can't tell which subject namespaces exist; %w", err))
+		existing = nil
+	case err != nil:
+		return err
+	default:
+		recordListed("namespaces", len(list.Items))
+		timeList("namespaces", listStarted)
+		for _, ns := range list.Items {
+			existing[ns.ObjectMeta.Name] = true
+		}
+	}
+
+	for _, b := range bindings {
+		for _, s := range b.Subjects {
+			if s.Kind != rbacv1.ServiceAccountKind || s.Namespace == "" {
+				continue
+			}
+			id, message, severity := "", "", ""
+			switch {
+			case existing != nil && !existing[s.Namespace]:
+				id, severity = "missing-subject-namespace", severityMedium
+				message = fmt.Sprintf("service account %s/%s is in a namespace which does not exist", s.Namespace, s.Name)
+			case (scanNamespace != "" && s.Namespace != scanNamespace) || isSkippedNamespace(s.Namespace):
+				id, severity = "subject-namespace-not-exported", severityLow
+				message = fmt.Sprintf("service account %s/%s is in a namespace this export leaves out", s.Namespace, s.Name)
+			default:
+				continue
+			}
+			log.Printf("warning: clusterrolebinding %s: %s", b.ObjectMeta.Name, message)
+			addFinding(finding{
+				ID:       id,
+				Severity: severity,
+				Kind:     "ClusterRoleBinding",
+				Name:     b.ObjectMeta.Name,
+				Message:  message,
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+/*
+clusters fed by more than one identity provider see the same person or team under different names, for example
+oidc:jane, https://issuer.example.com#jane or CN=Team A,OU=Groups,DC=corp - normalizing them before matching and
+reporting makes the reports line up. the exported bindings keep the names as they are in the cluster.
+*/
+type subjectConfig struct {
+	// exact names, mapped as is - these win over everything below
+	Names map[string]string `json:"names,omitempty"`
+	// prefixes removed from the start of a name, the first one found
+	StripPrefixes []string `json:"stripPrefixes,omitempty"`
+	// regular expressions applied in order, the replacement may refer to groups as $1
+	Replace []subjectRewrite `json:"replace,omitempty"`
+	// the naming convention subjects are held to, see namingrules.go
+	Naming []namingRule `json:"naming,omitempty"`
+}
+
+type subjectRewrite struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+type compiledRewrite struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+var subjectRewrites []compiledRewrite
+
+func parseSubjectConfig(c subjectConfig) error {
+	subjectRewrites = nil
+	for _, r := range c.Replace {
+		p, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid subject pattern %q; %w", r.Pattern, err)
+		}
+		subjectRewrites = append(subjectRewrites, compiledRewrite{pattern: p, replacement: r.Replacement})
+	}
+	return parseNamingRules(c.Naming)
+}
+
+func normalizeSubjectName(name string) string {
+	if mapped, ok := cfg.Subjects.Names[name]; ok {
+		return mapped
+	}
+	for _, prefix := range cfg.Subjects.StripPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			name = strings.TrimPrefix(name, prefix)
+			break
+		}
+	}
+	for _, r := range subjectRewrites {
+		name = r.pattern.ReplaceAllString(name, r.replacement)
+	}
+	return name
+}
+
+func normalizeSubjects(subjects []rbacv1.Subject) []rbacv1.Subject {
+	// service accounts come from the cluster itself, only users and groups come from an identity provider
+	normalized := make([]rbacv1.Subject, len(subjects))
+	for i, s := range subjects {
+		if s.Kind != rbacv1.ServiceAccountKind {
+			s.Name = normalizeSubjectName(s.Name)
+		}
+		normalized[i] = s
+	}
+	return normalized
+}
+
+func normalizeRoleBindings(bindings []rbacv1.RoleBinding) []rbacv1.RoleBinding {
+	normalized := make([]rbacv1.RoleBinding, len(bindings))
+	for i, b := range bindings {
+		b.Subjects = normalizeSubjects(b.Subjects)
+		normalized[i] = b
+	}
+	return normalized
+}
+
+func normalizeClusterRoleBindings(bindings []rbacv1.ClusterRoleBinding) []rbacv1.ClusterRoleBinding {
+	normalized := make([]rbacv1.ClusterRoleBinding, len(bindings))
+	for i, b := range bindings {
+		b.Subjects = normalizeSubjects(b.Subjects)
+		normalized[i] = b
+	}
+	return normalized
+}
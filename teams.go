@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+/*
+	teams in the config get a copy of their own namespaces, so that a single scan can feed every team's repository
+	and each team owns the manifests of what it runs. the full export is written as always, then the namespaces/
+	tree of every namespace a team's globs match is synced into that team's output directory: files which changed
+	are written, files which are no longer exported are removed. git: true commits the team's directory, which has
+	to be inside a git work tree, once it has been synced
+
+		teams:
+		  - name: payments
+		    namespaces: [payments, "payments-*"]
+		    output: /repos/payments-manifests
+		    git: true
+*/
+
+type teamOutput struct {
+	Name string `json:"name"`
+	// namespace names or globs
+	Namespaces []string `json:"namespaces"`
+	Output     string   `json:"output"`
+	Git        bool     `json:"git,omitempty"`
+}
+
+func validateTeams(teams []teamOutput) error {
+	names := map[string]bool{}
+	for _, t := range teams {
+		if t.Name == "" || names[t.Name] {
+			return fmt.Errorf("teams: every team needs a name of its own, %q", t.Name)
+		}
+		names[t.Name] = true
+		if t.Output == "" || len(t.Namespaces) == 0 {
+			return fmt.Errorf("teams: %s needs an output and at least one namespace", t.Name)
+		}
+		for _, pattern := range t.Namespaces {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("teams: %s: invalid namespace pattern %q", t.Name, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+func (t teamOutput) ownsNamespace(namespace string) bool {
+	for _, pattern := range t.Namespaces {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func fanOutTeams(teams []teamOutput, cluster string, startedAt time.Time) error {
+	// this reads back what was written, so it only works with the local disk the scanner writes to
+	exported, err := os.ReadDir(filepath.Join(outputDirectory, "namespaces"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, t := range teams {
+		synced := map[string]bool{}
+		changed := 0
+		for _, e := range exported {
+			if !e.IsDir() || !t.ownsNamespace(e.Name()) {
+				continue
+			}
+			synced[e.Name()] = true
+			under := path.Join("namespaces", e.Name())
+			n, err := syncTree(filepath.Join(outputDirectory, filepath.FromSlash(under)), filepath.Join(t.Output, filepath.FromSlash(under)), under)
+			if err != nil {
+				return fmt.Errorf("team %s: %w", t.Name, err)
+			}
+			changed += n
+		}
+
+		// a namespace of the team's which is gone from the cluster is gone from its repository too
+		existing, err := os.ReadDir(filepath.Join(t.Output, "namespaces"))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("team %s: %w", t.Name, err)
+		}
+		for _, e := range existing {
+			if e.IsDir() && t.ownsNamespace(e.Name()) && !synced[e.Name()] {
+				under := path.Join("namespaces", e.Name())
+				n, err := syncTree("", filepath.Join(t.Output, filepath.FromSlash(under)), under)
+				if err != nil {
+					return fmt.Errorf("team %s: %w", t.Name, err)
+				}
+				changed += n
+			}
+		}
+		log.Printf("team %s: %d namespaces, %d files changed in %s", t.Name, len(synced), changed, t.Output)
+
+		if t.Git {
+			if err := commitExport(t.Output, gitCommitSingle, cluster, startedAt); err != nil {
+				return fmt.Errorf("team %s: %w", t.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func syncTree(from, to, under string) (int, error) {
+	/*
+		makes the files under to match those under from, an empty from removes them all, returning how many changed.
+		under is where both sit relative to an output directory: a team's output is an export like the full one, so
+		the ignore file leaves the same paths alone in it, and what is written counts towards the same limits
+	*/
+	wanted := map[string]bool{}
+	changed := 0
+	if from != "" {
+		err := filepath.Walk(from, func(p string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(from, p)
+			if err != nil {
+				return err
+			}
+			wanted[rel] = true
+			if isIgnoredPath(path.Join(under, filepath.ToSlash(rel))) {
+				skipIgnored(filepath.Join(to, rel))
+				return nil
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			target := filepath.Join(to, rel)
+			if current, err := os.ReadFile(target); err == nil && bytes.Equal(current, data) {
+				return nil
+			}
+			if err := output.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+				return err
+			}
+			if err := countOutput(0, len(data)); err != nil {
+				return err
+			}
+			changed++
+			return output.WriteFile(target, data, os.ModePerm)
+		})
+		if err != nil {
+			return changed, err
+		}
+	}
+	err := filepath.Walk(to, func(p string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(to, p)
+		if err != nil || wanted[rel] || isIgnoredPath(path.Join(under, filepath.ToSlash(rel))) {
+			return err
+		}
+		changed++
+		return os.Remove(p)
+	})
+	return changed, err
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/nicgrobler/k8s/result"
+	"sigs.k8s.io/yaml"
+)
+
+/*
+	tenant tokens let teams read their own slice of the fleet from one collector: a tenant sees the clusters it
+	is given (all of them when none are), and in those only what lives in its namespaces - objects, findings,
+	errors and the exported files themselves. cluster scoped objects, and status.json with its cluster wide grade,
+	stay with the -token-file token. tenants only ever read, pushing needs the agents' token
+
+	the tenants file holds the sha256 of every token rather than the token, so that it can live in a configmap:
+
+		- name: payments
+		  tokenSHA256: <printf %s "$token" | sha256sum>
+		  clusters: [prod-eu-1, prod-us-1]
+		  namespaces: [payments, "payments-*"]
+*/
+
+type tenant struct {
+	Name        string `json:"name"`
+	TokenSHA256 string `json:"tokenSHA256"`
+	// cluster names, all clusters when empty
+	Clusters []string `json:"clusters,omitempty"`
+	// namespace names or globs
+	Namespaces []string `json:"namespaces"`
+
+	digest []byte
+}
+
+func loadTenants(file string) ([]tenant, error) {
+	if file == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	tenants := []tenant{}
+	if err := yaml.UnmarshalStrict(b, &tenants); err != nil {
+		return nil, fmt.Errorf("tenants %s: %w", file, err)
+	}
+	names := map[string]bool{}
+	for i, t := range tenants {
+		if t.Name == "" || names[t.Name] {
+			return nil, fmt.Errorf("tenants %s: every tenant needs a name of its own, %q", file, t.Name)
+		}
+		names[t.Name] = true
+		digest, err := hex.DecodeString(strings.TrimSpace(t.TokenSHA256))
+		if err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("tenant %s: tokenSHA256 must be a hex encoded sha256", t.Name)
+		}
+		if len(t.Namespaces) == 0 {
+			return nil, fmt.Errorf("tenant %s: no namespaces, the tenant could read nothing", t.Name)
+		}
+		for _, pattern := range t.Namespaces {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("tenant %s: invalid namespace %q; %w", t.Name, pattern, err)
+			}
+		}
+		tenants[i].digest = digest
+	}
+	return tenants, nil
+}
+
+func tenantForToken(tenants []tenant, token string) *tenant {
+	sum := sha256.Sum256([]byte(token))
+	for i := range tenants {
+		if subtle.ConstantTimeCompare(sum[:], tenants[i].digest) == 1 {
+			return &tenants[i]
+		}
+	}
+	return nil
+}
+
+func (t *tenant) seesCluster(cluster string) bool {
+	if len(t.Clusters) == 0 {
+		return true
+	}
+	for _, c := range t.Clusters {
+		if c == cluster {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tenant) seesNamespace(namespace string) bool {
+	if namespace == "" {
+		return false
+	}
+	for _, pattern := range t.Namespaces {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func scopeResult(res *result.ScanResult, t *tenant) *result.ScanResult {
+	/*
+		fields are copied one by one, so that one added to the result stays hidden from tenants until it is scoped.
+		unsupported is left out: its counts are of the whole cluster, with no namespace to scope them by
+	*/
+	scoped := result.ScanResult{
+		APIVersion: res.APIVersion,
+		Kind:       res.Kind,
+		Cluster:    res.Cluster,
+		StartedAt:  res.StartedAt,
+		FinishedAt: res.FinishedAt,
+	}
+	scoped.Objects = []result.Object{}
+	for _, o := range res.Objects {
+		if t.seesNamespace(o.Namespace) {
+			scoped.Objects = append(scoped.Objects, o)
+		}
+	}
+	scoped.Relationships = []result.Relationship{}
+	for _, r := range res.Relationships {
+		// a binding is the tenant's even when it grants a cluster role
+		if t.seesNamespace(r.From.Namespace) {
+			scoped.Relationships = append(scoped.Relationships, r)
+		}
+	}
+	scoped.Findings = []result.Finding{}
+	for _, f := range res.Findings {
+		if t.seesNamespace(f.Object.Namespace) {
+			scoped.Findings = append(scoped.Findings, f)
+		}
+	}
+	scoped.Errors = []result.Error{}
+	for _, e := range res.Errors {
+		if e.Object != nil && t.seesNamespace(e.Object.Namespace) {
+			scoped.Errors = append(scoped.Errors, e)
+		}
+	}
+	// the summary lists the objects of the errors, so it is made again from those the tenant sees
+	if len(res.ErrorSummary) > 0 {
+		scoped.ErrorSummary = errorSummary(scoped.Errors)
+	}
+	return &scoped
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nicgrobler/k8s/result"
+)
+
+func TestScopeResult(t *testing.T) {
+	ref := func(kind, namespace, name string) result.ObjectRef {
+		return result.ObjectRef{APIVersion: "v1", Kind: kind, Namespace: namespace, Name: name}
+	}
+	mine, theirs, cluster := ref("ConfigMap", "payments", "app"), ref("ConfigMap", "shop", "app"), ref("ClusterRole", "", "admin")
+	errs := []result.Error{
+		{Object: &mine, Message: "mine", Class: result.ErrorAuth},
+		{Object: &theirs, Message: "theirs", Class: result.ErrorAuth},
+		{Message: "of the run", Class: result.ErrorAuth},
+	}
+	res := &result.ScanResult{
+		APIVersion: result.APIVersion,
+		Kind:       result.Kind,
+		Cluster:    "prod",
+		StartedAt:  time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		FinishedAt: time.Date(2026, 1, 2, 3, 5, 5, 0, time.UTC),
+		Objects:    []result.Object{{ObjectRef: mine}, {ObjectRef: theirs}, {ObjectRef: cluster}},
+		Relationships: []result.Relationship{
+			{Type: result.RoleRef, From: ref("RoleBinding", "payments", "edit"), To: ref("ClusterRole", "", "edit")},
+			{Type: result.RoleRef, From: ref("RoleBinding", "shop", "edit"), To: ref("ClusterRole", "", "edit")},
+		},
+		Findings: []result.Finding{
+			{ID: "lint", Object: mine},
+			{ID: "lint", Object: theirs},
+			{ID: "lint", Object: cluster},
+		},
+		Errors:       errs,
+		ErrorSummary: errorSummary(errs),
+		Unsupported:  []result.UnsupportedType{{GoType: "*v1.Deployment", Count: 1}},
+	}
+	payments := &tenant{Name: "payments", Namespaces: []string{"pay*"}}
+
+	want := &result.ScanResult{
+		APIVersion:    res.APIVersion,
+		Kind:          res.Kind,
+		Cluster:       res.Cluster,
+		StartedAt:     res.StartedAt,
+		FinishedAt:    res.FinishedAt,
+		Objects:       []result.Object{{ObjectRef: mine}},
+		Relationships: res.Relationships[:1],
+		Findings:      res.Findings[:1],
+		Errors:        errs[:1],
+		ErrorSummary:  []result.ErrorClassSummary{{Class: result.ErrorAuth, Count: 1, Objects: []result.ObjectRef{mine}}},
+	}
+	if got := scopeResult(res, payments); !reflect.DeepEqual(got, want) {
+		t.Errorf("scoped\n%+v\nexpected\n%+v", got, want)
+	}
+
+	nothing := scopeResult(res, &tenant{Name: "nobody", Namespaces: []string{"other"}})
+	if len(nothing.Objects)+len(nothing.Relationships)+len(nothing.Findings)+len(nothing.Errors)+len(nothing.ErrorSummary) != 0 {
+		t.Errorf("a tenant without objects in the result sees %+v", nothing)
+	}
+}
+
+// every field of the result a tenant can see, anything added to it has to be scoped and listed here
+var scopedResultFields = map[string]bool{
+	"APIVersion": true, "Kind": true, "Cluster": true, "StartedAt": true, "FinishedAt": true,
+	"Objects": true, "Relationships": true, "Findings": true, "Errors": true, "ErrorSummary": true,
+}
+
+func TestScopeResultHidesNewFields(t *testing.T) {
+	res := result.ScanResult{}
+	v := reflect.ValueOf(&res).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		// every field holding something, so that anything copied through shows
+		f := v.Field(i)
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString("x")
+		case reflect.Slice:
+			f.Set(reflect.MakeSlice(f.Type(), 1, 1))
+		}
+	}
+	scoped := reflect.ValueOf(*scopeResult(&res, &tenant{Name: "nobody", Namespaces: []string{"other"}}))
+	for i := 0; i < scoped.NumField(); i++ {
+		name := scoped.Type().Field(i).Name
+		if !scopedResultFields[name] && !scoped.Field(i).IsZero() {
+			t.Errorf("%s is copied into tenant results without being scoped", name)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	terraformDirectory string = "terraform"
+
+	// every object as a kubernetes_manifest holding the exported file, or rbac as the provider's own typed resources
+	terraformManifest string = "manifest"
+	terraformRBAC     string = "rbac"
+)
+
+var terraformInvalidChars = regexp.MustCompile(`[^a-z0-9_]+`)
+
+func terraformName(parts ...string) string {
+	// keep resource names to lowercase letters, digits and underscores, never starting with a digit
+	name := terraformInvalidChars.ReplaceAllString(strings.ToLower(strings.Join(parts, "_")), "_")
+	name = strings.Trim(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "r_" + name
+	}
+	return name
+}
+
+var terraformRBACTypes = map[string]string{
+	"Role":               "kubernetes_role",
+	"RoleBinding":        "kubernetes_role_binding",
+	"ClusterRole":        "kubernetes_cluster_role",
+	"ClusterRoleBinding": "kubernetes_cluster_role_binding",
+}
+
+func hclString(s string) string {
+	// go quoting is valid hcl, apart from the template sequences which need escaping
+	q := fmt.Sprintf("%q", s)
+	q = strings.ReplaceAll(q, "${", "$${")
+	return strings.ReplaceAll(q, "%{", "%%{")
+}
+
+func hclList(values []string) string {
+	quoted := []string{}
+	for _, v := range values {
+		quoted = append(quoted, hclString(v))
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+func hclMetadata(w *bytes.Buffer, namespace, name string, labels map[string]string) {
+	w.WriteString("  metadata {\n")
+	fmt.Fprintf(w, "    name = %s\n", hclString(name))
+	if namespace != "" {
+		fmt.Fprintf(w, "    namespace = %s\n", hclString(namespace))
+	}
+	if len(labels) > 0 {
+		keys := []string{}
+		for k := range labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		w.WriteString("    labels = {\n")
+		for _, k := range keys {
+			fmt.Fprintf(w, "      %s = %s\n", hclString(k), hclString(labels[k]))
+		}
+		w.WriteString("    }\n")
+	}
+	w.WriteString("  }\n")
+}
+
+func hclRules(w *bytes.Buffer, rules []rbacv1.PolicyRule) {
+	for _, rule := range rules {
+		w.WriteString("  rule {\n")
+		if len(rule.APIGroups) > 0 {
+			fmt.Fprintf(w, "    api_groups = %s\n", hclList(rule.APIGroups))
+		}
+		if len(rule.Resources) > 0 {
+			fmt.Fprintf(w, "    resources = %s\n", hclList(rule.Resources))
+		}
+		if len(rule.ResourceNames) > 0 {
+			fmt.Fprintf(w, "    resource_names = %s\n", hclList(rule.ResourceNames))
+		}
+		if len(rule.NonResourceURLs) > 0 {
+			fmt.Fprintf(w, "    non_resource_urls = %s\n", hclList(rule.NonResourceURLs))
+		}
+		fmt.Fprintf(w, "    verbs = %s\n", hclList(rule.Verbs))
+		w.WriteString("  }\n")
+	}
+}
+
+func hclBinding(w *bytes.Buffer, ref rbacv1.RoleRef, subjects []rbacv1.Subject) {
+	w.WriteString("  role_ref {\n")
+	fmt.Fprintf(w, "    api_group = %s\n", hclString(ref.APIGroup))
+	fmt.Fprintf(w, "    kind = %s\n", hclString(ref.Kind))
+	fmt.Fprintf(w, "    name = %s\n", hclString(ref.Name))
+	w.WriteString("  }\n")
+	for _, s := range subjects {
+		w.WriteString("  subject {\n")
+		fmt.Fprintf(w, "    kind = %s\n", hclString(s.Kind))
+		fmt.Fprintf(w, "    name = %s\n", hclString(s.Name))
+		if s.APIGroup != "" {
+			fmt.Fprintf(w, "    api_group = %s\n", hclString(s.APIGroup))
+		}
+		if s.Namespace != "" {
+			fmt.Fprintf(w, "    namespace = %s\n", hclString(s.Namespace))
+		}
+		w.WriteString("  }\n")
+	}
+}
+
+func terraformRBACResource(w *bytes.Buffer, resourceType, name string, o exportedObject, encoded []byte) error {
+	// the provider's typed rbac resources mirror the api objects, so the exported yaml maps onto them block by block
+	fmt.Fprintf(w, "resource %q %q {\n", resourceType, name)
+	switch o.Kind {
+	case "Role", "ClusterRole":
+		role := rbacv1.Role{}
+		if err := yaml.Unmarshal(encoded, &role); err != nil {
+			return fmt.Errorf("failed to read %s %s for terraform; %w", strings.ToLower(o.Kind), o.Name, err)
+		}
+		hclMetadata(w, o.Namespace, o.Name, role.ObjectMeta.Labels)
+		hclRules(w, role.Rules)
+	case "RoleBinding", "ClusterRoleBinding":
+		binding := rbacv1.RoleBinding{}
+		if err := yaml.Unmarshal(encoded, &binding); err != nil {
+			return fmt.Errorf("failed to read %s %s for terraform; %w", strings.ToLower(o.Kind), o.Name, err)
+		}
+		hclMetadata(w, o.Namespace, o.Name, binding.ObjectMeta.Labels)
+		hclBinding(w, binding.RoleRef, binding.Subjects)
+	}
+	w.WriteString("}\n\n")
+	return nil
+}
+
+func terraformManifests(objects []exportedObject, flavor string) (manifests, imports []byte, err error) {
+	/*
+		every exported object becomes a kubernetes_manifest resource which decodes the exported yaml file, and a matching
+		terraform import command using the provider's "apiVersion=..,kind=..,namespace=..,name=.." import id format.
+		in the rbac flavor roles and bindings become typed resources instead, imported by <namespace>/<name> or <name>
+	*/
+	rbac := currentRBACState()
+	tf := bytes.Buffer{}
+	sh := bytes.Buffer{}
+	sh.WriteString("#!/bin/sh\n# generated by kube-scanner: run from the terraform directory after terraform init\nset -e\n\n")
+
+	seen := map[string]int{}
+	for _, o := range objects {
+		if resourceType, ok := terraformRBACTypes[o.Kind]; ok && flavor == terraformRBAC {
+			name := terraformName(o.Namespace, o.Name)
+			seen[resourceType+"."+name]++
+			if n := seen[resourceType+"."+name]; n > 1 {
+				name = fmt.Sprintf("%s_%d", name, n)
+			}
+			if err := terraformRBACResource(&tf, resourceType, name, o, rbac[rbacKey(o.Kind, o.Namespace, o.Name)]); err != nil {
+				return nil, nil, err
+			}
+			id := o.Name
+			if o.Namespace != "" {
+				id = o.Namespace + "/" + o.Name
+			}
+			fmt.Fprintf(&sh, "terraform import '%s.%s' '%s'\n", resourceType, name, id)
+			continue
+		}
+
+		if strings.HasSuffix(o.Path, compressedSuffix) {
+			// terraform has no way of reading a gzipped file
+			fmt.Fprintf(&sh, "# skipped %s: compressed output cannot be referenced from terraform\n", o.Path)
+			continue
+		}
+		name := terraformName(o.Kind, o.Namespace, o.Name)
+		seen[name]++
+		if seen[name] > 1 {
+			name = fmt.Sprintf("%s_%d", name, seen[name])
+		}
+
+		fmt.Fprintf(&tf, "resource \"kubernetes_manifest\" %q {\n", name)
+		fmt.Fprintf(&tf, "  manifest = yamldecode(file(\"${path.module}/../%s\"))\n", o.Path)
+		tf.WriteString("}\n\n")
+
+		id := fmt.Sprintf("apiVersion=%s,kind=%s,name=%s", o.APIVersion, o.Kind, o.Name)
+		if o.Namespace != "" {
+			id = fmt.Sprintf("apiVersion=%s,kind=%s,namespace=%s,name=%s", o.APIVersion, o.Kind, o.Namespace, o.Name)
+		}
+		fmt.Fprintf(&sh, "terraform import 'kubernetes_manifest.%s' '%s'\n", name, id)
+	}
+	return tf.Bytes(), sh.Bytes(), nil
+}
+
+func writeTerraformImports(objects []exportedObject, flavor string) error {
+	manifests, imports, err := terraformManifests(objects, flavor)
+	if err != nil {
+		return err
+	}
+	err = writeRootFile(terraformDirectory+"/main.tf", manifests)
+	if err != nil {
+		return err
+	}
+	return writeRootFile(terraformDirectory+"/import.sh", imports)
+}
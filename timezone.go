@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+	timestamps people read - object headers, git commit messages, the drift html report, lock and retention
+	messages - are in utc and rfc3339 unless -timezone and -time-format say otherwise, for teams which kept
+	misreading utc. -timezone is an iana name such as Europe/London, or Local. -time-format is rfc3339, rfc1123,
+	or a go layout written with the reference time, such as "02 Jan 2006 15:04 MST".
+	snapshot directory names (of the collector's store and of s3 archives) take the timezone but keep their layout,
+	as they are parsed back and sorted, with the offset added outside utc. json results, annotations and formats
+	somebody else defines (cyclonedx, syslog) stay in utc
+*/
+
+var reportLocation = time.UTC
+var reportTimeFormat = time.RFC3339
+
+// utc names end in Z exactly as before, anything else in its offset, such as +0200
+const snapshotTimeFormat string = "20060102T150405.000Z0700"
+
+var namedTimeFormats = map[string]string{
+	"rfc3339": time.RFC3339,
+	"rfc1123": time.RFC1123,
+}
+
+func timeFlags(fs *flag.FlagSet) (*string, *string) {
+	zone := fs.String("timezone", "UTC", "(optional) timezone of the timestamps in reports, commit messages and snapshot names, such as Europe/London or Local")
+	format := fs.String("time-format", "rfc3339", "(optional) layout of the timestamps in reports and commit messages: rfc3339, rfc1123 or a go layout such as \"02 Jan 2006 15:04 MST\"")
+	return zone, format
+}
+
+func setReportTime(zone, format string) error {
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return fmt.Errorf("invalid -timezone; %w", err)
+	}
+	layout, named := namedTimeFormats[strings.ToLower(format)]
+	if !named {
+		layout = format
+		// a layout without any of the reference time's fields prints itself whatever the time
+		if other := time.Date(1999, time.December, 31, 23, 58, 59, 0, time.UTC); layout == "" || other.Format(layout) == layout {
+			return fmt.Errorf("invalid -time-format %q: expected rfc3339, rfc1123 or a go layout such as 2006-01-02 15:04 MST", format)
+		}
+	}
+	reportLocation, reportTimeFormat = loc, layout
+	return nil
+}
+
+func reportTime(t time.Time) string {
+	return t.In(reportLocation).Format(reportTimeFormat)
+}
+
+func snapshotName(t time.Time) string {
+	return t.In(reportLocation).Format(snapshotTimeFormat)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const topologyReport string = "reports/topology"
+
+type workloadTopology struct {
+	Namespace   string   `json:"namespace"`
+	Deployment  string   `json:"deployment"`
+	Constraints []string `json:"constraints"`
+}
+
+// every workload sharing a constraint, which is the question asked before draining or retiring a node pool
+type constraintUse struct {
+	Constraint string   `json:"constraint"`
+	Workloads  []string `json:"workloads"`
+}
+
+func selectorRequirement(r corev1.NodeSelectorRequirement) string {
+	if len(r.Values) == 0 {
+		return fmt.Sprintf("%s %s", r.Key, r.Operator)
+	}
+	return fmt.Sprintf("%s %s [%s]", r.Key, r.Operator, strings.Join(r.Values, ","))
+}
+
+func nodeSelectorTerm(t corev1.NodeSelectorTerm) string {
+	parts := []string{}
+	for _, r := range t.MatchExpressions {
+		parts = append(parts, selectorRequirement(r))
+	}
+	for _, r := range t.MatchFields {
+		parts = append(parts, "field "+selectorRequirement(r))
+	}
+	return strings.Join(parts, " && ")
+}
+
+func schedulingConstraints(spec corev1.PodSpec) []string {
+	/*
+		each constraint written as a short readable line, so that identical constraints in different workloads
+		compare equal - the order within a workload does not matter, so they are sorted
+	*/
+	constraints := []string{}
+	for k, v := range spec.NodeSelector {
+		constraints = append(constraints, fmt.Sprintf("nodeSelector %s=%s", k, v))
+	}
+	for _, t := range spec.Tolerations {
+		toleration := t.Key
+		if t.Operator != corev1.TolerationOpExists {
+			toleration += "=" + t.Value
+		}
+		if toleration == "" {
+			toleration = "*"
+		}
+		if t.Effect != "" {
+			toleration += ":" + string(t.Effect)
+		}
+		constraints = append(constraints, "toleration "+toleration)
+	}
+
+	if a := spec.Affinity; a != nil {
+		if na := a.NodeAffinity; na != nil {
+			if na.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+				for _, t := range na.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+					constraints = append(constraints, "nodeAffinity required "+nodeSelectorTerm(t))
+				}
+			}
+			for _, p := range na.PreferredDuringSchedulingIgnoredDuringExecution {
+				constraints = append(constraints, fmt.Sprintf("nodeAffinity preferred(%d) %s", p.Weight, nodeSelectorTerm(p.Preference)))
+			}
+		}
+		if pa := a.PodAffinity; pa != nil {
+			for _, t := range pa.RequiredDuringSchedulingIgnoredDuringExecution {
+				constraints = append(constraints, "podAffinity required "+t.TopologyKey)
+			}
+			for _, p := range pa.PreferredDuringSchedulingIgnoredDuringExecution {
+				constraints = append(constraints, "podAffinity preferred "+p.PodAffinityTerm.TopologyKey)
+			}
+		}
+		if pa := a.PodAntiAffinity; pa != nil {
+			for _, t := range pa.RequiredDuringSchedulingIgnoredDuringExecution {
+				constraints = append(constraints, "podAntiAffinity required "+t.TopologyKey)
+			}
+			for _, p := range pa.PreferredDuringSchedulingIgnoredDuringExecution {
+				constraints = append(constraints, "podAntiAffinity preferred "+p.PodAffinityTerm.TopologyKey)
+			}
+		}
+	}
+
+	for _, c := range spec.TopologySpreadConstraints {
+		constraints = append(constraints, fmt.Sprintf("spread %s maxSkew=%d %s", c.TopologyKey, c.MaxSkew, c.WhenUnsatisfiable))
+	}
+	if spec.PriorityClassName != "" {
+		constraints = append(constraints, "priorityClass "+spec.PriorityClassName)
+	}
+	sort.Strings(constraints)
+	return constraints
+}
+
+func topology(deployments []appsv1.Deployment) ([]workloadTopology, []constraintUse) {
+	workloads := []workloadTopology{}
+	uses := map[string][]string{}
+	for _, d := range deployments {
+		w := workloadTopology{Namespace: d.ObjectMeta.Namespace, Deployment: d.ObjectMeta.Name, Constraints: schedulingConstraints(d.Spec.Template.Spec)}
+		workloads = append(workloads, w)
+		if len(w.Constraints) == 0 {
+			uses["unconstrained"] = append(uses["unconstrained"], w.Namespace+"/"+w.Deployment)
+		}
+		for _, c := range w.Constraints {
+			uses[c] = append(uses[c], w.Namespace+"/"+w.Deployment)
+		}
+	}
+
+	summary := []constraintUse{}
+	for _, c := range grantKeys(uses) {
+		sort.Strings(uses[c])
+		summary = append(summary, constraintUse{Constraint: c, Workloads: uses[c]})
+	}
+	return workloads, summary
+}
+
+func writeTopologyReport(deployments []appsv1.Deployment) error {
+	workloads, summary := topology(deployments)
+
+	b, err := json.MarshalIndent(map[string]interface{}{"constraints": summary, "workloads": workloads}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeRootFile(topologyReport+".json", b); err != nil {
+		return err
+	}
+
+	buffer := bytes.Buffer{}
+	w := csv.NewWriter(&buffer)
+	w.Write([]string{"constraint", "workloads", "names"})
+	for _, c := range summary {
+		w.Write([]string{c.Constraint, strconv.Itoa(len(c.Workloads)), strings.Join(c.Workloads, " ")})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return writeRootFile(topologyReport+".csv", buffer.Bytes())
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+/*
+	the users and groups of every binding the rolestring didn't match, by name only, so that a filter missing
+	user-defined access because it is named differently shows up here rather than not at all. system: subjects
+	are left out, kubernetes and the platform own those, and so are bindings in skipped namespaces
+*/
+
+const unmatchedBindingsReport string = "reports/unmatched-bindings"
+
+type unmatchedSubject struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// namespace/name of rolebindings, name alone of clusterrolebindings
+	Bindings []string `json:"bindings"`
+}
+
+func unmatchedSubjects(bindings []rbacv1.RoleBinding, clusterBindings []rbacv1.ClusterRoleBinding, lookFor string) []*unmatchedSubject {
+	subjects := map[string]*unmatchedSubject{}
+	add := func(all []rbacv1.Subject, binding string) {
+		for _, s := range all {
+			if (s.Kind != rbacv1.UserKind && s.Kind != rbacv1.GroupKind) || strings.HasPrefix(s.Name, "system:") {
+				continue
+			}
+			id := subjectKey(s)
+			if subjects[id] == nil {
+				subjects[id] = &unmatchedSubject{Kind: s.Kind, Name: s.Name, Bindings: []string{}}
+			}
+			subjects[id].Bindings = append(subjects[id].Bindings, binding)
+		}
+	}
+	for _, b := range bindings {
+		if isSkippedNamespace(b.ObjectMeta.Namespace) || containsUserDefined(b.Subjects, lookFor) {
+			continue
+		}
+		add(b.Subjects, b.ObjectMeta.Namespace+"/"+b.ObjectMeta.Name)
+	}
+	for _, b := range clusterBindings {
+		if containsUserDefined(b.Subjects, lookFor) {
+			continue
+		}
+		add(b.Subjects, b.ObjectMeta.Name)
+	}
+
+	sorted := []*unmatchedSubject{}
+	for _, s := range subjects {
+		sort.Strings(s.Bindings)
+		sorted = append(sorted, s)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Kind != sorted[j].Kind {
+			return sorted[i].Kind < sorted[j].Kind
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+func writeUnmatchedBindingsReport(bindings []rbacv1.RoleBinding, clusterBindings []rbacv1.ClusterRoleBinding, lookFor string) error {
+	subjects := unmatchedSubjects(bindings, clusterBindings, lookFor)
+
+	buffer := bytes.Buffer{}
+	w := csv.NewWriter(&buffer)
+	w.Write([]string{"kind", "name", "bindings", "binding names"})
+	for _, s := range subjects {
+		w.Write([]string{s.Kind, s.Name, strconv.Itoa(len(s.Bindings)), strings.Join(s.Bindings, " ")})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if err := writeRootFile(unmatchedBindingsReport+".csv", buffer.Bytes()); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(subjects, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeRootFile(unmatchedBindingsReport+".json", b)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/nicgrobler/k8s/result"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/kubectl/pkg/scheme"
+)
+
+/*
+	extract only knows the types it was written for - an object of any other type, say a new list source handing
+	over pointers rather than values, is skipped with a warning instead of ending the run. the first object of each
+	type is logged, every one is counted in the result and the summary at the end of the scan
+*/
+
+var (
+	unsupported   = map[result.UnsupportedType]int{}
+	unsupportedMu sync.Mutex
+)
+
+func resetUnsupported() {
+	unsupportedMu.Lock()
+	defer unsupportedMu.Unlock()
+	unsupported = map[result.UnsupportedType]int{}
+}
+
+func unsupportedType(unknown interface{}) result.UnsupportedType {
+	t := result.UnsupportedType{GoType: fmt.Sprintf("%T", unknown)}
+	obj, ok := unknown.(runtime.Object)
+	if v := reflect.ValueOf(unknown); !ok && v.IsValid() {
+		// typed lists hold values, whose pointers are the objects
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		obj, ok = p.Interface().(runtime.Object)
+	}
+	if !ok || obj == nil {
+		return t
+	}
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if gvk.Empty() {
+		if gvks, _, err := scheme.Scheme.ObjectKinds(obj); err == nil && len(gvks) > 0 {
+			gvk = gvks[0]
+		}
+	}
+	if !gvk.Empty() {
+		// as in object keys, see objectkeys.go
+		group := gvk.Group
+		if group == "" {
+			group = result.CoreGroup
+		}
+		t.GVK = group + "/" + gvk.Version + "/" + gvk.Kind
+	}
+	return t
+}
+
+func recordUnsupported(unknown interface{}) {
+	t := unsupportedType(unknown)
+	unsupportedMu.Lock()
+	defer unsupportedMu.Unlock()
+	if unsupported[t] == 0 {
+		log.Printf("warning: skipping objects of unsupported type gvk=%q goType=%q", t.GVK, t.GoType)
+	}
+	unsupported[t]++
+}
+
+func unsupportedSummary() []result.UnsupportedType {
+	unsupportedMu.Lock()
+	defer unsupportedMu.Unlock()
+	summary := []result.UnsupportedType{}
+	for t, count := range unsupported {
+		t.Count = count
+		summary = append(summary, t)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].GVK != summary[j].GVK {
+			return summary[i].GVK < summary[j].GVK
+		}
+		return summary[i].GoType < summary[j].GoType
+	})
+	return summary
+}
+
+func logUnsupported() {
+	for _, t := range unsupportedSummary() {
+		name := t.GVK
+		if name == "" {
+			name = t.GoType
+		}
+		log.Printf("skipped %d objects of unsupported type %s", t.Count, name)
+	}
+}
+
+func mergeUnsupported(merged, more []result.UnsupportedType) []result.UnsupportedType {
+	for _, t := range more {
+		found := false
+		for i := range merged {
+			if merged[i].GVK == t.GVK && merged[i].GoType == t.GoType {
+				merged[i].Count += t.Count
+				found = true
+			}
+		}
+		if !found {
+			merged = append(merged, t)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+/*
+	for clusters without egress, everything the scanner would otherwise fetch or can't know can be vendored into one
+	directory, given with -data-dir and copied in from a host that has access:
+
+		deprecations.yaml  the api removal schedule, replacing the one compiled in
+		schemas/*.yaml     CustomResourceDefinitions - lint validates custom resources against their openAPIV3Schema
+		policies/*.yaml    policy bundles, lists of custom checks added to checks.custom of the config file
+		images.yaml        digests and platforms by image - when present, registries are never contacted
+
+	every file is optional, a missing one leaves its feature as it would be without -data-dir
+*/
+
+//go:embed data/deprecations.yaml
+var defaultDeprecations []byte
+
+type deprecatedAPI struct {
+	APIVersion string `json:"apiVersion"`
+	// empty for every kind of the api version
+	Kind        string `json:"kind,omitempty"`
+	RemovedIn   string `json:"removedIn"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+type vendoredImage struct {
+	Digest    string   `json:"digest,omitempty"`
+	Platforms []string `json:"platforms,omitempty"`
+}
+
+var (
+	deprecations []deprecatedAPI
+	// keyed by vendoredImageKey, nil unless images.yaml was vendored
+	vendoredImages map[string]vendoredImage
+	// keyed by apiVersion/kind
+	vendoredSchemas map[string]*openAPISchema
+)
+
+func vendoredImageKey(ref imageRef) string {
+	// the normalised reference, so that nginx and docker.io/library/nginx:latest are the same image
+	key := ref.Registry + "/" + ref.Repository
+	if ref.Digest != "" {
+		return key + "@" + ref.Digest
+	}
+	return key + ":" + ref.Tag
+}
+
+func lookupVendoredImage(ref imageRef) (vendoredImage, error) {
+	image, ok := vendoredImages[vendoredImageKey(ref)]
+	if !ok {
+		return image, fmt.Errorf("%s is not in the vendored images.yaml", vendoredImageKey(ref))
+	}
+	return image, nil
+}
+
+func readVendored(dir, name string) ([]byte, error) {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return b, err
+}
+
+func vendoredFiles(dir, sub string) ([]string, error) {
+	files := []string{}
+	for _, pattern := range []string{"*.yaml", "*.yml", "*.json"} {
+		matches, err := filepath.Glob(filepath.Join(dir, sub, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func loadDeprecations(dir string) error {
+	b := defaultDeprecations
+	if dir != "" {
+		vendored, err := readVendored(dir, "deprecations.yaml")
+		if err != nil {
+			return err
+		}
+		if vendored != nil {
+			b = vendored
+		}
+	}
+	deprecations = nil
+	if err := yaml.UnmarshalStrict(b, &deprecations); err != nil {
+		return fmt.Errorf("deprecations.yaml: %w", err)
+	}
+	return nil
+}
+
+func loadVendoredImages(dir string) error {
+	vendoredImages = nil
+	b, err := readVendored(dir, "images.yaml")
+	if err != nil || b == nil {
+		return err
+	}
+	images := map[string]vendoredImage{}
+	if err := yaml.UnmarshalStrict(b, &images); err != nil {
+		return fmt.Errorf("images.yaml: %w", err)
+	}
+	vendoredImages = map[string]vendoredImage{}
+	for image, v := range images {
+		vendoredImages[vendoredImageKey(parseImageRef(image))] = v
+	}
+	return nil
+}
+
+func loadPolicies(dir string) ([]customCheck, error) {
+	files, err := vendoredFiles(dir, "policies")
+	if err != nil {
+		return nil, err
+	}
+	checks := []customCheck{}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		bundle := []customCheck{}
+		if err := yaml.UnmarshalStrict(b, &bundle); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		checks = append(checks, bundle...)
+	}
+	return checks, nil
+}
+
+func loadDataDir(dir string) ([]customCheck, error) {
+	// returns the vendored policies, for the caller to add to the custom checks of the config
+	if err := loadDeprecations(dir); err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return nil, nil
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("-data-dir %s is not a directory", dir)
+	}
+	if err := loadVendoredImages(dir); err != nil {
+		return nil, err
+	}
+	if err := loadSchemas(dir); err != nil {
+		return nil, err
+	}
+	return loadPolicies(dir)
+}
+
+/*
+	just enough of a structural schema to catch what a restore would trip over: wrong types, missing required fields,
+	unknown fields and values outside an enum - formats, patterns and the cel rules are left to the api server
+*/
+
+type openAPISchema struct {
+	Type       string                    `json:"type,omitempty"`
+	Properties map[string]*openAPISchema `json:"properties,omitempty"`
+	Items      *openAPISchema            `json:"items,omitempty"`
+	Required   []string                  `json:"required,omitempty"`
+	Enum       []interface{}             `json:"enum,omitempty"`
+	// either a schema for every value of a map, or a bool
+	AdditionalProperties json.RawMessage `json:"additionalProperties,omitempty"`
+	PreserveUnknown      bool            `json:"x-kubernetes-preserve-unknown-fields,omitempty"`
+	IntOrString          bool            `json:"x-kubernetes-int-or-string,omitempty"`
+	EmbeddedResource     bool            `json:"x-kubernetes-embedded-resource,omitempty"`
+}
+
+type crdDocument struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		Group string `json:"group"`
+		Names struct {
+			Kind string `json:"kind"`
+		} `json:"names"`
+		Versions []struct {
+			Name   string `json:"name"`
+			Schema struct {
+				OpenAPIV3Schema *openAPISchema `json:"openAPIV3Schema"`
+			} `json:"schema"`
+		} `json:"versions"`
+	} `json:"spec"`
+}
+
+func loadSchemas(dir string) error {
+	vendoredSchemas = nil
+	files, err := vendoredFiles(dir, "schemas")
+	if err != nil || len(files) == 0 {
+		return err
+	}
+	vendoredSchemas = map[string]*openAPISchema{}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		// crds usually come as one multi document file per operator
+		decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(b), 4096)
+		for {
+			crd := crdDocument{}
+			err := decoder.Decode(&crd)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+			if crd.Kind != "CustomResourceDefinition" {
+				continue
+			}
+			for _, v := range crd.Spec.Versions {
+				if v.Schema.OpenAPIV3Schema != nil {
+					vendoredSchemas[crd.Spec.Group+"/"+v.Name+"/"+crd.Spec.Names.Kind] = v.Schema.OpenAPIV3Schema
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func lintSchema(obj map[string]interface{}) []string {
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	s, ok := vendoredSchemas[apiVersion+"/"+kind]
+	if !ok {
+		return nil
+	}
+	// apiVersion, kind and metadata belong to the api server rather than the crd, and have their own checks
+	rest := map[string]interface{}{}
+	for k, v := range obj {
+		if k != "apiVersion" && k != "kind" && k != "metadata" {
+			rest[k] = v
+		}
+	}
+	return s.validate("", rest, true)
+}
+
+func (s *openAPISchema) validate(path string, value interface{}, root bool) []string {
+	field := strings.TrimPrefix(path, ".")
+	if field == "" {
+		field = "(root)"
+	}
+	if value == nil {
+		return nil
+	}
+	if len(s.Enum) > 0 {
+		allowed := false
+		for _, e := range s.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(value) {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return []string{fmt.Sprintf("%s: unsupported value %v", field, value)}
+		}
+	}
+	if s.IntOrString {
+		switch value.(type) {
+		case string, float64, int64:
+			return nil
+		}
+		return []string{fmt.Sprintf("%s: must be an integer or a string", field)}
+	}
+
+	switch s.Type {
+	case "object", "":
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			if s.Type == "" {
+				return nil
+			}
+			return []string{fmt.Sprintf("%s: must be an object", field)}
+		}
+		return s.validateObject(path, m, root)
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: must be an array", field)}
+		}
+		problems := []string{}
+		if s.Items != nil {
+			for i, item := range items {
+				problems = append(problems, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, false)...)
+			}
+		}
+		return problems
+	case "string":
+		if _, ok := value.(string); !ok {
+			return []string{fmt.Sprintf("%s: must be a string", field)}
+		}
+	case "integer":
+		// json numbers are decoded as float64
+		if f, ok := value.(float64); !ok || f != float64(int64(f)) {
+			if _, ok := value.(int64); !ok {
+				return []string{fmt.Sprintf("%s: must be an integer", field)}
+			}
+		}
+	case "number":
+		switch value.(type) {
+		case float64, int64:
+		default:
+			return []string{fmt.Sprintf("%s: must be a number", field)}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{fmt.Sprintf("%s: must be a boolean", field)}
+		}
+	}
+	return nil
+}
+
+func (s *openAPISchema) validateObject(path string, m map[string]interface{}, root bool) []string {
+	problems := []string{}
+	for _, name := range s.Required {
+		// the root schema lists metadata and friends as required too, they were validated elsewhere
+		if root && (name == "apiVersion" || name == "kind" || name == "metadata") {
+			continue
+		}
+		if _, ok := m[name]; !ok {
+			problems = append(problems, fmt.Sprintf("%s.%s is required", strings.TrimPrefix(path, "."), name))
+		}
+	}
+
+	var additional *openAPISchema
+	allowUnknown := s.PreserveUnknown || s.EmbeddedResource
+	if len(s.AdditionalProperties) > 0 {
+		allow := false
+		if err := json.Unmarshal(s.AdditionalProperties, &allow); err != nil {
+			additional = &openAPISchema{}
+			if err := json.Unmarshal(s.AdditionalProperties, additional); err != nil {
+				additional = nil
+			}
+		}
+		allowUnknown = allowUnknown || allow
+	}
+
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		child, ok := s.Properties[k]
+		switch {
+		case ok:
+			problems = append(problems, child.validate(path+"."+k, m[k], false)...)
+		case additional != nil:
+			problems = append(problems, additional.validate(path+"."+k, m[k], false)...)
+		case !allowUnknown && (len(s.Properties) > 0 || s.Type == "object"):
+			problems = append(problems, fmt.Sprintf("%s: unknown field", strings.TrimPrefix(path+"."+k, ".")))
+		}
+	}
+	return problems
+}
+
+func checkDeprecations(objects []exportedObject) {
+	for _, o := range objects {
+		for _, d := range deprecations {
+			if d.APIVersion != o.APIVersion || (d.Kind != "" && d.Kind != o.Kind) {
+				continue
+			}
+			message := fmt.Sprintf("%s %s is removed in kubernetes %s", o.APIVersion, o.Kind, d.RemovedIn)
+			if d.Replacement != "" {
+				message += ", use " + d.Replacement
+			}
+			addFinding(finding{
+				ID:        "deprecated-api",
+				Severity:  severityMedium,
+				Kind:      o.Kind,
+				Namespace: o.Namespace,
+				Name:      o.Name,
+				Message:   message,
+			})
+			break
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+)
+
+/*
+	verify-restore checks that a cluster restored from a snapshot, say a dr cluster, holds everything the snapshot
+	does: every object has to exist, and every field the snapshot holds has to have the same value - fields the
+	cluster adds (defaults, status, bookkeeping) are fine, the snapshot being pruned. the drift ignores apply, the
+	defaults, drift.ignore of -config and -ignore, so fields expected to differ between clusters can be left out.
+	objects of the restored cluster which aren't in the snapshot are not gaps. every kind is listed once rather than
+	every object read on its own. exits with status 1 when anything is missing or different
+*/
+
+func runVerifyRestore(args []string) error {
+	fs := flag.NewFlagSet("verify-restore", flag.ExitOnError)
+	fromDir := fs.String("from-dir", "", "output directory of the snapshot the cluster was restored from")
+	contextName := fs.String("context", "", "(optional) kubeconfig context of the restored cluster, the current context when not set")
+	configFile := fs.String("config", "", "(optional) config file whose drift.ignore lists further fields to leave out")
+	ignore := fs.String("ignore", "", "(optional) comma separated fields to leave out, each a path or kind:path, such as Deployment:spec.replicas")
+	asJSON := fs.Bool("json", false, "(optional) write the gaps as json instead of text")
+	kubeconfig := kubeconfigFlag(fs)
+	fs.Parse(args)
+
+	if *fromDir == "" || fs.NArg() != 0 {
+		return errors.New("usage: verify-restore -from-dir <snapshot> [-context name] [-config file] [-ignore paths] [-json]")
+	}
+	ignores, err := driftIgnores(*configFile, *ignore)
+	if err != nil {
+		return err
+	}
+	snapshot, err := readSnapshot(*fromDir)
+	if err != nil {
+		return err
+	}
+
+	config, _, err := loadKubeconfigContext(*kubeconfig, *contextName)
+	if err != nil {
+		return err
+	}
+	disc, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return err
+	}
+	dyn, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	restored, err := restoredObjects(disc, dyn, snapshot)
+	if err != nil {
+		return err
+	}
+
+	gaps := restoreGaps(snapshot, restored, ignores)
+	if *asJSON {
+		b, err := json.MarshalIndent(gaps, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	} else {
+		printRestoreGaps(gaps)
+	}
+	log.Printf("verify-restore: %d of %d objects missing or different", len(gaps), len(snapshot))
+	if len(gaps) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func restoredObjects(disc discovery.DiscoveryInterface, dyn dynamic.Interface, snapshot []snapshotObject) ([]snapshotObject, error) {
+	// lists every kind the snapshot holds: a kind the restored cluster doesn't serve leaves its objects missing
+	groups, err := restmapper.GetAPIGroupResources(disc)
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+	mapper := restmapper.NewDiscoveryRESTMapper(groups)
+
+	listed := map[schema.GroupVersionResource]bool{}
+	objects := []snapshotObject{}
+	for _, o := range snapshot {
+		gv, err := schema.ParseGroupVersion(o.apiVersion())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", o.Path, err)
+		}
+		mapping, err := mapper.RESTMapping(gv.WithKind(o.kind()).GroupKind(), gv.Version)
+		if err != nil {
+			log.Printf("verify-restore: %s %s is not served by the restored cluster", o.apiVersion(), o.kind())
+			continue
+		}
+		if listed[mapping.Resource] {
+			continue
+		}
+		listed[mapping.Resource] = true
+		list, err := dyn.Resource(mapping.Resource).List(context.TODO(), listOptions())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s; %w", mapping.Resource.String(), err)
+		}
+		for _, item := range list.Items {
+			objects = append(objects, snapshotObject{Object: item.Object})
+		}
+	}
+	return objects, nil
+}
+
+func restoreGaps(snapshot, restored []snapshotObject, ignores []driftIgnore) []objectDrift {
+	current := map[string]snapshotObject{}
+	for _, o := range restored {
+		current[driftKey(o)] = o
+	}
+	gaps := []objectDrift{}
+	for _, o := range snapshot {
+		k := driftKey(o)
+		r, ok := current[k]
+		if !ok {
+			gaps = append(gaps, objectDrift{key: k, Key: o.key(), Change: "missing", Kind: o.kind(), Namespace: o.metadata("namespace"), Name: o.metadata("name")})
+			continue
+		}
+		// only what the snapshot holds is compared, whatever else the restored object has
+		wanted, got := objectFields(o, ignores), objectFields(r, ignores)
+		paths := map[string]bool{}
+		for p := range wanted {
+			paths[p] = true
+		}
+		changes := []fieldChange{}
+		for _, p := range sortedKeys(paths) {
+			if wanted[p] != got[p] {
+				changes = append(changes, fieldChange{Path: p, Old: wanted[p], New: got[p]})
+			}
+		}
+		if len(changes) > 0 {
+			gaps = append(gaps, objectDrift{key: k, Key: o.key(), Change: "different", Kind: o.kind(), Namespace: o.metadata("namespace"), Name: o.metadata("name"), Fields: changes})
+		}
+	}
+	return gaps
+}
+
+func printRestoreGaps(gaps []objectDrift) {
+	for _, g := range gaps {
+		fmt.Printf("%s %s\n", g.Change, g.Key)
+		for _, f := range g.Fields {
+			got := f.New
+			if got == "" {
+				got = "(unset)"
+			}
+			fmt.Printf("    %s: %s in the snapshot, %s restored\n", f.Path, f.Old, got)
+		}
+	}
+	if len(gaps) == 0 {
+		fmt.Println("everything in the snapshot was found in the restored cluster")
+	}
+}
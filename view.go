@@ -0,0 +1,219 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing/fstest"
+
+	"github.com/nicgrobler/k8s/result"
+)
+
+/*
+	view looks into an export without unpacking it: an archive as pushed to the collector or uploaded to s3 is read
+	into memory, a directory is read where it is. on its own it lists every file, with a path it prints that file
+	(decompressed), with -findings it prints the findings, and with -serve it serves all of it as pages to browse
+*/
+
+func readArchiveFS(file string) (fs.FS, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return os.DirFS(file), nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s is neither a directory nor a tar.gz archive; %w", file, err)
+	}
+	files := fstest.MapFS{}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[path.Clean(strings.TrimPrefix(h.Name, "/"))] = &fstest.MapFile{Data: b, Mode: 0444, ModTime: h.ModTime}
+	}
+}
+
+func archiveFiles(fsys fs.FS) ([]string, error) {
+	files := []string{}
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, p)
+		}
+		return err
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+func readArchiveFile(fsys fs.FS, name string) ([]byte, error) {
+	b, err := fs.ReadFile(fsys, path.Clean(strings.TrimPrefix(name, "/")))
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(name, compressedSuffix) {
+		return gunzipBytes(b)
+	}
+	return b, nil
+}
+
+func readArchiveResult(fsys fs.FS) (*result.ScanResult, error) {
+	f, err := fsys.Open(result.FileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return result.Decode(f)
+}
+
+func findingTarget(f result.Finding) string {
+	if f.Object.Namespace != "" {
+		return f.Object.Kind + " " + f.Object.Namespace + "/" + f.Object.Name
+	}
+	return f.Object.Kind + " " + f.Object.Name
+}
+
+var viewTemplate = template.Must(template.New("view").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>kube-scanner {{.Name}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+td { padding: 0 1em 0 0; vertical-align: top; }
+ul { font-family: monospace; list-style: none; padding-left: 0; }
+.high { color: #cf222e; } .medium { color: #9a6700; } .low { color: #57606a; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+{{with .Result}}<p>cluster {{.Cluster}}, scanned {{.StartedAt.Format "2006-01-02 15:04:05 MST"}}: {{len .Objects}} objects, {{len .Findings}} findings, {{len .Errors}} errors</p>
+<h2>Findings</h2>
+<table>
+{{range .Findings}}<tr><td class="{{.Severity}}">{{.Severity}}</td><td>{{.ID}}</td><td>{{$.Target .}}</td><td>{{.Message}}</td></tr>
+{{end}}</table>{{end}}
+<h2>Files</h2>
+<ul>
+{{range .Files}}<li><a href="/files/{{.}}">{{.}}</a></li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+type viewPage struct {
+	Name   string
+	Result *result.ScanResult
+	Files  []string
+}
+
+func (viewPage) Target(f result.Finding) string {
+	return findingTarget(f)
+}
+
+func serveArchive(addr, name string, fsys fs.FS) error {
+	files, err := archiveFiles(fsys)
+	if err != nil {
+		return err
+	}
+	// an export without a result can still be browsed
+	res, _ := readArchiveResult(fsys)
+	page := viewPage{Name: name, Result: res, Files: files}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		viewTemplate.Execute(w, page)
+	})
+	mux.HandleFunc("/files/", func(w http.ResponseWriter, r *http.Request) {
+		b, err := readArchiveFile(fsys, strings.TrimPrefix(r.URL.Path, "/files/"))
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(b)
+	})
+	log.Printf("view: serving %s on %s", name, addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+func runView(args []string) error {
+	fs := flag.NewFlagSet("view", flag.ExitOnError)
+	serve := fs.String("serve", "", "(optional) address to serve the export on for browsing, such as localhost:8080, instead of printing")
+	showFindings := fs.Bool("findings", false, "print the findings rather than the files")
+	fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return errors.New("usage: view [-serve addr | -findings] <archive or directory> [path]")
+	}
+	fsys, err := readArchiveFS(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *serve != "":
+		return serveArchive(*serve, fs.Arg(0), fsys)
+	case fs.NArg() == 2:
+		b, err := readArchiveFile(fsys, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(b)
+		return err
+	case *showFindings:
+		res, err := readArchiveResult(fsys)
+		if err != nil {
+			return fmt.Errorf("%s holds no readable %s; %w", fs.Arg(0), result.FileName, err)
+		}
+		for _, f := range res.Findings {
+			fmt.Printf("%s\t%s\t%s\t%s\n", f.Severity, f.ID, findingTarget(f), f.Message)
+		}
+		return nil
+	}
+	files, err := archiveFiles(fsys)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		fmt.Println(f)
+	}
+	return nil
+}
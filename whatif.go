@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// a single permission, as small as rbac can express it - namespace is allNamespaces for cluster-wide grants
+type grant struct {
+	Namespace    string `json:"namespace"`
+	APIGroup     string `json:"apiGroup,omitempty"`
+	Resource     string `json:"resource,omitempty"`
+	ResourceName string `json:"resourceName,omitempty"`
+	URL          string `json:"nonResourceURL,omitempty"`
+	Verb         string `json:"verb"`
+}
+
+type subjectLoss struct {
+	Subject string `json:"subject"`
+	// groups whose bindings were counted as the subject's own
+	Groups []string `json:"groups,omitempty"`
+	Lost   []grant  `json:"lost"`
+}
+
+func runRBAC(args []string) error {
+	if len(args) == 0 || args[0] != "what-if" {
+		return errors.New("usage: rbac what-if -remove binding|clusterbinding [-as-group groups] <namespace>/<name>")
+	}
+	return runWhatIf(args[1:])
+}
+
+func runWhatIf(args []string) error {
+	fs := flag.NewFlagSet("rbac what-if", flag.ExitOnError)
+	remove := fs.String("remove", "", "type of the binding to simulate removing: binding or clusterbinding, followed by its <namespace>/<name> or <name>")
+	asGroup := fs.String("as-group", "", "(optional) comma separated groups the users of the binding are members of, like kubectl --as-group, whose bindings keep their access")
+	asJSON := fs.Bool("json", false, "(optional) write the lost access as json instead of a table")
+	kubeconfig := kubeconfigFlag(fs)
+	// flags may come after the binding as well as before it
+	positional := []string{}
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if len(positional) != 1 {
+		return errors.New("what-if: expected the binding to remove, for example -remove binding team-a/developers")
+	}
+	target := positional[0]
+	if *remove != "binding" && *remove != "clusterbinding" {
+		return fmt.Errorf("what-if: unsupported binding type %q: expected binding or clusterbinding", *remove)
+	}
+
+	config, _, err := loadKubeconfig(*kubeconfig)
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	bindings, err := clientset.RbacV1().RoleBindings("").List(context.TODO(), listOptions())
+	if err != nil {
+		return err
+	}
+	clusterBindings, err := clientset.RbacV1().ClusterRoleBindings().List(context.TODO(), listOptions())
+	if err != nil {
+		return err
+	}
+	clusterRoles, err := clientset.RbacV1().ClusterRoles().List(context.TODO(), listOptions())
+	if err != nil {
+		return err
+	}
+
+	var subjects []rbacv1.Subject
+	found := false
+	var skip func(namespace, name string) bool
+	switch *remove {
+	case "binding":
+		parts := strings.SplitN(target, "/", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("what-if: expected <namespace>/<name> for a binding, got %q", target)
+		}
+		for _, b := range bindings.Items {
+			if b.ObjectMeta.Namespace == parts[0] && b.ObjectMeta.Name == parts[1] {
+				subjects, found = b.Subjects, true
+			}
+		}
+		skip = func(namespace, name string) bool { return namespace == parts[0] && name == parts[1] }
+	case "clusterbinding":
+		for _, b := range clusterBindings.Items {
+			if b.ObjectMeta.Name == target {
+				subjects, found = b.Subjects, true
+			}
+		}
+		skip = func(namespace, name string) bool { return namespace == "" && name == target }
+	}
+	if !found {
+		return fmt.Errorf("what-if: %s %s not found", *remove, target)
+	}
+
+	groups := []string{}
+	for _, g := range strings.Split(*asGroup, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+
+	losses := []subjectLoss{}
+	for _, s := range subjects {
+		identities := subjectIdentities(s, groups)
+		before, err := subjectGrants(clientset, identities, bindings.Items, clusterBindings.Items, clusterRoles.Items, nil)
+		if err != nil {
+			return err
+		}
+		after, err := subjectGrants(clientset, identities, bindings.Items, clusterBindings.Items, clusterRoles.Items, skip)
+		if err != nil {
+			return err
+		}
+		loss := subjectLoss{Subject: subjectKey(s), Lost: lostGrants(before, after)}
+		for _, identity := range identities[1:] {
+			loss.Groups = append(loss.Groups, identity.Name)
+		}
+		losses = append(losses, loss)
+	}
+
+	if *asJSON {
+		b, err := json.MarshalIndent(losses, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(append(b, '\n'))
+		return err
+	}
+	return printLosses(losses)
+}
+
+func sameSubject(a, b rbacv1.Subject) bool {
+	// service accounts are the only subjects with a namespace, which is also the only place it means something
+	if a.Kind != b.Kind || a.Name != b.Name {
+		return false
+	}
+	return a.Kind != rbacv1.ServiceAccountKind || a.Namespace == b.Namespace
+}
+
+func hasSubject(subjects []rbacv1.Subject, s rbacv1.Subject) bool {
+	for _, subject := range subjects {
+		if sameSubject(subject, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func subjectIdentities(s rbacv1.Subject, groups []string) []rbacv1.Subject {
+	/*
+		the subject itself first, then the groups it is a member of: access granted to any of them is the subject's.
+		every authenticated user and service account is in system:authenticated, service accounts are also in
+		system:serviceaccounts and that of their namespace. other groups of a user only the identity provider
+		knows, so they come from -as-group. groups don't nest, a group is only itself
+	*/
+	identities := []rbacv1.Subject{s}
+	member := []string{}
+	switch s.Kind {
+	case rbacv1.UserKind:
+		member = append([]string{"system:authenticated"}, groups...)
+	case rbacv1.ServiceAccountKind:
+		member = []string{"system:authenticated", "system:serviceaccounts", "system:serviceaccounts:" + s.Namespace}
+	}
+	seen := map[string]bool{}
+	for _, g := range member {
+		if !seen[g] && !(s.Kind == rbacv1.GroupKind && s.Name == g) {
+			seen[g] = true
+			identities = append(identities, rbacv1.Subject{Kind: rbacv1.GroupKind, APIGroup: rbacv1.GroupName, Name: g})
+		}
+	}
+	return identities
+}
+
+func bindsAny(subjects, identities []rbacv1.Subject) bool {
+	for _, identity := range identities {
+		if hasSubject(subjects, identity) {
+			return true
+		}
+	}
+	return false
+}
+
+func ruleGrants(namespace string, rule rbacv1.PolicyRule) []grant {
+	grants := []grant{}
+	for _, verb := range rule.Verbs {
+		for _, url := range rule.NonResourceURLs {
+			grants = append(grants, grant{Namespace: namespace, URL: url, Verb: verb})
+		}
+		for _, group := range rule.APIGroups {
+			for _, resource := range rule.Resources {
+				if len(rule.ResourceNames) == 0 {
+					grants = append(grants, grant{Namespace: namespace, APIGroup: group, Resource: resource, Verb: verb})
+				}
+				for _, name := range rule.ResourceNames {
+					grants = append(grants, grant{Namespace: namespace, APIGroup: group, Resource: resource, ResourceName: name, Verb: verb})
+				}
+			}
+		}
+	}
+	return grants
+}
+
+func subjectGrants(clientset kubernetes.Interface, identities []rbacv1.Subject, bindings []rbacv1.RoleBinding, clusterBindings []rbacv1.ClusterRoleBinding, clusterRoles []rbacv1.ClusterRole, skip func(namespace, name string) bool) ([]grant, error) {
+	grants := []grant{}
+	for _, b := range clusterBindings {
+		if (skip != nil && skip("", b.ObjectMeta.Name)) || !bindsAny(b.Subjects, identities) {
+			continue
+		}
+		rules, err := roleRules(clientset, "", b.RoleRef)
+		if err != nil {
+			return nil, err
+		}
+		aggregated, err := aggregatedRules(clusterRoles, b.RoleRef, map[string]bool{})
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, aggregated...)
+		for _, rule := range rules {
+			grants = append(grants, ruleGrants(allNamespaces, rule)...)
+		}
+	}
+	for _, b := range bindings {
+		if (skip != nil && skip(b.ObjectMeta.Namespace, b.ObjectMeta.Name)) || !bindsAny(b.Subjects, identities) {
+			continue
+		}
+		rules, err := roleRules(clientset, b.ObjectMeta.Namespace, b.RoleRef)
+		if err != nil {
+			return nil, err
+		}
+		aggregated, err := aggregatedRules(clusterRoles, b.RoleRef, map[string]bool{})
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, aggregated...)
+		for _, rule := range rules {
+			// non resource urls only mean something in cluster roles bound cluster-wide
+			rule.NonResourceURLs = nil
+			grants = append(grants, ruleGrants(b.ObjectMeta.Namespace, rule)...)
+		}
+	}
+	return grants, nil
+}
+
+func aggregatedRules(clusterRoles []rbacv1.ClusterRole, ref rbacv1.RoleRef, seen map[string]bool) ([]rbacv1.PolicyRule, error) {
+	/*
+		the rules of the cluster roles an aggregated cluster role selects, which the controller copies into its own
+		rules - read from them rather than waiting for it, as what a custom aggregation hasn't been filled in with
+		yet is granted as soon as it is
+	*/
+	if ref.Kind != "ClusterRole" || seen[ref.Name] {
+		return nil, nil
+	}
+	seen[ref.Name] = true
+	var aggregating *rbacv1.ClusterRole
+	for i := range clusterRoles {
+		if clusterRoles[i].ObjectMeta.Name == ref.Name {
+			aggregating = &clusterRoles[i]
+		}
+	}
+	if aggregating == nil || aggregating.AggregationRule == nil {
+		return nil, nil
+	}
+	rules := []rbacv1.PolicyRule{}
+	for _, s := range aggregating.AggregationRule.ClusterRoleSelectors {
+		selector, err := metav1.LabelSelectorAsSelector(&s)
+		if err != nil {
+			return nil, fmt.Errorf("what-if: clusterrole %s: %w", ref.Name, err)
+		}
+		for _, r := range clusterRoles {
+			if r.ObjectMeta.Name == ref.Name || !selector.Matches(labels.Set(r.ObjectMeta.Labels)) {
+				continue
+			}
+			rules = append(rules, r.Rules...)
+			nested, err := aggregatedRules(clusterRoles, rbacv1.RoleRef{Kind: "ClusterRole", Name: r.ObjectMeta.Name}, seen)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, nested...)
+		}
+	}
+	return rules, nil
+}
+
+func matchesGrant(pattern, value string) bool {
+	return pattern == "*" || pattern == value
+}
+
+func covers(a, b grant) bool {
+	// does holding a also give b - wildcards, cluster-wide grants and grants without resource names cover more
+	if a.Namespace != allNamespaces && a.Namespace != b.Namespace {
+		return false
+	}
+	if !matchesGrant(a.Verb, b.Verb) {
+		return false
+	}
+	if a.URL != "" || b.URL != "" {
+		if a.URL == "" || b.URL == "" {
+			return false
+		}
+		return a.URL == b.URL || (strings.HasSuffix(a.URL, "*") && strings.HasPrefix(b.URL, strings.TrimSuffix(a.URL, "*")))
+	}
+	return matchesGrant(a.APIGroup, b.APIGroup) && matchesGrant(a.Resource, b.Resource) && (a.ResourceName == "" || a.ResourceName == b.ResourceName)
+}
+
+func lostGrants(before, after []grant) []grant {
+	seen := map[grant]bool{}
+	lost := []grant{}
+	for _, g := range before {
+		if seen[g] {
+			continue
+		}
+		seen[g] = true
+		kept := false
+		for _, a := range after {
+			if covers(a, g) {
+				kept = true
+				break
+			}
+		}
+		if !kept {
+			lost = append(lost, g)
+		}
+	}
+	sort.Slice(lost, func(i, j int) bool {
+		return fmt.Sprint(lost[i]) < fmt.Sprint(lost[j])
+	})
+	return lost
+}
+
+func printLosses(losses []subjectLoss) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, l := range losses {
+		subject := l.Subject
+		if len(l.Groups) > 0 {
+			subject += " (with groups " + strings.Join(l.Groups, ", ") + ")"
+		}
+		if len(l.Lost) == 0 {
+			fmt.Fprintf(w, "%s keeps all of its access\n\n", subject)
+			continue
+		}
+		fmt.Fprintf(w, "%s would lose:\n", subject)
+		fmt.Fprintln(w, "  NAMESPACE\tVERB\tAPIGROUP\tRESOURCE\tNAME")
+		for _, g := range l.Lost {
+			resource := g.Resource
+			if g.URL != "" {
+				resource = g.URL
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", g.Namespace, g.Verb, g.APIGroup, resource, g.ResourceName)
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
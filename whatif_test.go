@@ -0,0 +1,143 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCovers(t *testing.T) {
+	pods := grant{Namespace: "shop", APIGroup: "", Resource: "pods", Verb: "get"}
+	tests := []struct {
+		name string
+		a, b grant
+		want bool
+	}{
+		{name: "same", a: pods, b: pods, want: true},
+		{name: "cluster-wide", a: grant{Namespace: allNamespaces, Resource: "pods", Verb: "get"}, b: pods, want: true},
+		{name: "other namespace", a: grant{Namespace: "web", Resource: "pods", Verb: "get"}, b: pods},
+		{name: "namespaced doesn't cover cluster-wide", a: pods, b: grant{Namespace: allNamespaces, Resource: "pods", Verb: "get"}},
+		{name: "any verb", a: grant{Namespace: "shop", Resource: "pods", Verb: "*"}, b: pods, want: true},
+		{name: "other verb", a: grant{Namespace: "shop", Resource: "pods", Verb: "list"}, b: pods},
+		{name: "any resource and group", a: grant{Namespace: "shop", APIGroup: "*", Resource: "*", Verb: "get"}, b: pods, want: true},
+		{name: "other group", a: grant{Namespace: "shop", APIGroup: "apps", Resource: "pods", Verb: "get"}, b: pods},
+		{name: "every name covers one", a: pods, b: grant{Namespace: "shop", Resource: "pods", ResourceName: "web-0", Verb: "get"}, want: true},
+		{name: "one name doesn't cover every", a: grant{Namespace: "shop", Resource: "pods", ResourceName: "web-0", Verb: "get"}, b: pods},
+		{name: "other name", a: grant{Namespace: "shop", Resource: "pods", ResourceName: "web-1", Verb: "get"}, b: grant{Namespace: "shop", Resource: "pods", ResourceName: "web-0", Verb: "get"}},
+		{name: "url", a: grant{Namespace: allNamespaces, URL: "/healthz", Verb: "get"}, b: grant{Namespace: allNamespaces, URL: "/healthz", Verb: "get"}, want: true},
+		{name: "url prefix", a: grant{Namespace: allNamespaces, URL: "/healthz/*", Verb: "get"}, b: grant{Namespace: allNamespaces, URL: "/healthz/ready", Verb: "get"}, want: true},
+		{name: "other url", a: grant{Namespace: allNamespaces, URL: "/healthz", Verb: "get"}, b: grant{Namespace: allNamespaces, URL: "/metrics", Verb: "get"}},
+		{name: "url doesn't cover a resource", a: grant{Namespace: allNamespaces, URL: "*", Verb: "*"}, b: pods},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := covers(tt.a, tt.b); got != tt.want {
+				t.Errorf("covers(%+v, %+v) is %v, expected %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLostGrants(t *testing.T) {
+	get := grant{Namespace: "shop", Resource: "pods", Verb: "get"}
+	del := grant{Namespace: "shop", Resource: "pods", Verb: "delete"}
+	tests := []struct {
+		name          string
+		before, after []grant
+		want          []grant
+	}{
+		{name: "nothing removed", before: []grant{get, del}, after: []grant{get, del}, want: []grant{}},
+		{name: "everything removed", before: []grant{get, del}, want: []grant{del, get}},
+		{name: "kept by a wider grant", before: []grant{get, del}, after: []grant{{Namespace: allNamespaces, Resource: "pods", Verb: "*"}}, want: []grant{}},
+		{name: "partly kept", before: []grant{get, del}, after: []grant{get}, want: []grant{del}},
+		{name: "duplicates once", before: []grant{del, del}, want: []grant{del}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lostGrants(tt.before, tt.after); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lost %+v, expected %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubjectIdentities(t *testing.T) {
+	tests := []struct {
+		name    string
+		subject rbacv1.Subject
+		groups  []string
+		want    []string
+	}{
+		{name: "user", subject: rbacv1.Subject{Kind: rbacv1.UserKind, Name: "alice"}, want: []string{"alice", "system:authenticated"}},
+		{name: "user with groups", subject: rbacv1.Subject{Kind: rbacv1.UserKind, Name: "alice"}, groups: []string{"dev", "system:authenticated"}, want: []string{"alice", "system:authenticated", "dev"}},
+		{name: "service account", subject: rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Namespace: "shop", Name: "web"}, groups: []string{"dev"}, want: []string{"web", "system:authenticated", "system:serviceaccounts", "system:serviceaccounts:shop"}},
+		{name: "group", subject: rbacv1.Subject{Kind: rbacv1.GroupKind, Name: "dev"}, groups: []string{"ops"}, want: []string{"dev"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, s := range subjectIdentities(tt.subject, tt.groups) {
+				got = append(got, s.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("identities %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregatedRules(t *testing.T) {
+	role := func(name string, labels map[string]string, aggregates map[string]string, verb string) rbacv1.ClusterRole {
+		r := rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+		if verb != "" {
+			r.Rules = []rbacv1.PolicyRule{{Verbs: []string{verb}, Resources: []string{"pods"}}}
+		}
+		if aggregates != nil {
+			r.AggregationRule = &rbacv1.AggregationRule{ClusterRoleSelectors: []metav1.LabelSelector{{MatchLabels: aggregates}}}
+		}
+		return r
+	}
+	clusterRoles := []rbacv1.ClusterRole{
+		role("view", nil, map[string]string{"agg": "view"}, ""),
+		role("edit", map[string]string{"agg": "view"}, map[string]string{"agg": "edit"}, ""),
+		role("pods-get", map[string]string{"agg": "view"}, nil, "get"),
+		role("pods-delete", map[string]string{"agg": "edit"}, nil, "delete"),
+		role("loop", map[string]string{"agg": "loop"}, map[string]string{"agg": "loop"}, "list"),
+		role("plain", nil, nil, "watch"),
+	}
+	tests := []struct {
+		name string
+		ref  rbacv1.RoleRef
+		want []string
+	}{
+		{name: "not aggregated", ref: rbacv1.RoleRef{Kind: "ClusterRole", Name: "plain"}, want: []string{}},
+		{name: "missing", ref: rbacv1.RoleRef{Kind: "ClusterRole", Name: "gone"}, want: []string{}},
+		{name: "role", ref: rbacv1.RoleRef{Kind: "Role", Name: "view"}, want: []string{}},
+		{name: "aggregated", ref: rbacv1.RoleRef{Kind: "ClusterRole", Name: "edit"}, want: []string{"delete"}},
+		{name: "nested", ref: rbacv1.RoleRef{Kind: "ClusterRole", Name: "view"}, want: []string{"delete", "get"}},
+		{name: "selects itself", ref: rbacv1.RoleRef{Kind: "ClusterRole", Name: "loop"}, want: []string{}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := aggregatedRules(clusterRoles, tt.ref, map[string]bool{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, rule := range rules {
+				got = append(got, rule.Verbs...)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("aggregatedRules(%s) gave verbs %v, expected %v", tt.ref.Name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+/*
+everything the scanner writes goes through an outputFS, so that outputs can be kept in memory (for tests, or to
+post-process before anything touches the disk) or sent to another storage backend without the writers caring
+*/
+type outputFS interface {
+	MkdirAll(path string, perm os.FileMode) error
+	WriteFile(name string, data []byte, perm os.FileMode) error
+}
+
+// the local disk, optionally syncing every file before it is considered written
+type osFS struct {
+	fsync bool
+}
+
+func (osFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (o osFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil && o.fsync {
+		err = f.Sync()
+	}
+	// a failed close can mean the data never made it, so it is as much an error as a failed write
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// an in-memory filesystem: directories are implied by the files written into them
+type memFS struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func newMemFS() *memFS {
+	return &memFS{files: map[string][]byte{}}
+}
+
+func (m *memFS) MkdirAll(path string, perm os.FileMode) error {
+	return nil
+}
+
+func (m *memFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[filepath.ToSlash(filepath.Clean(name))] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *memFS) ReadFile(name string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.files[filepath.ToSlash(filepath.Clean(name))]
+	return b, ok
+}
+
+func (m *memFS) Paths() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	paths := []string{}
+	for p := range m.files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+var output outputFS = osFS{}
+
+type fileWriter struct {
+	fs      outputFS
+	rootDir string
+	buffer  bytes.Buffer
+}
+
+// implement Writer interface
+func (f *fileWriter) Write(p []byte) (n int, err error) {
+	return f.buffer.Write(p)
+}
+
+func (f *fileWriter) flush(namespace, name, resourceType string) error {
+	/*
+		write the byte stream to a file, in the following format:
+		rootDir / namespaces / namespaceName / resourceType / filename
+		rootDir / non_namespaced / resourceType / filename
+	*/
+	file := filepath.Join(f.rootDir, filepath.FromSlash(objectPath(namespace, name, resourceType)))
+
+	err := f.fs.MkdirAll(filepath.Dir(file), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	data := f.buffer.Bytes()
+	if isCompressed(resourceType) {
+		data, err = gzipBytes(data)
+		if err != nil {
+			return err
+		}
+	}
+	if err := countOutput(0, len(data)); err != nil {
+		return err
+	}
+	return f.fs.WriteFile(file, data, os.ModePerm)
+
+}
+
+// resource types whose files are written gzipped, "*" meaning all of them
+var compressedTypes = map[string]bool{}
+
+const compressedSuffix string = ".gz"
+
+func isCompressed(resourceType string) bool {
+	return compressedTypes["*"] || compressedTypes[resourceType]
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	zw := gzip.NewWriter(&buffer)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func gunzipBytes(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// characters which are not allowed in file names on at least one of the platforms we run on
+var pathUnsafeChars = strings.NewReplacer(
+	"/", "_", "\\", "_", ":", "_", "*", "_", "?", "_", "\"", "_", "<", "_", ">", "_", "|", "_",
+)
+
+// device names windows refuses to create files for, whatever the extension
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// most filesystems limit a single path component to 255 bytes, leave room for suffixes added by other writers
+const maxPathComponentLength int = 200
+
+func sanitizePathComponent(s string) string {
+	/*
+		names which are safe everywhere are used as they are; anything else is escaped, and gets a short hash of the
+		original name appended so that two different names can never end up in the same file
+	*/
+	safe := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == utf8.RuneError {
+			return '_'
+		}
+		return r
+	}, pathUnsafeChars.Replace(s))
+
+	// windows silently drops trailing dots and spaces, and leading dots hide files everywhere else
+	safe = strings.TrimRight(safe, ". ")
+	if strings.HasPrefix(safe, ".") {
+		safe = "_" + safe
+	}
+	if safe == "" {
+		safe = "_"
+	}
+	if windowsReservedNames[strings.ToUpper(strings.SplitN(safe, ".", 2)[0])] {
+		safe = "_" + safe
+	}
+	if safe == s && len(safe) <= maxPathComponentLength {
+		return safe
+	}
+
+	sum := sha256.Sum256([]byte(s))
+	suffix := "~" + hex.EncodeToString(sum[:4])
+	if len(safe) > maxPathComponentLength-len(suffix) {
+		safe = truncateUTF8(safe, maxPathComponentLength-len(suffix))
+	}
+	return safe + suffix
+}
+
+func truncateUTF8(s string, n int) string {
+	// cut to at most n bytes without splitting a multi-byte character
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func isSanitized(namespace, name, resourceType string) bool {
+	return (namespace != "" && sanitizePathComponent(namespace) != namespace) ||
+		sanitizePathComponent(name) != name ||
+		sanitizePathComponent(resourceType) != resourceType
+}
+
+// maps each escaped file back to the object it holds
+type pathManifestEntry struct {
+	Path      string `json:"path"`
+	Key       string `json:"key"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+const pathManifestFile string = "path-manifest.json"
+
+func writePathManifest(objects []exportedObject) error {
+	entries := []pathManifestEntry{}
+	for _, o := range objects {
+		if o.Sanitized {
+			entries = append(entries, pathManifestEntry{Path: o.Path, Key: objectKey(o.APIVersion, o.Kind, o.Namespace, o.Name), Kind: o.Kind, Namespace: o.Namespace, Name: o.Name})
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeRootFile(pathManifestFile, b)
+}
+
+func objectPath(namespace, name, resourceType string) string {
+	// the relative location of an object under rootDir, always slash separated so that it can be used in reports
+	name = sanitizePathComponent(name)
+	if isCompressed(resourceType) {
+		name += compressedSuffix
+	}
+	resourceType = sanitizePathComponent(resourceType)
+	if namespace != "" {
+		return path.Join("namespaces", sanitizePathComponent(namespace), resourceType, name)
+	}
+	return path.Join("non_namespaced", resourceType, name)
+}
+
+func writeRootFile(name string, data []byte) error {
+	// reports and other generated artefacts which are not cluster objects live directly under rootDir
+	if isIgnoredPath(name) {
+		skipIgnored(name)
+		return nil
+	}
+	file := filepath.Join(outputDirectory, filepath.FromSlash(name))
+	err := output.MkdirAll(filepath.Dir(file), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	if err := countOutput(0, len(data)); err != nil {
+		return err
+	}
+	err = output.WriteFile(file, data, os.ModePerm)
+	if err == nil {
+		recordEvent(scanEvent{Action: eventWrote, Path: name})
+	}
+	return err
+}
+
+func newFileWriter() *fileWriter {
+	return &fileWriter{
+		fs:      output,
+		rootDir: outputDirectory,
+		buffer:  bytes.Buffer{},
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// swaps the output for a memFS under rootDir for the length of the test
+func useMemFS(t *testing.T) *memFS {
+	m := newMemFS()
+	previous, previousDir := output, outputDirectory
+	output, outputDirectory = m, "out"
+	t.Cleanup(func() {
+		output, outputDirectory = previous, previousDir
+	})
+	return m
+}
+
+func TestDumpToFile(t *testing.T) {
+	tests := []struct {
+		name         string
+		object       runtime.Object
+		namespace    string
+		resourceType string
+		path         string
+		want         string
+	}{
+		{
+			name:         "namespaced",
+			object:       &corev1.ConfigMap{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"}, ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "web"}, Data: map[string]string{"a": "b"}},
+			namespace:    "web",
+			resourceType: "configmaps",
+			path:         "out/namespaces/web/configmaps/app",
+			want:         "apiVersion: v1\ndata:\n  a: b\nkind: ConfigMap\nmetadata:\n  creationTimestamp: null\n  name: app\n  namespace: web\n",
+		},
+		{
+			name:         "cluster scoped",
+			object:       &rbacv1.ClusterRole{TypeMeta: metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"}, ObjectMeta: metav1.ObjectMeta{Name: "app"}, Rules: []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}}},
+			resourceType: "clusterroles",
+			path:         "out/non_namespaced/clusterroles/app",
+			want:         "apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata:\n  creationTimestamp: null\n  name: app\nrules:\n- apiGroups:\n  - \"\"\n  resources:\n  - pods\n  verbs:\n  - get\n",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			m := useMemFS(t)
+			if err := dumpToFile(tt.object, tt.namespace, "app", tt.resourceType); err != nil {
+				t.Fatal(err)
+			}
+			if paths := m.Paths(); len(paths) != 1 || paths[0] != tt.path {
+				t.Fatalf("wrote %v, expected only %s", paths, tt.path)
+			}
+			got, _ := m.ReadFile(tt.path)
+			if string(got) != tt.want {
+				t.Errorf("wrote\n%s\nexpected\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteRootFile(t *testing.T) {
+	m := useMemFS(t)
+	if err := writeRootFile("reports/findings.json", []byte("[]\n")); err != nil {
+		t.Fatal(err)
+	}
+	if paths := m.Paths(); len(paths) != 1 || paths[0] != "out/reports/findings.json" {
+		t.Fatalf("wrote %v, expected only out/reports/findings.json", paths)
+	}
+	if got, _ := m.ReadFile("out/reports/findings.json"); string(got) != "[]\n" {
+		t.Errorf("wrote %q, expected %q", got, "[]\n")
+	}
+}
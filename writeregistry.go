@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/nicgrobler/k8s/result"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+/*
+	the same object can be reached more than once in a run - a clusterrole granted by several bindings, a group
+	exported by the subject inventory and the openshift-rbac preset - and by concurrent workers. every write is
+	claimed here first, by group, kind, namespace and name: the first one is written, later ones with the same
+	content are dropped, and later ones with different content are conflicts, which -write-conflicts decides on
+*/
+
+const (
+	conflictWarn string = "warn"
+	conflictFail string = "fail"
+)
+
+var (
+	writeConflicts = conflictWarn
+	writtenObjects = map[string][sha256.Size]byte{}
+	writtenMu      sync.Mutex
+)
+
+func resetWriteRegistry() {
+	writtenMu.Lock()
+	defer writtenMu.Unlock()
+	writtenObjects = map[string][sha256.Size]byte{}
+}
+
+func writeKey(gvk schema.GroupVersionKind, namespace, name string) string {
+	// the version is left out, the same object read at two versions is still one object
+	return gvk.Group + "/" + gvk.Kind + "/" + namespace + "/" + name
+}
+
+// claimWrite reports whether the object still has to be written, and fails on conflicting content when asked to
+func claimWrite(gvk schema.GroupVersionKind, namespace, name string, encoded []byte) (bool, error) {
+	key := writeKey(gvk, namespace, name)
+	sum := sha256.Sum256(encoded)
+
+	writtenMu.Lock()
+	previous, seen := writtenObjects[key]
+	if !seen {
+		writtenObjects[key] = sum
+	}
+	writtenMu.Unlock()
+
+	if !seen || previous == sum {
+		return !seen, nil
+	}
+	// objects changing between two reads in one run are the usual reason, the first read is what was written
+	target := name
+	if namespace != "" {
+		target = namespace + "/" + name
+	}
+	err := fmt.Errorf("%s %s was read twice with different content, keeping the first", gvk.Kind, target)
+	if writeConflicts == conflictFail {
+		return false, err
+	}
+	log.Print(err)
+	recordError(&result.ObjectRef{APIVersion: gvk.GroupVersion().String(), Kind: gvk.Kind, Namespace: namespace, Name: name}, err)
+	return false, nil
+}